@@ -0,0 +1,941 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JustZacca/jotaku/internal/config"
+	"github.com/JustZacca/jotaku/internal/crypto"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/i18n"
+	"golang.org/x/term"
+)
+
+// runCommand executes a non-interactive subcommand and returns the exit code.
+func runCommand(ctx context.Context, args []string) int {
+	var err error
+	switch args[0] {
+	case "gc":
+		err = runGC(ctx)
+	case "snapshot":
+		err = runSnapshot(ctx, args[1:])
+	case "links":
+		err = runLinks(ctx)
+	case "graph":
+		err = runGraph(ctx, args[1:])
+	case "attach":
+		err = runAttach(ctx, args[1:])
+	case "new":
+		err = runNew(ctx, args[1:])
+	case "agenda":
+		err = runAgenda(ctx, args[1:])
+	case "doctor":
+		err = runDoctor(ctx, args[1:])
+	case "backup":
+		err = runBackup(ctx, args[1:])
+	case "profile":
+		err = runProfile(args[1:])
+	case "help", "-h", "--help":
+		printUsage()
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		printUsage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", i18n.T().Error, err)
+		return 1
+	}
+	return 0
+}
+
+func printUsage() {
+	fmt.Println("Usage: jotaku [--profile <name>] [command]")
+	fmt.Println()
+	fmt.Println("Without a command Jotaku starts the interactive interface.")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  gc                                Compact version history and reclaim disk space")
+	fmt.Println("  snapshot [list]                   List vault snapshots")
+	fmt.Println("  snapshot create <name>            Take a snapshot of all notes and folders")
+	fmt.Println("  snapshot restore <id|time> [-y]   Restore the vault to a snapshot or a point in time")
+	fmt.Println("  snapshot delete <id>              Delete a snapshot")
+	fmt.Println("  links                             Report broken [[wiki links]]")
+	fmt.Println("  graph [--format dot|json]         Export the note graph (--note <id> --depth <n> for a neighbourhood)")
+	fmt.Println("  attach list <note>                List the attachments of a note (id or title)")
+	fmt.Println("  attach add <note> <file>...       Attach files to a note")
+	fmt.Println("  attach extract <id> [path]        Decrypt an attachment to a file")
+	fmt.Println("  attach delete <id>                Delete an attachment")
+	fmt.Println("  new [--template <name>] [title]   Create a note (--folder <path> --tag <t> --var <label>=<value>)")
+	fmt.Println("  agenda [--days <n>] [--all]       List overdue and upcoming reminders (--ics <file|-> to export)")
+	fmt.Println("  backup [list]                     List backups, newest first")
+	fmt.Println("  backup create                     Take an encrypted backup now")
+	fmt.Println("  backup restore <n|file> [-y]      Restore a backup over the vault (--to <path> for a new database)")
+	fmt.Println("  doctor [-y]                       Check the database and repair what is safe (--no-decrypt to skip the key)")
+	fmt.Println("  profile [list]                    List the profiles and their databases")
+	fmt.Println("  profile add <name>                Add a profile with its own database, asked for on next start")
+	fmt.Println("  help                              Show this help")
+}
+
+// loadConfig loads the configuration of the profile chosen with --profile.
+func loadConfig() (*config.Config, error) {
+	return config.LoadProfile(config.DefaultConfigPath(), profileName)
+}
+
+// openVault loads the configuration and opens the local database without
+// asking for the master password.
+func openVault() (*config.Config, *db.DB, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Language != "" {
+		i18n.SetLanguage(i18n.Language(cfg.Language))
+	}
+
+	database, err := db.New(cfg.DBPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, database, nil
+}
+
+// unlockVault opens the local database like openVault, then asks for the
+// master password and checks it against the stored notes.
+func unlockVault(ctx context.Context) (*config.Config, *db.DB, error) {
+	cfg, database, err := openVault()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	salt, err := cfg.GetSalt()
+	if err != nil || salt == nil {
+		database.Close()
+		return nil, nil, fmt.Errorf("vault not initialized, start jotaku once first")
+	}
+
+	password, err := promptPassword()
+	if err != nil {
+		database.Close()
+		return nil, nil, err
+	}
+
+	database.SetCipher(crypto.NewEncryptor(password, salt))
+	if err := database.VerifyCipher(ctx); err != nil {
+		database.Close()
+		return nil, nil, err
+	}
+	return cfg, database, nil
+}
+
+func runGC(ctx context.Context) error {
+	cfg, database, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	removed, err := database.CompactNoteVersions(ctx, db.RetentionPolicy(cfg.History))
+	if err != nil {
+		return err
+	}
+	blobs, err := database.PurgeOrphanBlobs(ctx)
+	if err != nil {
+		return err
+	}
+	if err := database.Vacuum(ctx); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+
+	fmt.Printf("Removed %d old versions and %d unused attachment blobs\n", removed, blobs)
+	return nil
+}
+
+func runSnapshot(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return listSnapshots(ctx)
+	}
+
+	switch args[0] {
+	case "create":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: jotaku snapshot create <name>")
+		}
+		_, database, err := unlockVault(ctx)
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		snap, err := database.CreateSnapshot(ctx, strings.Join(args[1:], " "), db.SnapshotManual)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Snapshot %d created (%d notes, %d folders)\n", snap.ID, snap.Notes, snap.Folders)
+		return nil
+
+	case "restore":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: jotaku snapshot restore <id|time> [-y]")
+		}
+		return restoreSnapshot(ctx, args[1], len(args) > 2 && (args[2] == "-y" || args[2] == "--yes"))
+
+	case "delete":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: jotaku snapshot delete <id>")
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid snapshot id %q", args[1])
+		}
+		_, database, err := openVault()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+		return database.DeleteSnapshot(ctx, id)
+	}
+
+	return fmt.Errorf("unknown snapshot command %q", args[0])
+}
+
+func listSnapshots(ctx context.Context) error {
+	_, database, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	snapshots, err := database.ListSnapshots(ctx)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		fmt.Println("No snapshots")
+		return nil
+	}
+	for _, s := range snapshots {
+		name := s.Name
+		if name == "" {
+			name = "(" + s.Reason + ")"
+		}
+		fmt.Printf("%4d  %s  %-30s %d notes, %d folders\n",
+			s.ID, s.CreatedAt.Local().Format("2006-01-02 15:04:05"), name, s.Notes, s.Folders)
+	}
+	return nil
+}
+
+// parseRestorePoint accepts a snapshot ID or a local date/time.
+func parseRestorePoint(arg string) (int64, time.Time, error) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return id, time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, arg, time.Local); err == nil {
+			return 0, t, nil
+		}
+	}
+	return 0, time.Time{}, fmt.Errorf("%q is neither a snapshot id nor a date (e.g. \"2024-05-01 18:30\")", arg)
+}
+
+func restoreSnapshot(ctx context.Context, arg string, yes bool) error {
+	snapID, at, err := parseRestorePoint(arg)
+	if err != nil {
+		return err
+	}
+
+	_, database, err := unlockVault(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	var plan *db.RestorePlan
+	if snapID != 0 {
+		plan, err = database.PlanSnapshotRestore(ctx, snapID)
+	} else {
+		plan, err = database.PlanRestoreAt(ctx, at)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(plan.Changes) == 0 {
+		fmt.Println("Nothing to restore: the vault already matches", plan.At.Local().Format("2006-01-02 15:04:05"))
+		return nil
+	}
+
+	fmt.Printf("Restoring to %s would change:\n", plan.At.Local().Format("2006-01-02 15:04:05"))
+	symbols := map[db.RestoreAction]string{db.RestoreCreate: "+", db.RestoreUpdate: "~", db.RestoreDelete: "-"}
+	for _, c := range plan.Changes {
+		fmt.Printf("  %s %-6s %s\n", symbols[c.Action], c.Type, c.Title)
+	}
+
+	if !yes {
+		fmt.Print("Apply? [y/N] ")
+		answer, _ := stdin.ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+
+	// Keep the state being replaced, so the restore itself can be undone
+	before, err := database.CreateSnapshot(ctx, "", db.SnapshotRestore)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot current state: %w", err)
+	}
+	if err := database.ApplyRestore(ctx, plan); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %d items (previous state saved as snapshot %d)\n", len(plan.Changes), before.ID)
+	return nil
+}
+
+func runLinks(ctx context.Context) error {
+	_, database, err := unlockVault(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.IndexLinks(ctx); err != nil {
+		return err
+	}
+	broken, err := database.BrokenLinks(ctx)
+	if err != nil {
+		return err
+	}
+	if len(broken) == 0 {
+		fmt.Println("No broken links")
+		return nil
+	}
+	for _, b := range broken {
+		fmt.Printf("%s: [[%s]]\n", b.SourceTitle, b.Target)
+	}
+	fmt.Printf("%d broken links\n", len(broken))
+	return nil
+}
+
+func runGraph(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("graph", flag.ContinueOnError)
+	format := fs.String("format", "dot", "output format: dot or json")
+	noteID := fs.Int64("note", 0, "only export the neighbourhood of this note")
+	depth := fs.Int("depth", 2, "neighbourhood depth, with --note")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "dot" && *format != "json" {
+		return fmt.Errorf("unknown format %q (use dot or json)", *format)
+	}
+
+	_, database, err := unlockVault(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	// Links are resolved from decrypted content, so make sure they are indexed
+	if err := database.IndexLinks(ctx); err != nil {
+		return err
+	}
+	graph, err := database.VaultGraph(ctx)
+	if err != nil {
+		return err
+	}
+	if *noteID != 0 {
+		if _, ok := graph.Node(db.NoteKey(*noteID)); !ok {
+			return fmt.Errorf("note %d not found", *noteID)
+		}
+		graph = graph.Neighborhood(db.NoteKey(*noteID), *depth)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(graph)
+	}
+	fmt.Print(graph.DOT())
+	return nil
+}
+
+// findNote resolves a note given by ID or title, like a [[link]].
+func findNote(ctx context.Context, database *db.DB, arg string) (int64, error) {
+	link := db.Link{Target: arg}
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		link.NoteID = id
+	}
+	id, err := database.ResolveLink(ctx, link)
+	if err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		return 0, fmt.Errorf("note %q not found", arg)
+	}
+	return id, nil
+}
+
+func runAttach(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: jotaku attach list|add|extract|delete ...")
+	}
+
+	cfg, database, err := unlockVault(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	switch args[0] {
+	case "list":
+		noteID, err := findNote(ctx, database, args[1])
+		if err != nil {
+			return err
+		}
+		attachments, err := database.ListAttachments(ctx, noteID)
+		if err != nil {
+			return err
+		}
+		if len(attachments) == 0 {
+			fmt.Println("No attachments")
+			return nil
+		}
+		for _, a := range attachments {
+			fmt.Printf("%4d  %s  %10d  %s\n", a.ID, a.CreatedAt.Local().Format("2006-01-02 15:04"), a.Size, a.Name)
+		}
+		return nil
+
+	case "add":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: jotaku attach add <note> <file>...")
+		}
+		noteID, err := findNote(ctx, database, args[1])
+		if err != nil {
+			return err
+		}
+		for _, path := range args[2:] {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			a, err := database.AddAttachment(ctx, noteID, path, data, cfg.MaxAttachmentSize)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			fmt.Printf("Attached %s as %d\n", a.Name, a.ID)
+		}
+		return nil
+
+	case "extract":
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid attachment id %q", args[1])
+		}
+		a, err := database.GetAttachment(ctx, id)
+		if err != nil {
+			return err
+		}
+		if a == nil || a.Deleted {
+			return fmt.Errorf("attachment %d not found", id)
+		}
+		path := a.Name
+		if len(args) > 2 {
+			path = args[2]
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				path = filepath.Join(path, a.Name)
+			}
+		}
+		data, err := database.ReadAttachment(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return err
+		}
+		fmt.Printf("Extracted %s (%d bytes)\n", path, len(data))
+		return nil
+
+	case "delete":
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid attachment id %q", args[1])
+		}
+		return database.DeleteAttachment(ctx, id)
+	}
+
+	return fmt.Errorf("unknown attach command %q", args[0])
+}
+
+// stringList collects a flag given more than once.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func runNew(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	templateName := fs.String("template", "", "create the note from this template")
+	folder := fs.String("folder", "", "folder path, e.g. Work/Meetings")
+	var tags, vars stringList
+	fs.Var(&tags, "tag", "add a tag (repeatable)")
+	fs.Var(&vars, "var", "answer a template prompt, as label=value (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	title := strings.Join(fs.Args(), " ")
+
+	cfg, database, err := unlockVault(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	folderID, err := database.FolderByPath(ctx, *folder, true)
+	if err != nil {
+		return err
+	}
+
+	tmpl := &db.Template{}
+	if *templateName != "" {
+		if tmpl, err = database.GetTemplate(ctx, cfg.TemplatesFolder, *templateName); err != nil {
+			return err
+		}
+	}
+	if *folder != "" {
+		// An explicit --folder wins over the template's folder
+		tmpl.Folder = ""
+	}
+	tmpl.Tags = append(tmpl.Tags, tags...)
+
+	templateVars := db.TemplateVars{Now: time.Now(), Prompts: make(map[string]string)}
+	if folderID != 0 {
+		if f, err := database.GetFolder(ctx, folderID); err == nil {
+			templateVars.Folder = f.Title
+		}
+	}
+	for _, v := range vars {
+		label, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return fmt.Errorf("invalid --var %q, expected label=value", v)
+		}
+		templateVars.Prompts[strings.TrimSpace(label)] = value
+	}
+
+	// Prompts not given with --var are asked on the terminal
+	for _, label := range tmpl.Prompts() {
+		if _, ok := templateVars.Prompts[label]; ok {
+			continue
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return fmt.Errorf("missing value for prompt %q, use --var %q", label, label+"=...")
+		}
+		fmt.Fprintf(os.Stderr, "%s: ", label)
+		value, err := stdin.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		templateVars.Prompts[label] = strings.TrimSpace(value)
+	}
+
+	note, err := database.CreateNoteFromTemplate(ctx, tmpl, title, folderID, templateVars)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created note %d: %s\n", note.ID, note.Title)
+	return nil
+}
+
+func runAgenda(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("agenda", flag.ContinueOnError)
+	days := fs.Int("days", 7, "show reminders due within this many days")
+	all := fs.Bool("all", false, "include done reminders")
+	ics := fs.String("ics", "", "export the reminders as iCalendar to this file (- for stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	_, database, err := unlockVault(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	reminders, err := database.ListReminders(ctx, 0, *all)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	if *ics != "" {
+		data := db.RemindersICS(reminders, now)
+		if *ics == "-" {
+			fmt.Print(data)
+			return nil
+		}
+		if err := os.WriteFile(*ics, []byte(data), 0600); err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d reminders to %s\n", len(reminders), *ics)
+		return nil
+	}
+
+	limit := now.AddDate(0, 0, *days)
+	shown := 0
+	for _, r := range reminders {
+		if r.Due.After(limit) {
+			break
+		}
+		mark := " "
+		switch {
+		case r.Done:
+			mark = "x"
+		case r.Due.Before(now):
+			mark = "!"
+		}
+		line := fmt.Sprintf("%s %s  %s", mark, r.Due.Format("2006-01-02 15:04"), r.Label())
+		if r.Item != "" {
+			line += " (" + r.NoteTitle + ")"
+		}
+		fmt.Println(line)
+		shown++
+	}
+	if shown == 0 {
+		fmt.Printf("No reminders in the next %d days\n", *days)
+	}
+	return nil
+}
+
+func runDoctor(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	yes := fs.Bool("y", false, "repair without asking")
+	noDecrypt := fs.Bool("no-decrypt", false, "skip the encryption checks, no password needed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var cfg *config.Config
+	var database *db.DB
+	var err error
+	if *noDecrypt {
+		cfg, database, err = openVault()
+	} else {
+		cfg, database, err = unlockVault(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	report, err := database.Diagnose(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Checked %d notes, %d folders, %d versions\n", report.Notes, report.Folders, report.Versions)
+	if !report.Decrypted {
+		fmt.Println("Encryption not checked (--no-decrypt)")
+	}
+	if len(report.Issues) == 0 {
+		fmt.Println("No problems found")
+		return nil
+	}
+	printIssues(report.Issues)
+
+	n := report.Repairable()
+	if n == 0 {
+		fmt.Println("Nothing can be repaired automatically")
+		return nil
+	}
+	if !*yes {
+		fmt.Printf("Repair %d issues? [y/N] ", n)
+		answer, _ := stdin.ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+
+	dir := db.BackupConfig(cfg.Backup).BackupDir(cfg.DBPath)
+	if report.Decrypted {
+		salt, err := cfg.GetSalt()
+		if err != nil {
+			return err
+		}
+		info, err := database.Backup(ctx, dir, cfg.BackupProfile(), db.BackupDoctor, salt)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Backup saved to", info.Path)
+	} else {
+		// Without the key the copy cannot be encrypted
+		backup := filepath.Join(dir, db.BackupName(time.Now(), cfg.BackupProfile(), db.BackupDoctor, ".db"))
+		if err := database.BackupTo(ctx, backup); err != nil {
+			return err
+		}
+		fmt.Println("Unencrypted backup saved to", backup)
+	}
+
+	fixed, err := database.Repair(ctx, report)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Repaired %d issues\n", fixed)
+
+	after, err := database.Diagnose(ctx)
+	if err != nil {
+		return err
+	}
+	if len(after.Issues) > 0 {
+		fmt.Println("Still to fix by hand:")
+		printIssues(after.Issues)
+	}
+	return nil
+}
+
+// printIssues prints a doctor report grouped by check, in the order the
+// checks ran.
+func printIssues(issues []db.Issue) {
+	check := ""
+	for _, issue := range issues {
+		if issue.Check != check {
+			check = issue.Check
+			fmt.Printf("\n[%s]\n", check)
+		}
+		fmt.Printf("  %s\n", issue.Message)
+		if issue.Repair != "" {
+			fmt.Printf("    repair: %s\n", issue.Repair)
+		}
+	}
+	fmt.Println()
+}
+
+func runBackup(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return listBackups()
+	}
+
+	switch args[0] {
+	case "create":
+		cfg, database, err := unlockVault(ctx)
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		salt, err := cfg.GetSalt()
+		if err != nil {
+			return err
+		}
+		info, err := database.Backup(ctx, db.BackupConfig(cfg.Backup).BackupDir(cfg.DBPath), cfg.BackupProfile(), db.BackupManual, salt)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backup saved to %s (%d bytes, verified)\n", info.Path, info.Size)
+		return nil
+
+	case "restore":
+		return restoreBackup(ctx, args[1:])
+	}
+
+	return fmt.Errorf("unknown backup command %q", args[0])
+}
+
+func listBackups() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	dir := db.BackupConfig(cfg.Backup).BackupDir(cfg.DBPath)
+	backups, err := db.ListBackups(dir, cfg.BackupProfile())
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Println("No backups in", dir)
+		return nil
+	}
+	for i, b := range backups {
+		lock := " "
+		if !b.Encrypted {
+			lock = "!"
+		}
+		fmt.Printf("%4d %s %s  %-7s %12d  %s\n",
+			i+1, lock, b.CreatedAt.Format("2006-01-02 15:04:05"), b.Reason, b.Size, filepath.Base(b.Path))
+	}
+	return nil
+}
+
+// restoreBackup replaces the vault, or writes a new database with --to, with
+// the content of a backup. The backup is given by its number in the list or
+// its path.
+func restoreBackup(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backup restore", flag.ContinueOnError)
+	to := fs.String("to", "", "write the restored database here instead of replacing the vault")
+	yes := fs.Bool("y", false, "replace the vault without asking")
+	// The backup may come before the flags, as in "restore 1 -y"
+	var path string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		path, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if path == "" && fs.NArg() == 1 {
+		path = fs.Arg(0)
+	} else if path == "" || fs.NArg() > 0 {
+		return fmt.Errorf("usage: jotaku backup restore <n|file> [--to <path>] [-y]")
+	}
+
+	configPath := config.DefaultConfigPath()
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Language != "" {
+		i18n.SetLanguage(i18n.Language(cfg.Language))
+	}
+
+	if n, err := strconv.Atoi(path); err == nil {
+		backups, err := db.ListBackups(db.BackupConfig(cfg.Backup).BackupDir(cfg.DBPath), cfg.BackupProfile())
+		if err != nil {
+			return err
+		}
+		if n < 1 || n > len(backups) {
+			return fmt.Errorf("no backup %d, see jotaku backup list", n)
+		}
+		path = backups[n-1].Path
+	}
+
+	salt, err := db.ReadBackupSalt(path)
+	if err != nil {
+		return err
+	}
+	var cipher db.Cipher
+	if salt != nil {
+		password, err := promptPassword()
+		if err != nil {
+			return err
+		}
+		cipher = crypto.NewEncryptor(password, salt)
+	}
+
+	target := cfg.DBPath
+	if *to != "" {
+		target = *to
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("%s already exists", target)
+		}
+	}
+
+	restoring := target + ".restoring"
+	os.Remove(restoring)
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+	if err := db.ExtractBackup(ctx, path, cipher, restoring); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		aside := fmt.Sprintf("%s.before-restore-%s", target, time.Now().Format("20060102-150405"))
+		if _, err := os.Stat(aside); err == nil {
+			os.Remove(restoring)
+			return fmt.Errorf("%s already exists, try again in a second", aside)
+		}
+		if !*yes {
+			fmt.Printf("Replace the vault at %s? The current database is kept as %s [y/N] ", target, aside)
+			answer, _ := stdin.ReadString('\n')
+			if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+				os.Remove(restoring)
+				fmt.Println("Aborted")
+				return nil
+			}
+		}
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			if _, err := os.Stat(target + suffix); err == nil {
+				if err := os.Rename(target+suffix, aside+suffix); err != nil {
+					os.Remove(restoring)
+					return err
+				}
+			}
+		}
+		fmt.Println("Previous database kept as", aside)
+	}
+	if err := os.Rename(restoring, target); err != nil {
+		return err
+	}
+
+	// A fresh vault, or one whose key the backup was not taken with
+	if salt != nil && *to == "" {
+		if current, _ := cfg.GetSalt(); string(current) != string(salt) {
+			cfg.SetSalt(salt)
+			if err := cfg.Save(configPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Println("Restored", filepath.Base(path), "to", target)
+	if salt != nil {
+		fmt.Println("Unlock it with the master password of the backup")
+	}
+	return nil
+}
+
+// runProfile lists the profiles or adds one. A new profile gets its own
+// database and salt the first time it is opened.
+func runProfile(args []string) error {
+	configPath := config.DefaultConfigPath()
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 || args[0] == "list" {
+		for _, name := range cfg.ProfileNames() {
+			p, err := config.LoadProfile(configPath, name)
+			if err != nil {
+				return err
+			}
+			server := "offline"
+			if p.Server.URL != "" {
+				server = p.Server.URL
+			}
+			fmt.Printf("%-16s %s  (%s)\n", name, p.DBPath, server)
+		}
+		return nil
+	}
+
+	if args[0] != "add" || len(args) != 2 {
+		return fmt.Errorf("usage: jotaku profile [list] | jotaku profile add <name>")
+	}
+	name := args[1]
+	if !config.ValidProfileName(name) {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	if _, ok := cfg.Profiles[name]; ok {
+		return fmt.Errorf("profile %q already exists", name)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]config.Profile)
+	}
+	cfg.Profiles[name] = config.Profile{DBPath: config.DefaultProfileDBPath(name)}
+	if err := cfg.Save(configPath); err != nil {
+		return err
+	}
+	fmt.Printf("Profile %s added, start it with jotaku --profile %s\n", name, name)
+	return nil
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -16,7 +18,27 @@ import (
 	"golang.org/x/term"
 )
 
+// profileName is the profile chosen with --profile, empty for the default.
+var profileName string
+
+// stdin is shared by the prompts, so one does not buffer away the answer to
+// the next when input is piped.
+var stdin = bufio.NewReader(os.Stdin)
+
 func main() {
+	ctx := context.Background()
+
+	args, err := parseProfileFlag(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Non-interactive subcommands (e.g. "jotaku gc")
+	if len(args) > 0 {
+		os.Exit(runCommand(ctx, args))
+	}
+
 	// Show logo on startup
 	printLogo()
 
@@ -30,42 +52,68 @@ func main() {
 		}
 	}
 
-	cfg, err := config.Load(configPath)
+	// Without --profile, ask which vault to open when there is more than one
+	profile := profileName
+	if profile == "" {
+		profile, err = pickProfile(configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Switching profile from the interface closes the vault and opens the
+	// next one, asking for its password
+	for profile != "" {
+		profile, err = runVault(ctx, configPath, profile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", i18n.T().Error, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// runVault unlocks the vault of profile and runs the interface on it. It
+// returns the profile the user switched to, or "" on quit.
+func runVault(ctx context.Context, configPath, profile string) (string, error) {
+	cfg, err := config.LoadProfile(configPath, profile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return "", err
 	}
 
-	// Apply language setting
-	if cfg.Language != "" {
-		i18n.SetLanguage(i18n.Language(cfg.Language))
+	// Apply language setting, on every switch: a profile without one must not
+	// keep the language of the previous vault
+	language := i18n.Language(cfg.Language)
+	if language == "" {
+		language = i18n.DefaultLanguage
 	}
+	i18n.SetLanguage(language)
+	ui.SetTheme(cfg.Theme)
 
 	// Prompt for master password
+	if len(cfg.Profiles) > 0 {
+		fmt.Printf("%s: %s\n", i18n.T().Profile, cfg.Profile())
+	}
 	password, err := promptPassword()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s: %v\n", i18n.T().Error, err)
-		os.Exit(1)
+		return "", err
 	}
 
 	// Setup encryption
 	var enc *crypto.Encryptor
 	salt, err := cfg.GetSalt()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s: %v\n", i18n.T().Error, err)
-		os.Exit(1)
+		return "", err
 	}
 
 	if salt == nil {
 		salt, err = crypto.GenerateSalt()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s: %v\n", i18n.T().Error, err)
-			os.Exit(1)
+			return "", err
 		}
 		cfg.SetSalt(salt)
 		if err := cfg.Save(configPath); err != nil {
-			fmt.Fprintf(os.Stderr, "%s: %v\n", i18n.T().Error, err)
-			os.Exit(1)
+			return "", err
 		}
 	}
 
@@ -82,18 +130,90 @@ func main() {
 	// Initialize database
 	database, err := db.New(cfg.DBPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s: %v\n", i18n.T().Error, err)
-		os.Exit(1)
+		return "", err
 	}
 	defer database.Close()
 
+	// Version history is encrypted with the same key as note content
+	database.SetCipher(enc)
+	if err := database.MigrateVersions(ctx); err != nil {
+		// Non-fatal: legacy history stays readable as full copies
+		fmt.Fprintf(os.Stderr, "%s: %v\n", i18n.T().Error, err)
+	}
+	if err := database.IndexLinks(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", i18n.T().Error, err)
+	}
+
 	// Start TUI
-	m := ui.NewModel(database, enc, cfg)
+	m := ui.NewModel(ctx, database, enc, cfg)
 	p := tea.NewProgram(m, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "%s: %v\n", i18n.T().Error, err)
-		os.Exit(1)
+	final, err := p.Run()
+	if err != nil {
+		return "", err
+	}
+	return final.(ui.Model).SwitchProfile(), nil
+}
+
+// parseProfileFlag takes --profile <name> (or --profile=<name>) out of args,
+// before or after the command, and returns the rest.
+func parseProfileFlag(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--profile" || args[i] == "-profile":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("--profile needs a name")
+			}
+			i++
+			profileName = args[i]
+		case strings.HasPrefix(args[i], "--profile="):
+			profileName = strings.TrimPrefix(args[i], "--profile=")
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return rest, nil
+}
+
+// pickProfile lists the profiles and reads the number of the one to open.
+// With a single profile there is nothing to choose.
+func pickProfile(configPath string) (string, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return "", err
 	}
+	if cfg.Language != "" {
+		i18n.SetLanguage(i18n.Language(cfg.Language))
+	}
+	names := cfg.ProfileNames()
+	if len(names) == 1 {
+		return config.DefaultProfile, nil
+	}
+
+	fmt.Println("  " + i18n.T().ChooseProfile)
+	for i, name := range names {
+		fmt.Printf("  [%d] %s\n", i+1, name)
+	}
+	fmt.Print("  > ")
+
+	choice, err := stdin.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	choice = strings.TrimSpace(choice)
+	if choice == "" {
+		return config.DefaultProfile, nil
+	}
+	if n, err := strconv.Atoi(choice); err == nil && n >= 1 && n <= len(names) {
+		return names[n-1], nil
+	}
+	// The name works too
+	for _, name := range names {
+		if name == choice {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown profile %q", choice)
 }
 
 func printLogo() {
@@ -111,15 +231,13 @@ func firstTimeSetup(configPath string) error {
 	fmt.Println("  Welcome to Jotaku! / Benvenuto in Jotaku!")
 	fmt.Println()
 
-	reader := bufio.NewReader(os.Stdin)
-
 	// Ask for language
 	fmt.Println("  Select language / Seleziona lingua:")
 	fmt.Println("  [1] English")
 	fmt.Println("  [2] Italiano")
 	fmt.Print("  > ")
 
-	choice, err := reader.ReadString('\n')
+	choice, err := stdin.ReadString('\n')
 	if err != nil {
 		return fmt.Errorf("failed to read input: %w", err)
 	}
@@ -138,6 +256,7 @@ func firstTimeSetup(configPath string) error {
 		DBPath:   config.DefaultDBPath(),
 		Language: language,
 		Theme:    "dark",
+		History:  config.DefaultHistoryConfig(),
 	}
 
 	// Save config
@@ -170,8 +289,7 @@ func promptPassword() (string, error) {
 		return strings.TrimSpace(string(password)), nil
 	}
 
-	reader := bufio.NewReader(os.Stdin)
-	password, err := reader.ReadString('\n')
+	password, err := stdin.ReadString('\n')
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", i18n.T().Error, err)
 	}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -14,10 +16,38 @@ import (
 )
 
 func main() {
+	ctx := context.Background()
+
 	// Configuration from environment
 	port := getEnv("PORT", "5689")
 	dbPath := getEnv("DB_PATH", "/data/notes.db")
 	jwtSecret := getEnv("JWT_SECRET", "")
+	retention := retentionFromEnv()
+
+	// "jotaku-server gc" compacts version history once and exits
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		database, err := openDatabase(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer database.Close()
+
+		removed, err := database.CompactVersions(ctx, retention)
+		if err != nil {
+			log.Fatalf("Compaction failed: %v", err)
+		}
+		log.Printf("Removed %d old versions", removed)
+
+		if err := setupBlobStore(database); err != nil {
+			log.Fatalf("Failed to initialize blob storage: %v", err)
+		}
+		blobs, err := database.GCBlobs(ctx, blobGrace)
+		if err != nil {
+			log.Fatalf("Blob cleanup failed: %v", err)
+		}
+		log.Printf("Removed %d unreferenced blobs", blobs)
+		return
+	}
 
 	if jwtSecret == "" {
 		log.Fatal("JWT_SECRET environment variable is required")
@@ -27,28 +57,135 @@ func main() {
 	jwtExpiration := 30 * 24 * time.Hour
 
 	// Initialize database
-	database, err := db.NewServerDB(dbPath)
+	database, err := openDatabase(dbPath)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer database.Close()
 
+	if err := setupBlobStore(database); err != nil {
+		log.Fatalf("Failed to initialize blob storage: %v", err)
+	}
+
+	// Compact version history in the background
+	go compactLoop(ctx, database, retention)
+
 	// Initialize JWT manager
 	jwtManager := auth.NewJWTManager(jwtSecret, jwtExpiration)
 
 	// Initialize server
 	srv := server.New(database, jwtManager)
+	if value := os.Getenv("BLOB_QUOTA_MB"); value != "" {
+		mb, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid BLOB_QUOTA_MB: %v", err)
+		}
+		srv.SetBlobQuota(mb << 20)
+	}
 
 	// Start server
 	addr := fmt.Sprintf(":%s", port)
 	log.Printf("Starting server on %s", addr)
-	log.Printf("Database: %s", dbPath)
+	if os.Getenv("DATABASE_URL") != "" {
+		log.Printf("Database: PostgreSQL")
+	} else {
+		log.Printf("Database: %s", dbPath)
+	}
 
 	if err := http.ListenAndServe(addr, srv); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
 
+func compactLoop(ctx context.Context, database *db.ServerDB, retention db.RetentionPolicy) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		removed, err := database.CompactVersions(ctx, retention)
+		if err != nil {
+			log.Printf("Version compaction failed: %v", err)
+		} else if removed > 0 {
+			log.Printf("Compacted %d old versions", removed)
+		}
+		if blobs, err := database.GCBlobs(ctx, blobGrace); err != nil {
+			log.Printf("Blob cleanup failed: %v", err)
+		} else if blobs > 0 {
+			log.Printf("Removed %d unreferenced blobs", blobs)
+		}
+		<-ticker.C
+	}
+}
+
+// openDatabase connects to PostgreSQL when DATABASE_URL is set, and opens
+// the SQLite file at dbPath otherwise.
+func openDatabase(dbPath string) (*db.ServerDB, error) {
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		return db.NewServerDB(dbPath)
+	}
+	database, err := db.NewPostgresServerDB(url)
+	if err != nil {
+		return nil, err
+	}
+	if value := os.Getenv("DB_MAX_CONNS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			database.Close()
+			return nil, fmt.Errorf("invalid DB_MAX_CONNS: %q", value)
+		}
+		database.SetMaxConns(n)
+	}
+	return database, nil
+}
+
+// blobGrace keeps new blobs from being collected before the client has
+// registered the attachment that uses them.
+const blobGrace = 24 * time.Hour
+
+// setupBlobStore keeps blob chunks as files under BLOB_DIR when it is set,
+// in the database otherwise.
+func setupBlobStore(database *db.ServerDB) error {
+	dir := os.Getenv("BLOB_DIR")
+	if dir == "" {
+		return nil
+	}
+	store, err := db.NewFSBlobStore(dir)
+	if err != nil {
+		return err
+	}
+	database.SetBlobStore(store)
+	return nil
+}
+
+// retentionFromEnv builds the version retention policy, starting from the
+// defaults and overriding any HISTORY_* variable that is set.
+func retentionFromEnv() db.RetentionPolicy {
+	policy := db.DefaultRetentionPolicy()
+	durations := map[string]*time.Duration{
+		"HISTORY_KEEP_ALL": &policy.KeepAll,
+		"HISTORY_HOURLY":   &policy.Hourly,
+		"HISTORY_DAILY":    &policy.Daily,
+		"HISTORY_WEEKLY":   &policy.Weekly,
+	}
+	for key, target := range durations {
+		if value := os.Getenv(key); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				log.Fatalf("Invalid %s: %v", key, err)
+			}
+			*target = d
+		}
+	}
+	if value := os.Getenv("HISTORY_MAX_VERSIONS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			log.Fatalf("Invalid HISTORY_MAX_VERSIONS: %v", err)
+		}
+		policy.MaxPerNote = n
+	}
+	return policy
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
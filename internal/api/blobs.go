@@ -0,0 +1,213 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Progress reports how many bytes of a transfer are done out of total.
+type Progress func(done, total int64)
+
+type BlobResponse struct {
+	Hash     string `json:"hash"`
+	Size     int64  `json:"size"`
+	Chunks   int    `json:"chunks"`
+	Received []int  `json:"received"`
+	Complete bool   `json:"complete"`
+}
+
+type BlobUsageResponse struct {
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
+}
+
+type StartBlobRequest struct {
+	Size   int64 `json:"size"`
+	Chunks int   `json:"chunks"`
+}
+
+type AttachmentResponse struct {
+	ID        string `json:"id"`
+	NoteID    string `json:"note_id"`
+	Name      string `json:"name"`
+	Hash      string `json:"hash"`
+	Size      int64  `json:"size"`
+	Deleted   bool   `json:"deleted"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+type AttachmentListResponse struct {
+	Attachments []AttachmentResponse `json:"attachments"`
+}
+
+type UpsertAttachmentRequest struct {
+	ID        string `json:"id"`
+	NoteID    string `json:"note_id"`
+	Name      string `json:"name"`
+	Hash      string `json:"hash"`
+	Size      int64  `json:"size"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func (c *Client) BlobUsage() (*BlobUsageResponse, error) {
+	var resp BlobUsageResponse
+	if err := c.get("/api/blobs", &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetBlob(hash string) (*BlobResponse, error) {
+	var resp BlobResponse
+	if err := c.get("/api/blobs/"+hash, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UploadBlob sends the chunks of a blob. If an earlier upload of the same
+// blob was interrupted, only the chunks the server is missing are sent.
+// progress may be nil.
+func (c *Client) UploadBlob(hash string, chunks [][]byte, progress Progress) error {
+	var total int64
+	for _, chunk := range chunks {
+		total += int64(len(chunk))
+	}
+
+	var blob BlobResponse
+	if err := c.post("/api/blobs/"+hash, StartBlobRequest{Size: total, Chunks: len(chunks)}, &blob); err != nil {
+		return err
+	}
+
+	received := make(map[int]bool, len(blob.Received))
+	var done int64
+	for _, seq := range blob.Received {
+		if seq >= 0 && seq < len(chunks) {
+			received[seq] = true
+			done += int64(len(chunks[seq]))
+		}
+	}
+	if progress != nil {
+		progress(done, total)
+	}
+
+	for seq, chunk := range chunks {
+		if blob.Complete {
+			break
+		}
+		if received[seq] {
+			continue
+		}
+		path := fmt.Sprintf("/api/blobs/%s/chunks/%d", hash, seq)
+		if err := c.putRaw(path, chunk, &blob); err != nil {
+			return err
+		}
+		done += int64(len(chunk))
+		if progress != nil {
+			progress(done, total)
+		}
+	}
+
+	if !blob.Complete {
+		return fmt.Errorf("blob %s incomplete after upload", hash)
+	}
+	return nil
+}
+
+// DownloadBlob fetches all chunks of a complete blob. progress may be nil.
+func (c *Client) DownloadBlob(hash string, progress Progress) ([][]byte, error) {
+	blob, err := c.GetBlob(hash)
+	if err != nil {
+		return nil, err
+	}
+	if !blob.Complete {
+		return nil, fmt.Errorf("blob %s is incomplete", hash)
+	}
+
+	chunks := make([][]byte, blob.Chunks)
+	var done int64
+	for seq := range chunks {
+		data, err := c.getRaw(fmt.Sprintf("/api/blobs/%s/chunks/%d", hash, seq))
+		if err != nil {
+			return nil, err
+		}
+		chunks[seq] = data
+		done += int64(len(data))
+		if progress != nil {
+			progress(done, blob.Size)
+		}
+	}
+	return chunks, nil
+}
+
+func (c *Client) UpsertAttachment(a UpsertAttachmentRequest) (*AttachmentResponse, error) {
+	var resp AttachmentResponse
+	if err := c.post("/api/attachments", a, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) DeleteAttachment(id string) error {
+	return c.delete("/api/attachments/" + id)
+}
+
+func (c *Client) SyncAttachments(since int64) ([]AttachmentResponse, error) {
+	url := "/api/attachments/sync"
+	if since > 0 {
+		url = fmt.Sprintf("/api/attachments/sync?since=%d", since)
+	}
+
+	var resp AttachmentListResponse
+	if err := c.get(url, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Attachments, nil
+}
+
+// Raw HTTP helpers for chunk data
+
+func (c *Client) putRaw(path string, data []byte, result interface{}) error {
+	req, err := http.NewRequest("PUT", c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	return c.doRequest(req, result)
+}
+
+func (c *Client) getRaw(path string) ([]byte, error) {
+	req, err := http.NewRequest("GET", c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		var errResp ErrorResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+			return nil, fmt.Errorf("%s", errResp.Error)
+		}
+		return nil, fmt.Errorf("request failed with status %d", resp.StatusCode)
+	}
+
+	return body, nil
+}
@@ -32,6 +32,8 @@ type NoteResponse struct {
 	Title     string `json:"title"`
 	Content   string `json:"content"`
 	Tags      string `json:"tags"`
+	Archived  bool   `json:"archived,omitempty"`
+	ReadOnly  bool   `json:"read_only,omitempty"`
 	CreatedAt int64  `json:"created_at"`
 	UpdatedAt int64  `json:"updated_at"`
 }
@@ -45,6 +47,8 @@ type UpsertNoteRequest struct {
 	Title     string `json:"title"`
 	Content   string `json:"content"`
 	Tags      string `json:"tags"`
+	Archived  bool   `json:"archived,omitempty"`
+	ReadOnly  bool   `json:"read_only,omitempty"`
 	CreatedAt int64  `json:"created_at"`
 	UpdatedAt int64  `json:"updated_at"`
 }
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/JustZacca/jotaku/internal/db"
@@ -14,11 +16,31 @@ type SyncResult struct {
 	Errors     []error
 }
 
-func Sync(database *db.DB, client *Client, lastSync int64) (*SyncResult, error) {
+// Remote is the server side of a sync. *Client satisfies it.
+type Remote interface {
+	UpsertNote(note UpsertNoteRequest) (*NoteResponse, error)
+	DeleteNote(id string) error
+	SyncNotes(since int64) ([]NoteResponse, error)
+}
+
+// AttachmentRemote is a Remote that also stores attachments.
+type AttachmentRemote interface {
+	Remote
+	UploadBlob(hash string, chunks [][]byte, progress Progress) error
+	DownloadBlob(hash string, progress Progress) ([][]byte, error)
+	UpsertAttachment(a UpsertAttachmentRequest) (*AttachmentResponse, error)
+	DeleteAttachment(id string) error
+	SyncAttachments(since int64) ([]AttachmentResponse, error)
+}
+
+// Sync uploads the pending notes, then downloads the ones changed on the
+// server since lastSync. Attachments are synced too when both sides store
+// them.
+func Sync(ctx context.Context, database db.NoteStore, client Remote, lastSync int64) (*SyncResult, error) {
 	result := &SyncResult{}
 
 	// 1. Upload pending local changes
-	pending, err := database.GetPendingNotes()
+	pending, err := database.GetPendingNotes(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -31,14 +53,13 @@ func Sync(database *db.DB, client *Client, lastSync int64) (*SyncResult, error)
 					result.Errors = append(result.Errors, err)
 					continue
 				}
-				// Permanently delete local
-				database.PermanentlyDeleteSynced(note.ID)
-				result.Deleted++
-			} else {
-				// Never synced, just delete locally
-				database.PermanentlyDeleteSynced(note.ID)
-				result.Deleted++
 			}
+			// Permanently delete local (never synced notes just go)
+			if err := database.PermanentlyDeleteSynced(ctx, note.ID); err != nil {
+				result.Errors = append(result.Errors, err)
+				continue
+			}
+			result.Deleted++
 			continue
 		}
 
@@ -49,6 +70,8 @@ func Sync(database *db.DB, client *Client, lastSync int64) (*SyncResult, error)
 			Title:     note.Title,
 			Content:   note.Content,
 			Tags:      string(tagsJSON),
+			Archived:  note.Archived,
+			ReadOnly:  note.ReadOnly,
 			CreatedAt: note.CreatedAt.Unix(),
 			UpdatedAt: note.UpdatedAt.Unix(),
 		}
@@ -59,8 +82,11 @@ func Sync(database *db.DB, client *Client, lastSync int64) (*SyncResult, error)
 			continue
 		}
 
-		// Mark as synced with server ID
-		database.SetNoteSynced(note.ID, resp.ID)
+		// Mark as synced with server ID, unless it was edited meanwhile
+		if err := database.SetNoteSynced(ctx, note.ID, resp.ID, note.UpdatedAt); err != nil {
+			result.Errors = append(result.Errors, err)
+			continue
+		}
 		result.Uploaded++
 	}
 
@@ -72,11 +98,13 @@ func Sync(database *db.DB, client *Client, lastSync int64) (*SyncResult, error)
 	}
 
 	for _, sn := range serverNotes {
-		err := database.UpsertFromServer(
+		err := database.UpsertFromServer(ctx,
 			sn.ID,
 			sn.Title,
 			sn.Content,
 			sn.Tags,
+			sn.Archived,
+			sn.ReadOnly,
 			time.Unix(sn.CreatedAt, 0),
 			time.Unix(sn.UpdatedAt, 0),
 		)
@@ -87,5 +115,118 @@ func Sync(database *db.DB, client *Client, lastSync int64) (*SyncResult, error)
 		result.Downloaded++
 	}
 
+	// Links to the downloaded notes are resolved once, not once per note
+	if links, ok := database.(db.LinkStore); ok && result.Downloaded > 0 {
+		if err := links.ResolveBrokenLinks(ctx); err != nil {
+			result.Errors = append(result.Errors, err)
+		}
+	}
+
+	// 3. Attachments, once their notes have server IDs
+	store, ok := database.(db.AttachmentStore)
+	remote, ok2 := client.(AttachmentRemote)
+	if ok && ok2 {
+		syncAttachments(ctx, database, store, remote, lastSync, result)
+	}
+
 	return result, nil
 }
+
+// syncAttachments uploads the blobs and records of pending attachments, then
+// downloads the ones added elsewhere. Blob chunks and names travel encrypted.
+func syncAttachments(ctx context.Context, notes db.NoteStore, database db.AttachmentStore, client AttachmentRemote, lastSync int64, result *SyncResult) {
+	pending, err := database.GetPendingAttachments(ctx)
+	if err != nil {
+		result.Errors = append(result.Errors, err)
+		return
+	}
+
+	for _, a := range pending {
+		if a.Deleted {
+			if a.ServerID != "" {
+				if err := client.DeleteAttachment(a.ServerID); err != nil {
+					result.Errors = append(result.Errors, err)
+					continue
+				}
+			}
+			database.PermanentlyDeleteAttachment(ctx, a.ID)
+			result.Deleted++
+			continue
+		}
+
+		note, err := notes.GetNote(ctx, a.NoteID)
+		if err != nil || note == nil || note.ServerID == "" {
+			// The note did not reach the server yet, retry next time
+			continue
+		}
+
+		chunks, err := database.BlobChunks(ctx, a.Hash)
+		if err != nil {
+			result.Errors = append(result.Errors, err)
+			continue
+		}
+		if err := client.UploadBlob(a.Hash, chunks, nil); err != nil {
+			result.Errors = append(result.Errors, err)
+			continue
+		}
+
+		resp, err := client.UpsertAttachment(UpsertAttachmentRequest{
+			ID:        a.ServerID,
+			NoteID:    note.ServerID,
+			Name:      a.Name,
+			Hash:      a.Hash,
+			Size:      a.Size,
+			CreatedAt: a.CreatedAt.Unix(),
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, err)
+			continue
+		}
+		database.SetAttachmentSynced(ctx, a.ID, resp.ID)
+		result.Uploaded++
+	}
+
+	serverAttachments, err := client.SyncAttachments(lastSync)
+	if err != nil {
+		result.Errors = append(result.Errors, err)
+		return
+	}
+
+	for _, sa := range serverAttachments {
+		var chunks [][]byte
+		if !sa.Deleted {
+			// The note failed to download in this sync: its attachment is
+			// fetched by the next one, which starts from the same point
+			note, err := notes.GetNoteByServerID(ctx, sa.NoteID)
+			if err == nil && note == nil {
+				err = fmt.Errorf("%w: attachment %s, note %s", db.ErrAttachmentNoteMissing, sa.ID, sa.NoteID)
+			}
+			if err != nil {
+				result.Errors = append(result.Errors, err)
+				continue
+			}
+
+			has, err := database.HasBlob(ctx, sa.Hash)
+			if err != nil {
+				result.Errors = append(result.Errors, err)
+				continue
+			}
+			if !has {
+				// Stored together with the attachment
+				chunks, err = client.DownloadBlob(sa.Hash, nil)
+				if err != nil {
+					result.Errors = append(result.Errors, err)
+					continue
+				}
+			}
+		}
+
+		err := database.UpsertAttachmentFromServer(ctx, sa.ID, sa.NoteID, sa.Name, sa.Hash, sa.Size,
+			time.Unix(sa.CreatedAt, 0), sa.Deleted, chunks)
+		if err != nil {
+			result.Errors = append(result.Errors, err)
+			continue
+		}
+		result.Downloaded++
+	}
+}
@@ -0,0 +1,422 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JustZacca/jotaku/internal/db"
+)
+
+// fakeRemote is an in-memory sync server.
+type fakeRemote struct {
+	notes   map[string]NoteResponse
+	lastID  int
+	deleted []string
+	fail    error
+
+	// onUpsert runs during an upload, before the server answers
+	onUpsert func(req UpsertNoteRequest)
+}
+
+func newFakeRemote() *fakeRemote {
+	return &fakeRemote{notes: make(map[string]NoteResponse)}
+}
+
+func (r *fakeRemote) UpsertNote(req UpsertNoteRequest) (*NoteResponse, error) {
+	if r.fail != nil {
+		return nil, r.fail
+	}
+	if r.onUpsert != nil {
+		r.onUpsert(req)
+	}
+	if req.ID == "" {
+		r.lastID++
+		req.ID = fmt.Sprintf("srv-%d", r.lastID)
+	}
+	note := NoteResponse(req)
+	r.notes[note.ID] = note
+	return &note, nil
+}
+
+func (r *fakeRemote) DeleteNote(id string) error {
+	if r.fail != nil {
+		return r.fail
+	}
+	delete(r.notes, id)
+	r.deleted = append(r.deleted, id)
+	return nil
+}
+
+func (r *fakeRemote) SyncNotes(since int64) ([]NoteResponse, error) {
+	var notes []NoteResponse
+	for _, n := range r.notes {
+		if n.UpdatedAt > since {
+			notes = append(notes, n)
+		}
+	}
+	return notes, nil
+}
+
+func mustSync(ctx context.Context, t *testing.T, store db.NoteStore, remote Remote) *SyncResult {
+	t.Helper()
+	result, err := Sync(ctx, store, remote, 0)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("sync errors: %v", result.Errors)
+	}
+	return result
+}
+
+func TestSyncUploadsPendingNotes(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	remote := newFakeRemote()
+
+	note, _ := store.CreateNoteInFolder(ctx, "Spesa", "latte", []string{"casa"}, 0)
+
+	result := mustSync(ctx, t, store, remote)
+	if result.Uploaded != 1 {
+		t.Fatalf("uploaded %d notes, want 1", result.Uploaded)
+	}
+
+	got, _ := store.GetNote(ctx, note.ID)
+	if got.SyncStatus != db.SyncStatusSynced || got.ServerID == "" {
+		t.Fatalf("note not marked synced: status %q, server id %q", got.SyncStatus, got.ServerID)
+	}
+	if remote.notes[got.ServerID].Content != "latte" {
+		t.Fatalf("server content %q, want %q", remote.notes[got.ServerID].Content, "latte")
+	}
+
+	if result := mustSync(ctx, t, store, remote); result.Uploaded != 0 {
+		t.Fatalf("second sync uploaded %d notes, want 0", result.Uploaded)
+	}
+}
+
+func TestSyncDownloadsToOtherDevice(t *testing.T) {
+	ctx := context.Background()
+	remote := newFakeRemote()
+	laptop := db.NewMemoryStore()
+	phone := db.NewMemoryStore()
+
+	laptop.CreateNoteInFolder(ctx, "Idee", "un'app per le note", []string{"lavoro"}, 0)
+	mustSync(ctx, t, laptop, remote)
+
+	if result := mustSync(ctx, t, phone, remote); result.Downloaded != 1 {
+		t.Fatalf("downloaded %d notes, want 1", result.Downloaded)
+	}
+
+	notes, _ := phone.ListNotes(ctx)
+	if len(notes) != 1 || notes[0].Title != "Idee" {
+		t.Fatalf("phone notes = %+v, want the note from the laptop", notes)
+	}
+	note, _ := phone.GetNote(ctx, notes[0].ID)
+	if note.Content != "un'app per le note" || len(note.Tags) != 1 || note.Tags[0] != "lavoro" {
+		t.Fatalf("downloaded note = %+v", note)
+	}
+}
+
+func TestSyncKeepsNewestVersion(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	remote := newFakeRemote()
+
+	note, _ := store.CreateNoteInFolder(ctx, "Diario", "lunedì", nil, 0)
+	mustSync(ctx, t, store, remote)
+	synced, _ := store.GetNote(ctx, note.ID)
+
+	// An older edit on the server does not overwrite the local copy
+	old := remote.notes[synced.ServerID]
+	old.Content = "vecchio"
+	old.UpdatedAt = synced.UpdatedAt.Add(-time.Hour).Unix()
+	remote.notes[old.ID] = old
+	mustSync(ctx, t, store, remote)
+	if got, _ := store.GetNote(ctx, note.ID); got.Content != "lunedì" {
+		t.Fatalf("older server edit applied: content %q", got.Content)
+	}
+
+	// A newer one does
+	newer := remote.notes[synced.ServerID]
+	newer.Content = "martedì"
+	newer.UpdatedAt = synced.UpdatedAt.Add(time.Minute).Unix()
+	remote.notes[newer.ID] = newer
+	mustSync(ctx, t, store, remote)
+	if got, _ := store.GetNote(ctx, note.ID); got.Content != "martedì" {
+		t.Fatalf("newer server edit not applied: content %q", got.Content)
+	}
+}
+
+func TestSyncDeletesNotes(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	remote := newFakeRemote()
+
+	synced, _ := store.CreateNoteInFolder(ctx, "Sincronizzata", "", nil, 0)
+	mustSync(ctx, t, store, remote)
+	uploaded, _ := store.GetNote(ctx, synced.ID)
+	serverID := uploaded.ServerID
+
+	local, _ := store.CreateNoteInFolder(ctx, "Solo locale", "", nil, 0)
+	store.DeleteNote(ctx, synced.ID)
+	store.DeleteNote(ctx, local.ID)
+
+	result := mustSync(ctx, t, store, remote)
+	if result.Deleted != 2 {
+		t.Fatalf("deleted %d notes, want 2", result.Deleted)
+	}
+	if len(remote.deleted) != 1 || remote.deleted[0] != serverID {
+		t.Fatalf("server deletes = %v, want only %s", remote.deleted, serverID)
+	}
+	for _, id := range []int64{synced.ID, local.ID} {
+		if note, _ := store.GetNote(ctx, id); note != nil {
+			t.Fatalf("note %d still stored after sync", id)
+		}
+	}
+}
+
+func TestSyncKeepsPendingOnError(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	remote := newFakeRemote()
+	remote.fail = errors.New("server down")
+
+	note, _ := store.CreateNoteInFolder(ctx, "Bozza", "", nil, 0)
+
+	result, err := Sync(ctx, store, remote, 0)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if len(result.Errors) != 1 || result.Uploaded != 0 {
+		t.Fatalf("result = %+v, want one error and no uploads", result)
+	}
+	if got, _ := store.GetNote(ctx, note.ID); got.SyncStatus != db.SyncStatusPending {
+		t.Fatalf("note status %q after a failed upload, want pending", got.SyncStatus)
+	}
+}
+
+// TestSyncWhileSaving runs the editor's autosave and a sync at the same time
+// on a SQLite vault, as the client does. Run it with -race.
+func TestSyncWhileSaving(t *testing.T) {
+	ctx := context.Background()
+	vault, err := db.New(filepath.Join(t.TempDir(), "jotaku.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vault.Close()
+
+	remote := newFakeRemote()
+	for i := 0; i < 20; i++ {
+		remote.UpsertNote(UpsertNoteRequest{
+			Title:     fmt.Sprintf("Dal telefono %d", i),
+			Content:   "scritta altrove",
+			Tags:      "[]",
+			CreatedAt: time.Now().Unix(),
+			UpdatedAt: time.Now().Unix(),
+		})
+	}
+	note, err := vault.CreateNoteInFolder(ctx, "Diario", "", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const editors, saves = 2, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, editors*saves+1)
+	for e := 0; e < editors; e++ {
+		wg.Add(1)
+		go func(e int) {
+			defer wg.Done()
+			for i := 0; i < saves; i++ {
+				content := fmt.Sprintf("bozza %d.%d", e, i)
+				if err := vault.UpdateNote(ctx, note.ID, "Diario", content, nil); err != nil {
+					errs <- fmt.Errorf("update: %w", err)
+					return
+				}
+				if err := vault.SaveNoteVersion(ctx, note.ID, "Diario", content, nil); err != nil {
+					errs <- fmt.Errorf("save version: %w", err)
+					return
+				}
+			}
+		}(e)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			result, err := Sync(ctx, vault, remote, 0)
+			if err != nil {
+				errs <- fmt.Errorf("sync: %w", err)
+				return
+			}
+			for _, err := range result.Errors {
+				errs <- fmt.Errorf("sync: %w", err)
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Every save got its own version number
+	versions, err := vault.GetNoteVersions(ctx, note.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != editors*saves {
+		t.Fatalf("%d versions, want %d", len(versions), editors*saves)
+	}
+	for i, v := range versions {
+		if want := len(versions) - i; v.VersionNum != want {
+			t.Fatalf("version %d numbered %d, want %d", i, v.VersionNum, want)
+		}
+	}
+
+	// A save made while the note is being uploaded is not lost: the next
+	// sync sends it
+	remote.onUpsert = func(req UpsertNoteRequest) {
+		remote.onUpsert = nil
+		if err := vault.UpdateNote(ctx, note.ID, "Diario", "salvata durante l'invio", nil); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := vault.UpdateNote(ctx, note.ID, "Diario", "ultima bozza", nil); err != nil {
+		t.Fatal(err)
+	}
+	mustSync(ctx, t, vault, remote)
+	mustSync(ctx, t, vault, remote)
+	local, err := vault.GetNote(ctx, note.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local.SyncStatus != db.SyncStatusSynced {
+		t.Fatalf("note status %q after the last sync, want synced", local.SyncStatus)
+	}
+	if got := remote.notes[local.ServerID].Content; got != local.Content || got != "salvata durante l'invio" {
+		t.Fatalf("server content %q, local content %q", got, local.Content)
+	}
+
+	notes, err := vault.ListNotes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 21 {
+		t.Fatalf("%d notes after sync, want 21", len(notes))
+	}
+}
+
+// fakeAttachmentRemote is a fakeRemote that also stores attachments.
+type fakeAttachmentRemote struct {
+	*fakeRemote
+	blobs       map[string][][]byte
+	attachments map[string]AttachmentResponse
+	downloads   int
+}
+
+func newFakeAttachmentRemote() *fakeAttachmentRemote {
+	return &fakeAttachmentRemote{
+		fakeRemote:  newFakeRemote(),
+		blobs:       make(map[string][][]byte),
+		attachments: make(map[string]AttachmentResponse),
+	}
+}
+
+func (r *fakeAttachmentRemote) UploadBlob(hash string, chunks [][]byte, progress Progress) error {
+	r.blobs[hash] = chunks
+	return nil
+}
+
+func (r *fakeAttachmentRemote) DownloadBlob(hash string, progress Progress) ([][]byte, error) {
+	r.downloads++
+	chunks, ok := r.blobs[hash]
+	if !ok {
+		return nil, fmt.Errorf("blob %s not found", hash)
+	}
+	return chunks, nil
+}
+
+func (r *fakeAttachmentRemote) UpsertAttachment(a UpsertAttachmentRequest) (*AttachmentResponse, error) {
+	if a.ID == "" {
+		r.lastID++
+		a.ID = fmt.Sprintf("att-%d", r.lastID)
+	}
+	resp := AttachmentResponse{ID: a.ID, NoteID: a.NoteID, Name: a.Name, Hash: a.Hash, Size: a.Size,
+		CreatedAt: a.CreatedAt, UpdatedAt: time.Now().Unix()}
+	r.attachments[a.ID] = resp
+	return &resp, nil
+}
+
+func (r *fakeAttachmentRemote) DeleteAttachment(id string) error {
+	a := r.attachments[id]
+	a.Deleted = true
+	r.attachments[id] = a
+	return nil
+}
+
+func (r *fakeAttachmentRemote) SyncAttachments(since int64) ([]AttachmentResponse, error) {
+	var attachments []AttachmentResponse
+	for _, a := range r.attachments {
+		attachments = append(attachments, a)
+	}
+	return attachments, nil
+}
+
+func TestSyncRetriesAttachmentOfMissingNote(t *testing.T) {
+	ctx := context.Background()
+	newVault := func() *db.DB {
+		vault, err := db.New(filepath.Join(t.TempDir(), "jotaku.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { vault.Close() })
+		return vault
+	}
+	remote := newFakeAttachmentRemote()
+
+	laptop := newVault()
+	note, _ := laptop.CreateNoteInFolder(ctx, "Contratto", "", nil, 0)
+	laptop.AddAttachment(ctx, note.ID, "contratto.pdf", []byte("%PDF"), 0)
+	mustSync(ctx, t, laptop, remote)
+	if len(remote.attachments) != 1 {
+		t.Fatalf("%d attachments on the server, want 1", len(remote.attachments))
+	}
+	var uploaded AttachmentResponse
+	for _, a := range remote.attachments {
+		uploaded = a
+	}
+
+	// The phone gets the attachment but not its note, as when the note
+	// failed to download
+	phone := newVault()
+	result, err := Sync(ctx, phone, remote, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 1 || !errors.Is(result.Errors[0], db.ErrAttachmentNoteMissing) || result.Downloaded != 0 {
+		t.Fatalf("result = %+v, want one missing note error and nothing downloaded", result)
+	}
+	if remote.downloads != 0 {
+		t.Fatalf("%d blobs downloaded for an attachment without its note", remote.downloads)
+	}
+
+	// The next sync starts from the same point and gets both
+	mustSync(ctx, t, phone, remote)
+	local, _ := phone.GetNoteByServerID(ctx, uploaded.NoteID)
+	if local == nil {
+		t.Fatal("note not downloaded")
+	}
+	attachments, _ := phone.ListAttachments(ctx, local.ID)
+	if len(attachments) != 1 {
+		t.Fatalf("%d attachments on the phone, want 1", len(attachments))
+	}
+	if data, err := phone.ReadAttachment(ctx, attachments[0].ID); err != nil || string(data) != "%PDF" {
+		t.Fatalf("attachment data %q, %v", data, err)
+	}
+}
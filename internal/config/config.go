@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -18,6 +20,55 @@ type ServerConfig struct {
 	LastSync int64  `yaml:"last_sync"`
 }
 
+// The settings below mirror the structs of the db package field by field, so
+// callers convert them with db.RetentionPolicy(cfg.History) and the like
+// without config depending on db.
+
+// HistoryConfig is the retention policy of note versions.
+type HistoryConfig struct {
+	KeepAll    time.Duration `yaml:"keep_all"`
+	Hourly     time.Duration `yaml:"hourly"`
+	Daily      time.Duration `yaml:"daily"`
+	Weekly     time.Duration `yaml:"weekly"`
+	MaxPerNote int           `yaml:"max_per_note"`
+}
+
+func DefaultHistoryConfig() HistoryConfig {
+	return HistoryConfig{
+		KeepAll:    24 * time.Hour,
+		Hourly:     7 * 24 * time.Hour,
+		Daily:      30 * 24 * time.Hour,
+		MaxPerNote: 500,
+	}
+}
+
+// DailyConfig says where daily notes live and how they are created.
+type DailyConfig struct {
+	Folder   string `yaml:"folder"`
+	Format   string `yaml:"format"`   // Formato Go del titolo, es. 2006-01-02
+	Template string `yaml:"template"` // Nome del template, vuoto = nota vuota
+}
+
+func DefaultDailyConfig() DailyConfig {
+	return DailyConfig{Folder: "Journal", Format: "2006-01-02"}
+}
+
+// BackupConfig says where automatic backups go and how many are kept.
+type BackupConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Dir      string        `yaml:"dir"` // Vuoto = cartella backups accanto al database
+	Interval time.Duration `yaml:"interval"`
+	Daily    int           `yaml:"daily"`
+	Weekly   int           `yaml:"weekly"`
+}
+
+func DefaultBackupConfig() BackupConfig {
+	return BackupConfig{Enabled: true, Interval: 6 * time.Hour, Daily: 7, Weekly: 4}
+}
+
+// DefaultTemplatesFolder is the folder templates are read from by default.
+const DefaultTemplatesFolder = "Templates"
+
 type Config struct {
 	DBPath           string        `yaml:"db_path"`
 	EditorMode       string        `yaml:"editor_mode"`
@@ -25,7 +76,39 @@ type Config struct {
 	AutoSaveInterval time.Duration `yaml:"auto_save_interval"`
 	Salt             string        `yaml:"salt"`
 	Language         string        `yaml:"language"`
+	TreeView         bool          `yaml:"tree_view"`
+	History          HistoryConfig `yaml:"history"`
+	Daily            DailyConfig   `yaml:"daily"`
+	Backup           BackupConfig  `yaml:"backup"`
 	Server           ServerConfig  `yaml:"server"`
+
+	// MaxAttachmentSize limits a single attachment, in bytes (0 = default)
+	MaxAttachmentSize int64 `yaml:"max_attachment_size"`
+
+	// TemplatesFolder is the folder whose notes are note templates
+	TemplatesFolder string `yaml:"templates_folder"`
+
+	// Profiles are further vaults, by name. The settings above are the
+	// default profile; a loaded profile replaces the ones it has.
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+
+	profile string  // Profilo caricato, vuoto = default
+	base    Profile // Impostazioni del profilo default mentre ne è caricato un altro
+}
+
+// DefaultProfile is the name of the vault described by the top level of the
+// configuration.
+const DefaultProfile = "default"
+
+// Profile holds the settings of a vault: its database, key salt, language,
+// theme and server. Language and theme default to the ones of the default
+// profile.
+type Profile struct {
+	DBPath   string       `yaml:"db_path"`
+	Salt     string       `yaml:"salt"`
+	Language string       `yaml:"language,omitempty"`
+	Theme    string       `yaml:"theme,omitempty"`
+	Server   ServerConfig `yaml:"server"`
 }
 
 func DefaultConfigPath() string {
@@ -44,6 +127,20 @@ func DefaultDBPath() string {
 	return filepath.Join(filepath.Dir(exe), "jotaku.db")
 }
 
+// DefaultProfileDBPath returns where the database of profile name goes
+// when its db_path is not set: a folder of its own, so backups stay apart.
+func DefaultProfileDBPath(name string) string {
+	return filepath.Join(filepath.Dir(DefaultDBPath()), "profiles", name, "jotaku.db")
+}
+
+// ValidProfileName reports whether name can be used for a new profile.
+func ValidProfileName(name string) bool {
+	if name == "" || name == DefaultProfile || strings.HasPrefix(name, "-") {
+		return false
+	}
+	return !strings.ContainsAny(name, `/\:. `)
+}
+
 func ConfigExists(path string) bool {
 	_, err := os.Stat(path)
 	return !os.IsNotExist(err)
@@ -55,6 +152,10 @@ func Load(path string) (*Config, error) {
 		EditorMode:       "normal",
 		Theme:            "dark",
 		AutoSaveInterval: 3 * time.Second,
+		History:          DefaultHistoryConfig(),
+		TemplatesFolder:  DefaultTemplatesFolder,
+		Daily:            DefaultDailyConfig(),
+		Backup:           DefaultBackupConfig(),
 	}
 
 	data, err := os.ReadFile(path)
@@ -73,21 +174,134 @@ func Load(path string) (*Config, error) {
 		cfg.DBPath = DefaultDBPath()
 	}
 
-	if cfg.DBPath[0] == '~' {
-		home, _ := os.UserHomeDir()
-		cfg.DBPath = filepath.Join(home, cfg.DBPath[1:])
+	if cfg.TemplatesFolder == "" {
+		cfg.TemplatesFolder = DefaultTemplatesFolder
+	}
+
+	if cfg.History == (HistoryConfig{}) {
+		cfg.History = DefaultHistoryConfig()
 	}
 
+	cfg.DBPath = expandHome(cfg.DBPath)
+
 	return cfg, nil
 }
 
+// LoadProfile loads the configuration at path with the settings of profile
+// name in place of the default ones. An empty name loads the default profile.
+func LoadProfile(path, name string) (*Config, error) {
+	cfg, err := Load(path)
+	if err != nil || name == "" || name == DefaultProfile {
+		return cfg, err
+	}
+
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	if p.DBPath == "" {
+		p.DBPath = DefaultProfileDBPath(name)
+	}
+	p.DBPath = expandHome(p.DBPath)
+
+	cfg.base = cfg.profileSettings()
+	cfg.profile = name
+	cfg.DBPath = p.DBPath
+	cfg.Salt = p.Salt
+	cfg.Server = p.Server
+	if p.Language != "" {
+		cfg.Language = p.Language
+	}
+	if p.Theme != "" {
+		cfg.Theme = p.Theme
+	}
+	return cfg, nil
+}
+
+// Profile returns the name of the loaded profile.
+func (c *Config) Profile() string {
+	if c.profile == "" {
+		return DefaultProfile
+	}
+	return c.profile
+}
+
+// BackupProfile returns the profile name backups of this vault are tagged
+// with: empty for the default profile, whose backups keep their old names.
+func (c *Config) BackupProfile() string {
+	return c.profile
+}
+
+// ProfileNames returns the default profile followed by the others, sorted.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{DefaultProfile}, names...)
+}
+
+func (c *Config) profileSettings() Profile {
+	return Profile{
+		DBPath:   c.DBPath,
+		Salt:     c.Salt,
+		Language: c.Language,
+		Theme:    c.Theme,
+		Server:   c.Server,
+	}
+}
+
+func expandHome(path string) string {
+	if path != "" && path[0] == '~' {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, path[1:])
+	}
+	return path
+}
+
+// Save writes the configuration to path. Only the loaded profile is written:
+// the other profiles are kept as they are in the file, since another Jotaku
+// may have changed them (a new salt, a token) since this one started.
+// Profiles added to c are written too.
 func (c *Config) Save(path string) error {
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0700); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	data, err := yaml.Marshal(c)
+	out := *c
+	out.Profiles = make(map[string]Profile)
+	for name, p := range c.Profiles {
+		out.Profiles[name] = p
+	}
+	base := c.base
+	if ConfigExists(path) {
+		if current, err := Load(path); err == nil {
+			for name, p := range current.Profiles {
+				out.Profiles[name] = p
+			}
+			base = current.profileSettings()
+		}
+	}
+	if c.profile != "" {
+		p := c.profileSettings()
+		// Inherited settings stay inherited
+		if p.Language == c.base.Language {
+			p.Language = out.Profiles[c.profile].Language
+		}
+		if p.Theme == c.base.Theme {
+			p.Theme = out.Profiles[c.profile].Theme
+		}
+		out.Profiles[c.profile] = p
+		out.DBPath = base.DBPath
+		out.Salt = base.Salt
+		out.Language = base.Language
+		out.Theme = base.Theme
+		out.Server = base.Server
+	}
+
+	data, err := yaml.Marshal(&out)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JustZacca/jotaku/internal/db"
+)
+
+const profilesConfig = `db_path: /vaults/personal.db
+salt: cGVyc29uYWw=
+language: it
+theme: dark
+server:
+  url: https://casa.example
+profiles:
+  lavoro:
+    db_path: /vaults/work.db
+    salt: bGF2b3Jv
+    language: en
+    theme: light
+    server:
+      url: https://work.example
+  vuoto: {}
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadProfile(t *testing.T) {
+	path := writeConfig(t, profilesConfig)
+
+	cfg, err := LoadProfile(path, "lavoro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Profile() != "lavoro" || cfg.DBPath != "/vaults/work.db" || cfg.Salt != "bGF2b3Jv" ||
+		cfg.Language != "en" || cfg.Server.URL != "https://work.example" {
+		t.Fatalf("profile lavoro loaded as %+v", cfg)
+	}
+	if cfg.Theme != "light" {
+		t.Fatalf("theme %q, want the one of the profile", cfg.Theme)
+	}
+
+	empty, err := LoadProfile(path, "vuoto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.DBPath != DefaultProfileDBPath("vuoto") || empty.Salt != "" || empty.Server.URL != "" {
+		t.Fatalf("empty profile loaded as %+v", empty)
+	}
+	// Language and theme are inherited from the default profile
+	if empty.Language != "it" || empty.Theme != "dark" {
+		t.Fatalf("empty profile has language %q and theme %q", empty.Language, empty.Theme)
+	}
+
+	def, err := LoadProfile(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.Profile() != DefaultProfile || def.DBPath != "/vaults/personal.db" {
+		t.Fatalf("default profile loaded as %+v", def)
+	}
+	if names := def.ProfileNames(); len(names) != 3 || names[0] != DefaultProfile || names[1] != "lavoro" {
+		t.Fatalf("profile names %q", names)
+	}
+
+	if _, err := LoadProfile(path, "nessuno"); err == nil {
+		t.Fatal("unknown profile loaded")
+	}
+}
+
+func TestSaveProfileKeepsOthers(t *testing.T) {
+	path := writeConfig(t, profilesConfig)
+
+	work, err := LoadProfile(path, "lavoro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := LoadProfile(path, "vuoto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two instances save their own profile
+	empty.SetSalt([]byte("nuovo"))
+	if err := empty.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	work.Server.Token = "segreto"
+	if err := work.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	def, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.DBPath != "/vaults/personal.db" || def.Salt != "cGVyc29uYWw=" || def.Server.URL != "https://casa.example" {
+		t.Fatalf("default profile changed: %+v", def)
+	}
+	if p := def.Profiles["lavoro"]; p.Server.Token != "segreto" || p.Language != "en" || p.Theme != "light" {
+		t.Fatalf("profile lavoro saved as %+v", p)
+	}
+	// vuoto still inherits the language and theme of the default profile
+	if def.Theme != "dark" {
+		t.Fatalf("theme of the default profile changed to %q", def.Theme)
+	}
+	vuoto := def.Profiles["vuoto"]
+	if salt, _ := (&Config{Salt: vuoto.Salt}).GetSalt(); string(salt) != "nuovo" || vuoto.Language != "" || vuoto.Theme != "" {
+		t.Fatalf("profile vuoto saved as %+v", vuoto)
+	}
+}
+
+// The settings mirror db structs: the conversions below only compile while
+// the fields match, and the defaults must stay the same.
+func TestDefaultsMatchDB(t *testing.T) {
+	if db.RetentionPolicy(DefaultHistoryConfig()) != db.DefaultRetentionPolicy() {
+		t.Error("history defaults differ from db.DefaultRetentionPolicy")
+	}
+	if db.DailyConfig(DefaultDailyConfig()) != db.DefaultDailyConfig() {
+		t.Error("daily defaults differ from db.DefaultDailyConfig")
+	}
+	if db.BackupConfig(DefaultBackupConfig()) != db.DefaultBackupConfig() {
+		t.Error("backup defaults differ from db.DefaultBackupConfig")
+	}
+	if DefaultTemplatesFolder != db.DefaultTemplatesFolder {
+		t.Error("templates folder differs from db.DefaultTemplatesFolder")
+	}
+}
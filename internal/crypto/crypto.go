@@ -3,9 +3,11 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 
@@ -83,3 +85,13 @@ func (e *Encryptor) Decrypt(ciphertext string) (string, error) {
 
 	return string(plaintext), nil
 }
+
+// Hash returns a keyed SHA-256 of data. Equal data gives equal hashes under
+// the same password, but the hash reveals nothing about the content to
+// anyone without the key.
+func (e *Encryptor) Hash(data []byte) string {
+	subkey := sha256.Sum256(append([]byte("jotaku-content-hash:"), e.key...))
+	mac := hmac.New(sha256.New, subkey[:])
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,525 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"time"
+)
+
+// Attachments are files kept with a note. Their data lives in blobs, split in
+// chunks that are encrypted one by one, so large files never have to be held
+// encrypted in a single string. Blobs are keyed by a hash of their content:
+// attaching the same file twice stores it once. With a cipher set the hash is
+// keyed (see ContentHasher), so it says nothing about the plaintext. The file
+// name is encrypted like note content.
+
+const (
+	AttachmentChunkSize      = 256 << 10
+	DefaultMaxAttachmentSize = 25 << 20
+)
+
+var (
+	ErrAttachmentTooLarge    = errors.New("attachment too large")
+	ErrAttachmentNoteMissing = errors.New("note of the attachment not downloaded")
+)
+
+// ContentHasher is implemented by ciphers that derive a keyed content hash.
+// *crypto.Encryptor satisfies it.
+type ContentHasher interface {
+	Hash(data []byte) string
+}
+
+type Attachment struct {
+	ID         int64      `json:"id"`
+	NoteID     int64      `json:"note_id"`
+	Name       string     `json:"name"`
+	Hash       string     `json:"hash"`
+	Size       int64      `json:"size"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ServerID   string     `json:"server_id,omitempty"`
+	SyncStatus SyncStatus `json:"sync_status"`
+	Deleted    bool       `json:"deleted"`
+}
+
+// MimeType guesses the content type from the file name.
+func (a Attachment) MimeType() string {
+	if t := mime.TypeByExtension(filepath.Ext(a.Name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func (db *DB) contentHash(data []byte) string {
+	if h, ok := db.cipher.(ContentHasher); ok {
+		return h.Hash(data)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// storeBlob writes data as encrypted chunks unless a blob with the same hash
+// is already stored.
+func (db *DB) storeBlob(ctx context.Context, conn querier, hash string, data []byte) error {
+	var exists int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM blobs WHERE hash = ?`, hash).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	chunks := 0
+	for start := 0; start < len(data) || chunks == 0; start += AttachmentChunkSize {
+		end := start + AttachmentChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		sealed, err := db.seal(string(data[start:end]))
+		if err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `INSERT INTO blob_chunks (hash, seq, data) VALUES (?, ?, ?)`, hash, chunks, sealed); err != nil {
+			return fmt.Errorf("failed to store blob: %w", err)
+		}
+		chunks++
+	}
+	if _, err := conn.ExecContext(ctx, `INSERT INTO blobs (hash, size, chunks) VALUES (?, ?, ?)`, hash, len(data), chunks); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	return nil
+}
+
+// readBlob decrypts and reassembles a blob, checking it against its hash.
+func (db *DB) readBlob(ctx context.Context, hash string) ([]byte, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT data FROM blob_chunks WHERE hash = ? ORDER BY seq`, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	defer rows.Close()
+
+	var data []byte
+	for rows.Next() {
+		var sealed string
+		if err := rows.Scan(&sealed); err != nil {
+			return nil, err
+		}
+		chunk, err := db.open(sealed)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if db.contentHash(data) != hash {
+		return nil, fmt.Errorf("attachment data is corrupted")
+	}
+	return data, nil
+}
+
+// AddAttachment attaches data to a note under the given file name. maxSize
+// <= 0 uses DefaultMaxAttachmentSize. Read-only notes are refused.
+func (db *DB) AddAttachment(ctx context.Context, noteID int64, name string, data []byte, maxSize int64) (*Attachment, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxAttachmentSize
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w: %d bytes, limit is %d", ErrAttachmentTooLarge, len(data), maxSize)
+	}
+
+	name = filepath.Base(name)
+	sealedName, err := db.seal(name)
+	if err != nil {
+		return nil, err
+	}
+	hash := db.contentHash(data)
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkWritable(ctx, tx, noteID); err != nil {
+		return nil, err
+	}
+	if err := db.storeBlob(ctx, tx, hash, data); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO attachments (note_id, name, hash, size, created_at, sync_status, deleted)
+		VALUES (?, ?, ?, ?, ?, 'pending', 0)
+	`, noteID, sealedName, hash, len(data), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add attachment: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &Attachment{
+		ID:         id,
+		NoteID:     noteID,
+		Name:       name,
+		Hash:       hash,
+		Size:       int64(len(data)),
+		CreatedAt:  now,
+		SyncStatus: SyncStatusPending,
+	}, nil
+}
+
+func (db *DB) scanAttachments(rows *sql.Rows) ([]Attachment, error) {
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		var a Attachment
+		var sealedName string
+		var serverID sql.NullString
+		var syncStatus string
+		if err := rows.Scan(&a.ID, &a.NoteID, &sealedName, &a.Hash, &a.Size, &a.CreatedAt,
+			&serverID, &syncStatus, &a.Deleted); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		name, err := db.open(sealedName)
+		if err != nil {
+			name = "?"
+		}
+		a.Name = name
+		a.ServerID = serverID.String
+		a.SyncStatus = SyncStatus(syncStatus)
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+const attachmentColumns = `id, note_id, name, hash, size, created_at,
+	server_id, COALESCE(sync_status, 'local'), COALESCE(deleted, 0)`
+
+// ListAttachments returns the attachments of a note, oldest first.
+func (db *DB) ListAttachments(ctx context.Context, noteID int64) ([]Attachment, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+attachmentColumns+` FROM attachments
+		WHERE note_id = ? AND (deleted = 0 OR deleted IS NULL)
+		ORDER BY created_at ASC, id ASC
+	`, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+	return db.scanAttachments(rows)
+}
+
+func (db *DB) GetAttachment(ctx context.Context, id int64) (*Attachment, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT `+attachmentColumns+` FROM attachments WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	attachments, err := db.scanAttachments(rows)
+	if err != nil || len(attachments) == 0 {
+		return nil, err
+	}
+	return &attachments[0], nil
+}
+
+// ReadAttachment returns the decrypted content of an attachment.
+func (db *DB) ReadAttachment(ctx context.Context, id int64) ([]byte, error) {
+	a, err := db.GetAttachment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil || a.Deleted {
+		return nil, fmt.Errorf("attachment %d not found", id)
+	}
+	return db.readBlob(ctx, a.Hash)
+}
+
+// DeleteAttachment removes an attachment. Attachments known to the server
+// are kept as deleted until the next sync tells the server. Attachments of
+// read-only notes are refused.
+func (db *DB) DeleteAttachment(ctx context.Context, id int64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var noteID int64
+	err = tx.QueryRowContext(ctx, `SELECT note_id FROM attachments WHERE id = ?`, id).Scan(&noteID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	if err := checkWritable(ctx, tx, noteID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE attachments SET deleted = 1, sync_status = 'pending'
+		WHERE id = ? AND server_id IS NOT NULL AND server_id != ''
+	`, id); err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM attachments WHERE id = ? AND (server_id IS NULL OR server_id = '')
+	`, id); err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	if _, err := purgeOrphanBlobs(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeOrphanBlobs removes the blobs no live attachment refers to and
+// returns how many were removed.
+func (db *DB) PurgeOrphanBlobs(ctx context.Context) (int, error) {
+	// In one transaction: a blob attached again between the two deletes
+	// would keep its row but lose its chunks
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n, err := purgeOrphanBlobs(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func purgeOrphanBlobs(ctx context.Context, conn execer) (int, error) {
+	orphans := `SELECT hash FROM blobs WHERE hash NOT IN (
+		SELECT hash FROM attachments WHERE deleted = 0 OR deleted IS NULL
+	)`
+	if _, err := conn.ExecContext(ctx, `DELETE FROM blob_chunks WHERE hash IN (`+orphans+`)`); err != nil {
+		return 0, fmt.Errorf("failed to purge blobs: %w", err)
+	}
+	result, err := conn.ExecContext(ctx, `DELETE FROM blobs WHERE hash IN (`+orphans+`)`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge blobs: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
+// Sync
+
+// GetPendingAttachments returns the attachments to send to the server,
+// deleted ones included. Names are returned as stored (encrypted), since the
+// server only keeps them opaque.
+func (db *DB) GetPendingAttachments(ctx context.Context) ([]Attachment, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+attachmentColumns+` FROM attachments
+		WHERE sync_status = 'pending'
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		var a Attachment
+		var serverID sql.NullString
+		var syncStatus string
+		if err := rows.Scan(&a.ID, &a.NoteID, &a.Name, &a.Hash, &a.Size, &a.CreatedAt,
+			&serverID, &syncStatus, &a.Deleted); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		a.ServerID = serverID.String
+		a.SyncStatus = SyncStatus(syncStatus)
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+func (db *DB) SetAttachmentSynced(ctx context.Context, id int64, serverID string) error {
+	_, err := db.conn.ExecContext(ctx, `
+		UPDATE attachments SET server_id = ?, sync_status = 'synced' WHERE id = ?
+	`, serverID, id)
+	return err
+}
+
+// PermanentlyDeleteAttachment removes an attachment whose deletion the server
+// has acknowledged.
+func (db *DB) PermanentlyDeleteAttachment(ctx context.Context, id int64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := permanentlyDeleteAttachment(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func permanentlyDeleteAttachment(ctx context.Context, tx execer, id int64) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM attachments WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	_, err := purgeOrphanBlobs(ctx, tx)
+	return err
+}
+
+func (db *DB) HasBlob(ctx context.Context, hash string) (bool, error) {
+	var n int
+	err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM blobs WHERE hash = ?`, hash).Scan(&n)
+	return n > 0, err
+}
+
+// BlobChunks returns the encrypted chunks of a blob, in order.
+func (db *DB) BlobChunks(ctx context.Context, hash string) ([][]byte, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT data FROM blob_chunks WHERE hash = ? ORDER BY seq`, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks [][]byte
+	for rows.Next() {
+		var sealed string
+		if err := rows.Scan(&sealed); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, []byte(sealed))
+	}
+	return chunks, rows.Err()
+}
+
+// storeSealedBlob stores chunks received from the server as they are, unless
+// the blob is already stored. The chunks must have been checked with
+// openSealedBlob.
+func storeSealedBlob(ctx context.Context, tx querier, hash string, chunks [][]byte, size int) error {
+	var exists int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM blobs WHERE hash = ?`, hash).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	if exists > 0 {
+		return nil
+	}
+	for seq, sealed := range chunks {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO blob_chunks (hash, seq, data) VALUES (?, ?, ?)`, hash, seq, string(sealed)); err != nil {
+			return fmt.Errorf("failed to store blob: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO blobs (hash, size, chunks) VALUES (?, ?, ?)`, hash, size, len(chunks)); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	return nil
+}
+
+// openSealedBlob checks that chunks received from the server decrypt to
+// content matching hash, and returns the size of the content.
+func (db *DB) openSealedBlob(hash string, chunks [][]byte) (int, error) {
+	var data []byte
+	for _, sealed := range chunks {
+		chunk, err := db.open(string(sealed))
+		if err != nil {
+			return 0, err
+		}
+		data = append(data, chunk...)
+	}
+	if db.contentHash(data) != hash {
+		return 0, fmt.Errorf("downloaded blob %s does not match its hash", hash)
+	}
+	return len(data), nil
+}
+
+// UpsertAttachmentFromServer applies an attachment received from the server.
+// sealedName is stored as is. chunks is the blob downloaded for it, nil when
+// HasBlob said it is already stored or the attachment is deleted; the blob
+// and the attachment are written in one transaction, so a purge of orphan
+// blobs cannot remove the blob in between. An attachment of a note this
+// device does not have yet is an ErrAttachmentNoteMissing error, so that the
+// sync fails and fetches it again next time.
+func (db *DB) UpsertAttachmentFromServer(ctx context.Context, serverID, noteServerID, sealedName, hash string, size int64, createdAt time.Time, deleted bool, chunks [][]byte) error {
+	blobSize := 0
+	if chunks != nil {
+		n, err := db.openSealedBlob(hash, chunks)
+		if err != nil {
+			return err
+		}
+		blobSize = n
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var localID int64
+	err = tx.QueryRowContext(ctx, `SELECT id FROM attachments WHERE server_id = ?`, serverID).Scan(&localID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if deleted {
+		if localID == 0 {
+			return nil
+		}
+		if err := permanentlyDeleteAttachment(ctx, tx, localID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if localID != 0 {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE attachments SET name = ?, sync_status = 'synced' WHERE id = ? AND sync_status != 'pending'
+		`, sealedName, localID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	var noteID int64
+	err = tx.QueryRowContext(ctx, `SELECT id FROM notes WHERE server_id = ?`, noteServerID).Scan(&noteID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: attachment %s, note %s", ErrAttachmentNoteMissing, serverID, noteServerID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if chunks != nil {
+		if err := storeSealedBlob(ctx, tx, hash, chunks, blobSize); err != nil {
+			return err
+		}
+	} else {
+		// The blob may have been purged since HasBlob: the next sync
+		// downloads it again
+		var exists int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM blobs WHERE hash = ?`, hash).Scan(&exists); err != nil {
+			return err
+		}
+		if exists == 0 {
+			return fmt.Errorf("blob %s of attachment %s is not stored", hash, serverID)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO attachments (note_id, name, hash, size, created_at, server_id, sync_status, deleted)
+		VALUES (?, ?, ?, ?, ?, ?, 'synced', 0)
+	`, noteID, sealedName, hash, size, createdAt, serverID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
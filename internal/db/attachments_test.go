@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadOnlyNoteAttachmentsAreNotChanged(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	note, _ := database.CreateNoteInFolder(ctx, "Contratto", "", nil, 0)
+	a, err := database.AddAttachment(ctx, note.ID, "/tmp/firmato.pdf", []byte("%PDF"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.SetNoteReadOnly(ctx, note.ID, true)
+
+	if _, err := database.AddAttachment(ctx, note.ID, "/tmp/bozza.pdf", []byte("%PDF-bozza"), 0); !errors.Is(err, ErrNoteReadOnly) {
+		t.Fatalf("attachment added to a read-only note: %v", err)
+	}
+	if err := database.DeleteAttachment(ctx, a.ID); !errors.Is(err, ErrNoteReadOnly) {
+		t.Fatalf("attachment of a read-only note deleted: %v", err)
+	}
+	if attachments, _ := database.ListAttachments(ctx, note.ID); len(attachments) != 1 {
+		t.Fatalf("%d attachments, want 1", len(attachments))
+	}
+	if data, err := database.ReadAttachment(ctx, a.ID); err != nil || string(data) != "%PDF" {
+		t.Fatalf("attachment data %q, %v", data, err)
+	}
+}
+
+func TestUpsertAttachmentFromServerStoresBlob(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	note, _ := database.CreateNoteInFolder(ctx, "Contratto", "", nil, 0)
+	database.SetNoteSynced(ctx, note.ID, "note-1", time.Now())
+
+	data := []byte("%PDF")
+	hash := database.contentHash(data)
+	if err := database.UpsertAttachmentFromServer(ctx, "att-1", "note-1", "firmato.pdf", hash, 4, time.Now(), false, [][]byte{data}); err != nil {
+		t.Fatal(err)
+	}
+	attachments, _ := database.ListAttachments(ctx, note.ID)
+	if len(attachments) != 1 {
+		t.Fatalf("%d attachments, want 1", len(attachments))
+	}
+	if got, err := database.ReadAttachment(ctx, attachments[0].ID); err != nil || string(got) != "%PDF" {
+		t.Fatalf("attachment data %q, %v", got, err)
+	}
+
+	// Chunks that do not match the hash store nothing
+	if err := database.UpsertAttachmentFromServer(ctx, "att-2", "note-1", "altro.pdf", hash, 4, time.Now(), false, [][]byte{[]byte("altro")}); err == nil {
+		t.Fatal("blob not matching its hash stored")
+	}
+
+	// A blob purged after HasBlob fails the upsert instead of leaving an
+	// attachment without data
+	other := database.contentHash([]byte("bozza"))
+	if err := database.UpsertAttachmentFromServer(ctx, "att-3", "note-1", "bozza.pdf", other, 5, time.Now(), false, nil); err == nil {
+		t.Fatal("attachment stored without its blob")
+	}
+	if attachments, _ := database.ListAttachments(ctx, note.ID); len(attachments) != 1 {
+		t.Fatalf("%d attachments after refused upserts, want 1", len(attachments))
+	}
+
+	// A deletion from the server removes the attachment and its blob
+	if err := database.UpsertAttachmentFromServer(ctx, "att-1", "note-1", "", hash, 0, time.Now(), true, nil); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := database.HasBlob(ctx, hash); has {
+		t.Fatal("blob of a deleted attachment kept")
+	}
+}
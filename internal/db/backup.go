@@ -0,0 +1,535 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// Backups are copies of the whole database taken with SQLite's online backup
+// API, so they can be taken while Jotaku is writing to it. Like attachments
+// the copy is split in chunks encrypted one by one with the vault key. The
+// header carries the key's salt: a backup can be restored with the master
+// password alone, on a machine without the original config.
+
+const (
+	BackupExt         = ".jbk"
+	backupMagic       = "JOTAKU-BACKUP 1"
+	backupChunkSize   = 1 << 20
+	backupTimeLayout  = "20060102-150405"
+	sqliteMagicHeader = "SQLite format 3\x00"
+)
+
+// Backup reasons, part of the file name
+const (
+	BackupAuto   = "auto"
+	BackupManual = "manual"
+	BackupDoctor = "doctor"
+)
+
+var ErrNotBackup = errors.New("not a jotaku backup")
+
+// BackupConfig says where automatic backups go and how many are kept: the
+// newest backup of each of the last Daily days and Weekly weeks.
+type BackupConfig struct {
+	Enabled  bool
+	Dir      string // Vuoto = cartella backups accanto al database
+	Interval time.Duration
+	Daily    int
+	Weekly   int
+}
+
+func DefaultBackupConfig() BackupConfig {
+	return BackupConfig{Enabled: true, Interval: 6 * time.Hour, Daily: 7, Weekly: 4}
+}
+
+func (c BackupConfig) withDefaults() BackupConfig {
+	if c.Interval <= 0 {
+		c.Interval = DefaultBackupConfig().Interval
+	}
+	return c
+}
+
+// BackupDir returns the directory backups of the database at dbPath go to.
+func (c BackupConfig) BackupDir(dbPath string) string {
+	if c.Dir == "" {
+		return filepath.Join(filepath.Dir(dbPath), "backups")
+	}
+	if c.Dir[0] == '~' {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, c.Dir[1:])
+	}
+	return c.Dir
+}
+
+// Due reports whether an automatic backup should be taken, given the
+// existing backups newest first.
+func (c BackupConfig) Due(backups []BackupInfo, now time.Time) bool {
+	if !c.Enabled {
+		return false
+	}
+	for _, b := range backups {
+		if b.Reason == BackupAuto {
+			return now.Sub(b.CreatedAt) >= c.withDefaults().Interval
+		}
+	}
+	return true
+}
+
+// expired returns the automatic backups rotation removes. backups must be
+// ordered newest first; the newest one is always kept.
+func (c BackupConfig) expired(backups []BackupInfo) []BackupInfo {
+	var drop []BackupInfo
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	first := true
+	for _, b := range backups {
+		if b.Reason != BackupAuto {
+			continue
+		}
+		keep := first
+		first = false
+
+		day := b.CreatedAt.Format("2006-01-02")
+		year, w := b.CreatedAt.ISOWeek()
+		week := fmt.Sprintf("%d-%02d", year, w)
+		if !days[day] && len(days) < c.Daily {
+			days[day] = true
+			keep = true
+		}
+		if !weeks[week] && len(weeks) < c.Weekly {
+			weeks[week] = true
+			keep = true
+		}
+		if !keep {
+			drop = append(drop, b)
+		}
+	}
+	return drop
+}
+
+// BackupInfo describes a backup file.
+type BackupInfo struct {
+	Path      string    `json:"path"`
+	Profile   string    `json:"profile,omitempty"` // Vuoto per il profilo predefinito
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+	Encrypted bool      `json:"encrypted"` // false per le copie in chiaro di jotaku doctor --no-decrypt
+}
+
+// BackupName returns the file name of a backup of profile taken at at.
+// Profiles can share a backup directory, so the name carries the profile;
+// backups of the default profile (empty) keep the plain jotaku- prefix.
+func BackupName(at time.Time, profile, reason, ext string) string {
+	if profile != "" {
+		profile += "-"
+	}
+	return fmt.Sprintf("jotaku-%s%s-%s%s", profile, at.Format(backupTimeLayout), reason, ext)
+}
+
+// parseBackupName reads the profile, time and reason from a backup file name.
+func parseBackupName(name string) (profile string, at time.Time, reason string, ok bool) {
+	ext := filepath.Ext(name)
+	if ext != BackupExt && ext != ".db" {
+		return "", time.Time{}, "", false
+	}
+	rest, found := strings.CutPrefix(strings.TrimSuffix(name, ext), "jotaku-")
+	i := strings.LastIndex(rest, "-")
+	if !found || i < len(backupTimeLayout) || i == len(rest)-1 {
+		return "", time.Time{}, "", false
+	}
+	stamp := rest[i-len(backupTimeLayout) : i]
+	at, err := time.ParseInLocation(backupTimeLayout, stamp, time.Local)
+	if err != nil {
+		return "", time.Time{}, "", false
+	}
+	if prefix := rest[:i-len(backupTimeLayout)]; prefix != "" {
+		var tagged bool
+		if profile, tagged = strings.CutSuffix(prefix, "-"); !tagged || profile == "" {
+			return "", time.Time{}, "", false
+		}
+	}
+	return profile, at, rest[i+1:], true
+}
+
+// ListBackups returns the backups of profile in dir, newest first. Backups of
+// other profiles sharing the directory are left out.
+func ListBackups(dir, profile string) ([]BackupInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var backups []BackupInfo
+	for _, e := range entries {
+		owner, at, reason, ok := parseBackupName(e.Name())
+		if !ok || e.IsDir() || owner != profile {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, BackupInfo{
+			Path:      filepath.Join(dir, e.Name()),
+			Profile:   owner,
+			Reason:    reason,
+			CreatedAt: at,
+			Size:      info.Size(),
+			Encrypted: filepath.Ext(e.Name()) == BackupExt,
+		})
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// RotateBackups removes the automatic backups of profile in dir that cfg no
+// longer keeps and returns how many were removed. Other backups are never
+// touched.
+func RotateBackups(dir, profile string, cfg BackupConfig) (int, error) {
+	backups, err := ListBackups(dir, profile)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, b := range cfg.expired(backups) {
+		if err := os.Remove(b.Path); err != nil {
+			return removed, fmt.Errorf("failed to remove backup: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// copyTo copies the database to path with the online backup API, a few
+// pages at a time so writers are not blocked for the whole copy.
+func (db *DB) copyTo(ctx context.Context, path string) error {
+	dest, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(d interface{}) error {
+		return srcConn.Raw(func(s interface{}) error {
+			dc, ok := d.(*sqlite3.SQLiteConn)
+			sc, ok2 := s.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return fmt.Errorf("unexpected sqlite driver")
+			}
+			b, err := dc.Backup("main", sc, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := b.Step(256)
+				if err != nil {
+					b.Finish()
+					return err
+				}
+				if done {
+					break
+				}
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// BackupTo writes an unencrypted copy of the database to path, which must not
+// exist yet.
+func (db *DB) BackupTo(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup %s already exists", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := db.copyTo(ctx, path); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
+
+// Backup writes an encrypted backup of the database of profile to dir and
+// checks that it restores to the same data. salt is the one the cipher's key
+// was derived with.
+func (db *DB) Backup(ctx context.Context, dir, profile, reason string, salt []byte) (*BackupInfo, error) {
+	if db.cipher == nil {
+		return nil, fmt.Errorf("encrypted backups need the vault key")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	now := time.Now()
+	path := filepath.Join(dir, BackupName(now, profile, reason, BackupExt))
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("backup %s already exists", path)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".jotaku-backup-*.db")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := db.copyTo(ctx, tmp.Name()); err != nil {
+		return nil, fmt.Errorf("failed to back up database: %w", err)
+	}
+
+	sum, err := sealBackup(tmp.Name(), path, db.cipher, salt)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	// Read it back before trusting it
+	check := tmp.Name() + ".check"
+	defer os.Remove(check)
+	restored, err := extractBackup(ctx, path, db.cipher, check)
+	if err == nil && restored != sum {
+		err = fmt.Errorf("restored data differs")
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("backup verification failed: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &BackupInfo{Path: path, Profile: profile, Reason: reason, CreatedAt: now, Size: info.Size(), Encrypted: true}, nil
+}
+
+// sealBackup encrypts the database file src into dst and returns the SHA-256
+// of the plaintext. Every chunk starts with its number, so chunks cannot be
+// dropped or reordered unnoticed.
+func sealBackup(src, dst string, c Cipher, salt []byte) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	stat, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "%s\nsalt %s\nsize %d\n\n", backupMagic, base64.StdEncoding.EncodeToString(salt), stat.Size())
+
+	hash := sha256.New()
+	buf := make([]byte, backupChunkSize)
+	for seq := 0; ; seq++ {
+		n, err := io.ReadFull(in, buf)
+		if n > 0 {
+			hash.Write(buf[:n])
+			sealed, err := c.Encrypt(strconv.Itoa(seq) + "\n" + string(buf[:n]))
+			if err != nil {
+				return "", fmt.Errorf("failed to encrypt backup: %w", err)
+			}
+			w.WriteString(sealed + "\n")
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read database: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := out.Sync(); err != nil {
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readBackupHeader reads the header of an encrypted backup.
+func readBackupHeader(r *bufio.Reader) (salt []byte, size int64, err error) {
+	line, _ := r.ReadString('\n')
+	if strings.TrimSpace(line) != backupMagic {
+		return nil, 0, ErrNotBackup
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, 0, ErrNotBackup
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "salt":
+			if salt, err = base64.StdEncoding.DecodeString(value); err != nil {
+				return nil, 0, ErrNotBackup
+			}
+		case "size":
+			if size, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return nil, 0, ErrNotBackup
+			}
+		}
+	}
+	return salt, size, nil
+}
+
+// ReadBackupSalt returns the salt the key of the backup at path was derived
+// with, or nil for an unencrypted copy.
+func ReadBackupSalt(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if head, _ := r.Peek(len(sqliteMagicHeader)); string(head) == sqliteMagicHeader {
+		return nil, nil
+	}
+	salt, _, err := readBackupHeader(r)
+	return salt, err
+}
+
+// ExtractBackup decrypts the backup at path into a new database file at
+// target and checks its integrity. c may be nil for an unencrypted copy.
+func ExtractBackup(ctx context.Context, path string, c Cipher, target string) error {
+	_, err := extractBackup(ctx, path, c, target)
+	if err != nil {
+		os.Remove(target)
+	}
+	return err
+}
+
+func extractBackup(ctx context.Context, path string, c Cipher, target string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create database: %w", err)
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	w := io.MultiWriter(out, hash)
+	r := bufio.NewReader(in)
+
+	if head, _ := r.Peek(len(sqliteMagicHeader)); string(head) == sqliteMagicHeader {
+		if _, err := io.Copy(w, r); err != nil {
+			return "", err
+		}
+	} else {
+		if c == nil {
+			return "", fmt.Errorf("the backup is encrypted")
+		}
+		_, size, err := readBackupHeader(r)
+		if err != nil {
+			return "", err
+		}
+		var written int64
+		for seq := 0; ; seq++ {
+			line, err := r.ReadString('\n')
+			if line = strings.TrimSpace(line); line != "" {
+				plain, derr := c.Decrypt(line)
+				if derr != nil {
+					if seq == 0 {
+						return "", ErrWrongKey
+					}
+					return "", fmt.Errorf("chunk %d is damaged", seq)
+				}
+				num, data, _ := strings.Cut(plain, "\n")
+				if num != strconv.Itoa(seq) {
+					return "", fmt.Errorf("chunk %d is out of place", seq)
+				}
+				w.Write([]byte(data))
+				written += int64(len(data))
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+		if written != size {
+			return "", fmt.Errorf("backup is truncated (%d of %d bytes)", written, size)
+		}
+	}
+	if err := out.Sync(); err != nil {
+		return "", err
+	}
+	out.Close()
+
+	if err := checkDatabaseFile(ctx, target); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checkDatabaseFile runs SQLite's integrity check on a database file and
+// makes sure it holds a vault.
+func checkDatabaseFile(ctx context.Context, path string) error {
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var result string
+	if err := conn.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result); err != nil {
+		return fmt.Errorf("failed to check backup: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("backup is corrupt: %s", result)
+	}
+	var n int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'notes'`).Scan(&n); err != nil || n == 0 {
+		return fmt.Errorf("backup holds no notes table")
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JustZacca/jotaku/internal/crypto"
+)
+
+// newBackup takes a backup of a vault large enough for several chunks and
+// returns its path.
+func newBackup(t *testing.T) (*DB, string) {
+	t.Helper()
+	ctx := context.Background()
+	database, _ := newEncryptedTestDB(t, "password")
+	big := strings.Repeat("0123456789abcdef", 2*backupChunkSize/16)
+	if _, err := database.CreateNoteInFolder(ctx, "Grande", big, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	info, err := database.Backup(ctx, t.TempDir(), "", BackupManual, testSalt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return database, info.Path
+}
+
+// backupLines splits a backup into its header and its chunk lines.
+func backupLines(t *testing.T, path string) (string, []string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, body, _ := strings.Cut(string(data), "\n\n")
+	return header + "\n\n", strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	database, path := newBackup(t)
+
+	if salt, err := ReadBackupSalt(path); err != nil || string(salt) != string(testSalt) {
+		t.Fatalf("backup salt %q, %v", salt, err)
+	}
+	if _, chunks := backupLines(t, path); len(chunks) < 2 {
+		t.Fatalf("backup of %d chunks, want several", len(chunks))
+	}
+
+	target := filepath.Join(t.TempDir(), "restored.db")
+	if err := ExtractBackup(ctx, path, database.cipher, target); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := New(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	var n int
+	restored.conn.QueryRow(`SELECT COUNT(*) FROM notes WHERE title IN ('Nota', 'Grande')`).Scan(&n)
+	if n != 2 {
+		t.Fatalf("%d notes in the restored vault, want 2", n)
+	}
+}
+
+func TestBackupWrongKey(t *testing.T) {
+	_, path := newBackup(t)
+	target := filepath.Join(t.TempDir(), "restored.db")
+	err := ExtractBackup(context.Background(), path, crypto.NewEncryptor("sbagliata", testSalt), target)
+	if !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("extract with the wrong key: %v, want ErrWrongKey", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatal("failed extraction left a database behind")
+	}
+}
+
+func TestBackupRejectsTamperedChunks(t *testing.T) {
+	database, path := newBackup(t)
+	header, chunks := backupLines(t, path)
+
+	swapped := append([]string(nil), chunks...)
+	swapped[0], swapped[1] = swapped[1], swapped[0]
+	for name, lines := range map[string][]string{
+		"truncated": chunks[:len(chunks)-1],
+		"reordered": swapped,
+		"dropped":   chunks[1:],
+	} {
+		tampered := filepath.Join(t.TempDir(), "tampered"+BackupExt)
+		if err := os.WriteFile(tampered, []byte(header+strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		target := filepath.Join(t.TempDir(), "restored.db")
+		if err := ExtractBackup(context.Background(), tampered, database.cipher, target); err == nil {
+			t.Errorf("%s backup extracted", name)
+		}
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	dir := t.TempDir()
+	// Sunday 18 October 2026, the last day of ISO week 42
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local)
+	for day := 0; day < 40; day++ {
+		for _, hour := range []int{9, 18} {
+			at := now.AddDate(0, 0, -day).Add(time.Duration(hour) * time.Hour)
+			if err := os.WriteFile(filepath.Join(dir, BackupName(at, "", BackupAuto, BackupExt)), nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	manual := BackupName(now.AddDate(0, -3, 0), "", BackupManual, BackupExt)
+	if err := os.WriteFile(filepath.Join(dir, manual), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RotateBackups(dir, "", DefaultBackupConfig()); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := ListBackups(dir, "")
+	var kept []string
+	for _, b := range backups {
+		kept = append(kept, filepath.Base(b.Path))
+	}
+	// The latest of each of the last 7 days, which make up week 42, then of
+	// weeks 41, 40 and 39
+	var want []string
+	for _, date := range []string{"1018", "1017", "1016", "1015", "1014", "1013", "1012", "1011", "1004", "0927"} {
+		want = append(want, "jotaku-2026"+date+"-180000-auto"+BackupExt)
+	}
+	want = append(want, manual)
+	if !reflect.DeepEqual(kept, want) {
+		t.Fatalf("kept %v, want %v", kept, want)
+	}
+}
+
+func TestProfilesShareBackupDir(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().Truncate(time.Second)
+	for _, profile := range []string{"", "lavoro-2"} {
+		for day := 0; day < 3; day++ {
+			name := BackupName(now.AddDate(0, 0, -day), profile, BackupAuto, BackupExt)
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// The newest backup of the default profile is old enough to take a new one
+	os.Remove(filepath.Join(dir, BackupName(now, "", BackupAuto, BackupExt)))
+
+	cfg := BackupConfig{Enabled: true, Interval: time.Hour, Daily: 1}
+	removed, err := RotateBackups(dir, "lavoro-2", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Fatalf("%d backups removed, want 2", removed)
+	}
+
+	work, _ := ListBackups(dir, "lavoro-2")
+	if len(work) != 1 || work[0].Profile != "lavoro-2" || !work[0].CreatedAt.Equal(now) {
+		t.Fatalf("backups of lavoro-2 after rotation: %+v", work)
+	}
+	personal, _ := ListBackups(dir, "")
+	if len(personal) != 2 {
+		t.Fatalf("%d backups of the default profile, want 2", len(personal))
+	}
+	if !cfg.Due(personal, now) {
+		t.Fatal("backup of another profile counted as the default profile's")
+	}
+}
@@ -0,0 +1,255 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A board shows the notes of a folder as cards in columns. Tag boards have a
+// column per tag and moving a card swaps the note's column tag; task boards
+// group notes by the state of their checklist and are read-only. Each folder
+// (0 = root) has its own board, kept on this device.
+
+const (
+	BoardTags  = "tags"
+	BoardTasks = "tasks"
+)
+
+// Board is the definition of a folder's board.
+type Board struct {
+	FolderID int64    `json:"folder_id"`
+	Kind     string   `json:"kind"`    // BoardTags o BoardTasks
+	Columns  []string `json:"columns"` // Tag delle colonne, solo per BoardTags
+}
+
+// BoardCard is a note on a board.
+type BoardCard struct {
+	NoteID int64    `json:"note_id"`
+	Title  string   `json:"title"`
+	Tags   []string `json:"tags"`
+	Done   int      `json:"done"`  // Voci di checklist spuntate
+	Total  int      `json:"total"` // Voci di checklist
+}
+
+// BoardColumn is a column of cards. Tag is empty for the column of notes
+// without any of the board's tags, and for the columns of a task board.
+type BoardColumn struct {
+	Tag   string      `json:"tag"`
+	Cards []BoardCard `json:"cards"`
+}
+
+// Columns of a task board
+const (
+	TaskColumnTodo = iota
+	TaskColumnDoing
+	TaskColumnDone
+)
+
+// DefaultBoard is the board of a folder that has none saved.
+func DefaultBoard(folderID int64) Board {
+	return Board{FolderID: folderID, Kind: BoardTags, Columns: []string{"todo", "doing", "done"}}
+}
+
+// ParseBoard reads a board definition as typed by the user: "tasks" for a
+// task board, otherwise the column tags, e.g. "#todo #doing #done".
+func ParseBoard(folderID int64, input string) (Board, error) {
+	input = strings.TrimSpace(input)
+	if strings.EqualFold(input, BoardTasks) {
+		return Board{FolderID: folderID, Kind: BoardTasks}, nil
+	}
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ' ' || r == ',' || r == ';'
+	})
+	columns := normalizeTags(fields)
+	if len(columns) == 0 {
+		return Board{}, fmt.Errorf("a board needs at least one column tag, or %q", BoardTasks)
+	}
+	return Board{FolderID: folderID, Kind: BoardTags, Columns: columns}, nil
+}
+
+// String is the definition in the form ParseBoard reads.
+func (b Board) String() string {
+	if b.Kind == BoardTasks {
+		return BoardTasks
+	}
+	tags := make([]string, len(b.Columns))
+	for i, c := range b.Columns {
+		tags[i] = "#" + c
+	}
+	return strings.Join(tags, " ")
+}
+
+// GetBoard returns the board of a folder, or the default one.
+func (db *DB) GetBoard(ctx context.Context, folderID int64) (Board, error) {
+	var kind string
+	var columns sql.NullString
+	err := db.conn.QueryRowContext(ctx, `SELECT kind, columns FROM boards WHERE folder_id = ?`, folderID).Scan(&kind, &columns)
+	if err == sql.ErrNoRows {
+		return DefaultBoard(folderID), nil
+	}
+	if err != nil {
+		return Board{}, fmt.Errorf("failed to get board: %w", err)
+	}
+
+	b := Board{FolderID: folderID, Kind: kind}
+	if columns.Valid && columns.String != "" {
+		if err := json.Unmarshal([]byte(columns.String), &b.Columns); err != nil {
+			return Board{}, fmt.Errorf("failed to read board columns: %w", err)
+		}
+	}
+	return b, nil
+}
+
+// SaveBoard stores the board of a folder.
+func (db *DB) SaveBoard(ctx context.Context, b Board) error {
+	columns, err := json.Marshal(b.Columns)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn.ExecContext(ctx, `
+		INSERT INTO boards (folder_id, kind, columns, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(folder_id) DO UPDATE SET kind = excluded.kind, columns = excluded.columns,
+			updated_at = excluded.updated_at
+	`, b.FolderID, b.Kind, string(columns), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save board: %w", err)
+	}
+	return nil
+}
+
+// BoardColumns fills the columns of a board with the notes of its folder.
+// Tag boards start with a column for notes without any of the board's tags;
+// task boards leave out notes without a checklist and protected notes.
+func (db *DB) BoardColumns(ctx context.Context, b Board) ([]BoardColumn, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, title, content, COALESCE(tags, '[]'), COALESCE(password, '')
+		FROM notes
+		WHERE COALESCE(parent_folder_id, 0) = ? AND (deleted = 0 OR deleted IS NULL)
+		  AND COALESCE(archived, 0) = 0
+		ORDER BY updated_at DESC
+	`, b.FolderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list board notes: %w", err)
+	}
+	defer rows.Close()
+
+	columns := newBoardColumns(b)
+	for rows.Next() {
+		var card BoardCard
+		var content, tagsJSON, password string
+		if err := rows.Scan(&card.NoteID, &card.Title, &content, &tagsJSON, &password); err != nil {
+			return nil, fmt.Errorf("failed to scan note: %w", err)
+		}
+		json.Unmarshal([]byte(tagsJSON), &card.Tags)
+
+		if b.Kind == BoardTasks {
+			if password != "" {
+				continue
+			}
+			plaintext, err := db.open(content)
+			if err != nil {
+				continue
+			}
+			placeTaskCard(columns, card, plaintext)
+			continue
+		}
+		placeTagCard(columns, card)
+	}
+	return columns, rows.Err()
+}
+
+// newBoardColumns returns the empty columns of a board.
+func newBoardColumns(b Board) []BoardColumn {
+	if b.Kind == BoardTasks {
+		return make([]BoardColumn, TaskColumnDone+1)
+	}
+	columns := []BoardColumn{{}}
+	for _, tag := range b.Columns {
+		columns = append(columns, BoardColumn{Tag: tag})
+	}
+	return columns
+}
+
+// placeTaskCard adds a note to the column of a task board its checklist puts
+// it in. Notes without a checklist are left out.
+func placeTaskCard(columns []BoardColumn, card BoardCard, plaintext string) {
+	for _, item := range ParseChecklist(plaintext) {
+		card.Total++
+		if item.Done {
+			card.Done++
+		}
+	}
+	switch {
+	case card.Total == 0:
+	case card.Done == 0:
+		columns[TaskColumnTodo].Cards = append(columns[TaskColumnTodo].Cards, card)
+	case card.Done < card.Total:
+		columns[TaskColumnDoing].Cards = append(columns[TaskColumnDoing].Cards, card)
+	default:
+		columns[TaskColumnDone].Cards = append(columns[TaskColumnDone].Cards, card)
+	}
+}
+
+// placeTagCard adds a note to the first column of a tag board whose tag it
+// has, or to the column of untagged notes.
+func placeTagCard(columns []BoardColumn, card BoardCard) {
+	column := 0
+	for i := 1; i < len(columns) && column == 0; i++ {
+		for _, tag := range card.Tags {
+			if tag == columns[i].Tag {
+				column = i
+				break
+			}
+		}
+	}
+	columns[column].Cards = append(columns[column].Cards, card)
+}
+
+// MoveCard moves a note to the column of a tag board with the given tag,
+// replacing the other column tags of the note; an empty tag only removes
+// them. The note is read and saved in one transaction, and marked for sync.
+func (db *DB) MoveCard(ctx context.Context, b Board, noteID int64, tag string) error {
+	if b.Kind != BoardTags {
+		return fmt.Errorf("cards of a %s board cannot be moved", b.Kind)
+	}
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	note, err := getNote(ctx, tx, noteID)
+	if err != nil {
+		return err
+	}
+	if note == nil || note.Deleted {
+		return fmt.Errorf("note %d not found", noteID)
+	}
+
+	if err := db.updateNote(ctx, tx, note.ID, note.Title, note.Content, b.cardTags(note.Tags, tag)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// cardTags returns the tags of a note moved to the column with tag.
+func (b Board) cardTags(noteTags []string, tag string) []string {
+	columns := make(map[string]bool, len(b.Columns))
+	for _, c := range b.Columns {
+		columns[c] = true
+	}
+	var tags []string
+	for _, t := range noteTags {
+		if !columns[NormalizeTag(t)] {
+			tags = append(tags, t)
+		}
+	}
+	if tag != "" {
+		tags = append(tags, tag)
+	}
+	return tags
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseBoard(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Board
+	}{
+		{"tasks", Board{FolderID: 7, Kind: BoardTasks}},
+		{" Tasks ", Board{FolderID: 7, Kind: BoardTasks}},
+		{"#todo #doing #done", Board{FolderID: 7, Kind: BoardTags, Columns: []string{"todo", "doing", "done"}}},
+		{"idee, #lavoro/bozze/;fatto idee", Board{FolderID: 7, Kind: BoardTags, Columns: []string{"idee", "lavoro/bozze", "fatto"}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseBoard(7, tt.input)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("ParseBoard(%q) = %+v, %v; want %+v", tt.input, got, err, tt.want)
+		}
+		if again, _ := ParseBoard(7, got.String()); !reflect.DeepEqual(again, got) {
+			t.Fatalf("ParseBoard(%q) = %+v, want %+v", got.String(), again, got)
+		}
+	}
+	for _, input := range []string{"", "  ", "# , ;"} {
+		if _, err := ParseBoard(7, input); err == nil {
+			t.Fatalf("ParseBoard(%q) succeeded", input)
+		}
+	}
+}
+
+// cardIDs returns the note IDs of each column.
+func cardIDs(columns []BoardColumn) [][]int64 {
+	ids := make([][]int64, len(columns))
+	for i, c := range columns {
+		for _, card := range c.Cards {
+			ids[i] = append(ids[i], card.NoteID)
+		}
+	}
+	return ids
+}
+
+func TestPlaceTagCard(t *testing.T) {
+	columns := newBoardColumns(Board{Kind: BoardTags, Columns: []string{"todo", "doing", "done"}})
+	for _, card := range []BoardCard{
+		{NoteID: 1, Tags: []string{"lavoro"}},
+		{NoteID: 2, Tags: []string{"done"}},
+		// With several column tags the card goes in the first column
+		{NoteID: 3, Tags: []string{"done", "lavoro", "doing"}},
+		{NoteID: 4},
+		{NoteID: 5, Tags: []string{"todo/bozze", "todo"}},
+	} {
+		placeTagCard(columns, card)
+	}
+	want := [][]int64{{1, 4}, {5}, {3}, {2}}
+	if got := cardIDs(columns); !reflect.DeepEqual(got, want) {
+		t.Fatalf("columns %v, want %v", got, want)
+	}
+	if columns[0].Tag != "" || columns[2].Tag != "doing" {
+		t.Fatalf("column tags %q, %q", columns[0].Tag, columns[2].Tag)
+	}
+}
+
+func TestPlaceTaskCard(t *testing.T) {
+	columns := newBoardColumns(Board{Kind: BoardTasks})
+	for i, content := range []string{
+		"nessuna lista",
+		"- [ ] pane\n- [ ] latte",
+		"- [x] pane\n* [ ] latte\n+ [X] uova",
+		"- [x] pane\n- [X] latte",
+	} {
+		placeTaskCard(columns, BoardCard{NoteID: int64(i + 1)}, content)
+	}
+	want := [][]int64{{2}, {3}, {4}}
+	if got := cardIDs(columns); !reflect.DeepEqual(got, want) {
+		t.Fatalf("columns %v, want %v", got, want)
+	}
+	if c := columns[TaskColumnDoing].Cards[0]; c.Done != 2 || c.Total != 3 {
+		t.Fatalf("progress %d/%d, want 2/3", c.Done, c.Total)
+	}
+}
+
+func TestCardTags(t *testing.T) {
+	b := Board{Kind: BoardTags, Columns: []string{"todo", "doing", "done"}}
+	tests := []struct {
+		tags []string
+		tag  string
+		want []string
+	}{
+		{[]string{"lavoro", "todo"}, "doing", []string{"lavoro", "doing"}},
+		{[]string{"#todo/", "done", "lavoro", "todo/bozze"}, "doing", []string{"lavoro", "todo/bozze", "doing"}},
+		{[]string{"doing"}, "doing", []string{"doing"}},
+		{[]string{"lavoro", "done"}, "", []string{"lavoro"}},
+		{nil, "", nil},
+	}
+	for _, tt := range tests {
+		if got := b.cardTags(tt.tags, tt.tag); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("cardTags(%q, %q) = %q, want %q", tt.tags, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestMoveCard(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	b := DefaultBoard(0)
+
+	note, _ := database.CreateNoteInFolder(ctx, "Preventivo", "", []string{"lavoro", "todo"}, 0)
+	untagged, _ := database.CreateNoteInFolder(ctx, "Idea", "", nil, 0)
+	if err := database.MoveCard(ctx, b, note.ID, "doing"); err != nil {
+		t.Fatal(err)
+	}
+	if got := tagsOf(t, database, note.ID); !reflect.DeepEqual(got, []string{"lavoro", "doing"}) {
+		t.Fatalf("tags after the move %q", got)
+	}
+	columns, err := database.BoardColumns(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cardIDs(columns); !reflect.DeepEqual(got, [][]int64{{untagged.ID}, nil, {note.ID}, nil}) {
+		t.Fatalf("columns %v", got)
+	}
+
+	// Back to the untagged column
+	if err := database.MoveCard(ctx, b, note.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := tagsOf(t, database, note.ID); !reflect.DeepEqual(got, []string{"lavoro"}) {
+		t.Fatalf("tags after moving to the untagged column %q", got)
+	}
+
+	database.SetNoteReadOnly(ctx, note.ID, true)
+	if err := database.MoveCard(ctx, b, note.ID, "done"); !errors.Is(err, ErrNoteReadOnly) {
+		t.Fatalf("MoveCard on a locked note: %v", err)
+	}
+	if got := tagsOf(t, database, note.ID); !reflect.DeepEqual(got, []string{"lavoro"}) {
+		t.Fatalf("tags of the locked note %q", got)
+	}
+
+	if err := database.MoveCard(ctx, Board{Kind: BoardTasks}, untagged.ID, "done"); err == nil {
+		t.Fatal("card of a task board moved")
+	}
+	database.DeleteNote(ctx, untagged.ID)
+	if err := database.MoveCard(ctx, b, untagged.ID, "done"); err == nil {
+		t.Fatal("deleted note moved")
+	}
+}
+
+func TestMemoryMoveCard(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	b := DefaultBoard(0)
+	note, _ := s.CreateNoteInFolder(ctx, "Preventivo", "", []string{"todo", "lavoro"}, 0)
+
+	if err := s.MoveCard(ctx, b, note.ID, "done"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := s.GetNote(ctx, note.ID)
+	if !reflect.DeepEqual(got.Tags, []string{"lavoro", "done"}) {
+		t.Fatalf("tags after the move %q", got.Tags)
+	}
+	s.SetNoteReadOnly(ctx, note.ID, true)
+	if err := s.MoveCard(ctx, b, note.ID, "todo"); !errors.Is(err, ErrNoteReadOnly) {
+		t.Fatalf("MoveCard on a locked note: %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ChecklistItem is a Markdown checkbox line ("- [ ] text" or "- [x] text").
+type ChecklistItem struct {
+	Line int    `json:"line"` // Indice della riga nel contenuto, da 0
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+}
+
+var checklistPattern = regexp.MustCompile(`^(\s*[-*+]\s+\[)([ xX])(\]\s+)(.*)$`)
+
+// ParseChecklist returns the checkbox lines of a note, in order.
+func ParseChecklist(content string) []ChecklistItem {
+	var items []ChecklistItem
+	for i, line := range strings.Split(content, "\n") {
+		m := checklistPattern.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		items = append(items, ChecklistItem{
+			Line: i,
+			Text: strings.TrimSpace(m[4]),
+			Done: m[2] != " ",
+		})
+	}
+	return items
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Daily notes are ordinary notes in a journal folder, titled with their date.
+// They are found again by title, so renaming one or moving it out of the
+// folder makes it a regular note.
+
+const (
+	DefaultDailyFolder = "Journal"
+	DefaultDailyFormat = "2006-01-02"
+)
+
+// DailyConfig says where daily notes live and how they are created.
+type DailyConfig struct {
+	Folder   string
+	Format   string // Formato Go del titolo, es. 2006-01-02
+	Template string // Nome del template, vuoto = nota vuota
+}
+
+func DefaultDailyConfig() DailyConfig {
+	return DailyConfig{Folder: DefaultDailyFolder, Format: DefaultDailyFormat}
+}
+
+func (c DailyConfig) withDefaults() DailyConfig {
+	if c.Folder == "" {
+		c.Folder = DefaultDailyFolder
+	}
+	if c.Format == "" {
+		c.Format = DefaultDailyFormat
+	}
+	return c
+}
+
+// dailyStore is what daily notes are made of: notes in a folder, created
+// from a template.
+type dailyStore interface {
+	NoteStore
+	FolderStore
+	TemplateStore
+}
+
+// DailyNoteID returns the daily note of day, or 0 if there is none.
+func (db *DB) DailyNoteID(ctx context.Context, cfg DailyConfig, day time.Time) (int64, error) {
+	return dailyNoteID(ctx, db, cfg, day)
+}
+
+func dailyNoteID(ctx context.Context, s dailyStore, cfg DailyConfig, day time.Time) (int64, error) {
+	cfg = cfg.withDefaults()
+	folderID, err := folderByPath(ctx, s, cfg.Folder, false)
+	if errors.Is(err, ErrFolderNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	notes, err := s.ListNotesWithArchived(ctx, folderID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find daily note: %w", err)
+	}
+	var id int64
+	title := day.Format(cfg.Format)
+	for _, n := range notes {
+		if n.Title == title && (id == 0 || n.ID < id) {
+			id = n.ID
+		}
+	}
+	return id, nil
+}
+
+// DailyNote returns the daily note of day, creating it (and the journal
+// folder) if needed. The configured template, if any, is expanded with day
+// as the current date.
+func (db *DB) DailyNote(ctx context.Context, cfg DailyConfig, templatesFolder string, day time.Time) (int64, error) {
+	return dailyNote(ctx, db, cfg, templatesFolder, day)
+}
+
+func dailyNote(ctx context.Context, s dailyStore, cfg DailyConfig, templatesFolder string, day time.Time) (int64, error) {
+	cfg = cfg.withDefaults()
+	if id, err := dailyNoteID(ctx, s, cfg, day); err != nil || id != 0 {
+		return id, err
+	}
+
+	folderID, err := folderByPath(ctx, s, cfg.Folder, true)
+	if err != nil {
+		return 0, err
+	}
+
+	tmpl := &Template{}
+	if cfg.Template != "" {
+		if tmpl, err = getTemplate(ctx, s, templatesFolder, cfg.Template); err != nil {
+			return 0, err
+		}
+		// Daily notes always go in the journal folder
+		t := *tmpl
+		t.Folder = ""
+		tmpl = &t
+	}
+
+	vars := TemplateVars{Now: day}
+	if f, err := s.GetFolder(ctx, folderID); err == nil {
+		vars.Folder = f.Title
+	}
+	note, err := s.CreateNoteFromTemplate(ctx, tmpl, day.Format(cfg.Format), folderID, vars)
+	if err != nil {
+		return 0, err
+	}
+	return note.ID, nil
+}
+
+// DailyNoteDays returns the days of month (1-31) that have a daily note,
+// with the note IDs.
+func (db *DB) DailyNoteDays(ctx context.Context, cfg DailyConfig, month time.Time) (map[int]int64, error) {
+	return dailyNoteDays(ctx, db, cfg, month)
+}
+
+func dailyNoteDays(ctx context.Context, s dailyStore, cfg DailyConfig, month time.Time) (map[int]int64, error) {
+	cfg = cfg.withDefaults()
+	days := make(map[int]int64)
+	folderID, err := folderByPath(ctx, s, cfg.Folder, false)
+	if errors.Is(err, ErrFolderNotFound) {
+		return days, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := s.ListNotesWithArchived(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range notes {
+		day, err := time.ParseInLocation(cfg.Format, n.Title, month.Location())
+		if err != nil {
+			continue
+		}
+		if day.Year() == month.Year() && day.Month() == month.Month() {
+			if id, ok := days[day.Day()]; !ok || n.ID < id {
+				days[day.Day()] = n.ID
+			}
+		}
+	}
+	return days, nil
+}
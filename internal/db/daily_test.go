@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDailyNote(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	templates, _ := database.CreateFolder(ctx, DefaultTemplatesFolder, 0)
+	database.CreateNoteInFolder(ctx, "Giornata", "---\ntitle: Altro {{date}}\nfolder: Altrove\n---\n# {{date}} ({{folder}})", nil, templates)
+
+	cfg := DailyConfig{Template: "giornata"}
+	day := time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)
+	if id, err := database.DailyNoteID(ctx, cfg, day); err != nil || id != 0 {
+		t.Fatalf("daily note before creating it: %d, %v", id, err)
+	}
+
+	id, err := database.DailyNote(ctx, cfg, "", day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	note, _ := database.GetNote(ctx, id)
+	if note.Title != "2024-05-03" || note.Content != "# 2024-05-03 (Journal)" {
+		t.Fatalf("daily note %q: %q", note.Title, note.Content)
+	}
+
+	// The template's folder is ignored: the note is in the journal
+	journal, err := database.FolderByPath(ctx, DefaultDailyFolder, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.FolderByPath(ctx, "Altrove", false); err == nil {
+		t.Fatal("folder of the template created")
+	}
+	notes, _ := database.ListNotesWithArchived(ctx, journal)
+	if len(notes) != 1 || notes[0].ID != id {
+		t.Fatalf("journal notes %+v", notes)
+	}
+
+	// The same day gives the same note, another day a new one in the same
+	// folder
+	again, err := database.DailyNote(ctx, cfg, "", day)
+	if err != nil || again != id {
+		t.Fatalf("second daily note %d, %v; want %d", again, err, id)
+	}
+	next, err := database.DailyNote(ctx, DailyConfig{}, "", day.AddDate(0, 0, 1))
+	if err != nil || next == id {
+		t.Fatalf("next day's note %d, %v", next, err)
+	}
+	notes, _ = database.ListNotesWithArchived(ctx, journal)
+	if len(notes) != 2 {
+		t.Fatalf("%d journal notes, want 2", len(notes))
+	}
+	if roots, _ := database.ListFolders(ctx, 0); len(roots) != 2 {
+		t.Fatalf("%d root folders, want 2", len(roots))
+	}
+
+	if _, err := database.DailyNote(ctx, DailyConfig{Template: "Manca"}, "", day.AddDate(0, 0, 2)); err == nil {
+		t.Fatal("daily note created with a missing template")
+	}
+}
+
+func TestDailyNoteDays(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	may := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	// Without a journal there are no days, and no folder is created
+	days, err := database.DailyNoteDays(ctx, DailyConfig{}, may)
+	if err != nil || len(days) != 0 {
+		t.Fatalf("days without a journal %v, %v", days, err)
+	}
+	if roots, _ := database.ListFolders(ctx, 0); len(roots) != 0 {
+		t.Fatalf("%d root folders, want 0", len(roots))
+	}
+
+	cfg := DailyConfig{Folder: "Diario", Format: "02/01/2006"}
+	journal, _ := database.FolderByPath(ctx, "Diario", true)
+	first, _ := database.CreateNoteInFolder(ctx, "03/05/2024", "", nil, journal)
+	database.CreateNoteInFolder(ctx, "03/05/2024", "copia", nil, journal)
+	last, _ := database.CreateNoteInFolder(ctx, "31/05/2024", "", nil, journal)
+	database.CreateNoteInFolder(ctx, "01/06/2024", "", nil, journal)
+	database.CreateNoteInFolder(ctx, "03/05/2023", "", nil, journal)
+	database.CreateNoteInFolder(ctx, "2024-05-04", "", nil, journal)
+	database.CreateNoteInFolder(ctx, "Appunti", "", nil, journal)
+	database.CreateNoteInFolder(ctx, "10/05/2024", "", nil, 0)
+
+	days, err = database.DailyNoteDays(ctx, cfg, may.AddDate(0, 0, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int64{3: first.ID, 31: last.ID}
+	if !reflect.DeepEqual(days, want) {
+		t.Fatalf("days %v, want %v", days, want)
+	}
+	if id, _ := database.DailyNoteID(ctx, cfg, may.AddDate(0, 0, 2)); id != first.ID {
+		t.Fatalf("daily note of May 3rd %d, want %d", id, first.ID)
+	}
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
@@ -10,7 +11,15 @@ import (
 )
 
 type DB struct {
-	conn *sql.DB
+	conn   *sql.DB
+	cipher Cipher
+}
+
+// Cipher encrypts data the database stores on behalf of the caller, such as
+// version history. *crypto.Encryptor satisfies it.
+type Cipher interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(ciphertext string) (string, error)
 }
 
 func New(dbPath string) (*DB, error) {
@@ -19,13 +28,13 @@ func New(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to create db directory: %w", err)
 	}
 
-	conn, err := sql.Open("sqlite3", dbPath)
+	conn, err := sql.Open("sqlite3", sqliteDSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	db := &DB{conn: conn}
-	if err := db.migrate(); err != nil {
+	if err := db.migrate(context.Background()); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
@@ -33,7 +42,14 @@ func New(dbPath string) (*DB, error) {
 	return db, nil
 }
 
-func (db *DB) migrate() error {
+// sqliteDSN opens the database at path in WAL mode, so readers do not block
+// the writer. Writers wait up to five seconds for the lock instead of failing
+// with "database is locked", and transactions take it when they begin.
+func sqliteDSN(path string) string {
+	return path + "?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+}
+
+func (db *DB) migrate(ctx context.Context) error {
 	schema := `
 	CREATE TABLE IF NOT EXISTS notes (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -67,9 +83,110 @@ func (db *DB) migrate() error {
 		tags TEXT,
 		hash TEXT,
 		version_num INTEGER NOT NULL,
+		kind TEXT,
+		base_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(note_id) REFERENCES notes(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS folder_versions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		folder_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		parent_folder_id INTEGER,
+		deleted INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT 'manual',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS snapshot_notes (
+		snapshot_id INTEGER NOT NULL,
+		note_id INTEGER NOT NULL,
+		version_id INTEGER,
+		title TEXT NOT NULL,
+		tags TEXT,
+		parent_folder_id INTEGER,
+		PRIMARY KEY (snapshot_id, note_id),
+		FOREIGN KEY(snapshot_id) REFERENCES snapshots(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS snapshot_folders (
+		snapshot_id INTEGER NOT NULL,
+		folder_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		parent_folder_id INTEGER,
+		PRIMARY KEY (snapshot_id, folder_id),
+		FOREIGN KEY(snapshot_id) REFERENCES snapshots(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE
+	);
+	CREATE TABLE IF NOT EXISTS note_tags (
+		note_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (note_id, tag_id),
+		FOREIGN KEY(note_id) REFERENCES notes(id) ON DELETE CASCADE,
+		FOREIGN KEY(tag_id) REFERENCES tags(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS note_links (
+		source_id INTEGER NOT NULL,
+		target_id INTEGER,
+		target TEXT NOT NULL,
+		FOREIGN KEY(source_id) REFERENCES notes(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS blobs (
+		hash TEXT PRIMARY KEY,
+		size INTEGER NOT NULL,
+		chunks INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS blob_chunks (
+		hash TEXT NOT NULL,
+		seq INTEGER NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (hash, seq)
+	);
+	CREATE TABLE IF NOT EXISTS attachments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		note_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		server_id TEXT,
+		sync_status TEXT DEFAULT 'local',
+		deleted INTEGER DEFAULT 0,
+		FOREIGN KEY(note_id) REFERENCES notes(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS reminders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		note_id INTEGER NOT NULL,
+		payload TEXT NOT NULL,
+		fired INTEGER DEFAULT 0,
+		done INTEGER DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY(note_id) REFERENCES notes(id) ON DELETE CASCADE
 	);
+	CREATE TABLE IF NOT EXISTS note_properties (
+		note_id INTEGER PRIMARY KEY,
+		payload TEXT NOT NULL,
+		FOREIGN KEY(note_id) REFERENCES notes(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS folder_sort (
+		folder_id INTEGER PRIMARY KEY,
+		mode TEXT NOT NULL DEFAULT 'updated',
+		descending INTEGER DEFAULT 1,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS boards (
+		folder_id INTEGER PRIMARY KEY,
+		kind TEXT NOT NULL DEFAULT 'tags',
+		columns TEXT,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
 	CREATE INDEX IF NOT EXISTS idx_notes_title ON notes(title);
 	CREATE INDEX IF NOT EXISTS idx_notes_updated ON notes(updated_at);
 	CREATE INDEX IF NOT EXISTS idx_notes_server_id ON notes(server_id);
@@ -79,30 +196,76 @@ func (db *DB) migrate() error {
 	CREATE INDEX IF NOT EXISTS idx_folders_parent ON folders(parent_folder_id);
 	CREATE INDEX IF NOT EXISTS idx_versions_note ON note_versions(note_id);
 	CREATE INDEX IF NOT EXISTS idx_versions_num ON note_versions(version_num);
+	CREATE INDEX IF NOT EXISTS idx_folder_versions_folder ON folder_versions(folder_id);
+	CREATE INDEX IF NOT EXISTS idx_note_tags_tag ON note_tags(tag_id);
+	CREATE INDEX IF NOT EXISTS idx_note_links_source ON note_links(source_id);
+	CREATE INDEX IF NOT EXISTS idx_note_links_target ON note_links(target_id);
+	CREATE INDEX IF NOT EXISTS idx_attachments_note ON attachments(note_id);
+	CREATE INDEX IF NOT EXISTS idx_attachments_hash ON attachments(hash);
+	CREATE INDEX IF NOT EXISTS idx_reminders_note ON reminders(note_id);
 	`
-	_, err := db.conn.Exec(schema)
+	_, err := db.conn.ExecContext(ctx, schema)
 	if err != nil {
 		return err
 	}
 
 	// Migration: add new columns if they don't exist
 	// Ignore errors as columns may already exist
-	db.conn.Exec(`ALTER TABLE notes ADD COLUMN password TEXT`)
-	db.conn.Exec(`ALTER TABLE notes ADD COLUMN parent_folder_id INTEGER`)
-	db.conn.Exec(`ALTER TABLE notes ADD COLUMN server_id TEXT`)
-	db.conn.Exec(`ALTER TABLE notes ADD COLUMN sync_status TEXT DEFAULT 'local'`)
-	db.conn.Exec(`ALTER TABLE notes ADD COLUMN deleted INTEGER DEFAULT 0`)
-	db.conn.Exec(`ALTER TABLE note_versions ADD COLUMN hash TEXT`)
+	db.conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN password TEXT`)
+	db.conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN parent_folder_id INTEGER`)
+	db.conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN server_id TEXT`)
+	db.conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN sync_status TEXT DEFAULT 'local'`)
+	db.conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN deleted INTEGER DEFAULT 0`)
+	db.conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN archived INTEGER DEFAULT 0`)
+	db.conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN read_only INTEGER DEFAULT 0`)
+	db.conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN pinned INTEGER DEFAULT 0`)
+	db.conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN position INTEGER DEFAULT 0`)
+	db.conn.ExecContext(ctx, `ALTER TABLE folders ADD COLUMN position INTEGER DEFAULT 0`)
+	db.conn.ExecContext(ctx, `ALTER TABLE note_versions ADD COLUMN hash TEXT`)
+	db.conn.ExecContext(ctx, `ALTER TABLE note_versions ADD COLUMN kind TEXT`)
+	db.conn.ExecContext(ctx, `ALTER TABLE note_versions ADD COLUMN base_id INTEGER`)
 
 	// Ensure indexes exist
-	db.conn.Exec(`CREATE INDEX IF NOT EXISTS idx_notes_server_id ON notes(server_id)`)
-	db.conn.Exec(`CREATE INDEX IF NOT EXISTS idx_notes_sync ON notes(sync_status)`)
-	db.conn.Exec(`CREATE INDEX IF NOT EXISTS idx_notes_parent ON notes(parent_folder_id)`)
-	db.conn.Exec(`CREATE INDEX IF NOT EXISTS idx_folders_parent ON folders(parent_folder_id)`)
+	db.conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_notes_server_id ON notes(server_id)`)
+	db.conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_notes_sync ON notes(sync_status)`)
+	db.conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_notes_parent ON notes(parent_folder_id)`)
+	db.conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_folders_parent ON folders(parent_folder_id)`)
+	db.conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_versions_base ON note_versions(base_id)`)
+
+	// Seed folder history with the current folders the first time
+	db.conn.ExecContext(ctx, `
+		INSERT INTO folder_versions (folder_id, title, parent_folder_id, deleted, created_at)
+		SELECT id, title, parent_folder_id, COALESCE(deleted, 0), created_at FROM folders
+		WHERE NOT EXISTS (SELECT 1 FROM folder_versions)
+	`)
+
+	// Build the tag index from the JSON tags of existing notes
+	if err := db.reindexTags(ctx); err != nil {
+		return fmt.Errorf("failed to index tags: %w", err)
+	}
 
 	return nil
 }
 
+// SetCipher sets the cipher used to encrypt version history.
+func (db *DB) SetCipher(c Cipher) {
+	db.cipher = c
+}
+
+func (db *DB) seal(plaintext string) (string, error) {
+	if db.cipher == nil {
+		return plaintext, nil
+	}
+	return db.cipher.Encrypt(plaintext)
+}
+
+func (db *DB) open(ciphertext string) (string, error) {
+	if db.cipher == nil {
+		return ciphertext, nil
+	}
+	return db.cipher.Decrypt(ciphertext)
+}
+
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
@@ -0,0 +1,522 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The doctor looks for the damage ignored migration errors, interrupted
+// syncs, crashes and key changes can leave behind. Diagnose only reads;
+// Repair applies the fixes that cannot lose anything a user could still
+// read: moving orphaned items to the root, resetting sync state and removing
+// rows that belong to notes that no longer exist. Undecryptable content and
+// SQLite corruption are only reported.
+
+const (
+	CheckIntegrity  = "integrity"
+	CheckSchema     = "schema"
+	CheckFolders    = "folders"
+	CheckSync       = "sync"
+	CheckEncryption = "encryption"
+	CheckOrphans    = "orphans"
+)
+
+// Issue is a problem found by Diagnose.
+type Issue struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+	Repair  string `json:"repair,omitempty"` // Cosa fa la riparazione, vuoto se va sistemato a mano
+	fix     func(tx *sql.Tx) error
+}
+
+// DoctorReport is the result of Diagnose.
+type DoctorReport struct {
+	Notes     int     `json:"notes"`
+	Folders   int     `json:"folders"`
+	Versions  int     `json:"versions"`
+	Decrypted bool    `json:"decrypted"` // Contenuti verificati con la chiave
+	Issues    []Issue `json:"issues"`
+}
+
+// Repairable is the number of issues Repair can fix.
+func (r *DoctorReport) Repairable() int {
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.Repair != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *DoctorReport) add(check, message, repair string, fix func(tx *sql.Tx) error) {
+	if fix == nil {
+		repair = ""
+	}
+	r.Issues = append(r.Issues, Issue{Check: check, Message: message, Repair: repair, fix: fix})
+}
+
+// expectedColumns are the columns added by migrations whose errors are
+// ignored, so a failed ALTER TABLE goes unnoticed until a query uses them.
+var expectedColumns = map[string][]string{
+	"notes": {"password", "parent_folder_id", "server_id", "sync_status", "deleted",
+		"archived", "read_only", "pinned", "position"},
+	"folders":       {"position"},
+	"note_versions": {"hash", "kind", "base_id"},
+}
+
+// Diagnose checks the database file, the schema, the folder tree, the sync
+// state and, when a cipher is set, that every encrypted row can be read.
+func (db *DB) Diagnose(ctx context.Context) (*DoctorReport, error) {
+	r := &DoctorReport{Decrypted: db.cipher != nil}
+	db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM notes`).Scan(&r.Notes)
+	db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM folders`).Scan(&r.Folders)
+	db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM note_versions`).Scan(&r.Versions)
+
+	checks := []func(context.Context, *DoctorReport) error{
+		db.checkIntegrity,
+		db.checkSchema,
+		db.checkFolders,
+		db.checkSync,
+		db.checkOrphans,
+	}
+	if db.cipher != nil {
+		checks = append(checks, db.checkEncryption)
+	}
+	for _, check := range checks {
+		if err := check(ctx, r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (db *DB) checkIntegrity(ctx context.Context, r *DoctorReport) error {
+	rows, err := db.conn.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return fmt.Errorf("failed to run integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return err
+		}
+		if result != "ok" {
+			r.add(CheckIntegrity, result, "", nil)
+		}
+	}
+	return rows.Err()
+}
+
+func (db *DB) checkSchema(ctx context.Context, r *DoctorReport) error {
+	tables := make([]string, 0, len(expectedColumns))
+	for table := range expectedColumns {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		rows, err := db.conn.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, table)
+		if err != nil {
+			return fmt.Errorf("failed to read schema: %w", err)
+		}
+		have := make(map[string]bool)
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			have[name] = true
+		}
+		rows.Close()
+
+		for _, column := range expectedColumns[table] {
+			if !have[column] {
+				// Repair runs the migrations again before anything else
+				r.add(CheckSchema, fmt.Sprintf("column %s.%s is missing", table, column),
+					"run the migrations again", func(*sql.Tx) error { return nil })
+			}
+		}
+	}
+	return nil
+}
+
+// intList runs a query returning one integer column.
+func (db *DB) intList(ctx context.Context, query string, args ...interface{}) ([]int64, error) {
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func joinIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (db *DB) checkFolders(ctx context.Context, r *DoctorReport) error {
+	notes, err := db.intList(ctx, `
+		SELECT id FROM notes
+		WHERE COALESCE(parent_folder_id, 0) != 0 AND parent_folder_id NOT IN (SELECT id FROM folders)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to check note folders: %w", err)
+	}
+	if len(notes) > 0 {
+		r.add(CheckFolders, fmt.Sprintf("%d notes are in folders that do not exist (notes %s)", len(notes), joinIDs(notes)),
+			"move them to the root", func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `
+					UPDATE notes SET parent_folder_id = NULL
+					WHERE COALESCE(parent_folder_id, 0) != 0 AND parent_folder_id NOT IN (SELECT id FROM folders)
+				`)
+				return err
+			})
+	}
+
+	folders, err := db.intList(ctx, `
+		SELECT id FROM folders
+		WHERE COALESCE(parent_folder_id, 0) != 0 AND parent_folder_id NOT IN (SELECT id FROM folders)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to check folder parents: %w", err)
+	}
+	if len(folders) > 0 {
+		r.add(CheckFolders, fmt.Sprintf("%d folders have a parent that does not exist (folders %s)", len(folders), joinIDs(folders)),
+			"move them to the root", func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `
+					UPDATE folders SET parent_folder_id = NULL
+					WHERE COALESCE(parent_folder_id, 0) != 0 AND parent_folder_id NOT IN (SELECT id FROM folders)
+				`)
+				return err
+			})
+	}
+
+	// A folder that is its own ancestor never shows up in the tree
+	parents := make(map[int64]int64)
+	rows, err := db.conn.QueryContext(ctx, `SELECT id, COALESCE(parent_folder_id, 0) FROM folders`)
+	if err != nil {
+		return fmt.Errorf("failed to check folder tree: %w", err)
+	}
+	for rows.Next() {
+		var id, parent int64
+		if err := rows.Scan(&id, &parent); err != nil {
+			rows.Close()
+			return err
+		}
+		parents[id] = parent
+	}
+	rows.Close()
+
+	ids := make([]int64, 0, len(parents))
+	for id := range parents {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	reported := make(map[int64]bool)
+	for _, id := range ids {
+		seen := map[int64]bool{id: true}
+		for p := parents[id]; p != 0; p = parents[p] {
+			if p == id {
+				var cycle []int64
+				for c := parents[id]; ; c = parents[c] {
+					cycle = append(cycle, c)
+					if c == id {
+						break
+					}
+				}
+				if !reported[id] {
+					for _, c := range cycle {
+						reported[c] = true
+					}
+					folderID := id
+					r.add(CheckFolders, fmt.Sprintf("folders %s are inside each other", joinIDs(cycle)),
+						fmt.Sprintf("move folder %d to the root", folderID), func(tx *sql.Tx) error {
+							_, err := tx.ExecContext(ctx, `UPDATE folders SET parent_folder_id = NULL WHERE id = ?`, folderID)
+							return err
+						})
+				}
+				break
+			}
+			if seen[p] {
+				break // A cycle further up, reported from one of its folders
+			}
+			seen[p] = true
+		}
+	}
+	return nil
+}
+
+func (db *DB) checkSync(ctx context.Context, r *DoctorReport) error {
+	invalid, err := db.intList(ctx, `
+		SELECT id FROM notes WHERE sync_status IS NULL OR sync_status NOT IN ('local', 'pending', 'synced')
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to check sync state: %w", err)
+	}
+	if len(invalid) > 0 {
+		r.add(CheckSync, fmt.Sprintf("%d notes have an unknown sync state (notes %s)", len(invalid), joinIDs(invalid)),
+			"mark them for upload", func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `
+					UPDATE notes SET sync_status = 'pending'
+					WHERE sync_status IS NULL OR sync_status NOT IN ('local', 'pending', 'synced')
+				`)
+				return err
+			})
+	}
+
+	unsent, err := db.intList(ctx, `
+		SELECT id FROM notes WHERE sync_status = 'synced' AND COALESCE(server_id, '') = ''
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to check sync state: %w", err)
+	}
+	if len(unsent) > 0 {
+		r.add(CheckSync, fmt.Sprintf("%d notes are marked synced but were never uploaded (notes %s)", len(unsent), joinIDs(unsent)),
+			"mark them for upload", func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `UPDATE notes SET sync_status = 'pending' WHERE sync_status = 'synced' AND COALESCE(server_id, '') = ''`)
+				return err
+			})
+	}
+
+	for _, table := range []string{"notes", "attachments"} {
+		if err := db.checkDuplicateServerIDs(ctx, r, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDuplicateServerIDs finds rows sharing a server ID. The most recent row
+// keeps it; the others are uploaded again as new items, so nothing is lost.
+func (db *DB) checkDuplicateServerIDs(ctx context.Context, r *DoctorReport, table string) error {
+	order := "updated_at"
+	if table == "attachments" {
+		order = "created_at"
+	}
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT server_id, id FROM `+table+`
+		WHERE server_id IN (
+			SELECT server_id FROM `+table+` WHERE COALESCE(server_id, '') != ''
+			GROUP BY server_id HAVING COUNT(*) > 1
+		)
+		ORDER BY server_id, `+order+` DESC, id DESC
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to check server ids: %w", err)
+	}
+	defer rows.Close()
+
+	var serverIDs []string
+	groups := make(map[string][]int64)
+	for rows.Next() {
+		var serverID string
+		var id int64
+		if err := rows.Scan(&serverID, &id); err != nil {
+			return err
+		}
+		if _, ok := groups[serverID]; !ok {
+			serverIDs = append(serverIDs, serverID)
+		}
+		groups[serverID] = append(groups[serverID], id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, serverID := range serverIDs {
+		ids := groups[serverID]
+		older := ids[1:]
+		r.add(CheckSync, fmt.Sprintf("%s %s share server id %s", table, joinIDs(ids), serverID),
+			fmt.Sprintf("keep it on %d, upload %s as new", ids[0], joinIDs(older)), func(tx *sql.Tx) error {
+				for _, id := range older {
+					if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET server_id = NULL, sync_status = 'pending' WHERE id = ?`, id); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+	}
+	return nil
+}
+
+// orphanChecks are the rows that belong to a note or folder that no longer
+// exists.
+var orphanChecks = []struct {
+	table, where, what string
+}{
+	{"note_versions", "note_id NOT IN (SELECT id FROM notes)", "versions of notes that no longer exist"},
+	{"note_versions", "kind = 'delta' AND (base_id IS NULL OR base_id NOT IN (SELECT id FROM note_versions))", "versions whose base snapshot is gone"},
+	{"folder_versions", "folder_id NOT IN (SELECT id FROM folders)", "versions of folders that no longer exist"},
+	{"note_tags", "note_id NOT IN (SELECT id FROM notes)", "tag entries of notes that no longer exist"},
+	{"note_links", "source_id NOT IN (SELECT id FROM notes)", "links from notes that no longer exist"},
+	{"attachments", "note_id NOT IN (SELECT id FROM notes)", "attachments of notes that no longer exist"},
+	{"reminders", "note_id NOT IN (SELECT id FROM notes)", "reminders of notes that no longer exist"},
+	{"note_properties", "note_id NOT IN (SELECT id FROM notes)", "properties of notes that no longer exist"},
+}
+
+func (db *DB) checkOrphans(ctx context.Context, r *DoctorReport) error {
+	for _, c := range orphanChecks {
+		var n int
+		if err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+c.table+` WHERE `+c.where).Scan(&n); err != nil {
+			return fmt.Errorf("failed to check %s: %w", c.table, err)
+		}
+		if n == 0 {
+			continue
+		}
+		query := `DELETE FROM ` + c.table + ` WHERE ` + c.where
+		r.add(CheckOrphans, fmt.Sprintf("%d %s (%s)", n, c.what, c.table), "delete them", func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, query)
+			return err
+		})
+	}
+	return nil
+}
+
+func (db *DB) checkEncryption(ctx context.Context, r *DoctorReport) error {
+	rows, err := db.conn.QueryContext(ctx, `SELECT id, title, content FROM notes WHERE content != '' ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("failed to check notes: %w", err)
+	}
+	var unreadable []string
+	for rows.Next() {
+		var id int64
+		var title, content string
+		if err := rows.Scan(&id, &title, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, err := db.open(content); err != nil {
+			unreadable = append(unreadable, fmt.Sprintf("%d %q", id, title))
+		}
+	}
+	rows.Close()
+	for _, note := range unreadable {
+		r.add(CheckEncryption, "note "+note+" cannot be decrypted with this key", "", nil)
+	}
+
+	rows, err = db.conn.QueryContext(ctx, `SELECT id, note_id, content, kind, base_id FROM note_versions ORDER BY note_id, id`)
+	if err != nil {
+		return fmt.Errorf("failed to check versions: %w", err)
+	}
+	broken := make(map[int64]int)
+	var brokenNotes []int64
+	snapshots := make(map[int64]string)
+	for rows.Next() {
+		var id, noteID int64
+		var sv storedVersion
+		if err := rows.Scan(&id, &noteID, &sv.payload, &sv.kind, &sv.baseID); err != nil {
+			rows.Close()
+			return err
+		}
+		// Bases come before their deltas, so a base missing from snapshots
+		// could not be decrypted: the delta cannot be rebuilt either. Asking
+		// decodeVersion would also open a second cursor to look it up
+		_, haveBase := snapshots[sv.baseID.Int64]
+		var plaintext string
+		var err error
+		if sv.kind.String == versionDelta && sv.baseID.Valid && !haveBase {
+			err = ErrWrongKey
+		} else {
+			plaintext, err = db.decodeVersion(ctx, db.conn, sv, snapshots)
+		}
+		if err != nil {
+			if broken[noteID] == 0 {
+				brokenNotes = append(brokenNotes, noteID)
+			}
+			broken[noteID]++
+			continue
+		}
+		if sv.kind.String == versionSnapshot {
+			snapshots[id] = plaintext
+		}
+	}
+	rows.Close()
+	for _, noteID := range brokenNotes {
+		r.add(CheckEncryption, fmt.Sprintf("%d versions of note %d cannot be decrypted", broken[noteID], noteID), "", nil)
+	}
+
+	for _, table := range []string{"reminders", "note_properties"} {
+		payloads, err := db.conn.QueryContext(ctx, `SELECT note_id, payload FROM `+table)
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", table, err)
+		}
+		var notes []int64
+		for payloads.Next() {
+			var noteID int64
+			var payload string
+			if err := payloads.Scan(&noteID, &payload); err != nil {
+				payloads.Close()
+				return err
+			}
+			if _, err := db.open(payload); err != nil {
+				notes = append(notes, noteID)
+			}
+		}
+		payloads.Close()
+		if len(notes) > 0 {
+			r.add(CheckEncryption, fmt.Sprintf("%d %s rows cannot be decrypted (notes %s)", len(notes), table, joinIDs(notes)), "", nil)
+		}
+	}
+	return nil
+}
+
+// Repair applies the fixes of the repairable issues in r, all in one
+// transaction after running the migrations again if columns are missing.
+// It returns the number of issues fixed.
+func (db *DB) Repair(ctx context.Context, r *DoctorReport) (int, error) {
+	fixed := 0
+	for _, issue := range r.Issues {
+		if issue.Check == CheckSchema && issue.fix != nil {
+			if err := db.migrate(ctx); err != nil {
+				return 0, fmt.Errorf("failed to migrate database: %w", err)
+			}
+			break
+		}
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, issue := range r.Issues {
+		if issue.fix == nil {
+			continue
+		}
+		if err := issue.fix(tx); err != nil {
+			return 0, fmt.Errorf("failed to repair %q: %w", issue.Message, err)
+		}
+		fixed++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// Blobs of removed attachments
+	if _, err := db.PurgeOrphanBlobs(ctx); err != nil {
+		return fixed, err
+	}
+	return fixed, nil
+}
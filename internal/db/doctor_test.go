@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRepairMovesStrayFoldersToRoot(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	stray, _ := database.CreateFolder(ctx, "Orfana", 0)
+	a, _ := database.CreateFolder(ctx, "A", 0)
+	b, _ := database.CreateFolder(ctx, "B", a)
+	database.conn.Exec(`UPDATE folders SET parent_folder_id = 999 WHERE id = ?`, stray)
+	database.conn.Exec(`UPDATE folders SET parent_folder_id = ? WHERE id = ?`, b, a)
+
+	report, err := database.Diagnose(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Repair(ctx, report); err != nil {
+		t.Fatal(err)
+	}
+
+	// Root folders have no parent, as the ones created there
+	var roots int
+	database.conn.QueryRow(`SELECT COUNT(*) FROM folders WHERE parent_folder_id IS NULL`).Scan(&roots)
+	if roots != 2 {
+		t.Fatalf("%d root folders after the repair, want 2", roots)
+	}
+	if after, _ := database.Diagnose(ctx); len(after.Issues) != 0 {
+		t.Fatalf("issues left after the repair: %+v", after.Issues)
+	}
+}
+
+func TestDeltasOfUnreadableSnapshotsAreBroken(t *testing.T) {
+	ctx := context.Background()
+	database, note := newEncryptedTestDB(t, "password")
+	header := strings.Repeat("intestazione del diario ", 10)
+	for _, content := range []string{header, header + "\nuno", header + "\nuno\ndue"} {
+		if err := database.SaveNoteVersion(ctx, note.ID, "Nota", content, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if kinds := strings.Join(versionKinds(t, database, note.ID), ","); kinds != "snapshot,delta,delta" {
+		t.Fatalf("unexpected storage kinds %s", kinds)
+	}
+	database.conn.Exec(`UPDATE note_versions SET content = 'rovinato' WHERE note_id = ? AND kind = 'snapshot'`, note.ID)
+
+	report, err := database.Diagnose(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("3 versions of note %d cannot be decrypted", note.ID)
+	for _, issue := range report.Issues {
+		if issue.Check == CheckEncryption && issue.Message == want {
+			return
+		}
+	}
+	t.Fatalf("issues %+v, want %q", report.Issues, want)
+}
@@ -0,0 +1,303 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The graph connects notes, folders and tags. A note points to the notes it
+// links with [[...]], to its folder and to its tags; folders and nested tags
+// point to their parent. It is built from the local index only: link targets
+// are resolved IDs and titles, folder names and tags are already clear text,
+// so nothing has to leave the vault to draw it.
+
+// Graph node types
+const (
+	GraphNote   = "note"
+	GraphFolder = "folder"
+	GraphTag    = "tag"
+)
+
+// Graph edge kinds
+const (
+	EdgeLink   = "link"   // nota -> nota collegata
+	EdgeFolder = "folder" // nota -> cartella che la contiene
+	EdgeTag    = "tag"    // nota -> tag
+	EdgeParent = "parent" // cartella/tag -> genitore
+)
+
+type GraphNode struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	ID    int64  `json:"id,omitempty"`
+	Label string `json:"label"`
+}
+
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// GraphNeighbor is a node adjacent to another, with the edge between them.
+// Outgoing is true when the edge goes from the other node to Node.
+type GraphNeighbor struct {
+	Node     GraphNode
+	Kind     string
+	Outgoing bool
+}
+
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+
+	index map[string]int
+	adj   map[string][]GraphNeighbor
+}
+
+func NoteKey(id int64) string   { return fmt.Sprintf("note:%d", id) }
+func FolderKey(id int64) string { return fmt.Sprintf("folder:%d", id) }
+func TagKey(name string) string { return "tag:" + name }
+
+func newGraph() *Graph {
+	return &Graph{index: make(map[string]int), adj: make(map[string][]GraphNeighbor)}
+}
+
+func (g *Graph) addNode(n GraphNode) {
+	if _, ok := g.index[n.Key]; ok {
+		return
+	}
+	g.index[n.Key] = len(g.Nodes)
+	g.Nodes = append(g.Nodes, n)
+}
+
+func (g *Graph) addEdge(from, to, kind string) {
+	if from == to {
+		return
+	}
+	_, okFrom := g.index[from]
+	_, okTo := g.index[to]
+	if !okFrom || !okTo {
+		return
+	}
+	for _, n := range g.adj[from] {
+		if n.Node.Key == to && n.Kind == kind && n.Outgoing {
+			return
+		}
+	}
+	g.Edges = append(g.Edges, GraphEdge{From: from, To: to, Kind: kind})
+	g.adj[from] = append(g.adj[from], GraphNeighbor{Node: g.Nodes[g.index[to]], Kind: kind, Outgoing: true})
+	g.adj[to] = append(g.adj[to], GraphNeighbor{Node: g.Nodes[g.index[from]], Kind: kind})
+}
+
+// addTag connects a note to a tag, adding the tag and the parents of a
+// nested tag.
+func (g *Graph) addTag(noteID int64, name string) {
+	for child := name; ; {
+		g.addNode(GraphNode{Key: TagKey(child), Type: GraphTag, Label: child})
+		i := strings.LastIndex(child, "/")
+		if i < 0 {
+			break
+		}
+		parent := child[:i]
+		g.addNode(GraphNode{Key: TagKey(parent), Type: GraphTag, Label: parent})
+		g.addEdge(TagKey(child), TagKey(parent), EdgeParent)
+		child = parent
+	}
+	g.addEdge(NoteKey(noteID), TagKey(name), EdgeTag)
+}
+
+// Node returns the node with the given key.
+func (g *Graph) Node(key string) (GraphNode, bool) {
+	i, ok := g.index[key]
+	if !ok {
+		return GraphNode{}, false
+	}
+	return g.Nodes[i], true
+}
+
+// Neighbors returns the nodes adjacent to key: folders first, then notes and
+// tags, each sorted by label.
+func (g *Graph) Neighbors(key string) []GraphNeighbor {
+	neighbors := append([]GraphNeighbor(nil), g.adj[key]...)
+	order := map[string]int{GraphFolder: 0, GraphNote: 1, GraphTag: 2}
+	sort.SliceStable(neighbors, func(i, j int) bool {
+		a, b := neighbors[i].Node, neighbors[j].Node
+		if order[a.Type] != order[b.Type] {
+			return order[a.Type] < order[b.Type]
+		}
+		return strings.ToLower(a.Label) < strings.ToLower(b.Label)
+	})
+	return neighbors
+}
+
+// Neighborhood returns the subgraph of the nodes at most depth edges away
+// from key, with the edges between them.
+func (g *Graph) Neighborhood(key string, depth int) *Graph {
+	sub := newGraph()
+	if _, ok := g.index[key]; !ok {
+		return sub
+	}
+
+	dist := map[string]int{key: 0}
+	queue := []string{key}
+	for len(queue) > 0 {
+		k := queue[0]
+		queue = queue[1:]
+		if dist[k] >= depth {
+			continue
+		}
+		for _, n := range g.Neighbors(k) {
+			if _, seen := dist[n.Node.Key]; !seen {
+				dist[n.Node.Key] = dist[k] + 1
+				queue = append(queue, n.Node.Key)
+			}
+		}
+	}
+
+	for _, n := range g.Nodes {
+		if _, ok := dist[n.Key]; ok {
+			sub.addNode(n)
+		}
+	}
+	for _, e := range g.Edges {
+		sub.addEdge(e.From, e.To, e.Kind)
+	}
+	return sub
+}
+
+// DOT renders the graph in Graphviz format.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph jotaku {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		label, shape := n.Label, "box"
+		switch n.Type {
+		case GraphFolder:
+			shape = "folder"
+		case GraphTag:
+			label, shape = "#"+n.Label, "ellipse"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s];\n", strconv.Quote(n.Key), strconv.Quote(label), shape)
+	}
+	for _, e := range g.Edges {
+		style := "solid"
+		if e.Kind != EdgeLink {
+			style = "dashed"
+		}
+		fmt.Fprintf(&b, "  %s -> %s [label=%s, style=%s];\n", strconv.Quote(e.From), strconv.Quote(e.To), strconv.Quote(e.Kind), style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// VaultGraph builds the graph of all live notes, folders and tags.
+func (db *DB) VaultGraph(ctx context.Context) (*Graph, error) {
+	g := newGraph()
+
+	// Folders
+	type parentRef struct {
+		key    string
+		parent int64
+	}
+	var folderParents []parentRef
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, title, COALESCE(parent_folder_id, 0) FROM folders
+		WHERE deleted = 0 OR deleted IS NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load folders: %w", err)
+	}
+	for rows.Next() {
+		var id, parent int64
+		var title string
+		if err := rows.Scan(&id, &title, &parent); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		g.addNode(GraphNode{Key: FolderKey(id), Type: GraphFolder, ID: id, Label: title})
+		if parent != 0 {
+			folderParents = append(folderParents, parentRef{FolderKey(id), parent})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Notes
+	var noteFolders []parentRef
+	rows, err = db.conn.QueryContext(ctx, `
+		SELECT id, title, COALESCE(parent_folder_id, 0) FROM notes
+		WHERE deleted = 0 OR deleted IS NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notes: %w", err)
+	}
+	for rows.Next() {
+		var id, parent int64
+		var title string
+		if err := rows.Scan(&id, &title, &parent); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		g.addNode(GraphNode{Key: NoteKey(id), Type: GraphNote, ID: id, Label: title})
+		if parent != 0 {
+			noteFolders = append(noteFolders, parentRef{NoteKey(id), parent})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, p := range folderParents {
+		g.addEdge(p.key, FolderKey(p.parent), EdgeParent)
+	}
+	for _, p := range noteFolders {
+		g.addEdge(p.key, FolderKey(p.parent), EdgeFolder)
+	}
+
+	// Tags, with the parents of nested tags
+	rows, err = db.conn.QueryContext(ctx, `
+		SELECT nt.note_id, t.name FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tags: %w", err)
+	}
+	for rows.Next() {
+		var noteID int64
+		var name string
+		if err := rows.Scan(&noteID, &name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if _, ok := g.index[NoteKey(noteID)]; !ok {
+			continue
+		}
+		g.addTag(noteID, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Resolved wiki links
+	rows, err = db.conn.QueryContext(ctx, `SELECT DISTINCT source_id, target_id FROM note_links WHERE target_id IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load links: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var source, target int64
+		if err := rows.Scan(&source, &target); err != nil {
+			return nil, err
+		}
+		g.addEdge(NoteKey(source), NoteKey(target), EdgeLink)
+	}
+	return g, rows.Err()
+}
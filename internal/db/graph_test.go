@@ -0,0 +1,192 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// graphKeys returns the node keys and the edges of g, sorted.
+func graphKeys(g *Graph) ([]string, []string) {
+	var nodes, edges []string
+	for _, n := range g.Nodes {
+		nodes = append(nodes, n.Key)
+	}
+	for _, e := range g.Edges {
+		edges = append(edges, e.From+" -"+e.Kind+"-> "+e.To)
+	}
+	sort.Strings(nodes)
+	sort.Strings(edges)
+	return nodes, edges
+}
+
+func TestVaultGraph(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	work, _ := database.CreateFolder(ctx, "Lavoro", 0)
+	clients, _ := database.CreateFolder(ctx, "Clienti", work)
+	acme, _ := database.CreateNoteInFolder(ctx, "Acme", "vedi [[Beta]] e [[Nessuna]]", []string{"work/acme"}, clients)
+	beta, _ := database.CreateNoteInFolder(ctx, "Beta", "poi [[Gamma]]", nil, 0)
+	gamma, _ := database.CreateNoteInFolder(ctx, "Gamma", "", []string{"work"}, 0)
+	gone, _ := database.CreateNoteInFolder(ctx, "Vecchia", "vedi [[Acme]]", []string{"old"}, 0)
+	database.DeleteNote(ctx, gone.ID)
+
+	g, err := database.VaultGraph(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, edges := graphKeys(g)
+	wantNodes := []string{
+		FolderKey(clients), FolderKey(work),
+		NoteKey(acme.ID), NoteKey(beta.ID), NoteKey(gamma.ID),
+		TagKey("work"), TagKey("work/acme"),
+	}
+	sort.Strings(wantNodes)
+	if !reflect.DeepEqual(nodes, wantNodes) {
+		t.Fatalf("nodes %q, want %q", nodes, wantNodes)
+	}
+	wantEdges := []string{
+		FolderKey(clients) + " -parent-> " + FolderKey(work),
+		NoteKey(acme.ID) + " -folder-> " + FolderKey(clients),
+		NoteKey(acme.ID) + " -link-> " + NoteKey(beta.ID),
+		NoteKey(acme.ID) + " -tag-> " + TagKey("work/acme"),
+		NoteKey(beta.ID) + " -link-> " + NoteKey(gamma.ID),
+		NoteKey(gamma.ID) + " -tag-> " + TagKey("work"),
+		TagKey("work/acme") + " -parent-> " + TagKey("work"),
+	}
+	sort.Strings(wantEdges)
+	if !reflect.DeepEqual(edges, wantEdges) {
+		t.Fatalf("edges %q, want %q", edges, wantEdges)
+	}
+
+	// Neighbours list folders, then notes, then tags
+	var labels []string
+	for _, n := range g.Neighbors(NoteKey(acme.ID)) {
+		labels = append(labels, n.Node.Label)
+	}
+	if !reflect.DeepEqual(labels, []string{"Clienti", "Beta", "work/acme"}) {
+		t.Fatalf("neighbours of Acme %q", labels)
+	}
+}
+
+func TestNeighborhood(t *testing.T) {
+	g := newGraph()
+	for _, n := range []GraphNode{
+		{Key: NoteKey(1), Type: GraphNote, ID: 1, Label: "Acme"},
+		{Key: NoteKey(2), Type: GraphNote, ID: 2, Label: "Beta"},
+		{Key: NoteKey(3), Type: GraphNote, ID: 3, Label: "Gamma"},
+		{Key: FolderKey(10), Type: GraphFolder, ID: 10, Label: "Clienti"},
+		{Key: FolderKey(11), Type: GraphFolder, ID: 11, Label: "Lavoro"},
+	} {
+		g.addNode(n)
+	}
+	g.addEdge(NoteKey(1), NoteKey(2), EdgeLink)
+	g.addEdge(NoteKey(2), NoteKey(3), EdgeLink)
+	g.addEdge(NoteKey(3), NoteKey(1), EdgeLink)
+	g.addEdge(NoteKey(1), FolderKey(10), EdgeFolder)
+	g.addEdge(FolderKey(10), FolderKey(11), EdgeParent)
+	g.addTag(3, "work/acme")
+
+	// Depth 1: Gamma links to Acme, so both Beta and Gamma are kept, and
+	// so is the link between them
+	nodes, edges := graphKeys(g.Neighborhood(NoteKey(1), 1))
+	wantNodes := []string{FolderKey(10), NoteKey(1), NoteKey(2), NoteKey(3)}
+	sort.Strings(wantNodes)
+	if !reflect.DeepEqual(nodes, wantNodes) {
+		t.Fatalf("depth 1 nodes %q, want %q", nodes, wantNodes)
+	}
+	wantEdges := []string{
+		NoteKey(1) + " -folder-> " + FolderKey(10),
+		NoteKey(1) + " -link-> " + NoteKey(2),
+		NoteKey(2) + " -link-> " + NoteKey(3),
+		NoteKey(3) + " -link-> " + NoteKey(1),
+	}
+	sort.Strings(wantEdges)
+	if !reflect.DeepEqual(edges, wantEdges) {
+		t.Fatalf("depth 1 edges %q, want %q", edges, wantEdges)
+	}
+
+	// Depth 2 reaches the parent folder and the tag, but not the parent tag
+	nodes, _ = graphKeys(g.Neighborhood(NoteKey(1), 2))
+	wantNodes = append(wantNodes, FolderKey(11), TagKey("work/acme"))
+	sort.Strings(wantNodes)
+	if !reflect.DeepEqual(nodes, wantNodes) {
+		t.Fatalf("depth 2 nodes %q, want %q", nodes, wantNodes)
+	}
+
+	if sub := g.Neighborhood(NoteKey(1), 0); len(sub.Nodes) != 1 || len(sub.Edges) != 0 {
+		t.Fatalf("depth 0: %+v", sub)
+	}
+	if sub := g.Neighborhood(NoteKey(99), 3); len(sub.Nodes) != 0 {
+		t.Fatalf("neighbourhood of a missing node: %+v", sub)
+	}
+}
+
+func TestAddNestedTag(t *testing.T) {
+	g := newGraph()
+	g.addNode(GraphNode{Key: NoteKey(1), Type: GraphNote, ID: 1, Label: "Acme"})
+	g.addNode(GraphNode{Key: NoteKey(2), Type: GraphNote, ID: 2, Label: "Beta"})
+	g.addTag(1, "lavoro/clienti/acme")
+	g.addTag(2, "lavoro/clienti")
+
+	nodes, edges := graphKeys(g)
+	want := []string{NoteKey(1), NoteKey(2), TagKey("lavoro"), TagKey("lavoro/clienti"), TagKey("lavoro/clienti/acme")}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Fatalf("nodes %q, want %q", nodes, want)
+	}
+	// The parent edges are added once, however many notes use the tags
+	want = []string{
+		NoteKey(1) + " -tag-> " + TagKey("lavoro/clienti/acme"),
+		NoteKey(2) + " -tag-> " + TagKey("lavoro/clienti"),
+		TagKey("lavoro/clienti") + " -parent-> " + TagKey("lavoro"),
+		TagKey("lavoro/clienti/acme") + " -parent-> " + TagKey("lavoro/clienti"),
+	}
+	if !reflect.DeepEqual(edges, want) {
+		t.Fatalf("edges %q, want %q", edges, want)
+	}
+}
+
+func TestGraphExport(t *testing.T) {
+	g := newGraph()
+	g.addNode(GraphNode{Key: NoteKey(1), Type: GraphNote, ID: 1, Label: `Nota "uno"`})
+	g.addNode(GraphNode{Key: NoteKey(2), Type: GraphNote, ID: 2, Label: "Due"})
+	g.addNode(GraphNode{Key: FolderKey(3), Type: GraphFolder, ID: 3, Label: "Cartella"})
+	g.addEdge(NoteKey(1), NoteKey(2), EdgeLink)
+	g.addEdge(NoteKey(1), FolderKey(3), EdgeFolder)
+	g.addTag(2, "idee")
+
+	want := `digraph jotaku {
+  rankdir=LR;
+  "note:1" [label="Nota \"uno\"", shape=box];
+  "note:2" [label="Due", shape=box];
+  "folder:3" [label="Cartella", shape=folder];
+  "tag:idee" [label="#idee", shape=ellipse];
+  "note:1" -> "note:2" [label="link", style=solid];
+  "note:1" -> "folder:3" [label="folder", style=dashed];
+  "note:2" -> "tag:idee" [label="tag", style=dashed];
+}
+`
+	if got := g.DOT(); got != want {
+		t.Fatalf("DOT:\n%s\nwant:\n%s", got, want)
+	}
+
+	data, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON := `{"nodes":[` +
+		`{"key":"note:1","type":"note","id":1,"label":"Nota \"uno\""},` +
+		`{"key":"note:2","type":"note","id":2,"label":"Due"},` +
+		`{"key":"folder:3","type":"folder","id":3,"label":"Cartella"},` +
+		`{"key":"tag:idee","type":"tag","label":"idee"}],` +
+		`"edges":[` +
+		`{"from":"note:1","to":"note:2","kind":"link"},` +
+		`{"from":"note:1","to":"folder:3","kind":"folder"},` +
+		`{"from":"note:2","to":"tag:idee","kind":"tag"}]}`
+	if string(data) != wantJSON {
+		t.Fatalf("JSON:\n%s\nwant:\n%s", data, wantJSON)
+	}
+}
@@ -0,0 +1,415 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notes link to each other with [[Note Title]], [[Note Title|label]] or
+// [[id:42]]. Links are parsed from the decrypted content whenever a note is
+// written and kept in note_links. The link text comes from note content, so
+// it is stored encrypted; resolved links also keep the target note ID.
+
+var linkPattern = regexp.MustCompile(`\[\[([^\[\]\n]+?)\]\]`)
+
+// Link is a wiki link found in note content. Start and End are byte offsets
+// of the whole [[...]] in the content.
+type Link struct {
+	Target string // Titolo, oppure "id:N"
+	Label  string
+	NoteID int64 // Impostato per i link [[id:N]]
+	Start  int
+	End    int
+}
+
+// BrokenLink is a link whose target note does not exist.
+type BrokenLink struct {
+	SourceID    int64  `json:"source_id"`
+	SourceTitle string `json:"source_title"`
+	Target      string `json:"target"`
+}
+
+// ParseLinks returns the wiki links in content, in order.
+func ParseLinks(content string) []Link {
+	var links []Link
+	for _, m := range linkPattern.FindAllStringSubmatchIndex(content, -1) {
+		inner := content[m[2]:m[3]]
+		l := Link{Start: m[0], End: m[1]}
+		if i := strings.Index(inner, "|"); i >= 0 {
+			l.Label = strings.TrimSpace(inner[i+1:])
+			inner = inner[:i]
+		}
+		l.Target = strings.TrimSpace(inner)
+		if l.Target == "" {
+			continue
+		}
+		if strings.HasPrefix(l.Target, "id:") {
+			if id, err := strconv.ParseInt(strings.TrimSpace(l.Target[3:]), 10, 64); err == nil {
+				l.NoteID = id
+			}
+		}
+		if l.Label == "" {
+			l.Label = l.Target
+		}
+		links = append(links, l)
+	}
+	return links
+}
+
+// resolveLink returns the ID of the live note a link points to, or 0.
+func resolveLink(ctx context.Context, conn querier, l Link) (int64, error) {
+	var id int64
+	var err error
+	if l.NoteID != 0 {
+		err = conn.QueryRowContext(ctx, `
+			SELECT id FROM notes WHERE id = ? AND (deleted = 0 OR deleted IS NULL)
+		`, l.NoteID).Scan(&id)
+	} else {
+		err = conn.QueryRowContext(ctx, `
+			SELECT id FROM notes
+			WHERE lower(title) = lower(?) AND (deleted = 0 OR deleted IS NULL)
+			ORDER BY updated_at DESC LIMIT 1
+		`, l.Target).Scan(&id)
+	}
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// ResolveLink returns the ID of the note a link points to, or 0 when the
+// link is broken.
+func (db *DB) ResolveLink(ctx context.Context, l Link) (int64, error) {
+	return resolveLink(ctx, db.conn, l)
+}
+
+// indexNoteLinks replaces the link index entries of a note.
+func (db *DB) indexNoteLinks(ctx context.Context, conn querier, noteID int64, plaintext string) error {
+	if _, err := conn.ExecContext(ctx, `DELETE FROM note_links WHERE source_id = ?`, noteID); err != nil {
+		return fmt.Errorf("failed to index links: %w", err)
+	}
+	for _, l := range ParseLinks(plaintext) {
+		targetID, err := resolveLink(ctx, conn, l)
+		if err != nil {
+			return fmt.Errorf("failed to resolve link: %w", err)
+		}
+		target, err := db.seal(l.Target)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `
+			INSERT INTO note_links (source_id, target_id, target) VALUES (?, ?, ?)
+		`, noteID, nullID(targetID), target); err != nil {
+			return fmt.Errorf("failed to index links: %w", err)
+		}
+	}
+	return nil
+}
+
+// indexStoredContent indexes the links and properties of a note from its
+// stored (encrypted) content. Notes the cipher cannot read keep their
+// previous index entries.
+func (db *DB) indexStoredContent(ctx context.Context, conn querier, noteID int64, stored string) error {
+	plaintext, err := db.open(stored)
+	if err != nil {
+		return nil
+	}
+	return db.indexNoteContent(ctx, conn, noteID, plaintext)
+}
+
+func (db *DB) indexNoteContent(ctx context.Context, conn querier, noteID int64, plaintext string) error {
+	if err := db.indexNoteLinks(ctx, conn, noteID, plaintext); err != nil {
+		return err
+	}
+	return db.indexNoteProperties(ctx, conn, noteID, plaintext)
+}
+
+// brokenLink is an unresolved entry of the link index.
+type brokenLink struct {
+	rowID int64
+	link  Link
+}
+
+// brokenLinks returns the unresolved links the cipher can read. Their
+// targets are sealed, so they are all opened: callers run it once per
+// change, not once per note.
+func (db *DB) brokenLinks(ctx context.Context, conn querier) ([]brokenLink, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT rowid, target FROM note_links WHERE target_id IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var broken []brokenLink
+	for rows.Next() {
+		var rowID int64
+		var sealed string
+		if err := rows.Scan(&rowID, &sealed); err != nil {
+			return nil, err
+		}
+		target, err := db.open(sealed)
+		if err != nil {
+			continue
+		}
+		if links := ParseLinks("[[" + target + "]]"); len(links) > 0 {
+			broken = append(broken, brokenLink{rowID: rowID, link: links[0]})
+		}
+	}
+	return broken, rows.Err()
+}
+
+// resolveLinksTo points the unresolved links to title, or to the ID of the
+// note, at a note just created or renamed. Being the latest note written, it
+// is the one resolveLink would pick among notes with the same title.
+func (db *DB) resolveLinksTo(ctx context.Context, conn querier, id int64, title string) error {
+	broken, err := db.brokenLinks(ctx, conn)
+	if err != nil {
+		return err
+	}
+	for _, b := range broken {
+		if b.link.NoteID != id && (b.link.NoteID != 0 || !strings.EqualFold(b.link.Target, title)) {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, `UPDATE note_links SET target_id = ? WHERE rowid = ?`, id, b.rowID); err != nil {
+			return fmt.Errorf("failed to resolve link: %w", err)
+		}
+	}
+	return nil
+}
+
+// ResolveBrokenLinks points unresolved links at the notes received since
+// they were indexed. Sync calls it once after downloading, rather than once
+// per note.
+func (db *DB) ResolveBrokenLinks(ctx context.Context) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	broken, err := db.brokenLinks(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, b := range broken {
+		id, err := resolveLink(ctx, tx, b.link)
+		if err != nil {
+			return fmt.Errorf("failed to resolve link: %w", err)
+		}
+		if id == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE note_links SET target_id = ? WHERE rowid = ?`, id, b.rowID); err != nil {
+			return fmt.Errorf("failed to resolve link: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// IndexLinks rebuilds the link index of every note when it is empty, e.g.
+// the first time a database is opened by a version with links. It needs the
+// cipher, so it runs after SetCipher.
+func (db *DB) IndexLinks(ctx context.Context) error {
+	var indexed int
+	if err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM note_links`).Scan(&indexed); err != nil || indexed > 0 {
+		return err
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT id, content FROM notes WHERE deleted = 0 OR deleted IS NULL`)
+	if err != nil {
+		return err
+	}
+	contents := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		contents[id] = content
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for id, content := range contents {
+		if err := db.indexStoredContent(ctx, tx, id, content); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetBacklinks returns the live notes that link to noteID.
+func (db *DB) GetBacklinks(ctx context.Context, noteID int64) ([]NoteListItem, error) {
+	return getBacklinks(ctx, db.conn, noteID)
+}
+
+func getBacklinks(ctx context.Context, conn querier, noteID int64) ([]NoteListItem, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT DISTINCT n.id, n.title, n.updated_at, COALESCE(n.sync_status, 'local')
+		FROM note_links l
+		JOIN notes n ON n.id = l.source_id
+		WHERE l.target_id = ? AND l.source_id != ? AND (n.deleted = 0 OR n.deleted IS NULL)
+		ORDER BY n.title ASC
+	`, noteID, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backlinks: %w", err)
+	}
+	defer rows.Close()
+
+	var notes []NoteListItem
+	for rows.Next() {
+		var n NoteListItem
+		var syncStatus string
+		if err := rows.Scan(&n.ID, &n.Title, &n.UpdatedAt, &syncStatus); err != nil {
+			return nil, fmt.Errorf("failed to scan note: %w", err)
+		}
+		n.SyncStatus = SyncStatus(syncStatus)
+		n.Type = "note"
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// BrokenLinks lists the links of live notes whose target does not exist or
+// was deleted.
+func (db *DB) BrokenLinks(ctx context.Context) ([]BrokenLink, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT s.id, s.title, l.target
+		FROM note_links l
+		JOIN notes s ON s.id = l.source_id
+		LEFT JOIN notes t ON t.id = l.target_id
+		WHERE (s.deleted = 0 OR s.deleted IS NULL)
+		  AND (l.target_id IS NULL OR t.id IS NULL OR t.deleted = 1)
+		ORDER BY s.title ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list broken links: %w", err)
+	}
+	defer rows.Close()
+
+	var broken []BrokenLink
+	for rows.Next() {
+		var b BrokenLink
+		var sealed string
+		if err := rows.Scan(&b.SourceID, &b.SourceTitle, &sealed); err != nil {
+			return nil, err
+		}
+		if b.Target, err = db.open(sealed); err != nil {
+			b.Target = "?"
+		}
+		broken = append(broken, b)
+	}
+	return broken, rows.Err()
+}
+
+// rewriteLinks replaces title links to oldTitle in content with newTitle,
+// keeping labels. ID links are left alone.
+func rewriteLinks(content, oldTitle, newTitle string) (string, bool) {
+	links := ParseLinks(content)
+	var b strings.Builder
+	changed := false
+	last := 0
+	for _, l := range links {
+		if l.NoteID != 0 || !strings.EqualFold(l.Target, oldTitle) {
+			continue
+		}
+		b.WriteString(content[last:l.Start])
+		if l.Label != l.Target {
+			b.WriteString("[[" + newTitle + "|" + l.Label + "]]")
+		} else {
+			b.WriteString("[[" + newTitle + "]]")
+		}
+		last = l.End
+		changed = true
+	}
+	if !changed {
+		return content, false
+	}
+	b.WriteString(content[last:])
+	return b.String(), true
+}
+
+// RenameNote changes the title of a note and rewrites the [[Title]] links
+// in the notes that point to it. Each rewritten note gets a new version and
+// is marked for sync; read-only notes are left as they are, and cannot be
+// renamed themselves. It returns the number of notes rewritten.
+func (db *DB) RenameNote(ctx context.Context, id int64, newTitle string) (int, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Backlinks follow note IDs, so the rename does not change them
+	sources, err := getBacklinks(ctx, tx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	note, err := getNote(ctx, tx, id)
+	if err != nil {
+		return 0, err
+	}
+	if note == nil {
+		return 0, fmt.Errorf("note %d not found", id)
+	}
+	oldTitle := note.Title
+	if err := checkWritable(ctx, tx, id); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE notes SET title = ?, updated_at = ?, sync_status = 'pending' WHERE id = ?
+	`, newTitle, time.Now(), id); err != nil {
+		return 0, fmt.Errorf("failed to rename note: %w", err)
+	}
+
+	rewritten := 0
+	for _, s := range sources {
+		// Locked notes keep their links as written
+		src, err := getNote(ctx, tx, s.ID)
+		if err != nil || src == nil || src.ReadOnly {
+			continue
+		}
+		plaintext, err := db.open(src.Content)
+		if err != nil {
+			continue
+		}
+		updated, changed := rewriteLinks(plaintext, oldTitle, newTitle)
+		if !changed {
+			continue
+		}
+
+		if err := db.saveNoteVersion(ctx, tx, src.ID, src.Title, updated, src.Tags); err != nil {
+			return 0, err
+		}
+		sealed, err := db.seal(updated)
+		if err != nil {
+			return 0, err
+		}
+		if err := db.updateNote(ctx, tx, src.ID, src.Title, sealed, src.Tags); err != nil {
+			return 0, err
+		}
+		rewritten++
+	}
+
+	// Links that were waiting for a note with the new title now resolve
+	if err := db.resolveLinksTo(ctx, tx, id, newTitle); err != nil {
+		return 0, err
+	}
+	return rewritten, tx.Commit()
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// brokenTargets returns the targets of the broken links, in order.
+func brokenTargets(t *testing.T, database *DB) []string {
+	t.Helper()
+	broken, err := database.BrokenLinks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []string
+	for _, b := range broken {
+		targets = append(targets, b.Target)
+	}
+	return targets
+}
+
+func TestLinksResolveToNewAndRenamedNotes(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	src, _ := database.CreateNoteInFolder(ctx, "Indice", "[[Acme]] [[beta]] [[Gamma]]", nil, 0)
+	if got := brokenTargets(t, database); !reflect.DeepEqual(got, []string{"Acme", "beta", "Gamma"}) {
+		t.Fatalf("broken links %q", got)
+	}
+
+	// Creating a note resolves the links to its title only
+	acme, _ := database.CreateNoteInFolder(ctx, "acme", "", nil, 0)
+	if got := brokenTargets(t, database); !reflect.DeepEqual(got, []string{"beta", "Gamma"}) {
+		t.Fatalf("broken links after creating acme %q", got)
+	}
+
+	// So does renaming one, and a link by ID waits for its note too
+	other, _ := database.CreateNoteInFolder(ctx, "Bozza", "", nil, 0)
+	if _, err := database.RenameNote(ctx, other.ID, "Beta"); err != nil {
+		t.Fatal(err)
+	}
+	if got := brokenTargets(t, database); !reflect.DeepEqual(got, []string{"Gamma"}) {
+		t.Fatalf("broken links after the rename %q", got)
+	}
+	next := fmt.Sprintf("id:%d", other.ID+1)
+	database.UpdateNote(ctx, src.ID, src.Title, "[[Acme]] [[beta]] [["+next+"]]", nil)
+	database.CreateNoteInFolder(ctx, "Delta", "", nil, 0)
+	if got := brokenTargets(t, database); len(got) != 0 {
+		t.Fatalf("broken links after creating note %s %q", next, got)
+	}
+
+	backlinks, _ := database.GetBacklinks(ctx, acme.ID)
+	if len(backlinks) != 1 || backlinks[0].ID != src.ID {
+		t.Fatalf("backlinks of acme %+v", backlinks)
+	}
+}
+
+func TestResolveBrokenLinksAfterDownload(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	now := time.Now()
+
+	database.UpsertFromServer(ctx, "s1", "Indice", "[[Acme]] [[Gamma]]", "[]", false, false, now, now)
+	database.UpsertFromServer(ctx, "s2", "Acme", "", "[]", false, false, now, now)
+
+	// Downloads leave the links to the sync, which resolves them at the end
+	if got := brokenTargets(t, database); !reflect.DeepEqual(got, []string{"Acme", "Gamma"}) {
+		t.Fatalf("broken links before resolving %q", got)
+	}
+	if err := database.ResolveBrokenLinks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := brokenTargets(t, database); !reflect.DeepEqual(got, []string{"Gamma"}) {
+		t.Fatalf("broken links after resolving %q", got)
+	}
+}
@@ -0,0 +1,656 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps a whole vault in memory: notes, folders and versions,
+// and the attachments, properties, reminders and boards of memory_vault.go.
+// It follows the SQLite store in what it returns, but keeps no index: tags,
+// links and front matter are read from the notes when asked for. Content,
+// versions and attachments are stored as given, without a cipher.
+type MemoryStore struct {
+	mu          sync.Mutex
+	lastID      int64
+	notes       map[int64]*memoryNote
+	folders     map[int64]*memoryFolder
+	versions    []NoteVersion // In ordine di inserimento
+	sorts       map[int64]FolderSort
+	attachments map[int64]*memoryAttachment
+	properties  map[int64][]Property
+	reminders   map[int64]*Reminder
+	boards      map[int64]Board
+}
+
+type memoryNote struct {
+	Note
+	pinned   bool
+	position int
+}
+
+type memoryFolder struct {
+	Folder
+	position int
+}
+
+var (
+	_ NoteStore     = (*MemoryStore)(nil)
+	_ FolderStore   = (*MemoryStore)(nil)
+	_ VersionStore  = (*MemoryStore)(nil)
+	_ FileStore     = (*MemoryStore)(nil)
+	_ LinkStore     = (*MemoryStore)(nil)
+	_ TagStore      = (*MemoryStore)(nil)
+	_ PropertyStore = (*MemoryStore)(nil)
+	_ ReminderStore = (*MemoryStore)(nil)
+	_ TaskStore     = (*MemoryStore)(nil)
+	_ BoardStore    = (*MemoryStore)(nil)
+	_ TemplateStore = (*MemoryStore)(nil)
+	_ DailyStore    = (*MemoryStore)(nil)
+)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		notes:       make(map[int64]*memoryNote),
+		folders:     make(map[int64]*memoryFolder),
+		sorts:       make(map[int64]FolderSort),
+		attachments: make(map[int64]*memoryAttachment),
+		properties:  make(map[int64][]Property),
+		reminders:   make(map[int64]*Reminder),
+		boards:      make(map[int64]Board),
+	}
+}
+
+// nextID returns a new ID, unique across notes, folders and versions.
+func (s *MemoryStore) nextID() int64 {
+	s.lastID++
+	return s.lastID
+}
+
+func copyNote(n *memoryNote) *Note {
+	note := n.Note
+	note.Tags = append([]string(nil), n.Tags...)
+	return &note
+}
+
+func (s *MemoryStore) GetNote(ctx context.Context, id int64) (*Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.notes[id]; ok {
+		return copyNote(n), nil
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) CreateNoteInFolder(ctx context.Context, title, content string, tags []string, folderID int64) (*Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	n := &memoryNote{Note: Note{
+		ID:           s.nextID(),
+		Title:        title,
+		Content:      content,
+		Tags:         normalizeTags(tags),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		SyncStatus:   SyncStatusPending,
+		ParentFolder: folderID,
+	}}
+	s.notes[n.ID] = n
+	return copyNote(n), nil
+}
+
+// change applies fn to a note, marks it for sync and bumps its update time.
+func (s *MemoryStore) change(id int64, fn func(n *memoryNote)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.notes[id]; ok {
+		fn(n)
+		n.UpdatedAt = time.Now()
+		n.SyncStatus = SyncStatusPending
+	}
+	return nil
+}
+
+func (s *MemoryStore) UpdateNote(ctx context.Context, id int64, title, content string, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notes[id]
+	if !ok {
+		return nil
+	}
+	if n.ReadOnly {
+		return ErrNoteReadOnly
+	}
+	n.Title, n.Content, n.Tags = title, content, normalizeTags(tags)
+	n.UpdatedAt = time.Now()
+	n.SyncStatus = SyncStatusPending
+	return nil
+}
+
+func (s *MemoryStore) DeleteNote(ctx context.Context, id int64) error {
+	return s.change(id, func(n *memoryNote) { n.Deleted = true })
+}
+
+func (s *MemoryStore) SetNoteTags(ctx context.Context, id int64, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notes[id]
+	if !ok {
+		return nil
+	}
+	if n.ReadOnly {
+		return ErrNoteReadOnly
+	}
+	n.Tags = normalizeTags(tags)
+	n.UpdatedAt = time.Now()
+	n.SyncStatus = SyncStatusPending
+	return nil
+}
+
+func (s *MemoryStore) SetNoteArchived(ctx context.Context, id int64, archived bool) error {
+	return s.change(id, func(n *memoryNote) { n.Archived = archived })
+}
+
+func (s *MemoryStore) SetNoteReadOnly(ctx context.Context, id int64, readOnly bool) error {
+	return s.change(id, func(n *memoryNote) { n.ReadOnly = readOnly })
+}
+
+func (s *MemoryStore) SetNotePassword(ctx context.Context, noteID int64, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.notes[noteID]; ok {
+		n.Password = password
+		n.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *MemoryStore) SetNotePinned(ctx context.Context, id int64, pinned bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.notes[id]; ok {
+		n.pinned = pinned
+	}
+	return nil
+}
+
+func listItem(n *memoryNote) NoteListItem {
+	return NoteListItem{
+		ID:         n.ID,
+		Title:      n.Title,
+		UpdatedAt:  n.UpdatedAt,
+		SyncStatus: n.SyncStatus,
+		Type:       "note",
+		Locked:     n.Password != "",
+		Pinned:     n.pinned,
+		Archived:   n.Archived,
+		ReadOnly:   n.ReadOnly,
+	}
+}
+
+func (s *MemoryStore) ListNotes(ctx context.Context) ([]NoteListItem, error) {
+	return s.listNotes(0, false), nil
+}
+
+func (s *MemoryStore) ListNotesInFolder(ctx context.Context, folderID int64) ([]NoteListItem, error) {
+	return s.listNotes(folderID, false), nil
+}
+
+func (s *MemoryStore) ListNotesWithArchived(ctx context.Context, folderID int64) ([]NoteListItem, error) {
+	return s.listNotes(folderID, true), nil
+}
+
+func (s *MemoryStore) listNotes(folderID int64, archived bool) []NoteListItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notes []*memoryNote
+	for _, n := range s.notes {
+		if n.ParentFolder == folderID && !n.Deleted && (archived || !n.Archived) {
+			notes = append(notes, n)
+		}
+	}
+	order := s.folderSort(folderID)
+	sort.Slice(notes, func(i, j int) bool { return order.noteLess(notes[i], notes[j]) })
+
+	var items []NoteListItem
+	for _, n := range notes {
+		items = append(items, listItem(n))
+	}
+	return items
+}
+
+// noteLess orders notes like noteOrder does in SQL.
+func (s FolderSort) noteLess(a, b *memoryNote) bool {
+	if a.pinned != b.pinned {
+		return a.pinned
+	}
+	less := func(cmp int) bool {
+		if cmp == 0 {
+			cmp = compareInt(a.ID, b.ID)
+		}
+		if s.Desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+	switch s.Mode {
+	case SortCreated:
+		return less(a.CreatedAt.Compare(b.CreatedAt))
+	case SortTitle:
+		return less(strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)))
+	case SortSize:
+		return less(compareInt(int64(len(a.Content)), int64(len(b.Content))))
+	case SortManual:
+		if a.position != b.position {
+			return a.position < b.position
+		}
+		return a.UpdatedAt.After(b.UpdatedAt)
+	}
+	return less(a.UpdatedAt.Compare(b.UpdatedAt))
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (s *MemoryStore) SearchNotes(ctx context.Context, query string, tags []string, filter SearchFilter) ([]NoteListItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query = strings.ToLower(query)
+	var found []*memoryNote
+	for _, n := range s.notes {
+		if n.Deleted ||
+			(filter.Archived == ArchivedHide && n.Archived) ||
+			(filter.Archived == ArchivedOnly && !n.Archived) ||
+			(filter.ReadOnly && !n.ReadOnly) {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(n.Title), query) &&
+			!strings.Contains(strings.ToLower(n.Content), query) {
+			continue
+		}
+		if hasTags(n.Tags, tags) {
+			found = append(found, n)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].UpdatedAt.After(found[j].UpdatedAt) })
+
+	var items []NoteListItem
+	for _, n := range found {
+		// Search results carry only the state, like in SQLite
+		item := listItem(n)
+		item.Type, item.Locked, item.Pinned = "", false, false
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// hasTags reports whether a note has every tag in want, or one of its
+// children.
+func hasTags(noteTags, want []string) bool {
+	for _, tag := range want {
+		tag = NormalizeTag(tag)
+		ok := false
+		for _, t := range noteTags {
+			if t == tag || strings.HasPrefix(t, tag+"/") {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *MemoryStore) GetPendingNotes(ctx context.Context) ([]Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notes []Note
+	for _, n := range s.notes {
+		if n.SyncStatus == SyncStatusPending {
+			notes = append(notes, *copyNote(n))
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].ID < notes[j].ID })
+	return notes, nil
+}
+
+func (s *MemoryStore) GetNoteByServerID(ctx context.Context, serverID string) (*Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := s.byServerID(serverID); n != nil {
+		return copyNote(n), nil
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) byServerID(serverID string) *memoryNote {
+	for _, n := range s.notes {
+		if n.ServerID == serverID {
+			return n
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) SetNoteSynced(ctx context.Context, id int64, serverID string, updatedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.notes[id]; ok {
+		n.ServerID = serverID
+		if n.UpdatedAt.Equal(updatedAt) {
+			n.SyncStatus = SyncStatusSynced
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) UpsertFromServer(ctx context.Context, serverID, title, content, tags string, archived, readOnly bool, createdAt, updatedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tagList []string
+	if tags != "" {
+		json.Unmarshal([]byte(tags), &tagList)
+	}
+
+	if n := s.byServerID(serverID); n != nil {
+		// Update only if server version is newer
+		if updatedAt.After(n.UpdatedAt) {
+			n.Title, n.Content, n.Tags = title, content, tagList
+			n.Archived, n.ReadOnly = archived, readOnly
+			n.UpdatedAt = updatedAt
+			n.SyncStatus = SyncStatusSynced
+		}
+		return nil
+	}
+
+	n := &memoryNote{Note: Note{
+		ID:         s.nextID(),
+		Title:      title,
+		Content:    content,
+		Tags:       tagList,
+		CreatedAt:  createdAt,
+		UpdatedAt:  updatedAt,
+		ServerID:   serverID,
+		SyncStatus: SyncStatusSynced,
+		Archived:   archived,
+		ReadOnly:   readOnly,
+	}}
+	s.notes[n.ID] = n
+	return nil
+}
+
+func (s *MemoryStore) PermanentlyDeleteSynced(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.notes[id]; ok && n.Deleted {
+		delete(s.notes, id)
+	}
+	return nil
+}
+
+// Folders
+
+func (s *MemoryStore) CreateFolder(ctx context.Context, title string, parentID int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	f := &memoryFolder{Folder: Folder{
+		ID:           s.nextID(),
+		Title:        title,
+		ParentFolder: parentID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}}
+	s.folders[f.ID] = f
+	return f.ID, nil
+}
+
+func (s *MemoryStore) GetFolder(ctx context.Context, id int64) (*Folder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.folders[id]
+	if !ok {
+		return nil, fmt.Errorf("failed to get folder: %w", sql.ErrNoRows)
+	}
+	folder := f.Folder
+	return &folder, nil
+}
+
+func (s *MemoryStore) ListFolders(ctx context.Context, parentID int64) ([]Folder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found []*memoryFolder
+	for _, f := range s.folders {
+		if f.ParentFolder == parentID && !f.Deleted {
+			found = append(found, f)
+		}
+	}
+	order := s.folderSort(parentID)
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if order.Mode == SortManual && a.position != b.position {
+			return a.position < b.position
+		}
+		cmp := strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+		if order.Mode == SortTitle && order.Desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	var folders []Folder
+	for _, f := range found {
+		folders = append(folders, f.Folder)
+	}
+	return folders, nil
+}
+
+func (s *MemoryStore) DeleteFolder(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.folders[id]; ok {
+		f.Deleted = true
+		f.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *MemoryStore) SetFolderPassword(ctx context.Context, folderID int64, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.folders[folderID]; ok {
+		f.Password = password
+		f.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *MemoryStore) CountNotesInFolder(ctx context.Context, folderID int64, archived bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, n := range s.notes {
+		if n.ParentFolder == folderID && !n.Deleted && (archived || !n.Archived) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) CountNotesInSubfolders(ctx context.Context, parentID int64, archived bool) (map[int64]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[int64]int)
+	for _, n := range s.notes {
+		if f, ok := s.folders[n.ParentFolder]; ok && f.ParentFolder == parentID && !n.Deleted && (archived || !n.Archived) {
+			counts[f.ID]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *MemoryStore) folderSort(folderID int64) FolderSort {
+	if order, ok := s.sorts[folderID]; ok {
+		return order
+	}
+	return DefaultSort(folderID)
+}
+
+func (s *MemoryStore) GetFolderSort(ctx context.Context, folderID int64) (FolderSort, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.folderSort(folderID), nil
+}
+
+func (s *MemoryStore) SaveFolderSort(ctx context.Context, order FolderSort) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sorts[order.FolderID] = order
+	return nil
+}
+
+func (s *MemoryStore) SetManualOrder(ctx context.Context, folderID int64, items []NoteListItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, item := range items {
+		if item.Type == "folder" {
+			if f, ok := s.folders[item.ID]; ok {
+				f.position = i + 1
+			}
+		} else if n, ok := s.notes[item.ID]; ok {
+			n.position = i + 1
+		}
+	}
+	s.sorts[folderID] = FolderSort{FolderID: folderID, Mode: SortManual}
+	return nil
+}
+
+// Versions
+
+func (s *MemoryStore) SaveNoteVersion(ctx context.Context, noteID int64, title, content string, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveVersion(noteID, title, content, tags)
+	return nil
+}
+
+func (s *MemoryStore) saveVersion(noteID int64, title, content string, tags []string) {
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])[:12]
+
+	last, lastHash := 0, ""
+	for _, v := range s.versions {
+		if v.NoteID == noteID && v.VersionNum > last {
+			last, lastHash = v.VersionNum, v.Hash
+		}
+	}
+	// Same content as the last version: nothing to save
+	if last > 0 && lastHash == hash {
+		return
+	}
+
+	s.versions = append(s.versions, NoteVersion{
+		ID:         s.nextID(),
+		NoteID:     noteID,
+		Title:      title,
+		Content:    content,
+		Tags:       append([]string(nil), tags...),
+		Hash:       hash,
+		CreatedAt:  time.Now(),
+		VersionNum: last + 1,
+	})
+}
+
+func (s *MemoryStore) GetNoteVersions(ctx context.Context, noteID int64) ([]NoteVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var versions []NoteVersion
+	for i := len(s.versions) - 1; i >= 0; i-- {
+		if s.versions[i].NoteID == noteID {
+			versions = append(versions, s.versions[i])
+		}
+	}
+	return versions, nil
+}
+
+func (s *MemoryStore) RestoreNoteVersion(ctx context.Context, noteID int64, versionID int64) error {
+	s.mu.Lock()
+	n, ok := s.notes[noteID]
+	if ok && n.ReadOnly {
+		s.mu.Unlock()
+		return ErrNoteReadOnly
+	}
+	var version *NoteVersion
+	for i := range s.versions {
+		if s.versions[i].ID == versionID {
+			version = &s.versions[i]
+		}
+	}
+	s.mu.Unlock()
+
+	if version == nil {
+		return sql.ErrNoRows
+	}
+	return s.change(noteID, func(n *memoryNote) {
+		n.Title, n.Content, n.Tags = version.Title, version.Content, append([]string(nil), version.Tags...)
+	})
+}
+
+func (s *MemoryStore) CompactNoteVersions(ctx context.Context, policy RetentionPolicy) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups := make(map[int64][]versionStamp)
+	for i := len(s.versions) - 1; i >= 0; i-- {
+		v := s.versions[i]
+		groups[v.NoteID] = append(groups[v.NoteID], versionStamp{
+			ID:        fmt.Sprint(v.ID),
+			NoteID:    fmt.Sprint(v.NoteID),
+			CreatedAt: v.CreatedAt,
+		})
+	}
+
+	now := time.Now()
+	drop := make(map[string]bool)
+	for _, group := range groups {
+		for _, id := range policy.expired(group, now) {
+			drop[id] = true
+		}
+	}
+	if len(drop) == 0 {
+		return 0, nil
+	}
+
+	kept := s.versions[:0]
+	for _, v := range s.versions {
+		if !drop[fmt.Sprint(v.ID)] {
+			kept = append(kept, v)
+		}
+	}
+	s.versions = kept
+	return len(drop), nil
+}
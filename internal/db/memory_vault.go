@@ -0,0 +1,644 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The rest of the vault on MemoryStore: links, tags, properties,
+// attachments, reminders, tasks, boards, templates and daily notes.
+
+type memoryAttachment struct {
+	Attachment
+	data []byte
+}
+
+// touch marks a changed note for sync and bumps its update time.
+func touch(n *memoryNote) {
+	n.UpdatedAt = time.Now()
+	n.SyncStatus = SyncStatusPending
+}
+
+// liveNotes returns the notes that are not deleted, by ID.
+func (s *MemoryStore) liveNotes() []*memoryNote {
+	var notes []*memoryNote
+	for _, n := range s.notes {
+		if !n.Deleted {
+			notes = append(notes, n)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].ID < notes[j].ID })
+	return notes
+}
+
+// liveNote returns a note that is not deleted, or nil.
+func (s *MemoryStore) liveNote(id int64) *memoryNote {
+	if n, ok := s.notes[id]; ok && !n.Deleted {
+		return n
+	}
+	return nil
+}
+
+// Links
+
+// resolveLink returns the live note a link points to, or nil.
+func (s *MemoryStore) resolveLink(l Link) *memoryNote {
+	if l.NoteID != 0 {
+		return s.liveNote(l.NoteID)
+	}
+	var found *memoryNote
+	for _, n := range s.liveNotes() {
+		if strings.EqualFold(n.Title, l.Target) && (found == nil || n.UpdatedAt.After(found.UpdatedAt)) {
+			found = n
+		}
+	}
+	return found
+}
+
+// linksTo reports whether the content of n links to the note with id.
+func (s *MemoryStore) linksTo(n *memoryNote, id int64) bool {
+	for _, l := range ParseLinks(n.Content) {
+		if t := s.resolveLink(l); t != nil && t.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) ResolveLink(ctx context.Context, l Link) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := s.resolveLink(l); n != nil {
+		return n.ID, nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) GetBacklinks(ctx context.Context, noteID int64) ([]NoteListItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notes []NoteListItem
+	for _, n := range s.liveNotes() {
+		if n.ID != noteID && s.linksTo(n, noteID) {
+			notes = append(notes, NoteListItem{
+				ID:         n.ID,
+				Title:      n.Title,
+				UpdatedAt:  n.UpdatedAt,
+				SyncStatus: n.SyncStatus,
+				Type:       "note",
+			})
+		}
+	}
+	sort.SliceStable(notes, func(i, j int) bool { return notes[i].Title < notes[j].Title })
+	return notes, nil
+}
+
+func (s *MemoryStore) RenameNote(ctx context.Context, id int64, newTitle string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[id]
+	if !ok {
+		return 0, fmt.Errorf("note %d not found", id)
+	}
+	if note.ReadOnly {
+		return 0, ErrNoteReadOnly
+	}
+
+	// The links are rewritten before the rename, while they still resolve
+	rewritten := 0
+	for _, src := range s.liveNotes() {
+		if src.ID == id || src.ReadOnly || !s.linksTo(src, id) {
+			continue
+		}
+		updated, changed := rewriteLinks(src.Content, note.Title, newTitle)
+		if !changed {
+			continue
+		}
+		s.saveVersion(src.ID, src.Title, updated, src.Tags)
+		src.Content = updated
+		touch(src)
+		rewritten++
+	}
+	note.Title = newTitle
+	touch(note)
+	return rewritten, nil
+}
+
+// ResolveBrokenLinks has nothing to do: MemoryStore resolves links when they
+// are read.
+func (s *MemoryStore) ResolveBrokenLinks(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) VaultGraph(ctx context.Context) (*Graph, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := newGraph()
+	var folders []*memoryFolder
+	for _, f := range s.folders {
+		if !f.Deleted {
+			folders = append(folders, f)
+		}
+	}
+	sort.Slice(folders, func(i, j int) bool { return folders[i].ID < folders[j].ID })
+	for _, f := range folders {
+		g.addNode(GraphNode{Key: FolderKey(f.ID), Type: GraphFolder, ID: f.ID, Label: f.Title})
+	}
+	notes := s.liveNotes()
+	for _, n := range notes {
+		g.addNode(GraphNode{Key: NoteKey(n.ID), Type: GraphNote, ID: n.ID, Label: n.Title})
+	}
+
+	for _, f := range folders {
+		if f.ParentFolder != 0 {
+			g.addEdge(FolderKey(f.ID), FolderKey(f.ParentFolder), EdgeParent)
+		}
+	}
+	for _, n := range notes {
+		if n.ParentFolder != 0 {
+			g.addEdge(NoteKey(n.ID), FolderKey(n.ParentFolder), EdgeFolder)
+		}
+	}
+	for _, n := range notes {
+		for _, tag := range n.Tags {
+			g.addTag(n.ID, tag)
+		}
+	}
+	for _, n := range notes {
+		for _, l := range ParseLinks(n.Content) {
+			if t := s.resolveLink(l); t != nil {
+				g.addEdge(NoteKey(n.ID), NoteKey(t.ID), EdgeLink)
+			}
+		}
+	}
+	return g, nil
+}
+
+// Tags
+
+func (s *MemoryStore) ListTags(ctx context.Context) ([]TagCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notes := make(map[string]map[int64]bool)
+	for _, n := range s.liveNotes() {
+		for _, tag := range n.Tags {
+			countTag(notes, tag, n.ID)
+		}
+	}
+	return tagCounts(notes), nil
+}
+
+func (s *MemoryStore) RenameTag(ctx context.Context, oldName, newName string) (int, error) {
+	return s.MergeTags(ctx, []string{oldName}, newName)
+}
+
+func (s *MemoryStore) MergeTags(ctx context.Context, names []string, into string) (int, error) {
+	from, rename, err := tagRenamer(names, into)
+	if err != nil || len(from) == 0 {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := 0
+	for _, n := range s.liveNotes() {
+		if n.ReadOnly {
+			continue
+		}
+		tags := make([]string, len(n.Tags))
+		renamed := false
+		for i, tag := range n.Tags {
+			var ok bool
+			tags[i], ok = rename(NormalizeTag(tag))
+			renamed = renamed || ok
+		}
+		if !renamed {
+			continue
+		}
+		n.Tags = normalizeTags(tags)
+		touch(n)
+		changed++
+	}
+	return changed, nil
+}
+
+// Properties
+
+// noteProperties returns the stored properties of a note merged with its
+// front matter, as the SQLite store indexes them when the note is written.
+func (s *MemoryStore) noteProperties(n *memoryNote) []Property {
+	return mergeFrontMatter(s.properties[n.ID], ParseFrontMatter(n.Content))
+}
+
+func (s *MemoryStore) NoteProperties(ctx context.Context, noteID int64) ([]Property, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.notes[noteID]; ok {
+		return s.noteProperties(n), nil
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) SetNoteProperty(ctx context.Context, noteID int64, p Property) error {
+	value, err := p.NormalizeValue(p.Value)
+	if err != nil {
+		return err
+	}
+	p.Value = value
+	return s.changeProperty(noteID, p.Name, func(props []Property) []Property {
+		return putProperty(props, p)
+	}, value, false)
+}
+
+func (s *MemoryStore) DeleteNoteProperty(ctx context.Context, noteID int64, name string) error {
+	return s.changeProperty(noteID, name, func(props []Property) []Property {
+		return dropProperty(props, name)
+	}, "", true)
+}
+
+// changeProperty applies fn to the properties of a note and rewrites the
+// front matter line of the property, if the note has one.
+func (s *MemoryStore) changeProperty(noteID int64, name string, fn func([]Property) []Property, value string, remove bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notes[noteID]
+	if !ok {
+		return nil
+	}
+	if n.ReadOnly {
+		return ErrNoteReadOnly
+	}
+	s.properties[noteID] = fn(s.noteProperties(n))
+	if updated, ok := setFrontMatterValue(n.Content, name, value, remove); ok && updated != n.Content {
+		s.saveVersion(n.ID, n.Title, updated, n.Tags)
+		n.Content = updated
+		touch(n)
+	}
+	return nil
+}
+
+func (s *MemoryStore) PropertyTable(ctx context.Context, folderID int64) (*PropertyTable, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notes []*memoryNote
+	for _, n := range s.liveNotes() {
+		if n.ParentFolder == folderID && n.Password == "" && !n.Archived {
+			notes = append(notes, n)
+		}
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		return strings.ToLower(notes[i].Title) < strings.ToLower(notes[j].Title)
+	})
+
+	table := &PropertyTable{}
+	columns := make(map[string]bool)
+	for _, n := range notes {
+		table.addRow(PropertyRow{NoteID: n.ID, Title: n.Title, UpdatedAt: n.UpdatedAt}, s.noteProperties(n), columns)
+	}
+	return table, nil
+}
+
+// Attachments
+
+func (s *MemoryStore) AddAttachment(ctx context.Context, noteID int64, name string, data []byte, maxSize int64) (*Attachment, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxAttachmentSize
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w: %d bytes, limit is %d", ErrAttachmentTooLarge, len(data), maxSize)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.notes[noteID]; ok && n.ReadOnly {
+		return nil, ErrNoteReadOnly
+	}
+	sum := sha256.Sum256(data)
+	a := &memoryAttachment{
+		Attachment: Attachment{
+			ID:         s.nextID(),
+			NoteID:     noteID,
+			Name:       filepath.Base(name),
+			Hash:       hex.EncodeToString(sum[:]),
+			Size:       int64(len(data)),
+			CreatedAt:  time.Now(),
+			SyncStatus: SyncStatusPending,
+		},
+		data: append([]byte(nil), data...),
+	}
+	s.attachments[a.ID] = a
+	attachment := a.Attachment
+	return &attachment, nil
+}
+
+func (s *MemoryStore) ListAttachments(ctx context.Context, noteID int64) ([]Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var attachments []Attachment
+	for _, a := range s.attachments {
+		if a.NoteID == noteID && !a.Deleted {
+			attachments = append(attachments, a.Attachment)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool {
+		if !attachments[i].CreatedAt.Equal(attachments[j].CreatedAt) {
+			return attachments[i].CreatedAt.Before(attachments[j].CreatedAt)
+		}
+		return attachments[i].ID < attachments[j].ID
+	})
+	return attachments, nil
+}
+
+func (s *MemoryStore) ReadAttachment(ctx context.Context, id int64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.attachments[id]
+	if !ok || a.Deleted {
+		return nil, fmt.Errorf("attachment %d not found", id)
+	}
+	return append([]byte(nil), a.data...), nil
+}
+
+func (s *MemoryStore) DeleteAttachment(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.attachments[id]
+	if !ok {
+		return nil
+	}
+	if n, ok := s.notes[a.NoteID]; ok && n.ReadOnly {
+		return ErrNoteReadOnly
+	}
+	// Attachments known to the server wait for the next sync
+	if a.ServerID != "" {
+		a.Deleted = true
+		a.SyncStatus = SyncStatusPending
+		return nil
+	}
+	delete(s.attachments, id)
+	return nil
+}
+
+// Reminders
+
+func (s *MemoryStore) AddReminder(ctx context.Context, noteID int64, item string, due time.Time) (*Reminder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := &Reminder{ID: s.nextID(), NoteID: noteID, Item: item, Due: due, CreatedAt: time.Now()}
+	s.reminders[r.ID] = r
+	reminder := *r
+	return &reminder, nil
+}
+
+func (s *MemoryStore) ListReminders(ctx context.Context, noteID int64, includeDone bool) ([]Reminder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listReminders(noteID, includeDone), nil
+}
+
+func (s *MemoryStore) listReminders(noteID int64, includeDone bool) []Reminder {
+	var reminders []Reminder
+	for _, r := range s.reminders {
+		n := s.liveNote(r.NoteID)
+		if n == nil || (noteID != 0 && r.NoteID != noteID) {
+			continue
+		}
+		reminder := *r
+		reminder.NoteTitle = n.Title
+		// Item reminders are done once their checkbox is ticked
+		if reminder.Item != "" && !reminder.Done {
+			for _, item := range ParseChecklist(n.Content) {
+				if item.Done && item.Text == reminder.Item {
+					reminder.Done = true
+					break
+				}
+			}
+		}
+		if reminder.Done && !includeDone {
+			continue
+		}
+		reminders = append(reminders, reminder)
+	}
+	sort.Slice(reminders, func(i, j int) bool {
+		if !reminders[i].Due.Equal(reminders[j].Due) {
+			return reminders[i].Due.Before(reminders[j].Due)
+		}
+		return reminders[i].ID < reminders[j].ID
+	})
+	return reminders
+}
+
+func (s *MemoryStore) MarkReminderFired(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.reminders[id]; ok {
+		r.Fired = true
+	}
+	return nil
+}
+
+func (s *MemoryStore) SetReminderDone(ctx context.Context, id int64, done bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.reminders[id]; ok {
+		r.Done = done
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteReminder(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reminders, id)
+	return nil
+}
+
+// Tasks
+
+func (s *MemoryStore) ListTasks(ctx context.Context, filter TaskFilter, now time.Time) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	folders := make(map[int64]taskFolder)
+	for id, f := range s.folders {
+		if !f.Deleted {
+			folders[id] = taskFolder{title: f.Title, parent: f.ParentFolder, locked: f.Password != ""}
+		}
+	}
+	reminded := itemDueTimes(s.listReminders(0, false))
+
+	var tags []string
+	if tag := NormalizeTag(filter.Tag); tag != "" {
+		tags = []string{tag}
+	}
+	var tasks []Task
+	for _, n := range s.liveNotes() {
+		if n.Password != "" || n.Archived || !hasTags(n.Tags, tags) {
+			continue
+		}
+		path, locked, under := folderPath(folders, n.ParentFolder, filter.Folder)
+		if locked || !under {
+			continue
+		}
+		note := Task{
+			NoteID:    n.ID,
+			NoteTitle: n.Title,
+			FolderID:  n.ParentFolder,
+			Folder:    path,
+			Tags:      append([]string(nil), n.Tags...),
+		}
+		tasks = appendTasks(tasks, note, n.Content, reminded[n.ID], filter, now)
+	}
+	sortTasks(tasks)
+	return tasks, nil
+}
+
+func (s *MemoryStore) ToggleTask(ctx context.Context, noteID int64, line int, text string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.liveNote(noteID)
+	if n == nil {
+		return false, fmt.Errorf("note %d not found", noteID)
+	}
+	if n.ReadOnly {
+		return false, ErrNoteReadOnly
+	}
+	content, done, err := toggleChecklistLine(n.Content, line, text)
+	if err != nil {
+		return false, err
+	}
+	s.saveVersion(n.ID, n.Title, content, n.Tags)
+	n.Content = content
+	touch(n)
+	return done, nil
+}
+
+// Boards
+
+func (s *MemoryStore) GetBoard(ctx context.Context, folderID int64) (Board, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.boards[folderID]; ok {
+		b.Columns = append([]string(nil), b.Columns...)
+		return b, nil
+	}
+	return DefaultBoard(folderID), nil
+}
+
+func (s *MemoryStore) SaveBoard(ctx context.Context, b Board) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b.Columns = append([]string(nil), b.Columns...)
+	s.boards[b.FolderID] = b
+	return nil
+}
+
+func (s *MemoryStore) BoardColumns(ctx context.Context, b Board) ([]BoardColumn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notes []*memoryNote
+	for _, n := range s.liveNotes() {
+		if n.ParentFolder == b.FolderID && !n.Archived {
+			notes = append(notes, n)
+		}
+	}
+	sort.SliceStable(notes, func(i, j int) bool { return notes[i].UpdatedAt.After(notes[j].UpdatedAt) })
+
+	columns := newBoardColumns(b)
+	for _, n := range notes {
+		card := BoardCard{NoteID: n.ID, Title: n.Title, Tags: append([]string(nil), n.Tags...)}
+		if b.Kind == BoardTasks {
+			if n.Password == "" {
+				placeTaskCard(columns, card, n.Content)
+			}
+			continue
+		}
+		placeTagCard(columns, card)
+	}
+	return columns, nil
+}
+
+func (s *MemoryStore) MoveCard(ctx context.Context, b Board, noteID int64, tag string) error {
+	if b.Kind != BoardTags {
+		return fmt.Errorf("cards of a %s board cannot be moved", b.Kind)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.liveNote(noteID)
+	if n == nil {
+		return fmt.Errorf("note %d not found", noteID)
+	}
+	if n.ReadOnly {
+		return ErrNoteReadOnly
+	}
+	n.Tags = normalizeTags(b.cardTags(n.Tags, tag))
+	touch(n)
+	return nil
+}
+
+// Templates and daily notes
+
+func (s *MemoryStore) ListTemplates(ctx context.Context, folder string) ([]Template, error) {
+	if folder == "" {
+		folder = DefaultTemplatesFolder
+	}
+	folderID, err := folderByPath(ctx, s, folder, false)
+	if errors.Is(err, ErrFolderNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var notes []*memoryNote
+	for _, n := range s.liveNotes() {
+		if n.ParentFolder == folderID {
+			notes = append(notes, n)
+		}
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		return strings.ToLower(notes[i].Title) < strings.ToLower(notes[j].Title)
+	})
+
+	var templates []Template
+	for _, n := range notes {
+		t := ParseTemplate(n.Title, n.Content)
+		t.NoteID = n.ID
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+func (s *MemoryStore) CreateNoteFromTemplate(ctx context.Context, t *Template, title string, folderID int64, vars TemplateVars) (*Note, error) {
+	title, folderID, body, err := t.expand(ctx, s, title, folderID, vars)
+	if err != nil {
+		return nil, err
+	}
+	return s.CreateNoteInFolder(ctx, title, body, t.Tags, folderID)
+}
+
+func (s *MemoryStore) DailyNote(ctx context.Context, cfg DailyConfig, templatesFolder string, day time.Time) (int64, error) {
+	return dailyNote(ctx, s, cfg, templatesFolder, day)
+}
+
+func (s *MemoryStore) DailyNoteDays(ctx context.Context, cfg DailyConfig, month time.Time) (map[int]int64, error) {
+	return dailyNoteDays(ctx, s, cfg, month)
+}
@@ -20,6 +20,8 @@ type Note struct {
 	ServerID     string     `json:"server_id,omitempty"`
 	SyncStatus   SyncStatus `json:"sync_status"`
 	Deleted      bool       `json:"deleted"`
+	Archived     bool       `json:"archived"`  // Nascosta dalle liste, ma sincronizzata
+	ReadOnly     bool       `json:"read_only"` // Bloccata contro le modifiche
 	Password     string     `json:"-"`
 	ParentFolder int64      `json:"parent_folder,omitempty"`
 }
@@ -47,6 +49,10 @@ type NoteListItem struct {
 	UpdatedAt  time.Time  `json:"updated_at"`
 	SyncStatus SyncStatus `json:"sync_status"`
 	Type       string     `json:"type"` // "note" o "folder"
+	Locked     bool       `json:"locked"`
+	Pinned     bool       `json:"pinned"`
+	Archived   bool       `json:"archived"`
+	ReadOnly   bool       `json:"read_only"`
 }
 
 func (n NoteListItem) GetID() int64 {
@@ -1,53 +1,42 @@
 package db
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 )
 
-func (db *DB) ListNotes() ([]NoteListItem, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, title, updated_at, COALESCE(sync_status, 'local')
-		FROM notes
-		WHERE (deleted = 0 OR deleted IS NULL) AND parent_folder_id IS NULL
-		ORDER BY updated_at DESC
-	`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list notes: %w", err)
-	}
-	defer rows.Close()
+// ListNotes returns the notes at the root, in the root's sort order.
+// Archived notes are left out.
+func (db *DB) ListNotes(ctx context.Context) ([]NoteListItem, error) {
+	return db.listNotes(ctx, 0, false)
+}
 
-	var notes []NoteListItem
-	for rows.Next() {
-		var n NoteListItem
-		var syncStatus string
-		if err := rows.Scan(&n.ID, &n.Title, &n.UpdatedAt, &syncStatus); err != nil {
-			return nil, fmt.Errorf("failed to scan note: %w", err)
-		}
-		n.SyncStatus = SyncStatus(syncStatus)
-		notes = append(notes, n)
-	}
-	return notes, rows.Err()
+func (db *DB) GetNote(ctx context.Context, id int64) (*Note, error) {
+	return getNote(ctx, db.conn, id)
 }
 
-func (db *DB) GetNote(id int64) (*Note, error) {
+// getNote reads a note through conn, which may be a transaction.
+func getNote(ctx context.Context, conn querier, id int64) (*Note, error) {
 	var n Note
 	var tagsJSON sql.NullString
 	var serverID sql.NullString
 	var syncStatus sql.NullString
 	var deleted sql.NullInt64
 
-	err := db.conn.QueryRow(`
+	err := conn.QueryRowContext(ctx, `
 		SELECT id, title, content, tags, created_at, updated_at,
-		       server_id, COALESCE(sync_status, 'local'), COALESCE(deleted, 0)
+		       server_id, COALESCE(sync_status, 'local'), COALESCE(deleted, 0),
+		       COALESCE(archived, 0), COALESCE(read_only, 0)
 		FROM notes WHERE id = ?
 	`, id).Scan(&n.ID, &n.Title, &n.Content, &tagsJSON, &n.CreatedAt, &n.UpdatedAt,
-		&serverID, &syncStatus, &deleted)
+		&serverID, &syncStatus, &deleted, &n.Archived, &n.ReadOnly)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -75,14 +64,21 @@ func (db *DB) GetNote(id int64) (*Note, error) {
 	return &n, nil
 }
 
-func (db *DB) CreateNote(title, content string, tags []string) (*Note, error) {
+func (db *DB) CreateNote(ctx context.Context, title, content string, tags []string) (*Note, error) {
+	tags = normalizeTags(tags)
 	tagsJSON, err := json.Marshal(tags)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal tags: %w", err)
 	}
 
 	now := time.Now()
-	result, err := db.conn.Exec(`
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
 		INSERT INTO notes (title, content, tags, created_at, updated_at, sync_status, deleted)
 		VALUES (?, ?, ?, ?, ?, 'pending', 0)
 	`, title, content, string(tagsJSON), now, now)
@@ -95,6 +91,18 @@ func (db *DB) CreateNote(title, content string, tags []string) (*Note, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get last insert id: %w", err)
 	}
+	if err := indexNoteTags(ctx, tx, id, tags); err != nil {
+		return nil, err
+	}
+	if err := db.indexStoredContent(ctx, tx, id, content); err != nil {
+		return nil, err
+	}
+	if err := db.resolveLinksTo(ctx, tx, id, title); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 
 	return &Note{
 		ID:         id,
@@ -107,7 +115,8 @@ func (db *DB) CreateNote(title, content string, tags []string) (*Note, error) {
 	}, nil
 }
 
-func (db *DB) CreateNoteInFolder(title, content string, tags []string, folderID int64) (*Note, error) {
+func (db *DB) CreateNoteInFolder(ctx context.Context, title, content string, tags []string, folderID int64) (*Note, error) {
+	tags = normalizeTags(tags)
 	tagsJSON, err := json.Marshal(tags)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal tags: %w", err)
@@ -119,7 +128,13 @@ func (db *DB) CreateNoteInFolder(title, content string, tags []string, folderID
 		parentID = folderID
 	}
 
-	result, err := db.conn.Exec(`
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
 		INSERT INTO notes (title, content, tags, parent_folder_id, created_at, updated_at, sync_status, deleted)
 		VALUES (?, ?, ?, ?, ?, ?, 'pending', 0)
 	`, title, content, string(tagsJSON), parentID, now, now)
@@ -132,6 +147,18 @@ func (db *DB) CreateNoteInFolder(title, content string, tags []string, folderID
 	if err != nil {
 		return nil, fmt.Errorf("failed to get last insert id: %w", err)
 	}
+	if err := indexNoteTags(ctx, tx, id, tags); err != nil {
+		return nil, err
+	}
+	if err := db.indexStoredContent(ctx, tx, id, content); err != nil {
+		return nil, err
+	}
+	if err := db.resolveLinksTo(ctx, tx, id, title); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 
 	return &Note{
 		ID:           id,
@@ -145,13 +172,32 @@ func (db *DB) CreateNoteInFolder(title, content string, tags []string, folderID
 	}, nil
 }
 
-func (db *DB) UpdateNote(id int64, title, content string, tags []string) error {
+func (db *DB) UpdateNote(ctx context.Context, id int64, title, content string, tags []string) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := db.updateNote(ctx, tx, id, title, content, tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateNote is UpdateNote within the transaction tx, for operations that
+// change several notes at once. Read-only notes are refused.
+func (db *DB) updateNote(ctx context.Context, tx querier, id int64, title, content string, tags []string) error {
+	if err := checkWritable(ctx, tx, id); err != nil {
+		return err
+	}
+	tags = normalizeTags(tags)
 	tagsJSON, err := json.Marshal(tags)
 	if err != nil {
 		return fmt.Errorf("failed to marshal tags: %w", err)
 	}
 
-	_, err = db.conn.Exec(`
+	_, err = tx.ExecContext(ctx, `
 		UPDATE notes
 		SET title = ?, content = ?, tags = ?, updated_at = ?, sync_status = 'pending'
 		WHERE id = ?
@@ -161,12 +207,15 @@ func (db *DB) UpdateNote(id int64, title, content string, tags []string) error {
 		return fmt.Errorf("failed to update note: %w", err)
 	}
 
-	return nil
+	if err := indexNoteTags(ctx, tx, id, tags); err != nil {
+		return err
+	}
+	return db.indexStoredContent(ctx, tx, id, content)
 }
 
-func (db *DB) DeleteNote(id int64) error {
+func (db *DB) DeleteNote(ctx context.Context, id int64) error {
 	// Soft delete - mark as deleted and pending sync
-	_, err := db.conn.Exec(`
+	_, err := db.conn.ExecContext(ctx, `
 		UPDATE notes SET deleted = 1, sync_status = 'pending', updated_at = ?
 		WHERE id = ?
 	`, time.Now(), id)
@@ -176,11 +225,75 @@ func (db *DB) DeleteNote(id int64) error {
 	return nil
 }
 
-func (db *DB) SearchNotes(query string, tags []string) ([]NoteListItem, error) {
+// ErrNoteReadOnly is returned when changing the content of a locked note.
+var ErrNoteReadOnly = errors.New("note is read-only")
+
+// SetNoteArchived archives a note, hiding it from lists and search, or
+// brings it back. Archived notes keep syncing.
+func (db *DB) SetNoteArchived(ctx context.Context, id int64, archived bool) error {
+	_, err := db.conn.ExecContext(ctx, `
+		UPDATE notes SET archived = ?, sync_status = 'pending', updated_at = ? WHERE id = ?
+	`, archived, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to archive note: %w", err)
+	}
+	return nil
+}
+
+// checkWritable returns ErrNoteReadOnly if the note is locked.
+func checkWritable(ctx context.Context, conn querier, id int64) error {
+	var readOnly bool
+	err := conn.QueryRowContext(ctx, `SELECT COALESCE(read_only, 0) FROM notes WHERE id = ?`, id).Scan(&readOnly)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get note: %w", err)
+	}
+	if readOnly {
+		return ErrNoteReadOnly
+	}
+	return nil
+}
+
+// SetNoteReadOnly locks a note against edits, or unlocks it.
+func (db *DB) SetNoteReadOnly(ctx context.Context, id int64, readOnly bool) error {
+	_, err := db.conn.ExecContext(ctx, `
+		UPDATE notes SET read_only = ?, sync_status = 'pending', updated_at = ? WHERE id = ?
+	`, readOnly, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to lock note: %w", err)
+	}
+	return nil
+}
+
+// SearchFilter restricts a search by the state of the notes.
+type SearchFilter struct {
+	Archived ArchiveFilter
+	ReadOnly bool // Solo le note bloccate
+}
+
+type ArchiveFilter int
+
+const (
+	ArchivedHide ArchiveFilter = iota // Default: archived notes are left out
+	ArchivedShow
+	ArchivedOnly
+)
+
+func (db *DB) SearchNotes(ctx context.Context, query string, tags []string, filter SearchFilter) ([]NoteListItem, error) {
 	var args []interface{}
 	var conditions []string
 
-	baseQuery := `SELECT id, title, updated_at, COALESCE(sync_status, 'local') FROM notes WHERE (deleted = 0 OR deleted IS NULL)`
+	baseQuery := `SELECT id, title, updated_at, COALESCE(sync_status, 'local'), COALESCE(archived, 0),
+		COALESCE(read_only, 0) FROM notes WHERE (deleted = 0 OR deleted IS NULL)`
+
+	switch filter.Archived {
+	case ArchivedHide:
+		conditions = append(conditions, `COALESCE(archived, 0) = 0`)
+	case ArchivedOnly:
+		conditions = append(conditions, `archived = 1`)
+	}
+	if filter.ReadOnly {
+		conditions = append(conditions, `read_only = 1`)
+	}
 
 	if query != "" {
 		conditions = append(conditions, `(title LIKE ? OR content LIKE ?)`)
@@ -188,9 +301,14 @@ func (db *DB) SearchNotes(query string, tags []string) ([]NoteListItem, error) {
 		args = append(args, searchTerm, searchTerm)
 	}
 
+	// A tag also matches its children: "work" finds "work/acme"
 	for _, tag := range tags {
-		conditions = append(conditions, `tags LIKE ?`)
-		args = append(args, "%\""+tag+"\"%")
+		tag = NormalizeTag(tag)
+		conditions = append(conditions, `id IN (
+			SELECT nt.note_id FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+			WHERE t.name = ? OR t.name LIKE ? ESCAPE '\'
+		)`)
+		args = append(args, tag, escapeLike(tag)+"/%")
 	}
 
 	if len(conditions) > 0 {
@@ -199,7 +317,7 @@ func (db *DB) SearchNotes(query string, tags []string) ([]NoteListItem, error) {
 
 	baseQuery += " ORDER BY updated_at DESC"
 
-	rows, err := db.conn.Query(baseQuery, args...)
+	rows, err := db.conn.QueryContext(ctx, baseQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search notes: %w", err)
 	}
@@ -209,7 +327,7 @@ func (db *DB) SearchNotes(query string, tags []string) ([]NoteListItem, error) {
 	for rows.Next() {
 		var n NoteListItem
 		var syncStatus string
-		if err := rows.Scan(&n.ID, &n.Title, &n.UpdatedAt, &syncStatus); err != nil {
+		if err := rows.Scan(&n.ID, &n.Title, &n.UpdatedAt, &syncStatus, &n.Archived, &n.ReadOnly); err != nil {
 			return nil, fmt.Errorf("failed to scan note: %w", err)
 		}
 		n.SyncStatus = SyncStatus(syncStatus)
@@ -220,9 +338,10 @@ func (db *DB) SearchNotes(query string, tags []string) ([]NoteListItem, error) {
 
 // Sync-related functions
 
-func (db *DB) GetPendingNotes() ([]Note, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, title, content, tags, created_at, updated_at, server_id, sync_status, COALESCE(deleted, 0)
+func (db *DB) GetPendingNotes(ctx context.Context) ([]Note, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, title, content, tags, created_at, updated_at, server_id, sync_status, COALESCE(deleted, 0),
+		       COALESCE(archived, 0), COALESCE(read_only, 0)
 		FROM notes
 		WHERE sync_status = 'pending'
 	`)
@@ -240,7 +359,7 @@ func (db *DB) GetPendingNotes() ([]Note, error) {
 		var deleted int
 
 		if err := rows.Scan(&n.ID, &n.Title, &n.Content, &tagsJSON, &n.CreatedAt, &n.UpdatedAt,
-			&serverID, &syncStatus, &deleted); err != nil {
+			&serverID, &syncStatus, &deleted, &n.Archived, &n.ReadOnly); err != nil {
 			return nil, fmt.Errorf("failed to scan note: %w", err)
 		}
 
@@ -258,25 +377,50 @@ func (db *DB) GetPendingNotes() ([]Note, error) {
 	return notes, rows.Err()
 }
 
-func (db *DB) SetNoteSynced(id int64, serverID string) error {
-	_, err := db.conn.Exec(`
-		UPDATE notes SET server_id = ?, sync_status = 'synced' WHERE id = ?
-	`, serverID, id)
-	return err
+// SetNoteSynced records the server ID of an uploaded note. The note is only
+// marked synced if it is still the version that was uploaded (updatedAt):
+// one saved during the upload stays pending and goes with the next sync.
+func (db *DB) SetNoteSynced(ctx context.Context, id int64, serverID string, updatedAt time.Time) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current time.Time
+	err = tx.QueryRowContext(ctx, `SELECT updated_at FROM notes WHERE id = ?`, id).Scan(&current)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	status := SyncStatusSynced
+	if !current.Equal(updatedAt) {
+		status = SyncStatusPending
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE notes SET server_id = ?, sync_status = ? WHERE id = ?
+	`, serverID, string(status), id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (db *DB) GetNoteByServerID(serverID string) (*Note, error) {
+func (db *DB) GetNoteByServerID(ctx context.Context, serverID string) (*Note, error) {
 	var n Note
 	var tagsJSON sql.NullString
 	var srvID sql.NullString
 	var syncStatus sql.NullString
 	var deleted sql.NullInt64
 
-	err := db.conn.QueryRow(`
-		SELECT id, title, content, tags, created_at, updated_at, server_id, sync_status, COALESCE(deleted, 0)
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT id, title, content, tags, created_at, updated_at, server_id, sync_status, COALESCE(deleted, 0),
+		       COALESCE(archived, 0), COALESCE(read_only, 0)
 		FROM notes WHERE server_id = ?
 	`, serverID).Scan(&n.ID, &n.Title, &n.Content, &tagsJSON, &n.CreatedAt, &n.UpdatedAt,
-		&srvID, &syncStatus, &deleted)
+		&srvID, &syncStatus, &deleted, &n.Archived, &n.ReadOnly)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -299,44 +443,114 @@ func (db *DB) GetNoteByServerID(serverID string) (*Note, error) {
 	return &n, nil
 }
 
-func (db *DB) UpsertFromServer(serverID, title, content, tags string, createdAt, updatedAt time.Time) error {
-	existing, _ := db.GetNoteByServerID(serverID)
+// UpsertFromServer stores a note received from the server. The lookup and
+// the write run in one transaction, so a note saved meanwhile is not lost.
+// Links waiting for the note are left to ResolveBrokenLinks.
+func (db *DB) UpsertFromServer(ctx context.Context, serverID, title, content, tags string, archived, readOnly bool, createdAt, updatedAt time.Time) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	if existing != nil {
+	var id int64
+	var localUpdatedAt time.Time
+	err = tx.QueryRowContext(ctx, `SELECT id, updated_at FROM notes WHERE server_id = ?`, serverID).Scan(&id, &localUpdatedAt)
+	switch {
+	case err == nil:
 		// Update only if server version is newer
-		if updatedAt.After(existing.UpdatedAt) {
-			_, err := db.conn.Exec(`
-				UPDATE notes SET title = ?, content = ?, tags = ?, updated_at = ?, sync_status = 'synced'
-				WHERE server_id = ?
-			`, title, content, tags, updatedAt, serverID)
+		if !updatedAt.After(localUpdatedAt) {
+			return nil
+		}
+		_, err := tx.ExecContext(ctx, `
+			UPDATE notes SET title = ?, content = ?, tags = ?, archived = ?, read_only = ?, updated_at = ?,
+				sync_status = 'synced'
+			WHERE server_id = ?
+		`, title, content, tags, archived, readOnly, updatedAt, serverID)
+		if err != nil {
 			return err
 		}
-		return nil
+	case err == sql.ErrNoRows:
+		// Insert new note from server
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO notes (title, content, tags, archived, read_only, created_at, updated_at, server_id, sync_status, deleted)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'synced', 0)
+		`, title, content, tags, archived, readOnly, createdAt, updatedAt, serverID)
+		if err != nil {
+			return err
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	default:
+		return err
 	}
 
-	// Insert new note from server
-	_, err := db.conn.Exec(`
-		INSERT INTO notes (title, content, tags, created_at, updated_at, server_id, sync_status, deleted)
-		VALUES (?, ?, ?, ?, ?, ?, 'synced', 0)
-	`, title, content, tags, createdAt, updatedAt, serverID)
-	return err
+	if err := indexNoteTagsJSON(ctx, tx, id, tags); err != nil {
+		return err
+	}
+	if err := db.indexStoredContent(ctx, tx, id, content); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (db *DB) PermanentlyDeleteSynced(id int64) error {
-	_, err := db.conn.Exec(`DELETE FROM notes WHERE id = ? AND deleted = 1`, id)
-	return err
+func (db *DB) PermanentlyDeleteSynced(ctx context.Context, id int64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM notes WHERE id = ? AND deleted = 1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+	// Attachments go with the note
+	if _, err := tx.ExecContext(ctx, `DELETE FROM attachments WHERE note_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM reminders WHERE note_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM note_properties WHERE note_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := purgeOrphanBlobs(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // Version control functions
 
-func (db *DB) SaveNoteVersion(noteID int64, title, content string, tags []string) error {
+func (db *DB) SaveNoteVersion(ctx context.Context, noteID int64, title, content string, tags []string) error {
+	// The version number is read and used in one transaction, so concurrent
+	// saves cannot take the same one
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := db.saveNoteVersion(ctx, tx, noteID, title, content, tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// saveNoteVersion is SaveNoteVersion within the transaction tx.
+func (db *DB) saveNoteVersion(ctx context.Context, tx querier, noteID int64, title, content string, tags []string) error {
 	// Calculate hash of content
 	hash := sha256.Sum256([]byte(content))
 	hashStr := hex.EncodeToString(hash[:])[:12] // First 12 chars for short hash
 
 	// Check if the last version has the same hash (no actual changes)
 	var lastHash sql.NullString
-	err := db.conn.QueryRow(`
+	err := tx.QueryRowContext(ctx, `
 		SELECT hash FROM note_versions 
 		WHERE note_id = ? 
 		ORDER BY version_num DESC 
@@ -350,24 +564,31 @@ func (db *DB) SaveNoteVersion(noteID int64, title, content string, tags []string
 
 	// Get current version number for this note
 	var maxVersion int
-	err = db.conn.QueryRow(`SELECT COALESCE(MAX(version_num), 0) FROM note_versions WHERE note_id = ?`, noteID).Scan(&maxVersion)
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version_num), 0) FROM note_versions WHERE note_id = ?`, noteID).Scan(&maxVersion)
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
 
-	tagsJSON, _ := json.Marshal(tags)
+	// Store a delta against the latest snapshot, or a new snapshot
+	kind, baseID, payload, err := db.encodeVersion(ctx, tx, noteID, content)
+	if err != nil {
+		return err
+	}
 
-	_, err = db.conn.Exec(`
-		INSERT INTO note_versions (note_id, title, content, tags, hash, version_num, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
-	`, noteID, title, content, string(tagsJSON), hashStr, maxVersion+1)
+	tagsJSON, _ := json.Marshal(tags)
 
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO note_versions (note_id, title, content, tags, hash, version_num, kind, base_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, noteID, title, payload, string(tagsJSON), hashStr, maxVersion+1, kind, baseID)
 	return err
 }
 
-func (db *DB) GetNoteVersions(noteID int64) ([]NoteVersion, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, note_id, title, content, tags, hash, version_num, created_at
+// GetNoteVersions returns the history of a note, newest first, with the
+// content of every version reconstructed and decrypted.
+func (db *DB) GetNoteVersions(ctx context.Context, noteID int64) ([]NoteVersion, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, note_id, title, content, tags, hash, version_num, created_at, kind, base_id
 		FROM note_versions
 		WHERE note_id = ?
 		ORDER BY version_num DESC
@@ -378,11 +599,13 @@ func (db *DB) GetNoteVersions(noteID int64) ([]NoteVersion, error) {
 	defer rows.Close()
 
 	var versions []NoteVersion
+	var stored []storedVersion
 	for rows.Next() {
 		var v NoteVersion
+		var sv storedVersion
 		var tagsJSON string
 		var hash sql.NullString
-		err := rows.Scan(&v.ID, &v.NoteID, &v.Title, &v.Content, &tagsJSON, &hash, &v.VersionNum, &v.CreatedAt)
+		err := rows.Scan(&v.ID, &v.NoteID, &v.Title, &sv.payload, &tagsJSON, &hash, &v.VersionNum, &v.CreatedAt, &sv.kind, &sv.baseID)
 		if err != nil {
 			return nil, err
 		}
@@ -391,19 +614,36 @@ func (db *DB) GetNoteVersions(noteID int64) ([]NoteVersion, error) {
 		}
 		json.Unmarshal([]byte(tagsJSON), &v.Tags)
 		versions = append(versions, v)
+		stored = append(stored, sv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	return versions, rows.Err()
+	rows.Close()
+
+	snapshots := make(map[int64]string)
+	for i := range versions {
+		// Versions that cannot be rebuilt (e.g. other key) are listed without content
+		versions[i].Content, _ = db.decodeVersion(ctx, db.conn, stored[i], snapshots)
+	}
+	return versions, nil
+}
+
+// GetNoteVersion returns a single version with its content reconstructed.
+func (db *DB) GetNoteVersion(ctx context.Context, versionID int64) (*NoteVersion, error) {
+	return db.getNoteVersion(ctx, db.conn, versionID)
 }
 
-func (db *DB) GetNoteVersion(versionID int64) (*NoteVersion, error) {
+func (db *DB) getNoteVersion(ctx context.Context, conn querier, versionID int64) (*NoteVersion, error) {
 	var v NoteVersion
+	var sv storedVersion
 	var tagsJSON string
 	var hash sql.NullString
-	err := db.conn.QueryRow(`
-		SELECT id, note_id, title, content, tags, hash, version_num, created_at
+	err := conn.QueryRowContext(ctx, `
+		SELECT id, note_id, title, content, tags, hash, version_num, created_at, kind, base_id
 		FROM note_versions
 		WHERE id = ?
-	`, versionID).Scan(&v.ID, &v.NoteID, &v.Title, &v.Content, &tagsJSON, &hash, &v.VersionNum, &v.CreatedAt)
+	`, versionID).Scan(&v.ID, &v.NoteID, &v.Title, &sv.payload, &tagsJSON, &hash, &v.VersionNum, &v.CreatedAt, &sv.kind, &sv.baseID)
 
 	if err != nil {
 		return nil, err
@@ -412,43 +652,76 @@ func (db *DB) GetNoteVersion(versionID int64) (*NoteVersion, error) {
 		v.Hash = hash.String
 	}
 	json.Unmarshal([]byte(tagsJSON), &v.Tags)
+
+	v.Content, err = db.decodeVersion(ctx, conn, sv, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconstruct version: %w", err)
+	}
 	return &v, nil
 }
 
-func (db *DB) RestoreNoteVersion(noteID int64, versionID int64) error {
-	version, err := db.GetNoteVersion(versionID)
+func (db *DB) RestoreNoteVersion(ctx context.Context, noteID int64, versionID int64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkWritable(ctx, tx, noteID); err != nil {
+		return err
+	}
+	version, err := db.getNoteVersion(ctx, tx, versionID)
+	if err != nil {
+		return err
+	}
+
+	// Versions are returned in plaintext; note content is stored encrypted
+	content, err := db.seal(version.Content)
 	if err != nil {
 		return err
 	}
 
 	tagsJSON, _ := json.Marshal(version.Tags)
-	_, err = db.conn.Exec(`
+	_, err = tx.ExecContext(ctx, `
 		UPDATE notes
 		SET title = ?, content = ?, tags = ?, updated_at = CURRENT_TIMESTAMP, sync_status = 'pending'
 		WHERE id = ?
-	`, version.Title, version.Content, string(tagsJSON), noteID)
+	`, version.Title, content, string(tagsJSON), noteID)
+	if err != nil {
+		return err
+	}
 
-	return err
+	if err := indexNoteTags(ctx, tx, noteID, version.Tags); err != nil {
+		return err
+	}
+	if err := db.indexNoteContent(ctx, tx, noteID, version.Content); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // Folder operations
-func (db *DB) CreateFolder(title string, parentID int64) (int64, error) {
-	result, err := db.conn.Exec(`
+func (db *DB) CreateFolder(ctx context.Context, title string, parentID int64) (int64, error) {
+	result, err := db.conn.ExecContext(ctx, `
 		INSERT INTO folders (title, parent_folder_id, created_at, updated_at)
 		VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 	`, title, parentID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create folder: %w", err)
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, recordFolderVersion(ctx, db.conn, id)
 }
 
-func (db *DB) GetFolder(id int64) (*Folder, error) {
+func (db *DB) GetFolder(ctx context.Context, id int64) (*Folder, error) {
 	var f Folder
 	var parentID sql.NullInt64
 	var password sql.NullString
 
-	err := db.conn.QueryRow(`
+	err := db.conn.QueryRowContext(ctx, `
 		SELECT id, title, password, parent_folder_id, created_at, updated_at, COALESCE(deleted, 0)
 		FROM folders WHERE id = ?
 	`, id).Scan(&f.ID, &f.Title, &password, &parentID, &f.CreatedAt, &f.UpdatedAt, &f.Deleted)
@@ -467,14 +740,19 @@ func (db *DB) GetFolder(id int64) (*Folder, error) {
 	return &f, nil
 }
 
-func (db *DB) ListFolders(parentID int64) ([]Folder, error) {
-	rows, err := db.conn.Query(`
+// ListFolders returns the subfolders of a folder, by title or, in manual
+// sort, by position.
+func (db *DB) ListFolders(ctx context.Context, parentID int64) ([]Folder, error) {
+	sort, err := db.GetFolderSort(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.conn.QueryContext(ctx, `
 		SELECT id, title, password, parent_folder_id, created_at, updated_at, COALESCE(deleted, 0)
 		FROM folders
 		WHERE (parent_folder_id = ? OR (parent_folder_id IS NULL AND ? = 0))
 		AND (deleted = 0 OR deleted IS NULL)
-		ORDER BY title ASC
-	`, parentID, parentID)
+		ORDER BY `+sort.folderOrder(), parentID, parentID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list folders: %w", err)
 	}
@@ -499,15 +777,34 @@ func (db *DB) ListFolders(parentID int64) ([]Folder, error) {
 	return folders, rows.Err()
 }
 
-func (db *DB) ListNotesInFolder(folderID int64) ([]NoteListItem, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, title, updated_at, COALESCE(sync_status, 'local'), 'note' as type
+// ListNotesInFolder returns the notes of a folder in its sort order.
+// Archived notes are left out.
+func (db *DB) ListNotesInFolder(ctx context.Context, folderID int64) ([]NoteListItem, error) {
+	return db.listNotes(ctx, folderID, false)
+}
+
+// ListNotesWithArchived is ListNotesInFolder including archived notes; the
+// root is folder 0.
+func (db *DB) ListNotesWithArchived(ctx context.Context, folderID int64) ([]NoteListItem, error) {
+	return db.listNotes(ctx, folderID, true)
+}
+
+func (db *DB) listNotes(ctx context.Context, folderID int64, archived bool) ([]NoteListItem, error) {
+	sort, err := db.GetFolderSort(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT id, title, updated_at, COALESCE(sync_status, 'local'), 'note' as type,
+		       COALESCE(password, '') != '', COALESCE(pinned, 0), COALESCE(archived, 0), COALESCE(read_only, 0)
 		FROM notes
-		WHERE parent_folder_id = ? AND (deleted = 0 OR deleted IS NULL)
-		ORDER BY updated_at DESC
-	`, folderID)
+		WHERE COALESCE(parent_folder_id, 0) = ? AND (deleted = 0 OR deleted IS NULL)`
+	if !archived {
+		query += ` AND COALESCE(archived, 0) = 0`
+	}
+	rows, err := db.conn.QueryContext(ctx, query+` ORDER BY `+sort.noteOrder(), folderID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list notes in folder: %w", err)
+		return nil, fmt.Errorf("failed to list notes: %w", err)
 	}
 	defer rows.Close()
 
@@ -515,7 +812,8 @@ func (db *DB) ListNotesInFolder(folderID int64) ([]NoteListItem, error) {
 	for rows.Next() {
 		var n NoteListItem
 		var syncStatus string
-		if err := rows.Scan(&n.ID, &n.Title, &n.UpdatedAt, &syncStatus, &n.Type); err != nil {
+		if err := rows.Scan(&n.ID, &n.Title, &n.UpdatedAt, &syncStatus, &n.Type, &n.Locked,
+			&n.Pinned, &n.Archived, &n.ReadOnly); err != nil {
 			return nil, fmt.Errorf("failed to scan note: %w", err)
 		}
 		n.SyncStatus = SyncStatus(syncStatus)
@@ -524,30 +822,73 @@ func (db *DB) ListNotesInFolder(folderID int64) ([]NoteListItem, error) {
 	return notes, rows.Err()
 }
 
-func (db *DB) CountNotesInFolder(folderID int64) (int, error) {
+// CountNotesInFolder returns the number of notes in a folder. Archived notes
+// are counted only with archived, as the list shows them.
+func (db *DB) CountNotesInFolder(ctx context.Context, folderID int64, archived bool) (int, error) {
 	var count int
-	err := db.conn.QueryRow(`
+	err := db.conn.QueryRowContext(ctx, `
 		SELECT COUNT(*) FROM notes
 		WHERE parent_folder_id = ? AND (deleted = 0 OR deleted IS NULL)
-	`, folderID).Scan(&count)
+		  AND (? OR COALESCE(archived, 0) = 0)
+	`, folderID, archived).Scan(&count)
 	return count, err
 }
 
-func (db *DB) SetNotePassword(noteID int64, password string) error {
-	_, err := db.conn.Exec(`
+// CountNotesInSubfolders returns the number of notes in each subfolder of
+// parentID, in one query. Empty folders are left out. Archived notes are
+// counted only with archived.
+func (db *DB) CountNotesInSubfolders(ctx context.Context, parentID int64, archived bool) (map[int64]int, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT f.id, COUNT(*) FROM folders f
+		JOIN notes n ON n.parent_folder_id = f.id AND (n.deleted = 0 OR n.deleted IS NULL)
+			AND (? OR COALESCE(n.archived, 0) = 0)
+		WHERE (f.parent_folder_id = ? OR (f.parent_folder_id IS NULL AND ? = 0))
+		GROUP BY f.id
+	`, archived, parentID, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count notes: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int)
+	for rows.Next() {
+		var id int64
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, fmt.Errorf("failed to count notes: %w", err)
+		}
+		counts[id] = count
+	}
+	return counts, rows.Err()
+}
+
+func (db *DB) SetNotePassword(ctx context.Context, noteID int64, password string) error {
+	_, err := db.conn.ExecContext(ctx, `
 		UPDATE notes SET password = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
 	`, password, noteID)
 	return err
 }
 
-func (db *DB) SetFolderPassword(folderID int64, password string) error {
-	_, err := db.conn.Exec(`
+func (db *DB) SetFolderPassword(ctx context.Context, folderID int64, password string) error {
+	_, err := db.conn.ExecContext(ctx, `
 		UPDATE folders SET password = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
 	`, password, folderID)
 	return err
 }
 
-func (db *DB) DeleteFolder(id int64) error {
-	_, err := db.conn.Exec(`UPDATE folders SET deleted = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
-	return err
+func (db *DB) DeleteFolder(ctx context.Context, id int64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE folders SET deleted = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if err := recordFolderVersion(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDB opens a vault in a temporary directory, without encryption.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	database, err := New(filepath.Join(t.TempDir(), "jotaku.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func TestReadOnlyNoteIsNotChanged(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	locked, _ := database.CreateNoteInFolder(ctx, "Verbale", "vedi [[Progetto]]", nil, 0)
+	open, _ := database.CreateNoteInFolder(ctx, "Appunti", "vedi [[Progetto]]", nil, 0)
+	target, _ := database.CreateNoteInFolder(ctx, "Progetto", "", nil, 0)
+	if err := database.SetNoteReadOnly(ctx, locked.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.UpdateNote(ctx, locked.ID, "Verbale", "cambiato", nil); !errors.Is(err, ErrNoteReadOnly) {
+		t.Fatalf("update of a read-only note: %v, want ErrNoteReadOnly", err)
+	}
+
+	if _, err := database.RenameNote(ctx, locked.ID, "Verbale 2"); !errors.Is(err, ErrNoteReadOnly) {
+		t.Fatalf("rename of a read-only note: %v, want ErrNoteReadOnly", err)
+	}
+
+	rewritten, err := database.RenameNote(ctx, target.ID, "Progetto 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewritten != 1 {
+		t.Fatalf("%d notes rewritten, want 1", rewritten)
+	}
+	if n, _ := database.GetNote(ctx, locked.ID); n.Content != "vedi [[Progetto]]" {
+		t.Fatalf("read-only note rewritten: %q", n.Content)
+	}
+	if n, _ := database.GetNote(ctx, open.ID); n.Content != "vedi [[Progetto 2]]" {
+		t.Fatalf("note content %q after the rename", n.Content)
+	}
+}
+
+func TestCountNotesInSubfolders(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	work, _ := database.CreateFolder(ctx, "Lavoro", 0)
+	home, _ := database.CreateFolder(ctx, "Casa", 0)
+	empty, _ := database.CreateFolder(ctx, "Vuota", 0)
+	clients, _ := database.CreateFolder(ctx, "Clienti", work)
+	database.CreateNoteInFolder(ctx, "Riunione", "", nil, work)
+	database.CreateNoteInFolder(ctx, "Budget", "", nil, work)
+	gone, _ := database.CreateNoteInFolder(ctx, "Spesa", "", nil, home)
+	database.CreateNoteInFolder(ctx, "Bollette", "", nil, home)
+	database.CreateNoteInFolder(ctx, "Rossi", "", nil, clients)
+	old, _ := database.CreateNoteInFolder(ctx, "Bianchi", "", nil, clients)
+	database.DeleteNote(ctx, gone.ID)
+	database.SetNoteArchived(ctx, old.ID, true)
+
+	counts, err := database.CountNotesInSubfolders(ctx, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[work] != 2 || counts[home] != 1 || counts[empty] != 0 || len(counts) != 2 {
+		t.Fatalf("note counts %v", counts)
+	}
+	// Archived notes count only when they are shown
+	if counts, _ := database.CountNotesInSubfolders(ctx, work, false); len(counts) != 1 || counts[clients] != 1 {
+		t.Fatalf("note counts in Lavoro %v", counts)
+	}
+	if counts, _ := database.CountNotesInSubfolders(ctx, work, true); counts[clients] != 2 {
+		t.Fatalf("note counts in Lavoro with archived notes %v", counts)
+	}
+	if count, _ := database.CountNotesInFolder(ctx, clients, false); count != 1 {
+		t.Fatalf("%d notes in Clienti, want 1 without archived notes", count)
+	}
+}
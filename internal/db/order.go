@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Every folder (0 = root) has a sort mode, kept on this device. Pinned notes
+// always come first, folders next and then the other notes; in manual mode
+// the three groups follow the positions set by moving items.
+
+type SortMode string
+
+const (
+	SortUpdated SortMode = "updated"
+	SortCreated SortMode = "created"
+	SortTitle   SortMode = "title"
+	SortSize    SortMode = "size"
+	SortManual  SortMode = "manual"
+)
+
+// SortModes is the order the modes are cycled through.
+var SortModes = []SortMode{SortUpdated, SortCreated, SortTitle, SortSize, SortManual}
+
+// FolderSort is the sort preference of a folder.
+type FolderSort struct {
+	FolderID int64    `json:"folder_id"`
+	Mode     SortMode `json:"mode"`
+	Desc     bool     `json:"desc"`
+}
+
+// DefaultSort is the sort of a folder that has none saved: most recently
+// updated first, as notes were always listed.
+func DefaultSort(folderID int64) FolderSort {
+	return FolderSort{FolderID: folderID, Mode: SortUpdated, Desc: true}
+}
+
+// Next returns the sort with the following mode, in its natural direction.
+func (s FolderSort) Next() FolderSort {
+	next := SortModes[0]
+	for i, mode := range SortModes {
+		if mode == s.Mode && i+1 < len(SortModes) {
+			next = SortModes[i+1]
+		}
+	}
+	s.Mode = next
+	s.Desc = next == SortUpdated || next == SortCreated || next == SortSize
+	return s
+}
+
+func direction(desc bool) string {
+	if desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// noteOrder is the ORDER BY clause for the notes of the folder.
+func (s FolderSort) noteOrder() string {
+	dir := direction(s.Desc)
+	switch s.Mode {
+	case SortCreated:
+		return "pinned DESC, created_at " + dir + ", id " + dir
+	case SortTitle:
+		return "pinned DESC, title COLLATE NOCASE " + dir + ", id"
+	case SortSize:
+		return "pinned DESC, LENGTH(content) " + dir + ", id"
+	case SortManual:
+		return "pinned DESC, position ASC, updated_at DESC"
+	}
+	return "pinned DESC, updated_at " + dir + ", id " + dir
+}
+
+// folderOrder is the ORDER BY clause for the subfolders: by title, or by
+// position in manual mode.
+func (s FolderSort) folderOrder() string {
+	switch s.Mode {
+	case SortManual:
+		return "position ASC, title COLLATE NOCASE ASC"
+	case SortTitle:
+		return "title COLLATE NOCASE " + direction(s.Desc)
+	}
+	return "title COLLATE NOCASE ASC"
+}
+
+// GetFolderSort returns the sort of a folder, or the default one.
+func (db *DB) GetFolderSort(ctx context.Context, folderID int64) (FolderSort, error) {
+	s := FolderSort{FolderID: folderID}
+	var mode string
+	err := db.conn.QueryRowContext(ctx, `SELECT mode, descending FROM folder_sort WHERE folder_id = ?`, folderID).Scan(&mode, &s.Desc)
+	if err == sql.ErrNoRows {
+		return DefaultSort(folderID), nil
+	}
+	if err != nil {
+		return FolderSort{}, fmt.Errorf("failed to get folder sort: %w", err)
+	}
+	s.Mode = SortMode(mode)
+	return s, nil
+}
+
+// SaveFolderSort stores the sort of a folder.
+func (db *DB) SaveFolderSort(ctx context.Context, s FolderSort) error {
+	_, err := db.conn.ExecContext(ctx, `
+		INSERT INTO folder_sort (folder_id, mode, descending, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(folder_id) DO UPDATE SET mode = excluded.mode, descending = excluded.descending,
+			updated_at = excluded.updated_at
+	`, s.FolderID, string(s.Mode), s.Desc, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save folder sort: %w", err)
+	}
+	return nil
+}
+
+// SetNotePinned pins or unpins a note. Like positions, pins stay on this
+// device and do not mark the note for sync.
+func (db *DB) SetNotePinned(ctx context.Context, id int64, pinned bool) error {
+	if _, err := db.conn.ExecContext(ctx, `UPDATE notes SET pinned = ? WHERE id = ?`, pinned, id); err != nil {
+		return fmt.Errorf("failed to pin note: %w", err)
+	}
+	return nil
+}
+
+// SetManualOrder stores items, the notes and folders of a folder, in the
+// given order and switches the folder to manual sort.
+func (db *DB) SetManualOrder(ctx context.Context, folderID int64, items []NoteListItem) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, item := range items {
+		query := `UPDATE notes SET position = ? WHERE id = ?`
+		if item.Type == "folder" {
+			query = `UPDATE folders SET position = ? WHERE id = ?`
+		}
+		if _, err := tx.ExecContext(ctx, query, i+1, item.ID); err != nil {
+			return fmt.Errorf("failed to save order: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO folder_sort (folder_id, mode, descending, updated_at) VALUES (?, ?, 0, ?)
+		ON CONFLICT(folder_id) DO UPDATE SET mode = excluded.mode, descending = 0,
+			updated_at = excluded.updated_at
+	`, folderID, string(SortManual), time.Now()); err != nil {
+		return fmt.Errorf("failed to save folder sort: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,637 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Properties are typed fields of a note, such as the status of a client or
+// the author of a book. They are stored encrypted, one sealed JSON list per
+// note. Keys of a YAML front matter block at the top of the note are read
+// into properties whenever the note is written, which is also how they reach
+// other devices: properties set only from the metadata panel stay local.
+//
+//	---
+//	status: active
+//	rating: 4
+//	due: 2024-06-01
+//	---
+
+type PropertyType string
+
+const (
+	PropertyText     PropertyType = "text"
+	PropertyNumber   PropertyType = "number"
+	PropertyDate     PropertyType = "date"
+	PropertySelect   PropertyType = "select"
+	PropertyCheckbox PropertyType = "checkbox"
+)
+
+var PropertyTypes = []PropertyType{PropertyText, PropertyNumber, PropertyDate, PropertySelect, PropertyCheckbox}
+
+type Property struct {
+	Name        string       `json:"name"`
+	Type        PropertyType `json:"type"`
+	Value       string       `json:"value"`                  // Valore normalizzato, vedi NormalizeValue
+	Options     []string     `json:"options,omitempty"`      // Valori ammessi, solo per select
+	FrontMatter bool         `json:"front_matter,omitempty"` // Letta dal front matter della nota
+}
+
+// Keys of the front matter that are not properties
+var reservedProperties = map[string]bool{"title": true, "tags": true}
+
+// NormalizeValue checks a value against the property type and returns it in
+// canonical form: numbers without trailing zeros, dates as 2006-01-02 and
+// checkboxes as "true" or "false". Empty values are always allowed.
+func (p Property) NormalizeValue(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	switch p.Type {
+	case PropertyNumber:
+		f, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+		if err != nil {
+			return "", fmt.Errorf("%s: %q is not a number", p.Name, value)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case PropertyDate:
+		for _, layout := range []string{"2006-01-02", time.RFC3339, "2006-01-02 15:04", "02/01/2006"} {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t.Format("2006-01-02"), nil
+			}
+		}
+		return "", fmt.Errorf("%s: %q is not a date (use 2006-01-02)", p.Name, value)
+	case PropertyCheckbox:
+		switch strings.ToLower(value) {
+		case "true", "yes", "y", "x", "1", "on", "si", "sì":
+			return "true", nil
+		case "false", "no", "n", "0", "off":
+			return "false", nil
+		}
+		return "", fmt.Errorf("%s: %q is not true or false", p.Name, value)
+	case PropertySelect:
+		if len(p.Options) == 0 {
+			return value, nil
+		}
+		for _, o := range p.Options {
+			if strings.EqualFold(o, value) {
+				return o, nil
+			}
+		}
+		return "", fmt.Errorf("%s: %q is not one of %s", p.Name, value, strings.Join(p.Options, ", "))
+	}
+	return value, nil
+}
+
+var propertyDefPattern = regexp.MustCompile(`^([^:()]+?)\s*(?::\s*([a-z]+)\s*(?:\((.*)\))?)?$`)
+
+// ParsePropertyDef reads a property definition typed by the user, as
+// "name", "name:type" or "name:select(a, b, c)". The type defaults to text.
+func ParsePropertyDef(input string) (Property, error) {
+	m := propertyDefPattern.FindStringSubmatch(strings.TrimSpace(input))
+	if m == nil || strings.TrimSpace(m[1]) == "" {
+		return Property{}, fmt.Errorf("invalid property %q, use name:type", input)
+	}
+	p := Property{Name: strings.TrimSpace(m[1]), Type: PropertyText}
+	if reservedProperties[strings.ToLower(p.Name)] {
+		return Property{}, fmt.Errorf("%q is not a property name", p.Name)
+	}
+	if m[2] != "" {
+		p.Type = PropertyType(m[2])
+		valid := false
+		for _, t := range PropertyTypes {
+			valid = valid || t == p.Type
+		}
+		if !valid {
+			return Property{}, fmt.Errorf("unknown property type %q", m[2])
+		}
+	}
+	if m[3] != "" {
+		if p.Type != PropertySelect {
+			return Property{}, fmt.Errorf("only select properties have options")
+		}
+		for _, o := range strings.Split(m[3], ",") {
+			if o = strings.TrimSpace(o); o != "" {
+				p.Options = append(p.Options, o)
+			}
+		}
+	}
+	return p, nil
+}
+
+// frontMatterBounds returns the line indexes of the opening and closing "---"
+// of the front matter, or -1, -1 if there is none.
+func frontMatterBounds(lines []string) (int, int) {
+	if len(lines) < 2 || strings.TrimSpace(lines[0]) != "---" {
+		return -1, -1
+	}
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "---" {
+			return 0, i
+		}
+	}
+	return -1, -1
+}
+
+var isoDatePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// ParseFrontMatter returns the properties set in the front matter of a note,
+// in order, with types guessed from the YAML values. Lists and nested maps
+// are not properties and are skipped.
+func ParseFrontMatter(content string) []Property {
+	lines := strings.Split(content, "\n")
+	start, end := frontMatterBounds(lines)
+	if start < 0 {
+		return nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(strings.Join(lines[start+1:end], "\n")), &doc); err != nil {
+		return nil
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var props []Property
+	mapping := doc.Content[0].Content
+	for i := 0; i+1 < len(mapping); i += 2 {
+		key, value := mapping[i], mapping[i+1]
+		if value.Kind != yaml.ScalarNode || reservedProperties[strings.ToLower(key.Value)] {
+			continue
+		}
+		p := Property{Name: key.Value, Type: PropertyText, Value: value.Value, FrontMatter: true}
+		switch value.Tag {
+		case "!!int", "!!float":
+			p.Type = PropertyNumber
+		case "!!bool":
+			p.Type = PropertyCheckbox
+		case "!!timestamp":
+			p.Type = PropertyDate
+		case "!!null":
+			p.Value = ""
+		default:
+			if isoDatePattern.MatchString(value.Value) {
+				p.Type = PropertyDate
+			}
+		}
+		if normalized, err := p.NormalizeValue(p.Value); err == nil {
+			p.Value = normalized
+		} else {
+			p.Type = PropertyText
+		}
+		props = append(props, p)
+	}
+	return props
+}
+
+// setFrontMatterValue rewrites the line of a front matter key. It returns
+// false when the note has no such line. An empty value with remove deletes
+// the line.
+func setFrontMatterValue(content, name, value string, remove bool) (string, bool) {
+	lines := strings.Split(content, "\n")
+	start, end := frontMatterBounds(lines)
+	if start < 0 {
+		return content, false
+	}
+	for i := start + 1; i < end; i++ {
+		key, _, ok := strings.Cut(lines[i], ":")
+		// Only top-level keys, not indented ones
+		if !ok || key != strings.TrimSpace(key) || !strings.EqualFold(key, name) {
+			continue
+		}
+		if remove {
+			lines = append(lines[:i], lines[i+1:]...)
+		} else {
+			lines[i] = key + ": " + yamlScalar(value)
+		}
+		return strings.Join(lines, "\n"), true
+	}
+	return content, false
+}
+
+// yamlScalar quotes a value when YAML would not read it back as the same
+// string.
+func yamlScalar(value string) string {
+	var back string
+	if err := yaml.Unmarshal([]byte("v: "+value), &struct {
+		V *string `yaml:"v"`
+	}{&back}); err == nil && back == value && !strings.ContainsAny(value, "#\n") {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+// NoteProperties returns the properties of a note, in order.
+func (db *DB) NoteProperties(ctx context.Context, noteID int64) ([]Property, error) {
+	return db.noteProperties(ctx, db.conn, noteID)
+}
+
+func (db *DB) noteProperties(ctx context.Context, conn querier, noteID int64) ([]Property, error) {
+	var sealed string
+	err := conn.QueryRowContext(ctx, `SELECT payload FROM note_properties WHERE note_id = ?`, noteID).Scan(&sealed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get properties: %w", err)
+	}
+	plain, err := db.open(sealed)
+	if err != nil {
+		return nil, err
+	}
+	var props []Property
+	if err := json.Unmarshal([]byte(plain), &props); err != nil {
+		return nil, fmt.Errorf("failed to read properties: %w", err)
+	}
+	return props, nil
+}
+
+func (db *DB) saveProperties(ctx context.Context, conn querier, noteID int64, props []Property) error {
+	if len(props) == 0 {
+		_, err := conn.ExecContext(ctx, `DELETE FROM note_properties WHERE note_id = ?`, noteID)
+		return err
+	}
+	data, err := json.Marshal(props)
+	if err != nil {
+		return err
+	}
+	sealed, err := db.seal(string(data))
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, `
+		INSERT INTO note_properties (note_id, payload) VALUES (?, ?)
+		ON CONFLICT(note_id) DO UPDATE SET payload = excluded.payload
+	`, noteID, sealed)
+	if err != nil {
+		return fmt.Errorf("failed to save properties: %w", err)
+	}
+	return nil
+}
+
+// indexNoteProperties merges the front matter of a note into its properties.
+func (db *DB) indexNoteProperties(ctx context.Context, conn querier, noteID int64, plaintext string) error {
+	stored, err := db.noteProperties(ctx, conn, noteID)
+	if err != nil {
+		return nil
+	}
+	front := ParseFrontMatter(plaintext)
+	if len(front) == 0 && len(stored) == 0 {
+		return nil
+	}
+	return db.saveProperties(ctx, conn, noteID, mergeFrontMatter(stored, front))
+}
+
+// mergeFrontMatter merges the properties read from a note's front matter into
+// the stored ones. A stored property keeps its type (and select options) when
+// the front matter value fits it; properties that came from keys no longer in
+// the front matter are dropped.
+func mergeFrontMatter(stored, front []Property) []Property {
+	var merged []Property
+	seen := make(map[string]bool)
+	for _, f := range front {
+		seen[strings.ToLower(f.Name)] = true
+		for _, s := range stored {
+			if !strings.EqualFold(s.Name, f.Name) || s.Type == f.Type {
+				continue
+			}
+			// Keep the declared type if the value fits it
+			if s.Type == PropertySelect && f.Value != "" && !containsFold(s.Options, f.Value) {
+				s.Options = append(append([]string(nil), s.Options...), f.Value)
+			}
+			if value, err := s.NormalizeValue(f.Value); err == nil {
+				s.Value, s.FrontMatter = value, true
+				f = s
+			}
+			break
+		}
+		merged = append(merged, f)
+	}
+	for _, s := range stored {
+		if !s.FrontMatter && !seen[strings.ToLower(s.Name)] {
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetNoteProperty adds or changes a property of a note. When the note's
+// front matter has the key, the line is rewritten too, saving a version of
+// the note, so the value does not change back on the next edit.
+func (db *DB) SetNoteProperty(ctx context.Context, noteID int64, p Property) error {
+	value, err := p.NormalizeValue(p.Value)
+	if err != nil {
+		return err
+	}
+	p.Value = value
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkWritable(ctx, tx, noteID); err != nil {
+		return err
+	}
+	props, err := db.noteProperties(ctx, tx, noteID)
+	if err != nil {
+		return err
+	}
+	if err := db.saveProperties(ctx, tx, noteID, putProperty(props, p)); err != nil {
+		return err
+	}
+	if err := db.rewriteFrontMatter(ctx, tx, noteID, p.Name, p.Value, false); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteNoteProperty removes a property, and its front matter line if any.
+func (db *DB) DeleteNoteProperty(ctx context.Context, noteID int64, name string) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkWritable(ctx, tx, noteID); err != nil {
+		return err
+	}
+	props, err := db.noteProperties(ctx, tx, noteID)
+	if err != nil {
+		return err
+	}
+	if err := db.saveProperties(ctx, tx, noteID, dropProperty(props, name)); err != nil {
+		return err
+	}
+	if err := db.rewriteFrontMatter(ctx, tx, noteID, name, "", true); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// putProperty replaces the property with the name of p, keeping where it
+// came from, or appends p.
+func putProperty(props []Property, p Property) []Property {
+	for i := range props {
+		if strings.EqualFold(props[i].Name, p.Name) {
+			p.FrontMatter = props[i].FrontMatter
+			props[i] = p
+			return props
+		}
+	}
+	return append(props, p)
+}
+
+func dropProperty(props []Property, name string) []Property {
+	var kept []Property
+	for _, p := range props {
+		if !strings.EqualFold(p.Name, name) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+func (db *DB) rewriteFrontMatter(ctx context.Context, tx querier, noteID int64, name, value string, remove bool) error {
+	note, err := getNote(ctx, tx, noteID)
+	if err != nil || note == nil {
+		return err
+	}
+	plaintext, err := db.open(note.Content)
+	if err != nil {
+		return nil
+	}
+	updated, ok := setFrontMatterValue(plaintext, name, value, remove)
+	if !ok || updated == plaintext {
+		return nil
+	}
+	if err := db.saveNoteVersion(ctx, tx, noteID, note.Title, updated, note.Tags); err != nil {
+		return err
+	}
+	sealed, err := db.seal(updated)
+	if err != nil {
+		return err
+	}
+	return db.updateNote(ctx, tx, noteID, note.Title, sealed, note.Tags)
+}
+
+// PropertyColumn is a column of the table view.
+type PropertyColumn struct {
+	Name string       `json:"name"`
+	Type PropertyType `json:"type"`
+}
+
+// PropertyRow is a note in the table view, with its properties by name.
+type PropertyRow struct {
+	NoteID    int64               `json:"note_id"`
+	Title     string              `json:"title"`
+	UpdatedAt time.Time           `json:"updated_at"`
+	Values    map[string]Property `json:"values"` // Per nome in minuscolo
+}
+
+// Value returns the value of a column, "" if the note does not have it.
+func (r PropertyRow) Value(column string) string {
+	return r.Values[strings.ToLower(column)].Value
+}
+
+// PropertyTable is the table view of a folder: a row per note, a column per
+// property used by any of them.
+type PropertyTable struct {
+	Columns []PropertyColumn `json:"columns"`
+	Rows    []PropertyRow    `json:"rows"`
+}
+
+// PropertyTable lists the notes directly in a folder (0 = root) with their
+// properties, by title. Protected notes are left out.
+func (db *DB) PropertyTable(ctx context.Context, folderID int64) (*PropertyTable, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT n.id, n.title, n.updated_at, p.payload
+		FROM notes n LEFT JOIN note_properties p ON p.note_id = n.id
+		WHERE COALESCE(n.parent_folder_id, 0) = ? AND (n.deleted = 0 OR n.deleted IS NULL)
+		  AND (n.password IS NULL OR n.password = '') AND COALESCE(n.archived, 0) = 0
+		ORDER BY n.title COLLATE NOCASE
+	`, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	defer rows.Close()
+
+	table := &PropertyTable{}
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var row PropertyRow
+		var sealed sql.NullString
+		if err := rows.Scan(&row.NoteID, &row.Title, &row.UpdatedAt, &sealed); err != nil {
+			return nil, fmt.Errorf("failed to scan note: %w", err)
+		}
+		var props []Property
+		if sealed.Valid {
+			if plain, err := db.open(sealed.String); err == nil {
+				json.Unmarshal([]byte(plain), &props)
+			}
+		}
+		table.addRow(row, props, columns)
+	}
+	return table, rows.Err()
+}
+
+// addRow appends a note to the table, adding a column for each property not
+// seen yet.
+func (t *PropertyTable) addRow(row PropertyRow, props []Property, columns map[string]bool) {
+	row.Values = make(map[string]Property)
+	for _, p := range props {
+		name := strings.ToLower(p.Name)
+		row.Values[name] = p
+		if !columns[name] {
+			columns[name] = true
+			t.Columns = append(t.Columns, PropertyColumn{Name: p.Name, Type: p.Type})
+		}
+	}
+	t.Rows = append(t.Rows, row)
+}
+
+// compareValues orders two values of a column type. Both must be non-empty.
+func compareValues(t PropertyType, a, b string) int {
+	switch t {
+	case PropertyNumber:
+		x, errA := strconv.ParseFloat(a, 64)
+		y, errB := strconv.ParseFloat(b, 64)
+		if errA == nil && errB == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	case PropertyDate, PropertyCheckbox:
+		// ISO dates and "false" < "true" compare as strings
+		return strings.Compare(a, b)
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func (t *PropertyTable) columnType(name string) PropertyType {
+	for _, c := range t.Columns {
+		if strings.EqualFold(c.Name, name) {
+			return c.Type
+		}
+	}
+	return PropertyText
+}
+
+// Sort orders the rows by a column ("" = title). Notes without a value go
+// last either way.
+func (t *PropertyTable) Sort(column string, desc bool) {
+	typ := t.columnType(column)
+	sort.SliceStable(t.Rows, func(i, j int) bool {
+		a, b := t.Rows[i].Title, t.Rows[j].Title
+		if column != "" {
+			a, b = t.Rows[i].Value(column), t.Rows[j].Value(column)
+		}
+		if a == "" || b == "" {
+			return a != "" && b == ""
+		}
+		c := compareValues(typ, a, b)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+var propertyFilterPattern = regexp.MustCompile(`^\s*([^=!<>~]+?)\s*(=|!=|>=|<=|>|<|~)\s*(.*?)\s*$`)
+
+// Filter keeps the rows matching every comma-separated condition of expr:
+// "column op value" with op one of = != > < >= <= ~ (contains), or plain
+// text found in the title or in any value.
+func (t *PropertyTable) Filter(expr string) {
+	for _, cond := range strings.Split(expr, ",") {
+		t.filter(cond)
+	}
+}
+
+func (t *PropertyTable) filter(expr string) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return
+	}
+	match := func(r PropertyRow) bool {
+		text := strings.ToLower(expr)
+		if strings.Contains(strings.ToLower(r.Title), text) {
+			return true
+		}
+		for _, p := range r.Values {
+			if strings.Contains(strings.ToLower(p.Value), text) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if m := propertyFilterPattern.FindStringSubmatch(expr); m != nil {
+		column, op, want := m[1], m[2], m[3]
+		typ := t.columnType(column)
+		if normalized, err := (Property{Type: typ}).NormalizeValue(want); err == nil && typ != PropertySelect {
+			want = normalized
+		}
+		match = func(r PropertyRow) bool {
+			value := r.Value(column)
+			if strings.EqualFold(column, "title") {
+				value = r.Title
+			}
+			switch op {
+			case "~":
+				return strings.Contains(strings.ToLower(value), strings.ToLower(want))
+			case "=":
+				return strings.EqualFold(value, want)
+			case "!=":
+				return !strings.EqualFold(value, want)
+			}
+			if value == "" || want == "" {
+				return false
+			}
+			c := compareValues(typ, value, want)
+			switch op {
+			case ">":
+				return c > 0
+			case "<":
+				return c < 0
+			case ">=":
+				return c >= 0
+			}
+			return c <= 0
+		}
+	}
+
+	var kept []PropertyRow
+	for _, r := range t.Rows {
+		if match(r) {
+			kept = append(kept, r)
+		}
+	}
+	t.Rows = kept
+}
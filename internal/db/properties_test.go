@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+const progettoNote = "---\ntitle: Progetto\nstato: attivo\nvoto: 4.50\nscadenza: 2024-06-01\nfatto: yes\nvuoto:\nelenco: [a, b]\n---\nTesto della nota"
+
+func TestParseFrontMatter(t *testing.T) {
+	want := []Property{
+		{Name: "stato", Type: PropertyText, Value: "attivo", FrontMatter: true},
+		{Name: "voto", Type: PropertyNumber, Value: "4.5", FrontMatter: true},
+		{Name: "scadenza", Type: PropertyDate, Value: "2024-06-01", FrontMatter: true},
+		{Name: "fatto", Type: PropertyText, Value: "yes", FrontMatter: true},
+		{Name: "vuoto", Type: PropertyText, Value: "", FrontMatter: true},
+	}
+	if got := ParseFrontMatter(progettoNote); !reflect.DeepEqual(got, want) {
+		t.Fatalf("properties %+v, want %+v", got, want)
+	}
+
+	for _, content := range []string{
+		"Nessun front matter",
+		"---\nstato: attivo\nmai chiuso",
+		"---\n- solo\n- una lista\n---\n",
+		"---\nstato: [non chiusa\n---\n",
+	} {
+		if got := ParseFrontMatter(content); got != nil {
+			t.Fatalf("properties of %q: %+v", content, got)
+		}
+	}
+}
+
+func TestSetFrontMatterValue(t *testing.T) {
+	content := "---\nStato: attivo\nvoto: 4\n  stato: annidato\n---\nstato: nel testo"
+
+	got, ok := setFrontMatterValue(content, "stato", "chiuso", false)
+	if !ok || got != "---\nStato: chiuso\nvoto: 4\n  stato: annidato\n---\nstato: nel testo" {
+		t.Fatalf("set: %v %q", ok, got)
+	}
+	got, ok = setFrontMatterValue(content, "voto", "", true)
+	if !ok || got != "---\nStato: attivo\n  stato: annidato\n---\nstato: nel testo" {
+		t.Fatalf("remove: %v %q", ok, got)
+	}
+	if got, ok = setFrontMatterValue(content, "autore", "Dante", false); ok || got != content {
+		t.Fatalf("missing key: %v %q", ok, got)
+	}
+	if _, ok = setFrontMatterValue("stato: attivo", "stato", "chiuso", false); ok {
+		t.Fatal("note without front matter rewritten")
+	}
+}
+
+func TestYAMLScalar(t *testing.T) {
+	for value, want := range map[string]string{
+		"attivo":        "attivo",
+		"2024-06-01":    "2024-06-01",
+		"4.5":           "4.5",
+		"":              "",
+		"true":          "true",
+		"a: b":          `"a: b"`,
+		"nota # fissa":  `"nota # fissa"`,
+		"riga\naltra":   `"riga\naltra"`,
+		"[lista]":       `"[lista]"`,
+		" spazi ":       `" spazi "`,
+		`"tra virgole"`: `"\"tra virgole\""`,
+	} {
+		if got := yamlScalar(value); got != want {
+			t.Fatalf("yamlScalar(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestSetNotePropertyRewritesFrontMatter(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	note, _ := database.CreateNoteInFolder(ctx, "Progetto", "", nil, 0)
+	if err := database.UpdateNote(ctx, note.ID, note.Title, "---\nstato: attivo\n---\nTesto", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	p := Property{Name: "stato", Type: PropertyText, Value: "in pausa: luglio"}
+	if err := database.SetNoteProperty(ctx, note.ID, p); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := database.GetNote(ctx, note.ID)
+	if got.Content != "---\nstato: \"in pausa: luglio\"\n---\nTesto" {
+		t.Fatalf("content %q", got.Content)
+	}
+	versions, _ := database.GetNoteVersions(ctx, note.ID)
+	if len(versions) == 0 {
+		t.Fatal("no version saved for the rewritten front matter")
+	}
+
+	// The next edit reads the value back from the front matter
+	if err := database.UpdateNote(ctx, note.ID, got.Title, got.Content+"\naltro", nil); err != nil {
+		t.Fatal(err)
+	}
+	props, _ := database.NoteProperties(ctx, note.ID)
+	want := []Property{{Name: "stato", Type: PropertyText, Value: "in pausa: luglio", FrontMatter: true}}
+	if !reflect.DeepEqual(props, want) {
+		t.Fatalf("properties %+v, want %+v", props, want)
+	}
+
+	// Removing the property removes the line
+	if err := database.DeleteNoteProperty(ctx, note.ID, "stato"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = database.GetNote(ctx, note.ID)
+	if got.Content != "---\n---\nTesto\naltro" {
+		t.Fatalf("content after delete %q", got.Content)
+	}
+	if props, _ := database.NoteProperties(ctx, note.ID); len(props) != 0 {
+		t.Fatalf("properties after delete %+v", props)
+	}
+}
+
+func TestReindexKeepsSelectType(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	note, _ := database.CreateNoteInFolder(ctx, "Cliente", "", nil, 0)
+	database.UpdateNote(ctx, note.ID, note.Title, "---\nstato: attivo\nvoto: 3\n---\n", nil)
+
+	status := Property{Name: "stato", Type: PropertySelect, Value: "attivo", Options: []string{"attivo", "chiuso"}}
+	if err := database.SetNoteProperty(ctx, note.ID, status); err != nil {
+		t.Fatal(err)
+	}
+	local := Property{Name: "referente", Type: PropertyText, Value: "Anna"}
+	if err := database.SetNoteProperty(ctx, note.ID, local); err != nil {
+		t.Fatal(err)
+	}
+
+	// Editing the front matter keeps the declared type and adds the new
+	// value to the options; keys removed from it go away
+	database.UpdateNote(ctx, note.ID, note.Title, "---\nstato: sospeso\n---\n", nil)
+	props, _ := database.NoteProperties(ctx, note.ID)
+	want := []Property{
+		{Name: "stato", Type: PropertySelect, Value: "sospeso", Options: []string{"attivo", "chiuso", "sospeso"}, FrontMatter: true},
+		{Name: "referente", Type: PropertyText, Value: "Anna"},
+	}
+	if !reflect.DeepEqual(props, want) {
+		t.Fatalf("properties %+v, want %+v", props, want)
+	}
+
+	// A value that does not fit the declared type falls back to the guess
+	database.UpdateNote(ctx, note.ID, note.Title, "---\nscadenza: 2024-06-01\n---\n", nil)
+	database.UpdateNote(ctx, note.ID, note.Title, "---\nscadenza: presto\n---\n", nil)
+	props, _ = database.NoteProperties(ctx, note.ID)
+	if props[0].Type != PropertyText || props[0].Value != "presto" {
+		t.Fatalf("property %+v", props[0])
+	}
+}
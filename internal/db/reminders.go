@@ -0,0 +1,268 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Reminders give a note, or a checklist item inside it, a due time. The item
+// text and the due time are stored encrypted together, so the database does
+// not reveal when anything is due; the client decrypts the (few) pending
+// reminders and schedules them itself. Reminders stay on this device: they
+// are not synced.
+
+type Reminder struct {
+	ID        int64     `json:"id"`
+	NoteID    int64     `json:"note_id"`
+	NoteTitle string    `json:"note_title"`
+	Item      string    `json:"item,omitempty"` // Testo della voce di checklist, vuoto = tutta la nota
+	Due       time.Time `json:"due"`
+	Fired     bool      `json:"fired"`
+	Done      bool      `json:"done"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Label is the text shown for a reminder: the item, or the note title.
+func (r Reminder) Label() string {
+	if r.Item != "" {
+		return r.Item
+	}
+	return r.NoteTitle
+}
+
+type reminderPayload struct {
+	Item string    `json:"item,omitempty"`
+	Due  time.Time `json:"due"`
+}
+
+// AddReminder sets a reminder on a note, or on one of its checklist items.
+func (db *DB) AddReminder(ctx context.Context, noteID int64, item string, due time.Time) (*Reminder, error) {
+	data, err := json.Marshal(reminderPayload{Item: item, Due: due})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := db.seal(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result, err := db.conn.ExecContext(ctx, `
+		INSERT INTO reminders (note_id, payload, fired, done, created_at) VALUES (?, ?, 0, 0, ?)
+	`, noteID, payload, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add reminder: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &Reminder{ID: id, NoteID: noteID, Item: item, Due: due, CreatedAt: now}, nil
+}
+
+// ListReminders returns the reminders of live notes, soonest first. Item
+// reminders whose checkbox has been ticked count as done. noteID 0 lists
+// every note's reminders.
+func (db *DB) ListReminders(ctx context.Context, noteID int64, includeDone bool) ([]Reminder, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT r.id, r.note_id, n.title, n.content, r.payload, COALESCE(r.fired, 0), COALESCE(r.done, 0), r.created_at
+		FROM reminders r JOIN notes n ON n.id = r.note_id
+		WHERE (n.deleted = 0 OR n.deleted IS NULL) AND (? = 0 OR r.note_id = ?)
+	`, noteID, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reminders: %w", err)
+	}
+	defer rows.Close()
+
+	// Checklists are parsed once per note
+	checked := make(map[int64]map[string]bool)
+	var reminders []Reminder
+	for rows.Next() {
+		var r Reminder
+		var content, sealed string
+		if err := rows.Scan(&r.ID, &r.NoteID, &r.NoteTitle, &content, &sealed, &r.Fired, &r.Done, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan reminder: %w", err)
+		}
+		plain, err := db.open(sealed)
+		if err != nil {
+			continue
+		}
+		var p reminderPayload
+		if err := json.Unmarshal([]byte(plain), &p); err != nil {
+			continue
+		}
+		r.Item, r.Due = p.Item, p.Due
+
+		if r.Item != "" && !r.Done {
+			if _, ok := checked[r.NoteID]; !ok {
+				checked[r.NoteID] = make(map[string]bool)
+				if text, err := db.open(content); err == nil {
+					for _, item := range ParseChecklist(text) {
+						if item.Done {
+							checked[r.NoteID][item.Text] = true
+						}
+					}
+				}
+			}
+			r.Done = checked[r.NoteID][r.Item]
+		}
+		if r.Done && !includeDone {
+			continue
+		}
+		reminders = append(reminders, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(reminders, func(i, j int) bool {
+		return reminders[i].Due.Before(reminders[j].Due)
+	})
+	return reminders, nil
+}
+
+// MarkReminderFired records that the alert of a reminder has been shown.
+func (db *DB) MarkReminderFired(ctx context.Context, id int64) error {
+	_, err := db.conn.ExecContext(ctx, `UPDATE reminders SET fired = 1 WHERE id = ?`, id)
+	return err
+}
+
+func (db *DB) SetReminderDone(ctx context.Context, id int64, done bool) error {
+	_, err := db.conn.ExecContext(ctx, `UPDATE reminders SET done = ? WHERE id = ?`, done, id)
+	return err
+}
+
+func (db *DB) DeleteReminder(ctx context.Context, id int64) error {
+	_, err := db.conn.ExecContext(ctx, `DELETE FROM reminders WHERE id = ?`, id)
+	return err
+}
+
+var relativeTimePattern = regexp.MustCompile(`^\+(\d+)\s*(m|min|h|d|w)$`)
+
+// ParseReminderTime reads a due time typed by the user, relative to now:
+//
+//	2024-05-01 18:30   2024-05-01 (09:00)   18:30 (today, or tomorrow if past)
+//	tomorrow 9:00      +30m  +2h  +3d  +1w
+//
+// "oggi" and "domani" work as well as "today" and "tomorrow".
+func ParseReminderTime(input string, now time.Time) (time.Time, error) {
+	s := strings.ToLower(strings.TrimSpace(input))
+	loc := now.Location()
+
+	if m := relativeTimePattern.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "m", "min":
+			return now.Add(time.Duration(n) * time.Minute), nil
+		case "h":
+			return now.Add(time.Duration(n) * time.Hour), nil
+		case "d":
+			return now.AddDate(0, 0, n), nil
+		case "w":
+			return now.AddDate(0, 0, 7*n), nil
+		}
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t.Add(9 * time.Hour), nil
+	}
+
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	explicitDay := false
+	for _, prefix := range []struct {
+		word string
+		days int
+	}{{"today", 0}, {"oggi", 0}, {"tomorrow", 1}, {"domani", 1}} {
+		if s == prefix.word || strings.HasPrefix(s, prefix.word+" ") {
+			day = day.AddDate(0, 0, prefix.days)
+			s = strings.TrimSpace(strings.TrimPrefix(s, prefix.word))
+			explicitDay = true
+			break
+		}
+	}
+	if s == "" {
+		return day.Add(9 * time.Hour), nil
+	}
+	for _, layout := range []string{"15:04", "15.04", "15"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			due := day.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute)
+			if !explicitDay && !due.After(now) {
+				due = due.AddDate(0, 0, 1)
+			}
+			return due, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("cannot read %q as a date or time", input)
+}
+
+// RemindersICS exports reminders as an iCalendar file, one event with a
+// display alarm per reminder.
+func RemindersICS(reminders []Reminder, now time.Time) string {
+	const stamp = "20060102T150405Z"
+	var b strings.Builder
+	line := func(s string) { b.WriteString(icsFold(s) + "\r\n") }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Jotaku//Reminders//EN")
+	line("CALSCALE:GREGORIAN")
+	for _, r := range reminders {
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:reminder-%d@jotaku", r.ID))
+		line("DTSTAMP:" + now.UTC().Format(stamp))
+		line("DTSTART:" + r.Due.UTC().Format(stamp))
+		line("DTEND:" + r.Due.Add(15*time.Minute).UTC().Format(stamp))
+		line("SUMMARY:" + icsEscape(r.Label()))
+		if r.Item != "" {
+			line("DESCRIPTION:" + icsEscape(r.NoteTitle))
+		}
+		if r.Done {
+			line("STATUS:CANCELLED")
+		}
+		line("BEGIN:VALARM")
+		line("ACTION:DISPLAY")
+		line("DESCRIPTION:" + icsEscape(r.Label()))
+		line("TRIGGER:PT0M")
+		line("END:VALARM")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+// icsFold folds a content line at 75 octets, as RFC 5545 requires: the rest
+// goes on continuation lines that start with a space. UTF-8 sequences are
+// never split.
+func icsFold(s string) string {
+	const limit = 75
+	var b strings.Builder
+	width := limit
+	for len(s) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		width = limit - 1 // The leading space counts
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", "").Replace(s)
+}
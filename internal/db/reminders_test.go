@@ -0,0 +1,31 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestRemindersICSFoldsLongLines(t *testing.T) {
+	title := strings.Repeat("Riunione sull'avanzamento è già fissata, ", 5)
+	ics := RemindersICS([]Reminder{{ID: 1, NoteTitle: title, Due: time.Now()}}, time.Now())
+
+	var unfolded strings.Builder
+	for i, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("line %d is %d octets: %q", i, len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Fatalf("line %d splits a character: %q", i, line)
+		}
+		if strings.HasPrefix(line, " ") {
+			unfolded.WriteString(line[1:])
+		} else {
+			unfolded.WriteString("\n" + line)
+		}
+	}
+	if !strings.Contains(unfolded.String(), "\nSUMMARY:"+icsEscape(title)+"\n") {
+		t.Fatalf("summary does not unfold to the title:%s", unfolded.String())
+	}
+}
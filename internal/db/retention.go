@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RetentionPolicy decides which note versions survive compaction. Every
+// version younger than KeepAll is kept, then one version per hour, day and
+// week up to the Hourly, Daily and Weekly ages. A zero Weekly keeps weekly
+// snapshots forever. MaxPerNote caps the versions kept for a single note.
+type RetentionPolicy struct {
+	KeepAll    time.Duration
+	Hourly     time.Duration
+	Daily      time.Duration
+	Weekly     time.Duration
+	MaxPerNote int
+}
+
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		KeepAll:    24 * time.Hour,
+		Hourly:     7 * 24 * time.Hour,
+		Daily:      30 * 24 * time.Hour,
+		Weekly:     0,
+		MaxPerNote: 500,
+	}
+}
+
+type versionStamp struct {
+	ID        string
+	NoteID    string
+	CreatedAt time.Time
+}
+
+// expired returns the IDs of the versions to drop. versions must belong to a
+// single note and be ordered newest first; the newest one is always kept.
+func (p RetentionPolicy) expired(versions []versionStamp, now time.Time) []string {
+	var drop []string
+	buckets := make(map[string]bool)
+	kept := 0
+
+	for i, v := range versions {
+		age := now.Sub(v.CreatedAt)
+
+		var bucket string
+		switch {
+		case i == 0 || age < p.KeepAll:
+			bucket = ""
+		case age < p.Hourly:
+			bucket = "h" + v.CreatedAt.Format("2006010215")
+		case age < p.Daily:
+			bucket = "d" + v.CreatedAt.Format("20060102")
+		case p.Weekly == 0 || age < p.Weekly:
+			year, week := v.CreatedAt.ISOWeek()
+			bucket = fmt.Sprintf("w%d%02d", year, week)
+		default:
+			drop = append(drop, v.ID)
+			continue
+		}
+
+		if bucket != "" {
+			if buckets[bucket] {
+				drop = append(drop, v.ID)
+				continue
+			}
+			buckets[bucket] = true
+		}
+
+		if p.MaxPerNote > 0 && kept >= p.MaxPerNote {
+			drop = append(drop, v.ID)
+			continue
+		}
+		kept++
+	}
+
+	return drop
+}
+
+// expiredVersionIDs applies policy to every note in a note_versions table.
+// The client and server schemas share the columns used here.
+func expiredVersionIDs(ctx context.Context, conn *sql.DB, policy RetentionPolicy) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, note_id, created_at
+		FROM note_versions
+		ORDER BY note_id, version_num DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list versions: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var drop []string
+	var group []versionStamp
+	for rows.Next() {
+		var v versionStamp
+		if err := rows.Scan(&v.ID, &v.NoteID, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan version: %w", err)
+		}
+		if len(group) > 0 && group[0].NoteID != v.NoteID {
+			drop = append(drop, policy.expired(group, now)...)
+			group = group[:0]
+		}
+		group = append(group, v)
+	}
+	if len(group) > 0 {
+		drop = append(drop, policy.expired(group, now)...)
+	}
+	return drop, rows.Err()
+}
+
+func deleteVersions(ctx context.Context, conn *sql.DB, drop []string) (int, error) {
+	if len(drop) == 0 {
+		return 0, nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range drop {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM note_versions WHERE id = ?`, id); err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("failed to delete version: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(drop), nil
+}
+
+// CompactNoteVersions thins out the local version history according to policy.
+// Snapshots that surviving deltas are based on, and versions referenced by
+// vault snapshots, are kept.
+func (db *DB) CompactNoteVersions(ctx context.Context, policy RetentionPolicy) (int, error) {
+	drop, err := expiredVersionIDs(ctx, db.conn, policy)
+	if err != nil || len(drop) == 0 {
+		return 0, err
+	}
+
+	dropped := make(map[string]bool, len(drop))
+	for _, id := range drop {
+		dropped[id] = true
+	}
+
+	// Versions referenced by vault snapshots are kept
+	pinned, err := db.conn.QueryContext(ctx, `SELECT version_id FROM snapshot_notes WHERE version_id IS NOT NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list snapshot versions: %w", err)
+	}
+	for pinned.Next() {
+		var id string
+		if err := pinned.Scan(&id); err != nil {
+			pinned.Close()
+			return 0, err
+		}
+		delete(dropped, id)
+	}
+	pinned.Close()
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT id, base_id FROM note_versions WHERE base_id IS NOT NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list deltas: %w", err)
+	}
+	protected := make(map[string]bool)
+	for rows.Next() {
+		var id, baseID string
+		if err := rows.Scan(&id, &baseID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !dropped[id] {
+			protected[baseID] = true
+		}
+	}
+	rows.Close()
+
+	var filtered []string
+	for _, id := range drop {
+		if dropped[id] && !protected[id] {
+			filtered = append(filtered, id)
+		}
+	}
+	return deleteVersions(ctx, db.conn, filtered)
+}
+
+// Vacuum rebuilds the database file to reclaim the space freed by compaction.
+func (db *DB) Vacuum(ctx context.Context) error {
+	_, err := db.conn.ExecContext(ctx, `VACUUM`)
+	return err
+}
+
+// CompactVersions thins out the version history of every user according to policy.
+func (db *ServerDB) CompactVersions(ctx context.Context, policy RetentionPolicy) (int, error) {
+	drop, err := expiredVersionIDs(ctx, db.conn.db, policy)
+	if err != nil || len(drop) == 0 {
+		return 0, err
+	}
+	err = db.withTx(ctx, func(tx *serverTx) error {
+		for _, id := range drop {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM note_versions WHERE id = ?`, id); err != nil {
+				return fmt.Errorf("failed to delete version: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(drop), nil
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// versionNums returns the version numbers left for noteID, oldest first.
+func versionNums(t *testing.T, database *DB, noteID int64) []int {
+	t.Helper()
+	rows, err := database.conn.Query(`SELECT version_num FROM note_versions WHERE note_id = ? ORDER BY version_num`, noteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var nums []int
+	for rows.Next() {
+		var n int
+		rows.Scan(&n)
+		nums = append(nums, n)
+	}
+	return nums
+}
+
+func TestCompactNoteVersions(t *testing.T) {
+	ctx := context.Background()
+	database, note := newEncryptedTestDB(t, "password")
+	now := time.Now().UTC()
+	hour := now.Truncate(time.Hour)
+	noon := func(daysAgo int) time.Time {
+		return now.Truncate(24*time.Hour).AddDate(0, 0, -daysAgo).Add(12 * time.Hour)
+	}
+
+	// Version 1 is the snapshot every later one is a delta of
+	created := []time.Time{
+		noon(60),
+		noon(20), noon(20).Add(time.Minute), // same week
+		noon(3), noon(3).Add(time.Minute), // same day
+		hour.Add(-5 * time.Hour), hour.Add(-5*time.Hour + time.Minute), // same hour
+		now.Add(-10 * time.Minute),
+		now,
+	}
+	lines := []string{strings.Repeat("intestazione del diario ", 10)}
+	for i, at := range created {
+		lines = append(lines, fmt.Sprintf("riga %d", i))
+		if err := database.SaveNoteVersion(ctx, note.ID, "Nota", strings.Join(lines, "\n"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.conn.Exec(`UPDATE note_versions SET created_at = ? WHERE note_id = ? AND version_num = ?`, at, note.ID, i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if kinds := versionKinds(t, database, note.ID); kinds[0] != versionSnapshot || kinds[len(kinds)-1] != versionDelta {
+		t.Fatalf("unexpected storage kinds %v", kinds)
+	}
+
+	// A vault snapshot pins version 4, which its day would otherwise drop
+	var pinned int64
+	database.conn.QueryRow(`SELECT id FROM note_versions WHERE note_id = ? AND version_num = 4`, note.ID).Scan(&pinned)
+	result, err := database.conn.Exec(`INSERT INTO snapshots (name, reason, created_at) VALUES ('', ?, ?)`, SnapshotManual, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapID, _ := result.LastInsertId()
+	if _, err := database.conn.Exec(`
+		INSERT INTO snapshot_notes (snapshot_id, note_id, version_id, title, tags) VALUES (?, ?, ?, 'Nota', '[]')
+	`, snapID, note.ID, pinned); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := RetentionPolicy{
+		KeepAll: time.Hour,
+		Hourly:  24 * time.Hour,
+		Daily:   7 * 24 * time.Hour,
+		Weekly:  28 * 24 * time.Hour,
+	}
+	// One per week, day and hour; version 1 is past every window but the
+	// deltas left still need it
+	if _, err := database.CompactNoteVersions(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := versionNums(t, database, note.ID), []int{1, 3, 4, 5, 7, 8, 9}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("versions after compaction %v, want %v", got, want)
+	}
+
+	policy.MaxPerNote = 3
+	if _, err := database.CompactNoteVersions(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := versionNums(t, database, note.ID), []int{1, 4, 7, 8, 9}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("versions past MaxPerNote %v, want %v", got, want)
+	}
+
+	// What is left still rebuilds
+	versions, err := database.GetNoteVersions(ctx, note.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range versions {
+		if !strings.HasSuffix(v.Content, fmt.Sprintf("riga %d", v.VersionNum-1)) {
+			t.Errorf("version %d rebuilt as %q", v.VersionNum, v.Content)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -10,7 +11,8 @@ import (
 )
 
 type ServerDB struct {
-	conn *sql.DB
+	conn  *serverConn
+	blobs BlobStore
 }
 
 type User struct {
@@ -28,6 +30,8 @@ type ServerNote struct {
 	Content        string    `json:"content"`
 	Tags           string    `json:"tags"`
 	ParentFolderID string    `json:"parent_folder_id,omitempty"`
+	Archived       bool      `json:"archived"`
+	ReadOnly       bool      `json:"read_only"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
@@ -54,13 +58,14 @@ type ServerNoteVersion struct {
 }
 
 func NewServerDB(dbPath string) (*ServerDB, error) {
-	conn, err := sql.Open("sqlite3", dbPath)
+	conn, err := sql.Open("sqlite3", sqliteDSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	db := &ServerDB{conn: conn}
-	if err := db.migrate(); err != nil {
+	db := &ServerDB{conn: &serverConn{db: conn}}
+	db.blobs = dbBlobStore{conn: db.conn}
+	if err := db.migrate(context.Background()); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
@@ -68,7 +73,15 @@ func NewServerDB(dbPath string) (*ServerDB, error) {
 	return db, nil
 }
 
-func (db *ServerDB) migrate() error {
+func (db *ServerDB) migrate(ctx context.Context) error {
+	if db.conn.postgres {
+		if _, err := db.conn.ExecContext(ctx, postgresSchema); err != nil {
+			return err
+		}
+		_, err := db.conn.ExecContext(ctx, serverIndexes)
+		return err
+	}
+
 	schema := `
 	CREATE TABLE IF NOT EXISTS users (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -114,6 +127,61 @@ func (db *ServerDB) migrate() error {
 		FOREIGN KEY (user_id) REFERENCES users(id)
 	);
 
+	CREATE TABLE IF NOT EXISTS blobs (
+		user_id INTEGER NOT NULL,
+		hash TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		chunks INTEGER NOT NULL,
+		complete INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, hash),
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS blob_parts (
+		user_id INTEGER NOT NULL,
+		hash TEXT NOT NULL,
+		seq INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		PRIMARY KEY (user_id, hash, seq)
+	);
+
+	CREATE TABLE IF NOT EXISTS blob_data (
+		user_id INTEGER NOT NULL,
+		hash TEXT NOT NULL,
+		seq INTEGER NOT NULL,
+		data BLOB NOT NULL,
+		PRIMARY KEY (user_id, hash, seq)
+	);
+
+	CREATE TABLE IF NOT EXISTS attachments (
+		id TEXT PRIMARY KEY,
+		note_id TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		deleted INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+	`
+	_, err := db.conn.ExecContext(ctx, schema)
+	if err != nil {
+		return err
+	}
+
+	// Migration: add parent_folder_id column if not exists
+	db.conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN parent_folder_id TEXT`)
+	db.conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN archived INTEGER DEFAULT 0`)
+	db.conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN read_only INTEGER DEFAULT 0`)
+
+	_, err = db.conn.ExecContext(ctx, serverIndexes)
+	return err
+}
+
+const serverIndexes = `
 	CREATE INDEX IF NOT EXISTS idx_notes_user ON notes(user_id);
 	CREATE INDEX IF NOT EXISTS idx_notes_updated ON notes(updated_at);
 	CREATE INDEX IF NOT EXISTS idx_notes_folder ON notes(parent_folder_id);
@@ -123,17 +191,10 @@ func (db *ServerDB) migrate() error {
 	CREATE INDEX IF NOT EXISTS idx_folders_parent ON folders(parent_folder_id);
 	CREATE INDEX IF NOT EXISTS idx_versions_note ON note_versions(note_id);
 	CREATE INDEX IF NOT EXISTS idx_versions_user ON note_versions(user_id);
-	`
-	_, err := db.conn.Exec(schema)
-	if err != nil {
-		return err
-	}
-
-	// Migration: add parent_folder_id column if not exists
-	db.conn.Exec(`ALTER TABLE notes ADD COLUMN parent_folder_id TEXT`)
-
-	return nil
-}
+	CREATE INDEX IF NOT EXISTS idx_attachments_note ON attachments(note_id);
+	CREATE INDEX IF NOT EXISTS idx_attachments_updated ON attachments(user_id, updated_at);
+	CREATE INDEX IF NOT EXISTS idx_attachments_hash ON attachments(user_id, hash);
+`
 
 func (db *ServerDB) Close() error {
 	return db.conn.Close()
@@ -141,23 +202,24 @@ func (db *ServerDB) Close() error {
 
 // User operations
 
-func (db *ServerDB) CreateUser(username, password string) (*User, error) {
+func (db *ServerDB) CreateUser(ctx context.Context, username, password string) (*User, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
 	now := time.Now()
-	result, err := db.conn.Exec(`
+	var id int64
+	err = db.conn.QueryRowContext(ctx, `
 		INSERT INTO users (username, password_hash, created_at, active)
-		VALUES (?, ?, ?, 1)
-	`, username, string(hash), now)
+		VALUES (?, ?, ?, TRUE)
+		RETURNING id
+	`, username, string(hash), now).Scan(&id)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	id, _ := result.LastInsertId()
 	return &User{
 		ID:        id,
 		Username:  username,
@@ -166,9 +228,9 @@ func (db *ServerDB) CreateUser(username, password string) (*User, error) {
 	}, nil
 }
 
-func (db *ServerDB) GetUserByUsername(username string) (*User, error) {
+func (db *ServerDB) GetUserByUsername(ctx context.Context, username string) (*User, error) {
 	var u User
-	err := db.conn.QueryRow(`
+	err := db.conn.QueryRowContext(ctx, `
 		SELECT id, username, password_hash, created_at, active
 		FROM users WHERE username = ?
 	`, username).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.CreatedAt, &u.Active)
@@ -182,9 +244,9 @@ func (db *ServerDB) GetUserByUsername(username string) (*User, error) {
 	return &u, nil
 }
 
-func (db *ServerDB) GetUserByID(id int64) (*User, error) {
+func (db *ServerDB) GetUserByID(ctx context.Context, id int64) (*User, error) {
 	var u User
-	err := db.conn.QueryRow(`
+	err := db.conn.QueryRowContext(ctx, `
 		SELECT id, username, password_hash, created_at, active
 		FROM users WHERE id = ?
 	`, id).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.CreatedAt, &u.Active)
@@ -205,9 +267,10 @@ func (db *ServerDB) ValidatePassword(user *User, password string) bool {
 
 // Note operations
 
-func (db *ServerDB) ListNotesByUser(userID int64) ([]ServerNote, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, user_id, title, content, tags, COALESCE(parent_folder_id, ''), created_at, updated_at
+func (db *ServerDB) ListNotesByUser(ctx context.Context, userID int64) ([]ServerNote, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, user_id, title, content, tags, COALESCE(parent_folder_id, ''),
+		       COALESCE(archived, FALSE), COALESCE(read_only, FALSE), created_at, updated_at
 		FROM notes
 		WHERE user_id = ?
 		ORDER BY updated_at DESC
@@ -220,7 +283,7 @@ func (db *ServerDB) ListNotesByUser(userID int64) ([]ServerNote, error) {
 	var notes []ServerNote
 	for rows.Next() {
 		var n ServerNote
-		if err := rows.Scan(&n.ID, &n.UserID, &n.Title, &n.Content, &n.Tags, &n.ParentFolderID, &n.CreatedAt, &n.UpdatedAt); err != nil {
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Title, &n.Content, &n.Tags, &n.ParentFolderID, &n.Archived, &n.ReadOnly, &n.CreatedAt, &n.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan note: %w", err)
 		}
 		notes = append(notes, n)
@@ -228,12 +291,13 @@ func (db *ServerDB) ListNotesByUser(userID int64) ([]ServerNote, error) {
 	return notes, rows.Err()
 }
 
-func (db *ServerDB) GetNote(id string, userID int64) (*ServerNote, error) {
+func (db *ServerDB) GetNote(ctx context.Context, id string, userID int64) (*ServerNote, error) {
 	var n ServerNote
-	err := db.conn.QueryRow(`
-		SELECT id, user_id, title, content, tags, COALESCE(parent_folder_id, ''), created_at, updated_at
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT id, user_id, title, content, tags, COALESCE(parent_folder_id, ''),
+		       COALESCE(archived, FALSE), COALESCE(read_only, FALSE), created_at, updated_at
 		FROM notes WHERE id = ? AND user_id = ?
-	`, id, userID).Scan(&n.ID, &n.UserID, &n.Title, &n.Content, &n.Tags, &n.ParentFolderID, &n.CreatedAt, &n.UpdatedAt)
+	`, id, userID).Scan(&n.ID, &n.UserID, &n.Title, &n.Content, &n.Tags, &n.ParentFolderID, &n.Archived, &n.ReadOnly, &n.CreatedAt, &n.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -244,7 +308,7 @@ func (db *ServerDB) GetNote(id string, userID int64) (*ServerNote, error) {
 	return &n, nil
 }
 
-func (db *ServerDB) UpsertNote(userID int64, id, title, content, tags, parentFolderID string, createdAt, updatedAt time.Time) (*ServerNote, error) {
+func (db *ServerDB) UpsertNote(ctx context.Context, userID int64, id, title, content, tags, parentFolderID string, archived, readOnly bool, createdAt, updatedAt time.Time) (*ServerNote, error) {
 	if id == "" {
 		id = uuid.New().String()
 	}
@@ -254,17 +318,19 @@ func (db *ServerDB) UpsertNote(userID int64, id, title, content, tags, parentFol
 		folderID = parentFolderID
 	}
 
-	_, err := db.conn.Exec(`
-		INSERT INTO notes (id, user_id, title, content, tags, parent_folder_id, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	_, err := db.conn.ExecContext(ctx, `
+		INSERT INTO notes (id, user_id, title, content, tags, parent_folder_id, archived, read_only, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
 			title = excluded.title,
 			content = excluded.content,
 			tags = excluded.tags,
 			parent_folder_id = excluded.parent_folder_id,
+			archived = excluded.archived,
+			read_only = excluded.read_only,
 			updated_at = excluded.updated_at
-		WHERE user_id = ?
-	`, id, userID, title, content, tags, folderID, createdAt, updatedAt, userID)
+		WHERE notes.user_id = ?
+	`, id, userID, title, content, tags, folderID, archived, readOnly, createdAt, updatedAt, userID)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to upsert note: %w", err)
@@ -277,22 +343,34 @@ func (db *ServerDB) UpsertNote(userID int64, id, title, content, tags, parentFol
 		Content:        content,
 		Tags:           tags,
 		ParentFolderID: parentFolderID,
+		Archived:       archived,
+		ReadOnly:       readOnly,
 		CreatedAt:      createdAt,
 		UpdatedAt:      updatedAt,
 	}, nil
 }
 
-func (db *ServerDB) DeleteNote(id string, userID int64) error {
-	_, err := db.conn.Exec(`DELETE FROM notes WHERE id = ? AND user_id = ?`, id, userID)
-	if err != nil {
-		return fmt.Errorf("failed to delete note: %w", err)
-	}
-	return nil
+func (db *ServerDB) DeleteNote(ctx context.Context, id string, userID int64) error {
+	return db.withTx(ctx, func(tx *serverTx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM notes WHERE id = ? AND user_id = ?`, id, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete note: %w", err)
+		}
+		// Its attachments go too; the blobs are collected by GCBlobs
+		_, err = tx.ExecContext(ctx, `
+			UPDATE attachments SET deleted = TRUE, updated_at = ? WHERE note_id = ? AND user_id = ? AND deleted = FALSE
+		`, time.Now(), id, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete note attachments: %w", err)
+		}
+		return nil
+	})
 }
 
-func (db *ServerDB) GetNotesSince(userID int64, since time.Time) ([]ServerNote, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, user_id, title, content, tags, COALESCE(parent_folder_id, ''), created_at, updated_at
+func (db *ServerDB) GetNotesSince(ctx context.Context, userID int64, since time.Time) ([]ServerNote, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, user_id, title, content, tags, COALESCE(parent_folder_id, ''),
+		       COALESCE(archived, FALSE), COALESCE(read_only, FALSE), created_at, updated_at
 		FROM notes
 		WHERE user_id = ? AND updated_at > ?
 		ORDER BY updated_at DESC
@@ -305,7 +383,7 @@ func (db *ServerDB) GetNotesSince(userID int64, since time.Time) ([]ServerNote,
 	var notes []ServerNote
 	for rows.Next() {
 		var n ServerNote
-		if err := rows.Scan(&n.ID, &n.UserID, &n.Title, &n.Content, &n.Tags, &n.ParentFolderID, &n.CreatedAt, &n.UpdatedAt); err != nil {
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Title, &n.Content, &n.Tags, &n.ParentFolderID, &n.Archived, &n.ReadOnly, &n.CreatedAt, &n.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan note: %w", err)
 		}
 		notes = append(notes, n)
@@ -315,8 +393,8 @@ func (db *ServerDB) GetNotesSince(userID int64, since time.Time) ([]ServerNote,
 
 // Folder operations
 
-func (db *ServerDB) ListFoldersByUser(userID int64) ([]ServerFolder, error) {
-	rows, err := db.conn.Query(`
+func (db *ServerDB) ListFoldersByUser(ctx context.Context, userID int64) ([]ServerFolder, error) {
+	rows, err := db.conn.QueryContext(ctx, `
 		SELECT id, user_id, title, COALESCE(parent_folder_id, ''), created_at, updated_at
 		FROM folders
 		WHERE user_id = ?
@@ -338,9 +416,9 @@ func (db *ServerDB) ListFoldersByUser(userID int64) ([]ServerFolder, error) {
 	return folders, rows.Err()
 }
 
-func (db *ServerDB) GetFolder(id string, userID int64) (*ServerFolder, error) {
+func (db *ServerDB) GetFolder(ctx context.Context, id string, userID int64) (*ServerFolder, error) {
 	var f ServerFolder
-	err := db.conn.QueryRow(`
+	err := db.conn.QueryRowContext(ctx, `
 		SELECT id, user_id, title, COALESCE(parent_folder_id, ''), created_at, updated_at
 		FROM folders WHERE id = ? AND user_id = ?
 	`, id, userID).Scan(&f.ID, &f.UserID, &f.Title, &f.ParentFolderID, &f.CreatedAt, &f.UpdatedAt)
@@ -354,7 +432,7 @@ func (db *ServerDB) GetFolder(id string, userID int64) (*ServerFolder, error) {
 	return &f, nil
 }
 
-func (db *ServerDB) UpsertFolder(userID int64, id, title, parentFolderID string, createdAt, updatedAt time.Time) (*ServerFolder, error) {
+func (db *ServerDB) UpsertFolder(ctx context.Context, userID int64, id, title, parentFolderID string, createdAt, updatedAt time.Time) (*ServerFolder, error) {
 	if id == "" {
 		id = uuid.New().String()
 	}
@@ -364,14 +442,14 @@ func (db *ServerDB) UpsertFolder(userID int64, id, title, parentFolderID string,
 		parentID = parentFolderID
 	}
 
-	_, err := db.conn.Exec(`
+	_, err := db.conn.ExecContext(ctx, `
 		INSERT INTO folders (id, user_id, title, parent_folder_id, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
 			title = excluded.title,
 			parent_folder_id = excluded.parent_folder_id,
 			updated_at = excluded.updated_at
-		WHERE user_id = ?
+		WHERE folders.user_id = ?
 	`, id, userID, title, parentID, createdAt, updatedAt, userID)
 
 	if err != nil {
@@ -388,16 +466,16 @@ func (db *ServerDB) UpsertFolder(userID int64, id, title, parentFolderID string,
 	}, nil
 }
 
-func (db *ServerDB) DeleteFolder(id string, userID int64) error {
-	_, err := db.conn.Exec(`DELETE FROM folders WHERE id = ? AND user_id = ?`, id, userID)
+func (db *ServerDB) DeleteFolder(ctx context.Context, id string, userID int64) error {
+	_, err := db.conn.ExecContext(ctx, `DELETE FROM folders WHERE id = ? AND user_id = ?`, id, userID)
 	if err != nil {
 		return fmt.Errorf("failed to delete folder: %w", err)
 	}
 	return nil
 }
 
-func (db *ServerDB) GetFoldersSince(userID int64, since time.Time) ([]ServerFolder, error) {
-	rows, err := db.conn.Query(`
+func (db *ServerDB) GetFoldersSince(ctx context.Context, userID int64, since time.Time) ([]ServerFolder, error) {
+	rows, err := db.conn.QueryContext(ctx, `
 		SELECT id, user_id, title, COALESCE(parent_folder_id, ''), created_at, updated_at
 		FROM folders
 		WHERE user_id = ? AND updated_at > ?
@@ -421,8 +499,8 @@ func (db *ServerDB) GetFoldersSince(userID int64, since time.Time) ([]ServerFold
 
 // Note version operations
 
-func (db *ServerDB) ListVersionsByNote(noteID string, userID int64) ([]ServerNoteVersion, error) {
-	rows, err := db.conn.Query(`
+func (db *ServerDB) ListVersionsByNote(ctx context.Context, noteID string, userID int64) ([]ServerNoteVersion, error) {
+	rows, err := db.conn.QueryContext(ctx, `
 		SELECT id, note_id, user_id, title, content, tags, COALESCE(hash, ''), version_num, created_at
 		FROM note_versions
 		WHERE note_id = ? AND user_id = ?
@@ -444,12 +522,12 @@ func (db *ServerDB) ListVersionsByNote(noteID string, userID int64) ([]ServerNot
 	return versions, rows.Err()
 }
 
-func (db *ServerDB) UpsertVersion(userID int64, id, noteID, title, content, tags, hash string, versionNum int, createdAt time.Time) (*ServerNoteVersion, error) {
+func (db *ServerDB) UpsertVersion(ctx context.Context, userID int64, id, noteID, title, content, tags, hash string, versionNum int, createdAt time.Time) (*ServerNoteVersion, error) {
 	if id == "" {
 		id = uuid.New().String()
 	}
 
-	_, err := db.conn.Exec(`
+	_, err := db.conn.ExecContext(ctx, `
 		INSERT INTO note_versions (id, note_id, user_id, title, content, tags, hash, version_num, created_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
@@ -476,8 +554,8 @@ func (db *ServerDB) UpsertVersion(userID int64, id, noteID, title, content, tags
 	}, nil
 }
 
-func (db *ServerDB) GetVersionsSince(userID int64, since time.Time) ([]ServerNoteVersion, error) {
-	rows, err := db.conn.Query(`
+func (db *ServerDB) GetVersionsSince(ctx context.Context, userID int64, since time.Time) ([]ServerNoteVersion, error) {
+	rows, err := db.conn.QueryContext(ctx, `
 		SELECT id, note_id, user_id, title, content, tags, COALESCE(hash, ''), version_num, created_at
 		FROM note_versions
 		WHERE user_id = ? AND created_at > ?
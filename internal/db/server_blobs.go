@@ -0,0 +1,479 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The server keeps attachment data as blobs it cannot read: the client
+// uploads the encrypted chunks of a blob one by one and the server only
+// stores them under the blob's hash. An upload is declared first (size and
+// chunk count, checked against the user's quota), then chunks can be sent
+// in any order and resent after an interruption until all have arrived.
+// Attachments reference blobs; blobs no attachment refers to are removed by
+// GCBlobs. The chunk data itself lives in a BlobStore.
+
+const (
+	DefaultBlobQuota = 1 << 30
+	MaxBlobChunkSize = 4 << 20
+)
+
+var (
+	ErrQuotaExceeded  = errors.New("storage quota exceeded")
+	ErrBlobNotFound   = errors.New("blob not found")
+	ErrBlobMismatch   = errors.New("blob does not match its declared size or chunks")
+	ErrBlobIncomplete = errors.New("blob upload is not complete")
+)
+
+var blobHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ValidBlobHash reports whether hash looks like a hex SHA-256.
+func ValidBlobHash(hash string) bool {
+	return blobHashPattern.MatchString(hash)
+}
+
+// BlobStore holds the chunk data of blobs.
+type BlobStore interface {
+	PutChunk(ctx context.Context, userID int64, hash string, seq int, data []byte) error
+	GetChunk(ctx context.Context, userID int64, hash string, seq int) ([]byte, error)
+	DeleteBlob(ctx context.Context, userID int64, hash string) error
+}
+
+// FSBlobStore keeps chunks as files under dir/<user>/<hash>/<seq>.
+type FSBlobStore struct {
+	dir string
+}
+
+func NewFSBlobStore(dir string) (*FSBlobStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &FSBlobStore{dir: dir}, nil
+}
+
+func (s *FSBlobStore) blobDir(ctx context.Context, userID int64, hash string) string {
+	return filepath.Join(s.dir, strconv.FormatInt(userID, 10), hash[:2], hash)
+}
+
+func (s *FSBlobStore) PutChunk(ctx context.Context, userID int64, hash string, seq int, data []byte) error {
+	dir := s.blobDir(ctx, userID, hash)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	// Write then rename, so an interrupted upload never leaves half a chunk
+	path := filepath.Join(dir, strconv.Itoa(seq))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *FSBlobStore) GetChunk(ctx context.Context, userID int64, hash string, seq int) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.blobDir(ctx, userID, hash), strconv.Itoa(seq)))
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+	return data, err
+}
+
+func (s *FSBlobStore) DeleteBlob(ctx context.Context, userID int64, hash string) error {
+	return os.RemoveAll(s.blobDir(ctx, userID, hash))
+}
+
+// dbBlobStore keeps chunks in the server database.
+type dbBlobStore struct {
+	conn *serverConn
+}
+
+func (s dbBlobStore) PutChunk(ctx context.Context, userID int64, hash string, seq int, data []byte) error {
+	_, err := s.conn.ExecContext(ctx, `
+		INSERT INTO blob_data (user_id, hash, seq, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, hash, seq) DO UPDATE SET data = excluded.data
+	`, userID, hash, seq, data)
+	return err
+}
+
+func (s dbBlobStore) GetChunk(ctx context.Context, userID int64, hash string, seq int) ([]byte, error) {
+	var data []byte
+	err := s.conn.QueryRowContext(ctx, `
+		SELECT data FROM blob_data WHERE user_id = ? AND hash = ? AND seq = ?
+	`, userID, hash, seq).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrBlobNotFound
+	}
+	return data, err
+}
+
+func (s dbBlobStore) DeleteBlob(ctx context.Context, userID int64, hash string) error {
+	_, err := s.conn.ExecContext(ctx, `DELETE FROM blob_data WHERE user_id = ? AND hash = ?`, userID, hash)
+	return err
+}
+
+// SetBlobStore changes where blob chunks are stored. By default they are
+// kept in the server database.
+func (db *ServerDB) SetBlobStore(store BlobStore) {
+	db.blobs = store
+}
+
+type ServerBlob struct {
+	Hash      string    `json:"hash"`
+	Size      int64     `json:"size"`
+	Chunks    int       `json:"chunks"`
+	Received  []int     `json:"received"`
+	Complete  bool      `json:"complete"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ServerAttachment struct {
+	ID        string    `json:"id"`
+	NoteID    string    `json:"note_id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Size      int64     `json:"size"`
+	Deleted   bool      `json:"deleted"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetBlob returns a blob with the chunks received so far, or nil.
+func (db *ServerDB) GetBlob(ctx context.Context, userID int64, hash string) (*ServerBlob, error) {
+	b := ServerBlob{Hash: hash, Received: []int{}}
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT size, chunks, complete, created_at FROM blobs WHERE user_id = ? AND hash = ?
+	`, userID, hash).Scan(&b.Size, &b.Chunks, &b.Complete, &b.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob: %w", err)
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT seq FROM blob_parts WHERE user_id = ? AND hash = ? ORDER BY seq
+	`, userID, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var seq int
+		if err := rows.Scan(&seq); err != nil {
+			return nil, err
+		}
+		b.Received = append(b.Received, seq)
+	}
+	return &b, rows.Err()
+}
+
+// BlobUsage returns the bytes a user's blobs take or have reserved.
+func (db *ServerDB) BlobUsage(ctx context.Context, userID int64) (int64, error) {
+	var used int64
+	err := db.conn.QueryRowContext(ctx, `SELECT COALESCE(SUM(size), 0) FROM blobs WHERE user_id = ?`, userID).Scan(&used)
+	return used, err
+}
+
+// StartBlobUpload declares a blob of size bytes in chunks pieces, or returns
+// the existing one so an interrupted upload can resume. The declared size
+// counts against quota (<= 0 means DefaultBlobQuota).
+func (db *ServerDB) StartBlobUpload(ctx context.Context, userID int64, hash string, size int64, chunks int, quota int64) (*ServerBlob, error) {
+	existing, err := db.GetBlob(ctx, userID, hash)
+	if err != nil || existing != nil {
+		if existing != nil && (existing.Size != size || existing.Chunks != chunks) {
+			return nil, ErrBlobMismatch
+		}
+		return existing, err
+	}
+	if size < 0 || chunks < 1 || int64(chunks) > size+1 || int64(chunks)*MaxBlobChunkSize < size {
+		return nil, ErrBlobMismatch
+	}
+
+	if quota <= 0 {
+		quota = DefaultBlobQuota
+	}
+	// Checked and reserved together, so parallel uploads cannot both fit
+	err = db.withTx(ctx, func(tx *serverTx) error {
+		var used int64
+		if err := tx.QueryRowContext(ctx, `SELECT COALESCE(SUM(size), 0) FROM blobs WHERE user_id = ?`, userID).Scan(&used); err != nil {
+			return err
+		}
+		if used+size > quota {
+			return ErrQuotaExceeded
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO blobs (user_id, hash, size, chunks, complete, created_at) VALUES (?, ?, ?, ?, FALSE, ?)
+		`, userID, hash, size, chunks, time.Now()); err != nil {
+			return fmt.Errorf("failed to start upload: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db.GetBlob(ctx, userID, hash)
+}
+
+// PutBlobChunk stores one chunk of a declared blob. Sending a chunk again
+// replaces it. The blob is complete once every chunk has arrived and they
+// add up to its declared size.
+func (db *ServerDB) PutBlobChunk(ctx context.Context, userID int64, hash string, seq int, data []byte) (*ServerBlob, error) {
+	blob, err := db.GetBlob(ctx, userID, hash)
+	if err != nil {
+		return nil, err
+	}
+	if blob == nil {
+		return nil, ErrBlobNotFound
+	}
+	if seq < 0 || seq >= blob.Chunks {
+		return nil, ErrBlobMismatch
+	}
+	if blob.Complete {
+		// Content addressed: a complete blob cannot change
+		return blob, nil
+	}
+
+	if err := db.blobs.PutChunk(ctx, userID, hash, seq, data); err != nil {
+		return nil, fmt.Errorf("failed to store chunk: %w", err)
+	}
+	// The size check, the part and the completion check go together, so
+	// chunks arriving at once can neither exceed what was reserved against
+	// the quota nor miss completing the blob
+	tooBig := false
+	err = db.withTx(ctx, func(tx *serverTx) error {
+		tooBig = false
+		var stored int64
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(size), 0) FROM blob_parts WHERE user_id = ? AND hash = ? AND seq != ?
+		`, userID, hash, seq).Scan(&stored); err != nil {
+			return err
+		}
+		if stored+int64(len(data)) > blob.Size {
+			// The stored data of seq is no longer the part on record, so it
+			// has to be sent again
+			tooBig = true
+			_, err := tx.ExecContext(ctx, `DELETE FROM blob_parts WHERE user_id = ? AND hash = ? AND seq = ?`, userID, hash, seq)
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO blob_parts (user_id, hash, seq, size) VALUES (?, ?, ?, ?)
+			ON CONFLICT (user_id, hash, seq) DO UPDATE SET size = excluded.size
+		`, userID, hash, seq, len(data)); err != nil {
+			return fmt.Errorf("failed to store chunk: %w", err)
+		}
+		_, err := tx.ExecContext(ctx, `
+			UPDATE blobs SET complete = TRUE
+			WHERE user_id = ? AND hash = ?
+			  AND (SELECT COUNT(*) FROM blob_parts WHERE user_id = ? AND hash = ?) = chunks
+			  AND (SELECT COALESCE(SUM(size), 0) FROM blob_parts WHERE user_id = ? AND hash = ?) = size
+		`, userID, hash, userID, hash, userID, hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tooBig {
+		return nil, ErrBlobMismatch
+	}
+	return db.GetBlob(ctx, userID, hash)
+}
+
+// GetBlobChunk returns one chunk of a complete blob.
+func (db *ServerDB) GetBlobChunk(ctx context.Context, userID int64, hash string, seq int) ([]byte, error) {
+	blob, err := db.GetBlob(ctx, userID, hash)
+	if err != nil {
+		return nil, err
+	}
+	if blob == nil || seq < 0 || seq >= blob.Chunks {
+		return nil, ErrBlobNotFound
+	}
+	if !blob.Complete {
+		return nil, ErrBlobIncomplete
+	}
+	return db.blobs.GetChunk(ctx, userID, hash, seq)
+}
+
+// UpsertAttachment records that a note has an attachment stored in a
+// complete blob.
+func (db *ServerDB) UpsertAttachment(ctx context.Context, userID int64, id, noteID, name, hash string, size int64, createdAt time.Time) (*ServerAttachment, error) {
+	if id == "" {
+		id = uuid.New().String()
+	}
+	now := time.Now()
+	// The blob is checked in the same transaction that references it, so
+	// GCBlobs cannot remove it in between
+	err := db.withTx(ctx, func(tx *serverTx) error {
+		var complete bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT complete FROM blobs WHERE user_id = ? AND hash = ?
+		`, userID, hash).Scan(&complete)
+		if err == sql.ErrNoRows {
+			return ErrBlobNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get blob: %w", err)
+		}
+		if !complete {
+			return ErrBlobIncomplete
+		}
+		var exists int
+		err = tx.QueryRowContext(ctx, `SELECT 1 FROM notes WHERE id = ? AND user_id = ?`, noteID, userID).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("note not found")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get note: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO attachments (id, note_id, user_id, name, hash, size, deleted, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, FALSE, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET
+				name = excluded.name,
+				deleted = FALSE,
+				updated_at = excluded.updated_at
+			WHERE attachments.user_id = ?
+		`, id, noteID, userID, name, hash, size, createdAt, now, userID); err != nil {
+			return fmt.Errorf("failed to upsert attachment: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServerAttachment{
+		ID:        id,
+		NoteID:    noteID,
+		UserID:    userID,
+		Name:      name,
+		Hash:      hash,
+		Size:      size,
+		CreatedAt: createdAt,
+		UpdatedAt: now,
+	}, nil
+}
+
+// DeleteAttachment marks an attachment deleted, so other clients learn about
+// it on their next sync. Its blob goes at the next GCBlobs if unused.
+func (db *ServerDB) DeleteAttachment(ctx context.Context, id string, userID int64) error {
+	_, err := db.conn.ExecContext(ctx, `
+		UPDATE attachments SET deleted = TRUE, updated_at = ? WHERE id = ? AND user_id = ?
+	`, time.Now(), id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	return nil
+}
+
+// GetAttachmentsSince returns the attachments added, renamed or deleted
+// after since.
+func (db *ServerDB) GetAttachmentsSince(ctx context.Context, userID int64, since time.Time) ([]ServerAttachment, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, note_id, user_id, name, hash, size, deleted, created_at, updated_at
+		FROM attachments
+		WHERE user_id = ? AND updated_at > ?
+		ORDER BY updated_at ASC
+	`, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []ServerAttachment
+	for rows.Next() {
+		var a ServerAttachment
+		if err := rows.Scan(&a.ID, &a.NoteID, &a.UserID, &a.Name, &a.Hash, &a.Size, &a.Deleted, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// GCBlobs removes the blobs no live attachment refers to. Blobs younger than
+// grace are kept, so uploads whose attachment is not registered yet survive.
+// It returns the number of blobs removed.
+func (db *ServerDB) GCBlobs(ctx context.Context, grace time.Duration) (int, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT b.user_id, b.hash FROM blobs b
+		WHERE b.created_at < ?
+		  AND NOT EXISTS (
+			SELECT 1 FROM attachments a
+			WHERE a.user_id = b.user_id AND a.hash = b.hash AND a.deleted = FALSE
+		  )
+	`, time.Now().Add(-grace))
+	if err != nil {
+		return 0, fmt.Errorf("failed to find unused blobs: %w", err)
+	}
+	type blobRef struct {
+		userID int64
+		hash   string
+	}
+	var unused []blobRef
+	for rows.Next() {
+		var b blobRef
+		if err := rows.Scan(&b.userID, &b.hash); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		unused = append(unused, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, b := range unused {
+		// An attachment may have been registered since the blob was picked:
+		// the check and the rows go together, the data only once they are gone
+		gone := false
+		err := db.withTx(ctx, func(tx *serverTx) error {
+			gone = false
+			var used int
+			if err := tx.QueryRowContext(ctx, `
+				SELECT COUNT(*) FROM attachments WHERE user_id = ? AND hash = ? AND deleted = FALSE
+			`, b.userID, b.hash).Scan(&used); err != nil {
+				return err
+			}
+			if used > 0 {
+				return nil
+			}
+			for _, table := range []string{"blob_parts", "blobs"} {
+				if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = ? AND hash = ?`, b.userID, b.hash); err != nil {
+					return err
+				}
+			}
+			gone = true
+			return nil
+		})
+		if err != nil {
+			return removed, err
+		}
+		if !gone {
+			continue
+		}
+		if err := db.blobs.DeleteBlob(ctx, b.userID, b.hash); err != nil {
+			return removed, fmt.Errorf("failed to delete blob: %w", err)
+		}
+		removed++
+	}
+
+	// Tombstones only need to live until every client has synced them
+	if _, err := db.conn.ExecContext(ctx, `
+		DELETE FROM attachments WHERE deleted = TRUE AND updated_at < ?
+	`, time.Now().Add(-30*24*time.Hour)); err != nil {
+		return removed, err
+	}
+	return removed, nil
+}
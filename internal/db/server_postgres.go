@@ -0,0 +1,230 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// The sync server can keep its data in PostgreSQL instead of a SQLite file.
+// Both use the same queries, written for SQLite: serverConn rewrites their
+// ? placeholders into Postgres' $1, $2... The schemas are the same tables
+// with the column types of each database.
+
+const (
+	DefaultPostgresMaxConns = 20
+	postgresTxRetries       = 3
+)
+
+// serverConn runs the server's queries on either database.
+type serverConn struct {
+	db       *sql.DB
+	postgres bool
+}
+
+// serverTx is a transaction on a serverConn.
+type serverTx struct {
+	tx       *sql.Tx
+	postgres bool
+}
+
+// rebind rewrites the ? placeholders of query for Postgres. The server's
+// queries never contain a literal question mark.
+func rebind(postgres bool, query string) string {
+	if !postgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (c *serverConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(ctx, rebind(c.postgres, query), args...)
+}
+
+func (c *serverConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(ctx, rebind(c.postgres, query), args...)
+}
+
+func (c *serverConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(ctx, rebind(c.postgres, query), args...)
+}
+
+func (c *serverConn) Close() error {
+	return c.db.Close()
+}
+
+func (t *serverTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.tx.ExecContext(ctx, rebind(t.postgres, query), args...)
+}
+
+func (t *serverTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return t.tx.QueryRowContext(ctx, rebind(t.postgres, query), args...)
+}
+
+// NewPostgresServerDB connects to the PostgreSQL database at url (a
+// postgres:// URL or a key=value connection string) and migrates it.
+func NewPostgresServerDB(url string) (*ServerDB, error) {
+	conn, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	conn.SetMaxOpenConns(DefaultPostgresMaxConns)
+	conn.SetMaxIdleConns(DefaultPostgresMaxConns / 4)
+	conn.SetConnMaxIdleTime(5 * time.Minute)
+	conn.SetConnMaxLifetime(time.Hour)
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	db := &ServerDB{conn: &serverConn{db: conn, postgres: true}}
+	db.blobs = dbBlobStore{conn: db.conn}
+	if err := db.migrate(context.Background()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return db, nil
+}
+
+// SetMaxConns limits the connections the server keeps open to its database.
+func (db *ServerDB) SetMaxConns(n int) {
+	db.conn.db.SetMaxOpenConns(n)
+	db.conn.db.SetMaxIdleConns(max(n/4, 1))
+}
+
+// withTx runs fn in a transaction. On Postgres the transaction is
+// serializable, and is retried when it conflicts with a concurrent one.
+func (db *ServerDB) withTx(ctx context.Context, fn func(tx *serverTx) error) error {
+	var opts *sql.TxOptions
+	if db.conn.postgres {
+		opts = &sql.TxOptions{Isolation: sql.LevelSerializable}
+	}
+
+	for attempt := 1; ; attempt++ {
+		tx, err := db.conn.db.BeginTx(ctx, opts)
+		if err != nil {
+			return err
+		}
+		err = fn(&serverTx{tx: tx, postgres: db.conn.postgres})
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+		if err == nil || attempt == postgresTxRetries || !isSerializationFailure(err) {
+			return err
+		}
+	}
+}
+
+// isSerializationFailure reports whether err is a Postgres serialization
+// failure or deadlock, after which the transaction can be run again.
+func isSerializationFailure(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	state := pgErr.SQLState()
+	return state == "40001" || state == "40P01"
+}
+
+const postgresSchema = `
+	CREATE TABLE IF NOT EXISTS users (
+		id BIGSERIAL PRIMARY KEY,
+		username TEXT UNIQUE NOT NULL,
+		password_hash TEXT NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		active BOOLEAN DEFAULT TRUE
+	);
+
+	CREATE TABLE IF NOT EXISTS notes (
+		id TEXT PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		title TEXT NOT NULL,
+		content TEXT NOT NULL,
+		tags TEXT,
+		parent_folder_id TEXT,
+		archived BOOLEAN DEFAULT FALSE,
+		read_only BOOLEAN DEFAULT FALSE,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS folders (
+		id TEXT PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		title TEXT NOT NULL,
+		parent_folder_id TEXT,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS note_versions (
+		id TEXT PRIMARY KEY,
+		note_id TEXT NOT NULL,
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		title TEXT NOT NULL,
+		content TEXT NOT NULL,
+		tags TEXT,
+		hash TEXT,
+		version_num INTEGER NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS blobs (
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		hash TEXT NOT NULL,
+		size BIGINT NOT NULL,
+		chunks INTEGER NOT NULL,
+		complete BOOLEAN DEFAULT FALSE,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, hash)
+	);
+
+	CREATE TABLE IF NOT EXISTS blob_parts (
+		user_id BIGINT NOT NULL,
+		hash TEXT NOT NULL,
+		seq INTEGER NOT NULL,
+		size BIGINT NOT NULL,
+		PRIMARY KEY (user_id, hash, seq)
+	);
+
+	CREATE TABLE IF NOT EXISTS blob_data (
+		user_id BIGINT NOT NULL,
+		hash TEXT NOT NULL,
+		seq INTEGER NOT NULL,
+		data BYTEA NOT NULL,
+		PRIMARY KEY (user_id, hash, seq)
+	);
+
+	CREATE TABLE IF NOT EXISTS attachments (
+		id TEXT PRIMARY KEY,
+		note_id TEXT NOT NULL,
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		name TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		size BIGINT NOT NULL,
+		deleted BOOLEAN DEFAULT FALSE,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+	);
+`
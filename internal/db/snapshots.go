@@ -0,0 +1,659 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Reasons a vault snapshot was taken. Every reason but SnapshotManual marks a
+// snapshot taken automatically before a risky operation.
+const (
+	SnapshotManual       = "manual"
+	SnapshotNotePassword = "note-password" // Prima di proteggere una nota o cartella con password
+	SnapshotSync         = "first-sync"
+	SnapshotRestore      = "restore"
+)
+
+type Snapshot struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+	Notes     int       `json:"notes"`
+	Folders   int       `json:"folders"`
+}
+
+type RestoreAction string
+
+const (
+	RestoreCreate RestoreAction = "create"
+	RestoreUpdate RestoreAction = "update"
+	RestoreDelete RestoreAction = "delete"
+)
+
+// RestoreChange is one note or folder a restore would touch.
+type RestoreChange struct {
+	Type   string // "note" o "folder"
+	ID     int64
+	Title  string
+	Action RestoreAction
+}
+
+// RestorePlan lists what restoring the vault to a past state would change.
+// Build one with PlanSnapshotRestore or PlanRestoreAt and pass it to
+// ApplyRestore.
+type RestorePlan struct {
+	At      time.Time
+	Changes []RestoreChange
+	target  *vaultState
+}
+
+// vaultState is the set of live notes and folders at a point in time. A note
+// with VersionID 0 has unknown content and is restored without touching it.
+type vaultState struct {
+	notes   map[int64]noteState
+	folders map[int64]folderState
+}
+
+type noteState struct {
+	VersionID    int64
+	Title        string
+	Content      string
+	Tags         []string
+	ParentFolder int64
+}
+
+type folderState struct {
+	Title        string
+	ParentFolder int64
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// nullID stores the root folder (0) as NULL.
+func nullID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// recordFolderVersion appends the current state of a folder to its history.
+func recordFolderVersion(ctx context.Context, conn execer, folderID int64) error {
+	_, err := conn.ExecContext(ctx, `
+		INSERT INTO folder_versions (folder_id, title, parent_folder_id, deleted, created_at)
+		SELECT id, title, parent_folder_id, COALESCE(deleted, 0), CURRENT_TIMESTAMP
+		FROM folders WHERE id = ?
+	`, folderID)
+	if err != nil {
+		return fmt.Errorf("failed to record folder history: %w", err)
+	}
+	return nil
+}
+
+// VerifyCipher returns ErrWrongKey when the cipher cannot read existing notes.
+func (db *DB) VerifyCipher(ctx context.Context) error {
+	ok, err := db.cipherMatches(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWrongKey
+	}
+	return nil
+}
+
+// CreateSnapshot records the current state of every note and folder. The
+// current content of each note is saved as a version first, so the snapshot
+// only has to reference version IDs.
+func (db *DB) CreateSnapshot(ctx context.Context, name, reason string) (*Snapshot, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := db.currentState(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure every readable note has a version matching its content. They
+	// are saved with the snapshot, so a failed snapshot leaves no versions
+	for id, n := range current.notes {
+		if n.VersionID == 0 {
+			continue
+		}
+		if err := db.saveNoteVersion(ctx, tx, id, n.Title, n.Content, n.Tags); err != nil {
+			return nil, fmt.Errorf("failed to save version: %w", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	result, err := tx.ExecContext(ctx, `INSERT INTO snapshots (name, reason, created_at) VALUES (?, ?, ?)`, name, reason, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	snapID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	for id, n := range current.notes {
+		var versionID interface{}
+		if n.VersionID != 0 {
+			var latest int64
+			err := tx.QueryRowContext(ctx, `
+				SELECT id FROM note_versions WHERE note_id = ? ORDER BY version_num DESC LIMIT 1
+			`, id).Scan(&latest)
+			if err != nil && err != sql.ErrNoRows {
+				return nil, err
+			}
+			if err == nil {
+				versionID = latest
+			}
+		}
+		tagsJSON, _ := json.Marshal(n.Tags)
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO snapshot_notes (snapshot_id, note_id, version_id, title, tags, parent_folder_id)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, snapID, id, versionID, n.Title, string(tagsJSON), nullID(n.ParentFolder)); err != nil {
+			return nil, fmt.Errorf("failed to record note: %w", err)
+		}
+	}
+	for id, f := range current.folders {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO snapshot_folders (snapshot_id, folder_id, title, parent_folder_id)
+			VALUES (?, ?, ?, ?)
+		`, snapID, id, f.Title, nullID(f.ParentFolder)); err != nil {
+			return nil, fmt.Errorf("failed to record folder: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{
+		ID:        snapID,
+		Name:      name,
+		Reason:    reason,
+		CreatedAt: now,
+		Notes:     len(current.notes),
+		Folders:   len(current.folders),
+	}, nil
+}
+
+// ListSnapshots returns the vault snapshots, newest first.
+func (db *DB) ListSnapshots(ctx context.Context) ([]Snapshot, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT s.id, s.name, s.reason, s.created_at,
+		       (SELECT COUNT(*) FROM snapshot_notes WHERE snapshot_id = s.id),
+		       (SELECT COUNT(*) FROM snapshot_folders WHERE snapshot_id = s.id)
+		FROM snapshots s
+		ORDER BY s.created_at DESC, s.id DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []Snapshot
+	for rows.Next() {
+		var s Snapshot
+		if err := rows.Scan(&s.ID, &s.Name, &s.Reason, &s.CreatedAt, &s.Notes, &s.Folders); err != nil {
+			return nil, fmt.Errorf("failed to scan snapshot: %w", err)
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
+
+// HasSnapshot reports whether a snapshot taken for reason exists.
+func (db *DB) HasSnapshot(ctx context.Context, reason string) (bool, error) {
+	var n int
+	if err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM snapshots WHERE reason = ?`, reason).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (db *DB) DeleteSnapshot(ctx context.Context, id int64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM snapshot_notes WHERE snapshot_id = ?`,
+		`DELETE FROM snapshot_folders WHERE snapshot_id = ?`,
+		`DELETE FROM snapshots WHERE id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return fmt.Errorf("failed to delete snapshot: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// currentState reads the live notes and folders. Notes the cipher cannot
+// read are included with VersionID 0.
+func (db *DB) currentState(ctx context.Context, conn querier) (*vaultState, error) {
+	state := &vaultState{notes: make(map[int64]noteState), folders: make(map[int64]folderState)}
+
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, title, content, tags, COALESCE(parent_folder_id, 0)
+		FROM notes WHERE deleted = 0 OR deleted IS NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var n noteState
+		var raw string
+		var tagsJSON sql.NullString
+		if err := rows.Scan(&id, &n.Title, &raw, &tagsJSON, &n.ParentFolder); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan note: %w", err)
+		}
+		if tagsJSON.Valid && tagsJSON.String != "" {
+			json.Unmarshal([]byte(tagsJSON.String), &n.Tags)
+		}
+		if plain, err := db.open(raw); err == nil {
+			n.Content = plain
+			n.VersionID = -1 // Contenuto noto, non ancora legato a una versione
+		}
+		state.notes[id] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	frows, err := conn.QueryContext(ctx, `
+		SELECT id, title, COALESCE(parent_folder_id, 0)
+		FROM folders WHERE deleted = 0 OR deleted IS NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folders: %w", err)
+	}
+	defer frows.Close()
+	for frows.Next() {
+		var id int64
+		var f folderState
+		if err := frows.Scan(&id, &f.Title, &f.ParentFolder); err != nil {
+			return nil, fmt.Errorf("failed to scan folder: %w", err)
+		}
+		state.folders[id] = f
+	}
+	return state, frows.Err()
+}
+
+// snapshotState rebuilds the vault as recorded by a named snapshot.
+func (db *DB) snapshotState(ctx context.Context, snapID int64) (*vaultState, time.Time, error) {
+	var at time.Time
+	err := db.conn.QueryRowContext(ctx, `SELECT created_at FROM snapshots WHERE id = ?`, snapID).Scan(&at)
+	if err == sql.ErrNoRows {
+		return nil, at, fmt.Errorf("snapshot %d not found", snapID)
+	}
+	if err != nil {
+		return nil, at, err
+	}
+
+	state := &vaultState{notes: make(map[int64]noteState), folders: make(map[int64]folderState)}
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT note_id, version_id, title, tags, COALESCE(parent_folder_id, 0)
+		FROM snapshot_notes WHERE snapshot_id = ?
+	`, snapID)
+	if err != nil {
+		return nil, at, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	type entry struct {
+		id        int64
+		versionID sql.NullInt64
+		state     noteState
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		var tagsJSON sql.NullString
+		if err := rows.Scan(&e.id, &e.versionID, &e.state.Title, &tagsJSON, &e.state.ParentFolder); err != nil {
+			rows.Close()
+			return nil, at, err
+		}
+		if tagsJSON.Valid && tagsJSON.String != "" {
+			json.Unmarshal([]byte(tagsJSON.String), &e.state.Tags)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, at, err
+	}
+
+	for _, e := range entries {
+		if e.versionID.Valid {
+			version, err := db.GetNoteVersion(ctx, e.versionID.Int64)
+			if err != nil {
+				return nil, at, fmt.Errorf("failed to load version of note %d: %w", e.id, err)
+			}
+			e.state.VersionID = version.ID
+			e.state.Content = version.Content
+		}
+		state.notes[e.id] = e.state
+	}
+
+	frows, err := db.conn.QueryContext(ctx, `
+		SELECT folder_id, title, COALESCE(parent_folder_id, 0)
+		FROM snapshot_folders WHERE snapshot_id = ?
+	`, snapID)
+	if err != nil {
+		return nil, at, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	defer frows.Close()
+	for frows.Next() {
+		var id int64
+		var f folderState
+		if err := frows.Scan(&id, &f.Title, &f.ParentFolder); err != nil {
+			return nil, at, err
+		}
+		state.folders[id] = f
+	}
+	return state, at, frows.Err()
+}
+
+// stateAt rebuilds the vault as of t from note and folder history. Note
+// history does not record moves, so notes keep their current folder, or go
+// to the root when that folder did not exist yet. Notes that were purged
+// after a sync can only be brought back from a named snapshot.
+func (db *DB) stateAt(ctx context.Context, t time.Time) (*vaultState, error) {
+	state := &vaultState{notes: make(map[int64]noteState), folders: make(map[int64]folderState)}
+
+	// Folders: latest history entry at or before t
+	frows, err := db.conn.QueryContext(ctx, `
+		SELECT folder_id, title, COALESCE(parent_folder_id, 0), COALESCE(deleted, 0), created_at
+		FROM folder_versions
+		ORDER BY folder_id, id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read folder history: %w", err)
+	}
+	deletedFolders := make(map[int64]bool)
+	for frows.Next() {
+		var id int64
+		var f folderState
+		var deleted bool
+		var createdAt time.Time
+		if err := frows.Scan(&id, &f.Title, &f.ParentFolder, &deleted, &createdAt); err != nil {
+			frows.Close()
+			return nil, err
+		}
+		if createdAt.After(t) {
+			continue
+		}
+		if deleted {
+			delete(state.folders, id)
+			deletedFolders[id] = true
+		} else {
+			state.folders[id] = f
+			delete(deletedFolders, id)
+		}
+	}
+	frows.Close()
+	if err := frows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Notes: latest version at or before t, for notes that still have a row
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT n.id, n.created_at, COALESCE(n.deleted, 0), n.updated_at, COALESCE(n.parent_folder_id, 0),
+		       n.title, n.tags,
+		       (SELECT v.id FROM note_versions v
+		        WHERE v.note_id = n.id AND v.created_at <= ?
+		        ORDER BY v.version_num DESC LIMIT 1)
+		FROM notes n
+	`, t.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notes: %w", err)
+	}
+	type entry struct {
+		id        int64
+		versionID sql.NullInt64
+		state     noteState
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		var createdAt, updatedAt time.Time
+		var deleted bool
+		var tagsJSON sql.NullString
+		if err := rows.Scan(&e.id, &createdAt, &deleted, &updatedAt, &e.state.ParentFolder,
+			&e.state.Title, &tagsJSON, &e.versionID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if createdAt.After(t) || (deleted && !updatedAt.After(t)) {
+			// Not created yet, or already deleted at t
+			continue
+		}
+		if tagsJSON.Valid && tagsJSON.String != "" {
+			json.Unmarshal([]byte(tagsJSON.String), &e.state.Tags)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if e.versionID.Valid {
+			version, err := db.GetNoteVersion(ctx, e.versionID.Int64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load version of note %d: %w", e.id, err)
+			}
+			e.state.VersionID = version.ID
+			e.state.Title = version.Title
+			e.state.Tags = version.Tags
+			e.state.Content = version.Content
+		}
+		if _, ok := state.folders[e.state.ParentFolder]; !ok {
+			e.state.ParentFolder = 0
+		}
+		state.notes[e.id] = e.state
+	}
+
+	return state, nil
+}
+
+// PlanSnapshotRestore compares the vault with a named snapshot.
+func (db *DB) PlanSnapshotRestore(ctx context.Context, snapID int64) (*RestorePlan, error) {
+	target, at, err := db.snapshotState(ctx, snapID)
+	if err != nil {
+		return nil, err
+	}
+	return db.plan(ctx, target, at)
+}
+
+// PlanRestoreAt compares the vault with its state at t.
+func (db *DB) PlanRestoreAt(ctx context.Context, t time.Time) (*RestorePlan, error) {
+	target, err := db.stateAt(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	return db.plan(ctx, target, t)
+}
+
+func (db *DB) plan(ctx context.Context, target *vaultState, at time.Time) (*RestorePlan, error) {
+	current, err := db.currentState(ctx, db.conn)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &RestorePlan{At: at, target: target}
+
+	for id, f := range target.folders {
+		cur, ok := current.folders[id]
+		switch {
+		case !ok:
+			p.Changes = append(p.Changes, RestoreChange{Type: "folder", ID: id, Title: f.Title, Action: RestoreCreate})
+		case cur != f:
+			p.Changes = append(p.Changes, RestoreChange{Type: "folder", ID: id, Title: f.Title, Action: RestoreUpdate})
+		}
+	}
+	for id, f := range current.folders {
+		if _, ok := target.folders[id]; !ok {
+			p.Changes = append(p.Changes, RestoreChange{Type: "folder", ID: id, Title: f.Title, Action: RestoreDelete})
+		}
+	}
+
+	for id, n := range target.notes {
+		cur, ok := current.notes[id]
+		switch {
+		case !ok:
+			p.Changes = append(p.Changes, RestoreChange{Type: "note", ID: id, Title: n.Title, Action: RestoreCreate})
+		case noteChanged(cur, n):
+			p.Changes = append(p.Changes, RestoreChange{Type: "note", ID: id, Title: n.Title, Action: RestoreUpdate})
+		}
+	}
+	for id, n := range current.notes {
+		if _, ok := target.notes[id]; !ok {
+			p.Changes = append(p.Changes, RestoreChange{Type: "note", ID: id, Title: n.Title, Action: RestoreDelete})
+		}
+	}
+
+	sort.Slice(p.Changes, func(i, j int) bool {
+		a, b := p.Changes[i], p.Changes[j]
+		if a.Type != b.Type {
+			return a.Type == "folder"
+		}
+		return a.Title < b.Title
+	})
+	return p, nil
+}
+
+func noteChanged(cur, target noteState) bool {
+	if cur.Title != target.Title || cur.ParentFolder != target.ParentFolder {
+		return true
+	}
+	if fmt.Sprint(cur.Tags) != fmt.Sprint(target.Tags) {
+		return true
+	}
+	// Content is only compared when both sides could be read
+	return target.VersionID > 0 && cur.VersionID != 0 && cur.Content != target.Content
+}
+
+// ApplyRestore brings the vault to the state of a plan in one transaction.
+// Restored notes are marked pending so the next sync uploads them.
+func (db *DB) ApplyRestore(ctx context.Context, p *RestorePlan) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, c := range p.Changes {
+		if c.Type != "folder" {
+			continue
+		}
+		switch c.Action {
+		case RestoreDelete:
+			_, err = tx.ExecContext(ctx, `UPDATE folders SET deleted = 1, updated_at = ? WHERE id = ?`, now, c.ID)
+		default:
+			f := p.target.folders[c.ID]
+			var result sql.Result
+			result, err = tx.ExecContext(ctx, `
+				UPDATE folders SET title = ?, parent_folder_id = ?, deleted = 0, updated_at = ? WHERE id = ?
+			`, f.Title, nullID(f.ParentFolder), now, c.ID)
+			if n, _ := rowsAffected(result, err); err == nil && n == 0 {
+				_, err = tx.ExecContext(ctx, `
+					INSERT INTO folders (id, title, parent_folder_id, created_at, updated_at, deleted)
+					VALUES (?, ?, ?, ?, ?, 0)
+				`, c.ID, f.Title, nullID(f.ParentFolder), now, now)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore folder %q: %w", c.Title, err)
+		}
+		if err := recordFolderVersion(ctx, tx, c.ID); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range p.Changes {
+		if c.Type != "note" {
+			continue
+		}
+		if c.Action == RestoreDelete {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE notes SET deleted = 1, sync_status = 'pending', updated_at = ? WHERE id = ?
+			`, now, c.ID); err != nil {
+				return fmt.Errorf("failed to delete note %q: %w", c.Title, err)
+			}
+			continue
+		}
+
+		n := p.target.notes[c.ID]
+		tagsJSON, _ := json.Marshal(n.Tags)
+		var result sql.Result
+		if n.VersionID > 0 {
+			content, err := db.seal(n.Content)
+			if err != nil {
+				return err
+			}
+			result, err = tx.ExecContext(ctx, `
+				UPDATE notes SET title = ?, content = ?, tags = ?, parent_folder_id = ?,
+				       deleted = 0, sync_status = 'pending', updated_at = ?
+				WHERE id = ?
+			`, n.Title, content, string(tagsJSON), nullID(n.ParentFolder), now, c.ID)
+			if affected, _ := rowsAffected(result, err); err == nil && affected == 0 {
+				// The note was purged after a sync: recreate it
+				_, err = tx.ExecContext(ctx, `
+					INSERT INTO notes (id, title, content, tags, parent_folder_id, created_at, updated_at, sync_status, deleted)
+					VALUES (?, ?, ?, ?, ?, ?, ?, 'pending', 0)
+				`, c.ID, n.Title, content, string(tagsJSON), nullID(n.ParentFolder), now, now)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to restore note %q: %w", c.Title, err)
+			}
+			if err := indexNoteTags(ctx, tx, c.ID, n.Tags); err != nil {
+				return err
+			}
+			if err := db.indexNoteContent(ctx, tx, c.ID, n.Content); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Content unknown: only bring back metadata and location
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE notes SET title = ?, tags = ?, parent_folder_id = ?,
+			       deleted = 0, sync_status = 'pending', updated_at = ?
+			WHERE id = ?
+		`, n.Title, string(tagsJSON), nullID(n.ParentFolder), now, c.ID); err != nil {
+			return fmt.Errorf("failed to restore note %q: %w", c.Title, err)
+		}
+		if err := indexNoteTags(ctx, tx, c.ID, n.Tags); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func rowsAffected(result sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
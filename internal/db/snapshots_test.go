@@ -0,0 +1,239 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// planSummary lists the changes of a plan as "type id action", sorted.
+func planSummary(p *RestorePlan) []string {
+	var out []string
+	for _, c := range p.Changes {
+		out = append(out, fmt.Sprintf("%s %d %s", c.Type, c.ID, c.Action))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func mustFolder(t *testing.T, database *DB, title string) int64 {
+	t.Helper()
+	id, err := database.CreateFolder(context.Background(), title, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func mustNote(t *testing.T, database *DB, title, content string, folderID int64) int64 {
+	t.Helper()
+	ctx := context.Background()
+	note, err := database.CreateNoteInFolder(ctx, title, content, nil, folderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SaveNoteVersion(ctx, note.ID, title, content, nil); err != nil {
+		t.Fatal(err)
+	}
+	return note.ID
+}
+
+// renameFolder renames a folder the way a sync does, recording its history.
+func renameFolder(t *testing.T, database *DB, id int64, title string) {
+	t.Helper()
+	if _, err := database.conn.Exec(`UPDATE folders SET title = ? WHERE id = ?`, title, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordFolderVersion(context.Background(), database.conn, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkNote fails unless note id is live with the given title and content.
+func checkNote(t *testing.T, database *DB, id int64, title, content string) {
+	t.Helper()
+	note, err := database.GetNote(context.Background(), id)
+	if err != nil || note == nil {
+		t.Fatalf("note %d: %+v, %v", id, note, err)
+	}
+	if note.Deleted || note.Title != title || note.Content != content {
+		t.Fatalf("note %d restored as %+v", id, note)
+	}
+}
+
+func noteDeleted(t *testing.T, database *DB, id int64) bool {
+	t.Helper()
+	var deleted bool
+	database.conn.QueryRow(`SELECT COALESCE(deleted, 0) FROM notes WHERE id = ?`, id).Scan(&deleted)
+	return deleted
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	work := mustFolder(t, database, "Lavoro")
+	home := mustFolder(t, database, "Casa")
+	shopping := mustNote(t, database, "Spesa", "latte", work)
+	ideas := mustNote(t, database, "Idee", "una", 0)
+
+	snap, err := database.CreateSnapshot(ctx, "prima", SnapshotManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Notes != 2 || snap.Folders != 2 {
+		t.Fatalf("snapshot of %d notes and %d folders", snap.Notes, snap.Folders)
+	}
+
+	renameFolder(t, database, work, "Ufficio")
+	if err := database.DeleteFolder(ctx, home); err != nil {
+		t.Fatal(err)
+	}
+	trips := mustFolder(t, database, "Viaggi")
+	if err := database.UpdateNote(ctx, shopping, "Spesa", "latte e uova", nil); err != nil {
+		t.Fatal(err)
+	}
+	// Purged after a sync: only the snapshot still knows it
+	if _, err := database.conn.Exec(`DELETE FROM notes WHERE id = ?`, ideas); err != nil {
+		t.Fatal(err)
+	}
+	added := mustNote(t, database, "Nuova", "", trips)
+
+	plan, err := database.PlanSnapshotRestore(ctx, snap.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		fmt.Sprintf("folder %d update", work),
+		fmt.Sprintf("folder %d create", home),
+		fmt.Sprintf("folder %d delete", trips),
+		fmt.Sprintf("note %d update", shopping),
+		fmt.Sprintf("note %d create", ideas),
+		fmt.Sprintf("note %d delete", added),
+	}
+	sort.Strings(want)
+	if got := planSummary(plan); !reflect.DeepEqual(got, want) {
+		t.Fatalf("plan %v, want %v", got, want)
+	}
+
+	if err := database.ApplyRestore(ctx, plan); err != nil {
+		t.Fatal(err)
+	}
+	checkNote(t, database, shopping, "Spesa", "latte")
+	checkNote(t, database, ideas, "Idee", "una")
+	if !noteDeleted(t, database, added) {
+		t.Fatal("note created after the snapshot survived the restore")
+	}
+	if f, _ := database.GetFolder(ctx, work); f == nil || f.Title != "Lavoro" {
+		t.Fatalf("folder restored as %+v", f)
+	}
+	if f, _ := database.GetFolder(ctx, home); f == nil || f.Deleted {
+		t.Fatalf("deleted folder restored as %+v", f)
+	}
+	if f, _ := database.GetFolder(ctx, trips); f != nil && !f.Deleted {
+		t.Fatal("folder created after the snapshot survived the restore")
+	}
+
+	// The vault now matches the snapshot
+	if plan, err := database.PlanSnapshotRestore(ctx, snap.ID); err != nil || len(plan.Changes) != 0 {
+		t.Fatalf("changes left after the restore: %v, %v", planSummary(plan), err)
+	}
+}
+
+func TestRestoreAt(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	work := mustFolder(t, database, "Lavoro")
+	home := mustFolder(t, database, "Casa")
+	shopping := mustNote(t, database, "Spesa", "latte", work)
+	ideas := mustNote(t, database, "Idee", "una", 0)
+
+	// History is kept to the second: move everything so far back in time
+	for _, query := range []string{
+		`UPDATE notes SET created_at = datetime('now', '-2 hours'), updated_at = datetime('now', '-2 hours')`,
+		`UPDATE note_versions SET created_at = datetime('now', '-2 hours')`,
+		`UPDATE folder_versions SET created_at = datetime('now', '-2 hours')`,
+	} {
+		if _, err := database.conn.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	at := time.Now().Add(-time.Hour)
+
+	renameFolder(t, database, work, "Ufficio")
+	if err := database.DeleteFolder(ctx, home); err != nil {
+		t.Fatal(err)
+	}
+	trips := mustFolder(t, database, "Viaggi")
+	if err := database.UpdateNote(ctx, shopping, "Spesa", "latte e uova", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SaveNoteVersion(ctx, shopping, "Spesa", "latte e uova", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DeleteNote(ctx, ideas); err != nil {
+		t.Fatal(err)
+	}
+	added := mustNote(t, database, "Nuova", "", trips)
+
+	plan, err := database.PlanRestoreAt(ctx, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		fmt.Sprintf("folder %d update", work),
+		fmt.Sprintf("folder %d create", home),
+		fmt.Sprintf("folder %d delete", trips),
+		fmt.Sprintf("note %d update", shopping),
+		fmt.Sprintf("note %d create", ideas),
+		fmt.Sprintf("note %d delete", added),
+	}
+	sort.Strings(want)
+	if got := planSummary(plan); !reflect.DeepEqual(got, want) {
+		t.Fatalf("plan %v, want %v", got, want)
+	}
+
+	if err := database.ApplyRestore(ctx, plan); err != nil {
+		t.Fatal(err)
+	}
+	checkNote(t, database, shopping, "Spesa", "latte")
+	checkNote(t, database, ideas, "Idee", "una")
+	if !noteDeleted(t, database, added) {
+		t.Fatal("note created after the restore point survived the restore")
+	}
+	if f, _ := database.GetFolder(ctx, work); f == nil || f.Title != "Lavoro" {
+		t.Fatalf("folder restored as %+v", f)
+	}
+	if f, _ := database.GetFolder(ctx, home); f == nil || f.Deleted {
+		t.Fatalf("deleted folder restored as %+v", f)
+	}
+	if f, _ := database.GetFolder(ctx, trips); f != nil && !f.Deleted {
+		t.Fatal("folder created after the restore point survived the restore")
+	}
+}
+
+func TestCreateSnapshotSavesVersions(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	note, err := database.CreateNoteInFolder(ctx, "Bozza", "mai salvata", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := database.CreateSnapshot(ctx, "", SnapshotManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content string
+	err = database.conn.QueryRow(`
+		SELECT v.content FROM snapshot_notes s JOIN note_versions v ON v.id = s.version_id
+		WHERE s.snapshot_id = ? AND s.note_id = ?
+	`, snap.ID, note.ID).Scan(&content)
+	if err != nil || content != "mai salvata" {
+		t.Fatalf("snapshot version %q, %v", content, err)
+	}
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// The interfaces below are what the interface, sync and server need from
+// their storage. The SQLite stores satisfy them; MemoryStore is a
+// dependency-free implementation of the client side for tests.
+
+// NoteStore reads and writes notes, including their sync state.
+type NoteStore interface {
+	GetNote(ctx context.Context, id int64) (*Note, error)
+	CreateNoteInFolder(ctx context.Context, title, content string, tags []string, folderID int64) (*Note, error)
+	UpdateNote(ctx context.Context, id int64, title, content string, tags []string) error
+	DeleteNote(ctx context.Context, id int64) error
+	ListNotes(ctx context.Context) ([]NoteListItem, error)
+	ListNotesInFolder(ctx context.Context, folderID int64) ([]NoteListItem, error)
+	ListNotesWithArchived(ctx context.Context, folderID int64) ([]NoteListItem, error)
+	SearchNotes(ctx context.Context, query string, tags []string, filter SearchFilter) ([]NoteListItem, error)
+	SetNoteTags(ctx context.Context, id int64, tags []string) error
+	SetNotePassword(ctx context.Context, noteID int64, password string) error
+	SetNoteArchived(ctx context.Context, id int64, archived bool) error
+	SetNoteReadOnly(ctx context.Context, id int64, readOnly bool) error
+	SetNotePinned(ctx context.Context, id int64, pinned bool) error
+
+	GetPendingNotes(ctx context.Context) ([]Note, error)
+	GetNoteByServerID(ctx context.Context, serverID string) (*Note, error)
+	SetNoteSynced(ctx context.Context, id int64, serverID string, updatedAt time.Time) error
+	UpsertFromServer(ctx context.Context, serverID, title, content, tags string, archived, readOnly bool, createdAt, updatedAt time.Time) error
+	PermanentlyDeleteSynced(ctx context.Context, id int64) error
+}
+
+// FolderStore reads and writes folders and their sort order.
+type FolderStore interface {
+	CreateFolder(ctx context.Context, title string, parentID int64) (int64, error)
+	GetFolder(ctx context.Context, id int64) (*Folder, error)
+	ListFolders(ctx context.Context, parentID int64) ([]Folder, error)
+	DeleteFolder(ctx context.Context, id int64) error
+	SetFolderPassword(ctx context.Context, folderID int64, password string) error
+	CountNotesInFolder(ctx context.Context, folderID int64, archived bool) (int, error)
+	CountNotesInSubfolders(ctx context.Context, parentID int64, archived bool) (map[int64]int, error)
+	GetFolderSort(ctx context.Context, folderID int64) (FolderSort, error)
+	SaveFolderSort(ctx context.Context, s FolderSort) error
+	SetManualOrder(ctx context.Context, folderID int64, items []NoteListItem) error
+}
+
+// VersionStore keeps the version history of notes. Versions are saved and
+// returned in plaintext.
+type VersionStore interface {
+	SaveNoteVersion(ctx context.Context, noteID int64, title, content string, tags []string) error
+	GetNoteVersions(ctx context.Context, noteID int64) ([]NoteVersion, error)
+	RestoreNoteVersion(ctx context.Context, noteID int64, versionID int64) error
+	CompactNoteVersions(ctx context.Context, policy RetentionPolicy) (int, error)
+}
+
+// AttachmentStore is the part of the attachment storage sync works on. Blob
+// chunks and names are passed sealed.
+type AttachmentStore interface {
+	GetPendingAttachments(ctx context.Context) ([]Attachment, error)
+	SetAttachmentSynced(ctx context.Context, id int64, serverID string) error
+	PermanentlyDeleteAttachment(ctx context.Context, id int64) error
+	UpsertAttachmentFromServer(ctx context.Context, serverID, noteServerID, sealedName, hash string, size int64, createdAt time.Time, deleted bool, chunks [][]byte) error
+	HasBlob(ctx context.Context, hash string) (bool, error)
+	BlobChunks(ctx context.Context, hash string) ([][]byte, error)
+}
+
+// FileStore is the part of the attachment storage the interface works on.
+// Names and data are passed in plaintext.
+type FileStore interface {
+	ListAttachments(ctx context.Context, noteID int64) ([]Attachment, error)
+	AddAttachment(ctx context.Context, noteID int64, name string, data []byte, maxSize int64) (*Attachment, error)
+	ReadAttachment(ctx context.Context, id int64) ([]byte, error)
+	DeleteAttachment(ctx context.Context, id int64) error
+}
+
+// LinkStore follows the wiki links between notes and builds the graph of
+// the vault from them.
+type LinkStore interface {
+	GetBacklinks(ctx context.Context, noteID int64) ([]NoteListItem, error)
+	ResolveLink(ctx context.Context, l Link) (int64, error)
+	RenameNote(ctx context.Context, id int64, newTitle string) (int, error)
+	ResolveBrokenLinks(ctx context.Context) error
+	VaultGraph(ctx context.Context) (*Graph, error)
+}
+
+// TagStore lists and renames the tags in use.
+type TagStore interface {
+	ListTags(ctx context.Context) ([]TagCount, error)
+	RenameTag(ctx context.Context, oldName, newName string) (int, error)
+	MergeTags(ctx context.Context, names []string, into string) (int, error)
+}
+
+// PropertyStore keeps the typed properties of notes.
+type PropertyStore interface {
+	NoteProperties(ctx context.Context, noteID int64) ([]Property, error)
+	SetNoteProperty(ctx context.Context, noteID int64, p Property) error
+	DeleteNoteProperty(ctx context.Context, noteID int64, name string) error
+	PropertyTable(ctx context.Context, folderID int64) (*PropertyTable, error)
+}
+
+// ReminderStore keeps the reminders of notes and checklist items.
+type ReminderStore interface {
+	AddReminder(ctx context.Context, noteID int64, item string, due time.Time) (*Reminder, error)
+	ListReminders(ctx context.Context, noteID int64, includeDone bool) ([]Reminder, error)
+	MarkReminderFired(ctx context.Context, id int64) error
+	SetReminderDone(ctx context.Context, id int64, done bool) error
+	DeleteReminder(ctx context.Context, id int64) error
+}
+
+// TaskStore lists the checklist items of every note and ticks them.
+type TaskStore interface {
+	ListTasks(ctx context.Context, filter TaskFilter, now time.Time) ([]Task, error)
+	ToggleTask(ctx context.Context, noteID int64, line int, text string) (bool, error)
+}
+
+// BoardStore keeps the boards of folders and moves their cards.
+type BoardStore interface {
+	GetBoard(ctx context.Context, folderID int64) (Board, error)
+	SaveBoard(ctx context.Context, b Board) error
+	BoardColumns(ctx context.Context, b Board) ([]BoardColumn, error)
+	MoveCard(ctx context.Context, b Board, noteID int64, tag string) error
+}
+
+// TemplateStore lists templates and creates notes from them.
+type TemplateStore interface {
+	ListTemplates(ctx context.Context, folder string) ([]Template, error)
+	CreateNoteFromTemplate(ctx context.Context, t *Template, title string, folderID int64, vars TemplateVars) (*Note, error)
+}
+
+// DailyStore finds and creates daily notes.
+type DailyStore interface {
+	DailyNote(ctx context.Context, cfg DailyConfig, templatesFolder string, day time.Time) (int64, error)
+	DailyNoteDays(ctx context.Context, cfg DailyConfig, month time.Time) (map[int]int64, error)
+}
+
+// UserStore keeps the accounts of the sync server.
+type UserStore interface {
+	CreateUser(ctx context.Context, username, password string) (*User, error)
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	GetUserByID(ctx context.Context, id int64) (*User, error)
+	ValidatePassword(user *User, password string) bool
+}
+
+// ServerStore is everything the sync server keeps for its users: accounts,
+// notes, folders, attachments and their blobs. IDs are the server's.
+type ServerStore interface {
+	UserStore
+
+	ListNotesByUser(ctx context.Context, userID int64) ([]ServerNote, error)
+	GetNote(ctx context.Context, id string, userID int64) (*ServerNote, error)
+	UpsertNote(ctx context.Context, userID int64, id, title, content, tags, parentFolderID string, archived, readOnly bool, createdAt, updatedAt time.Time) (*ServerNote, error)
+	DeleteNote(ctx context.Context, id string, userID int64) error
+	GetNotesSince(ctx context.Context, userID int64, since time.Time) ([]ServerNote, error)
+
+	ListFoldersByUser(ctx context.Context, userID int64) ([]ServerFolder, error)
+	GetFolder(ctx context.Context, id string, userID int64) (*ServerFolder, error)
+	UpsertFolder(ctx context.Context, userID int64, id, title, parentFolderID string, createdAt, updatedAt time.Time) (*ServerFolder, error)
+	DeleteFolder(ctx context.Context, id string, userID int64) error
+	GetFoldersSince(ctx context.Context, userID int64, since time.Time) ([]ServerFolder, error)
+
+	GetBlob(ctx context.Context, userID int64, hash string) (*ServerBlob, error)
+	BlobUsage(ctx context.Context, userID int64) (int64, error)
+	StartBlobUpload(ctx context.Context, userID int64, hash string, size int64, chunks int, quota int64) (*ServerBlob, error)
+	PutBlobChunk(ctx context.Context, userID int64, hash string, seq int, data []byte) (*ServerBlob, error)
+	GetBlobChunk(ctx context.Context, userID int64, hash string, seq int) ([]byte, error)
+	UpsertAttachment(ctx context.Context, userID int64, id, noteID, name, hash string, size int64, createdAt time.Time) (*ServerAttachment, error)
+	DeleteAttachment(ctx context.Context, id string, userID int64) error
+	GetAttachmentsSince(ctx context.Context, userID int64, since time.Time) ([]ServerAttachment, error)
+}
+
+var (
+	_ NoteStore       = (*DB)(nil)
+	_ FolderStore     = (*DB)(nil)
+	_ VersionStore    = (*DB)(nil)
+	_ AttachmentStore = (*DB)(nil)
+	_ FileStore       = (*DB)(nil)
+	_ LinkStore       = (*DB)(nil)
+	_ TagStore        = (*DB)(nil)
+	_ PropertyStore   = (*DB)(nil)
+	_ ReminderStore   = (*DB)(nil)
+	_ TaskStore       = (*DB)(nil)
+	_ BoardStore      = (*DB)(nil)
+	_ TemplateStore   = (*DB)(nil)
+	_ DailyStore      = (*DB)(nil)
+	_ ServerStore     = (*ServerDB)(nil)
+)
@@ -0,0 +1,334 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tags are indexed in the tags and note_tags tables. notes.tags keeps the
+// JSON array that is synced with the server and is rewritten together with
+// the index. Tag names are stored in clear text, like note titles. A "/" in
+// a name nests it: "work/clients/acme" is a child of "work/clients".
+
+// TagCount is a tag with the number of notes carrying it or one of its
+// children.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type querier interface {
+	execer
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// NormalizeTag trims a tag name, drops a leading "#" and empty path segments.
+func NormalizeTag(name string) string {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "#")
+	var parts []string
+	for _, p := range strings.Split(name, "/") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// normalizeTags normalizes names and drops empty and duplicate tags.
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = NormalizeTag(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+// indexNoteTags replaces the tag index entries of a note.
+func indexNoteTags(ctx context.Context, conn querier, noteID int64, tags []string) error {
+	if _, err := conn.ExecContext(ctx, `DELETE FROM note_tags WHERE note_id = ?`, noteID); err != nil {
+		return fmt.Errorf("failed to index tags: %w", err)
+	}
+	for _, name := range normalizeTags(tags) {
+		if _, err := conn.ExecContext(ctx, `INSERT OR IGNORE INTO tags (name) VALUES (?)`, name); err != nil {
+			return fmt.Errorf("failed to index tags: %w", err)
+		}
+		var tagID int64
+		if err := conn.QueryRowContext(ctx, `SELECT id FROM tags WHERE name = ?`, name).Scan(&tagID); err != nil {
+			return fmt.Errorf("failed to index tags: %w", err)
+		}
+		if _, err := conn.ExecContext(ctx, `INSERT OR IGNORE INTO note_tags (note_id, tag_id) VALUES (?, ?)`, noteID, tagID); err != nil {
+			return fmt.Errorf("failed to index tags: %w", err)
+		}
+	}
+	return nil
+}
+
+// indexNoteTagsJSON indexes tags given in their stored JSON form.
+func indexNoteTagsJSON(ctx context.Context, conn querier, noteID int64, tagsJSON string) error {
+	var tags []string
+	if tagsJSON != "" {
+		json.Unmarshal([]byte(tagsJSON), &tags)
+	}
+	return indexNoteTags(ctx, conn, noteID, tags)
+}
+
+// reindexTags rebuilds the tag index from notes.tags. It runs once, when
+// the index is first created on an existing database.
+func (db *DB) reindexTags(ctx context.Context) error {
+	var indexed int
+	if err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM tags`).Scan(&indexed); err != nil || indexed > 0 {
+		return err
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT id, tags FROM notes WHERE tags IS NOT NULL AND tags != '' AND tags != '[]' AND tags != 'null'`)
+	if err != nil {
+		return err
+	}
+	tagged := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var tagsJSON string
+		if err := rows.Scan(&id, &tagsJSON); err != nil {
+			rows.Close()
+			return err
+		}
+		tagged[id] = tagsJSON
+	}
+	rows.Close()
+	if len(tagged) == 0 {
+		return rows.Err()
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for id, tagsJSON := range tagged {
+		if err := indexNoteTagsJSON(ctx, tx, id, tagsJSON); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetNoteTags changes the tags of a note without touching its content.
+// Read-only notes are refused.
+func (db *DB) SetNoteTags(ctx context.Context, id int64, tags []string) error {
+	tags = normalizeTags(tags)
+	tagsJSON, err := json.Marshal(tags)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tags: %w", err)
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkWritable(ctx, tx, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE notes SET tags = ?, updated_at = ?, sync_status = 'pending' WHERE id = ?
+	`, string(tagsJSON), time.Now(), id); err != nil {
+		return fmt.Errorf("failed to update tags: %w", err)
+	}
+	if err := indexNoteTags(ctx, tx, id, tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListTags returns every tag in use, including the parents of nested tags,
+// sorted by name. Counts include the notes tagged with child tags.
+func (db *DB) ListTags(ctx context.Context) ([]TagCount, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT t.name, nt.note_id
+		FROM tags t
+		JOIN note_tags nt ON nt.tag_id = t.id
+		JOIN notes n ON n.id = nt.note_id
+		WHERE n.deleted = 0 OR n.deleted IS NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	defer rows.Close()
+
+	notes := make(map[string]map[int64]bool)
+	for rows.Next() {
+		var name string
+		var noteID int64
+		if err := rows.Scan(&name, &noteID); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		countTag(notes, name, noteID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tagCounts(notes), nil
+}
+
+// countTag counts a note for a tag and each of its parents.
+func countTag(notes map[string]map[int64]bool, name string, noteID int64) {
+	parts := strings.Split(name, "/")
+	for i := range parts {
+		path := strings.Join(parts[:i+1], "/")
+		if notes[path] == nil {
+			notes[path] = make(map[int64]bool)
+		}
+		notes[path][noteID] = true
+	}
+}
+
+// tagCounts returns the tags counted by countTag, sorted by name.
+func tagCounts(notes map[string]map[int64]bool) []TagCount {
+	tags := make([]TagCount, 0, len(notes))
+	for name, ids := range notes {
+		tags = append(tags, TagCount{Name: name, Count: len(ids)})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags
+}
+
+// RenameTag renames a tag and its children on every note, e.g. renaming
+// "work" also turns "work/acme" into "job/acme". Renaming onto an existing
+// tag merges the two. Changed notes are marked for sync; read-only notes keep
+// their tags. It returns the number of notes changed.
+func (db *DB) RenameTag(ctx context.Context, oldName, newName string) (int, error) {
+	return db.MergeTags(ctx, []string{oldName}, newName)
+}
+
+// MergeTags renames every tag in names, and their children, to into.
+func (db *DB) MergeTags(ctx context.Context, names []string, into string) (int, error) {
+	from, rename, err := tagRenamer(names, into)
+	if err != nil || len(from) == 0 {
+		return 0, err
+	}
+
+	// The notes are read and rewritten in one transaction, so a tag change
+	// saved in between is not overwritten
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Find the notes carrying one of the tags
+	var conditions []string
+	var args []interface{}
+	for _, name := range from {
+		conditions = append(conditions, `t.name = ? OR t.name LIKE ? ESCAPE '\'`)
+		args = append(args, name, escapeLike(name)+"/%")
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT n.id, n.tags
+		FROM notes n
+		JOIN note_tags nt ON nt.note_id = n.id
+		JOIN tags t ON t.id = nt.tag_id
+		WHERE COALESCE(n.read_only, 0) = 0 AND (n.deleted = 0 OR n.deleted IS NULL)
+		  AND (`+strings.Join(conditions, " OR ")+`)`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find tagged notes: %w", err)
+	}
+	affected := make(map[int64][]string)
+	for rows.Next() {
+		var id int64
+		var tagsJSON sql.NullString
+		if err := rows.Scan(&id, &tagsJSON); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		var tags []string
+		if tagsJSON.Valid && tagsJSON.String != "" {
+			json.Unmarshal([]byte(tagsJSON.String), &tags)
+		}
+		affected[id] = tags
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	for id, tags := range affected {
+		for i, tag := range tags {
+			tags[i], _ = rename(NormalizeTag(tag))
+		}
+		tags = normalizeTags(tags)
+		tagsJSON, _ := json.Marshal(tags)
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE notes SET tags = ?, updated_at = ?, sync_status = 'pending' WHERE id = ?
+		`, string(tagsJSON), now, id); err != nil {
+			return 0, fmt.Errorf("failed to update tags: %w", err)
+		}
+		if err := indexNoteTags(ctx, tx, id, tags); err != nil {
+			return 0, err
+		}
+	}
+
+	// Drop tags no note uses anymore
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM note_tags)`); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(affected), nil
+}
+
+// tagRenamer normalizes the tags to merge into into, and returns them with
+// the function that renames a tag or one of their children. Merging a tag
+// into itself or into one of its children is an error.
+func tagRenamer(names []string, into string) ([]string, func(string) (string, bool), error) {
+	into = NormalizeTag(into)
+	if into == "" {
+		return nil, nil, fmt.Errorf("tag name cannot be empty")
+	}
+
+	var from []string
+	for _, name := range names {
+		name = NormalizeTag(name)
+		if name == "" {
+			continue
+		}
+		if name == into || strings.HasPrefix(into, name+"/") {
+			return nil, nil, fmt.Errorf("cannot move tag %q into itself", name)
+		}
+		from = append(from, name)
+	}
+
+	rename := func(tag string) (string, bool) {
+		for _, name := range from {
+			if tag == name {
+				return into, true
+			}
+			if strings.HasPrefix(tag, name+"/") {
+				return into + tag[len(name):], true
+			}
+		}
+		return tag, false
+	}
+	return from, rename, nil
+}
+
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `%`, `\%`)
+	return strings.ReplaceAll(s, `_`, `\_`)
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// tagsOf returns the stored tags of a note.
+func tagsOf(t *testing.T, database *DB, id int64) []string {
+	t.Helper()
+	n, err := database.GetNote(context.Background(), id)
+	if err != nil || n == nil {
+		t.Fatalf("note %d: %v", id, err)
+	}
+	return n.Tags
+}
+
+// indexedTags returns the names in the tag index, sorted.
+func indexedTags(t *testing.T, database *DB) []string {
+	t.Helper()
+	rows, err := database.conn.Query(`SELECT name FROM tags ORDER BY name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestRenameTagRewritesChildren(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	parent, _ := database.CreateNoteInFolder(ctx, "Piano", "", []string{"work", "casa"}, 0)
+	child, _ := database.CreateNoteInFolder(ctx, "Acme", "", []string{"#work/acme/"}, 0)
+	other, _ := database.CreateNoteInFolder(ctx, "Palestra", "", []string{"workout"}, 0)
+
+	changed, err := database.RenameTag(ctx, "work", "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 2 {
+		t.Fatalf("%d notes changed, want 2", changed)
+	}
+	if got := tagsOf(t, database, parent.ID); !reflect.DeepEqual(got, []string{"job", "casa"}) {
+		t.Fatalf("tags of the parent note %q", got)
+	}
+	if got := tagsOf(t, database, child.ID); !reflect.DeepEqual(got, []string{"job/acme"}) {
+		t.Fatalf("tags of the child note %q", got)
+	}
+	if got := tagsOf(t, database, other.ID); !reflect.DeepEqual(got, []string{"workout"}) {
+		t.Fatalf("tags of a note with a similar tag %q", got)
+	}
+
+	// The old tags are no longer used, so they leave the index
+	if got := indexedTags(t, database); !reflect.DeepEqual(got, []string{"casa", "job", "job/acme", "workout"}) {
+		t.Fatalf("indexed tags %q", got)
+	}
+	tags, _ := database.ListTags(ctx)
+	want := []TagCount{{"casa", 1}, {"job", 2}, {"job/acme", 1}, {"workout", 1}}
+	if !reflect.DeepEqual(tags, want) {
+		t.Fatalf("tags %+v, want %+v", tags, want)
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	both, _ := database.CreateNoteInFolder(ctx, "Idee", "", []string{"idee", "spunti/web", "libri"}, 0)
+	one, _ := database.CreateNoteInFolder(ctx, "Link", "", []string{"spunti"}, 0)
+
+	changed, err := database.MergeTags(ctx, []string{"idee", "spunti"}, "note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 2 {
+		t.Fatalf("%d notes changed, want 2", changed)
+	}
+	if got := tagsOf(t, database, both.ID); !reflect.DeepEqual(got, []string{"note", "note/web", "libri"}) {
+		t.Fatalf("tags after the merge %q", got)
+	}
+	if got := tagsOf(t, database, one.ID); !reflect.DeepEqual(got, []string{"note"}) {
+		t.Fatalf("tags after the merge %q", got)
+	}
+
+	// Merging onto a tag the note already has leaves it once
+	if _, err := database.RenameTag(ctx, "libri", "note"); err != nil {
+		t.Fatal(err)
+	}
+	if got := tagsOf(t, database, both.ID); !reflect.DeepEqual(got, []string{"note", "note/web"}) {
+		t.Fatalf("tags after merging onto an existing tag %q", got)
+	}
+}
+
+func TestMergeTagIntoItself(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	note, _ := database.CreateNoteInFolder(ctx, "Piano", "", []string{"work"}, 0)
+
+	for _, into := range []string{"work", "#work/", "work/acme"} {
+		if _, err := database.RenameTag(ctx, "work", into); err == nil {
+			t.Fatalf("renaming work to %q succeeded", into)
+		}
+	}
+	if _, err := database.RenameTag(ctx, "work", ""); err == nil {
+		t.Fatal("renaming work to an empty tag succeeded")
+	}
+	if got := tagsOf(t, database, note.ID); !reflect.DeepEqual(got, []string{"work"}) {
+		t.Fatalf("tags after refused renames %q", got)
+	}
+}
+
+func TestRenameTagMatchesLiterally(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	// _ and % are LIKE wildcards: they must not match other tags
+	database.CreateNoteInFolder(ctx, "Sconti", "", []string{"50%/estate"}, 0)
+	database.CreateNoteInFolder(ctx, "Prezzi", "", []string{"500/estate", "a_b/c"}, 0)
+	database.CreateNoteInFolder(ctx, "Altro", "", []string{"axb/c"}, 0)
+
+	if changed, _ := database.RenameTag(ctx, "50%", "saldi"); changed != 1 {
+		t.Fatalf("%d notes changed renaming 50%%, want 1", changed)
+	}
+	if changed, _ := database.RenameTag(ctx, "a_b", "ab"); changed != 1 {
+		t.Fatalf("%d notes changed renaming a_b, want 1", changed)
+	}
+	if got := indexedTags(t, database); !reflect.DeepEqual(got, []string{"500/estate", "ab/c", "axb/c", "saldi/estate"}) {
+		t.Fatalf("indexed tags %q", got)
+	}
+
+	if got := escapeLike(`100%_a\b`); got != `100\%\_a\\b` {
+		t.Fatalf("escapeLike = %q", got)
+	}
+}
+
+func TestRenameTagSkipsLockedAndDeletedNotes(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+
+	locked, _ := database.CreateNoteInFolder(ctx, "Verbale", "", []string{"work"}, 0)
+	deleted, _ := database.CreateNoteInFolder(ctx, "Vecchia", "", []string{"work"}, 0)
+	open, _ := database.CreateNoteInFolder(ctx, "Piano", "", []string{"work"}, 0)
+	database.SetNoteReadOnly(ctx, locked.ID, true)
+	database.DeleteNote(ctx, deleted.ID)
+
+	if changed, err := database.RenameTag(ctx, "work", "job"); err != nil || changed != 1 {
+		t.Fatalf("%d notes changed, %v; want 1", changed, err)
+	}
+	for _, id := range []int64{locked.ID, deleted.ID} {
+		if got := tagsOf(t, database, id); !reflect.DeepEqual(got, []string{"work"}) {
+			t.Fatalf("tags of note %d changed to %q", id, got)
+		}
+	}
+	if got := tagsOf(t, database, open.ID); !reflect.DeepEqual(got, []string{"job"}) {
+		t.Fatalf("tags of the open note %q", got)
+	}
+}
+
+func TestSetNoteTagsRefusesLockedNote(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	note, _ := database.CreateNoteInFolder(ctx, "Verbale", "", []string{"work"}, 0)
+	database.SetNoteReadOnly(ctx, note.ID, true)
+
+	if err := database.SetNoteTags(ctx, note.ID, []string{"job"}); !errors.Is(err, ErrNoteReadOnly) {
+		t.Fatalf("SetNoteTags on a locked note: %v", err)
+	}
+	if got := tagsOf(t, database, note.ID); !reflect.DeepEqual(got, []string{"work"}) {
+		t.Fatalf("tags of the locked note %q", got)
+	}
+}
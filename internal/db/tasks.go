@@ -0,0 +1,339 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tasks are the checkbox lines of every note. The index is built from the
+// decrypted content when it is asked for, so nothing about tasks is stored
+// besides the notes themselves. Notes behind a password, or in a protected
+// folder, are left out.
+
+// ErrTaskChanged means the note no longer has the task at that line, e.g. it
+// was edited since the task list was loaded.
+var ErrTaskChanged = errors.New("task changed in the note")
+
+// Task is a checklist item together with the note it belongs to. A due date
+// is written in the item as "due:2024-05-01" or "📅 2024-05-01"; otherwise a
+// pending reminder on the item gives it one.
+type Task struct {
+	ChecklistItem
+	NoteID    int64     `json:"note_id"`
+	NoteTitle string    `json:"note_title"`
+	FolderID  int64     `json:"folder_id"`
+	Folder    string    `json:"folder"` // Percorso della cartella, es. Work/Meetings
+	Tags      []string  `json:"tags"`
+	Due       time.Time `json:"due,omitempty"` // Zero = nessuna scadenza
+}
+
+// TaskStatus filters tasks by completion.
+type TaskStatus int
+
+const (
+	TaskOpen TaskStatus = iota
+	TaskDone
+	TaskAll
+)
+
+// TaskDue filters tasks by due date.
+type TaskDue int
+
+const (
+	DueAny TaskDue = iota
+	DueOverdue
+	DueToday
+	DueWeek
+	DueNone
+)
+
+// TaskFilter selects tasks. Tag also matches its children, Folder (0 = all)
+// also matches its subfolders.
+type TaskFilter struct {
+	Tag    string
+	Folder int64
+	Status TaskStatus
+	Due    TaskDue
+}
+
+var taskDuePattern = regexp.MustCompile(`(?:\bdue:|📅\s*)(\d{4}-\d{2}-\d{2})`)
+
+// taskDue returns the due date written in a task, or the zero time.
+func taskDue(text string, loc *time.Location) time.Time {
+	m := taskDuePattern.FindStringSubmatch(text)
+	if m == nil {
+		return time.Time{}
+	}
+	due, err := time.ParseInLocation("2006-01-02", m[1], loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return due
+}
+
+// matches reports whether a task passes the status and due filters. Tasks
+// due on a day count as due at the end of it.
+func (f TaskFilter) matches(task Task, now time.Time) bool {
+	switch f.Status {
+	case TaskOpen:
+		if task.Done {
+			return false
+		}
+	case TaskDone:
+		if !task.Done {
+			return false
+		}
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch f.Due {
+	case DueOverdue:
+		return !task.Due.IsZero() && task.Due.Before(today)
+	case DueToday:
+		return !task.Due.IsZero() && task.Due.Before(today.AddDate(0, 0, 1))
+	case DueWeek:
+		return !task.Due.IsZero() && task.Due.Before(today.AddDate(0, 0, 7))
+	case DueNone:
+		return task.Due.IsZero()
+	}
+	return true
+}
+
+type taskFolder struct {
+	title  string
+	parent int64
+	locked bool
+}
+
+// folderTree loads every live folder, to build paths and find protected
+// ancestors without a query per note.
+func (db *DB) folderTree(ctx context.Context) (map[int64]taskFolder, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, title, COALESCE(parent_folder_id, 0), COALESCE(password, '')
+		FROM folders WHERE deleted = 0 OR deleted IS NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folders: %w", err)
+	}
+	defer rows.Close()
+
+	folders := make(map[int64]taskFolder)
+	for rows.Next() {
+		var id int64
+		var f taskFolder
+		var password string
+		if err := rows.Scan(&id, &f.title, &f.parent, &password); err != nil {
+			return nil, fmt.Errorf("failed to scan folder: %w", err)
+		}
+		f.locked = password != ""
+		folders[id] = f
+	}
+	return folders, rows.Err()
+}
+
+// folderPath returns the path of a folder, whether it or an ancestor is
+// protected, and whether it is under (or is) ancestor.
+func folderPath(folders map[int64]taskFolder, id, ancestor int64) (path string, locked, under bool) {
+	var names []string
+	under = ancestor == 0
+	// The depth limit guards against cycles in a damaged tree
+	for depth := 0; id != 0 && depth < 64; depth++ {
+		f, ok := folders[id]
+		if !ok {
+			break
+		}
+		if id == ancestor {
+			under = true
+		}
+		locked = locked || f.locked
+		names = append([]string{f.title}, names...)
+		id = f.parent
+	}
+	return strings.Join(names, "/"), locked, under
+}
+
+// ListTasks returns the tasks matching filter, open ones by due date first,
+// then by note and line.
+func (db *DB) ListTasks(ctx context.Context, filter TaskFilter, now time.Time) ([]Task, error) {
+	folders, err := db.folderTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Item reminders give a due time to tasks without an explicit one
+	reminders, err := db.ListReminders(ctx, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	reminded := itemDueTimes(reminders)
+
+	query := `
+		SELECT id, title, content, COALESCE(tags, '[]'), COALESCE(parent_folder_id, 0)
+		FROM notes
+		WHERE (deleted = 0 OR deleted IS NULL) AND (password IS NULL OR password = '')
+		  AND COALESCE(archived, 0) = 0`
+	var args []interface{}
+	if tag := NormalizeTag(filter.Tag); tag != "" {
+		query += ` AND id IN (
+			SELECT nt.note_id FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+			WHERE t.name = ? OR t.name LIKE ? ESCAPE '\'
+		)`
+		args = append(args, tag, escapeLike(tag)+"/%")
+	}
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []Task
+	for rows.Next() {
+		var noteID, folderID int64
+		var title, content, tagsJSON string
+		if err := rows.Scan(&noteID, &title, &content, &tagsJSON, &folderID); err != nil {
+			return nil, fmt.Errorf("failed to scan note: %w", err)
+		}
+		path, locked, under := folderPath(folders, folderID, filter.Folder)
+		if locked || !under {
+			continue
+		}
+		plaintext, err := db.open(content)
+		if err != nil {
+			continue
+		}
+		var tags []string
+		json.Unmarshal([]byte(tagsJSON), &tags)
+
+		note := Task{NoteID: noteID, NoteTitle: title, FolderID: folderID, Folder: path, Tags: tags}
+		tasks = appendTasks(tasks, note, plaintext, reminded[noteID], filter, now)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortTasks(tasks)
+	return tasks, nil
+}
+
+// itemDueTimes returns the earliest due time of the item reminders, by note
+// and item text.
+func itemDueTimes(reminders []Reminder) map[int64]map[string]time.Time {
+	reminded := make(map[int64]map[string]time.Time)
+	for _, r := range reminders {
+		if r.Item == "" {
+			continue
+		}
+		if reminded[r.NoteID] == nil {
+			reminded[r.NoteID] = make(map[string]time.Time)
+		}
+		if due, ok := reminded[r.NoteID][r.Item]; !ok || r.Due.Before(due) {
+			reminded[r.NoteID][r.Item] = r.Due
+		}
+	}
+	return reminded
+}
+
+// appendTasks appends the checklist items of a note that match filter. note
+// carries the fields of the note shared by its tasks.
+func appendTasks(tasks []Task, note Task, plaintext string, reminded map[string]time.Time, filter TaskFilter, now time.Time) []Task {
+	for _, item := range ParseChecklist(plaintext) {
+		task := note
+		task.ChecklistItem = item
+		task.Due = taskDue(item.Text, now.Location())
+		if task.Due.IsZero() {
+			task.Due = reminded[item.Text]
+		}
+		if filter.matches(task, now) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// sortTasks puts open tasks first, by due date, then by note and line.
+func sortTasks(tasks []Task) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i], tasks[j]
+		if a.Done != b.Done {
+			return !a.Done
+		}
+		if a.Due.IsZero() != b.Due.IsZero() {
+			return !a.Due.IsZero()
+		}
+		if !a.Due.Equal(b.Due) {
+			return a.Due.Before(b.Due)
+		}
+		if a.NoteTitle != b.NoteTitle {
+			return strings.ToLower(a.NoteTitle) < strings.ToLower(b.NoteTitle)
+		}
+		return a.Line < b.Line
+	})
+}
+
+// ToggleTask ticks or unticks the checkbox of a task in its note and saves a
+// version of the note. The line must still hold the same item, otherwise
+// ErrTaskChanged is returned. It returns the new state of the checkbox.
+func (db *DB) ToggleTask(ctx context.Context, noteID int64, line int, text string) (bool, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	note, err := getNote(ctx, tx, noteID)
+	if err != nil {
+		return false, err
+	}
+	if note == nil || note.Deleted {
+		return false, fmt.Errorf("note %d not found", noteID)
+	}
+	if note.ReadOnly {
+		return false, ErrNoteReadOnly
+	}
+	plaintext, err := db.open(note.Content)
+	if err != nil {
+		return false, err
+	}
+
+	plaintext, done, err := toggleChecklistLine(plaintext, line, text)
+	if err != nil {
+		return false, err
+	}
+
+	if err := db.saveNoteVersion(ctx, tx, noteID, note.Title, plaintext, note.Tags); err != nil {
+		return false, err
+	}
+	sealed, err := db.seal(plaintext)
+	if err != nil {
+		return false, err
+	}
+	if err := db.updateNote(ctx, tx, noteID, note.Title, sealed, note.Tags); err != nil {
+		return false, err
+	}
+	return done, tx.Commit()
+}
+
+// toggleChecklistLine ticks or unticks the checkbox at line, which must still
+// hold text. It returns the new content and the new state of the checkbox.
+func toggleChecklistLine(content string, line int, text string) (string, bool, error) {
+	lines := strings.Split(content, "\n")
+	if line < 0 || line >= len(lines) {
+		return "", false, ErrTaskChanged
+	}
+	m := checklistPattern.FindStringSubmatch(strings.TrimRight(lines[line], "\r"))
+	if m == nil || strings.TrimSpace(m[4]) != text {
+		return "", false, ErrTaskChanged
+	}
+	done := m[2] == " "
+	mark := " "
+	if done {
+		mark = "x"
+	}
+	lines[line] = m[1] + mark + m[3] + m[4] + strings.TrimPrefix(lines[line], m[0])
+	return strings.Join(lines, "\n"), done, nil
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestToggleTask(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	note, err := database.CreateNoteInFolder(ctx, "Spesa", "Lista\r\n- [ ] pane\r\n  * [X] latte con  spazi\r\n", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if done, err := database.ToggleTask(ctx, note.ID, 1, "pane"); err != nil || !done {
+		t.Fatalf("ToggleTask = %v, %v", done, err)
+	}
+	if done, err := database.ToggleTask(ctx, note.ID, 2, "latte con  spazi"); err != nil || done {
+		t.Fatalf("ToggleTask = %v, %v", done, err)
+	}
+	want := "Lista\r\n- [x] pane\r\n  * [ ] latte con  spazi\r\n"
+	got, _ := database.GetNote(ctx, note.ID)
+	if got.Content != want {
+		t.Fatalf("content after toggling %q, want %q", got.Content, want)
+	}
+
+	versions, err := database.GetNoteVersions(ctx, note.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Content != want {
+		t.Fatalf("%d versions after two toggles, latest %q", len(versions), versions[0].Content)
+	}
+
+	// The task list was loaded before the note was edited
+	for _, c := range []struct {
+		line int
+		text string
+	}{{1, "burro"}, {0, "Lista"}, {5, "pane"}} {
+		if _, err := database.ToggleTask(ctx, note.ID, c.line, c.text); !errors.Is(err, ErrTaskChanged) {
+			t.Errorf("toggling %q at line %d: %v, want ErrTaskChanged", c.text, c.line, err)
+		}
+	}
+
+	if err := database.SetNoteReadOnly(ctx, note.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.ToggleTask(ctx, note.ID, 1, "pane"); !errors.Is(err, ErrNoteReadOnly) {
+		t.Fatalf("toggling in a read-only note: %v, want ErrNoteReadOnly", err)
+	}
+	if got, _ := database.GetNote(ctx, note.ID); got.Content != want {
+		t.Fatal("read-only note changed")
+	}
+}
@@ -0,0 +1,268 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Templates are ordinary notes kept in a templates folder (see
+// DefaultTemplatesFolder), so they are edited, versioned and synced like any
+// other note. The note title is the template name. An optional header
+// between "---" lines sets the defaults of the notes created from it:
+//
+//	---
+//	title: Meeting {{date}}
+//	tags: work, meeting
+//	folder: Work/Meetings
+//	---
+//	# {{prompt:Client name}}
+//
+// Title, body and folder may use the variables {{date}}, {{time}},
+// {{datetime}}, {{weekday}}, {{title}}, {{folder}} and {{prompt:Label}},
+// which asks the user for a value.
+
+const DefaultTemplatesFolder = "Templates"
+
+var ErrFolderNotFound = errors.New("folder not found")
+
+var templateVarPattern = regexp.MustCompile(`\{\{\s*([a-z]+)(?::([^}]*))?\s*\}\}`)
+
+type Template struct {
+	NoteID int64    `json:"note_id"`
+	Name   string   `json:"name"`
+	Title  string   `json:"title,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Folder string   `json:"folder,omitempty"`
+	Body   string   `json:"body"`
+}
+
+// TemplateVars holds the values substituted into a template.
+type TemplateVars struct {
+	Now     time.Time
+	Title   string
+	Folder  string            // Nome della cartella in cui ci si trova
+	Prompts map[string]string // Risposte ai {{prompt:...}}, per etichetta
+}
+
+// ParseTemplate splits the header of a template from its body.
+func ParseTemplate(name, content string) Template {
+	t := Template{Name: name, Body: content}
+
+	lines := strings.Split(content, "\n")
+	if len(lines) < 2 || strings.TrimSpace(lines[0]) != "---" {
+		return t
+	}
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "---" {
+			t.Body = strings.TrimPrefix(strings.Join(lines[i+1:], "\n"), "\n")
+			return t
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "title":
+			t.Title = value
+		case "folder":
+			t.Folder = strings.Trim(value, "/")
+		case "tags":
+			for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == ';' }) {
+				t.Tags = append(t.Tags, strings.TrimPrefix(tag, "#"))
+			}
+		}
+	}
+
+	// No closing line: it was not a header after all
+	t.Title, t.Tags, t.Folder = "", nil, ""
+	return t
+}
+
+// Prompts returns the labels of the {{prompt:...}} variables, in order of
+// first appearance.
+func (t Template) Prompts() []string {
+	var labels []string
+	seen := make(map[string]bool)
+	for _, text := range []string{t.Title, t.Folder, t.Body} {
+		for _, m := range templateVarPattern.FindAllStringSubmatch(text, -1) {
+			label := strings.TrimSpace(m[2])
+			if m[1] == "prompt" && label != "" && !seen[label] {
+				seen[label] = true
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels
+}
+
+// ExpandTemplate replaces the variables in text. Unknown variables are left
+// as they are.
+func ExpandTemplate(text string, vars TemplateVars) string {
+	now := vars.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return templateVarPattern.ReplaceAllStringFunc(text, func(match string) string {
+		m := templateVarPattern.FindStringSubmatch(match)
+		switch m[1] {
+		case "date":
+			return now.Format("2006-01-02")
+		case "time":
+			return now.Format("15:04")
+		case "datetime":
+			return now.Format("2006-01-02 15:04")
+		case "weekday":
+			return now.Weekday().String()
+		case "title":
+			return vars.Title
+		case "folder":
+			return vars.Folder
+		case "prompt":
+			if value, ok := vars.Prompts[strings.TrimSpace(m[2])]; ok {
+				return value
+			}
+		}
+		return match
+	})
+}
+
+// FolderByPath returns the ID of the folder at a "/"-separated path of folder
+// titles from the root; "" is the root itself. With create, missing folders
+// are created, otherwise ErrFolderNotFound is returned.
+func (db *DB) FolderByPath(ctx context.Context, path string, create bool) (int64, error) {
+	return folderByPath(ctx, db, path, create)
+}
+
+func folderByPath(ctx context.Context, folders FolderStore, path string, create bool) (int64, error) {
+	var id int64
+	for _, name := range strings.Split(path, "/") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		children, err := folders.ListFolders(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		next := int64(0)
+		for _, f := range children {
+			if strings.EqualFold(f.Title, name) {
+				next = f.ID
+				break
+			}
+		}
+		if next == 0 {
+			if !create {
+				return 0, fmt.Errorf("%w: %s", ErrFolderNotFound, path)
+			}
+			if next, err = folders.CreateFolder(ctx, name, id); err != nil {
+				return 0, err
+			}
+		}
+		id = next
+	}
+	return id, nil
+}
+
+// ListTemplates returns the templates in the given folder, by name. A missing
+// folder means no templates.
+func (db *DB) ListTemplates(ctx context.Context, folder string) ([]Template, error) {
+	if folder == "" {
+		folder = DefaultTemplatesFolder
+	}
+	folderID, err := db.FolderByPath(ctx, folder, false)
+	if errors.Is(err, ErrFolderNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, title, content FROM notes
+		WHERE parent_folder_id = ? AND (deleted = 0 OR deleted IS NULL)
+		ORDER BY title COLLATE NOCASE
+	`, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []Template
+	for rows.Next() {
+		var id int64
+		var name, stored string
+		if err := rows.Scan(&id, &name, &stored); err != nil {
+			return nil, fmt.Errorf("failed to scan template: %w", err)
+		}
+		content, err := db.open(stored)
+		if err != nil {
+			// Encrypted with another key: not usable as a template
+			continue
+		}
+		t := ParseTemplate(name, content)
+		t.NoteID = id
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+// GetTemplate finds a template by name, ignoring case.
+func (db *DB) GetTemplate(ctx context.Context, folder, name string) (*Template, error) {
+	return getTemplate(ctx, db, folder, name)
+}
+
+func getTemplate(ctx context.Context, s TemplateStore, folder, name string) (*Template, error) {
+	templates, err := s.ListTemplates(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+	for i := range templates {
+		if strings.EqualFold(templates[i].Name, name) {
+			return &templates[i], nil
+		}
+	}
+	return nil, fmt.Errorf("template %q not found", name)
+}
+
+// CreateNoteFromTemplate creates a note from a template. An empty title uses
+// the template's title. The note goes in the template's folder if it sets
+// one (created if missing), in folderID otherwise.
+func (db *DB) CreateNoteFromTemplate(ctx context.Context, t *Template, title string, folderID int64, vars TemplateVars) (*Note, error) {
+	title, folderID, body, err := t.expand(ctx, db, title, folderID, vars)
+	if err != nil {
+		return nil, err
+	}
+	content, err := db.seal(body)
+	if err != nil {
+		return nil, err
+	}
+	return db.CreateNoteInFolder(ctx, title, content, t.Tags, folderID)
+}
+
+// expand returns the title, folder and body of a note created from the
+// template, creating the template's folder if missing.
+func (t *Template) expand(ctx context.Context, folders FolderStore, title string, folderID int64, vars TemplateVars) (string, int64, string, error) {
+	if title == "" {
+		title = strings.TrimSpace(ExpandTemplate(t.Title, vars))
+	}
+	if title == "" {
+		return "", 0, "", fmt.Errorf("note title required")
+	}
+	vars.Title = title
+
+	if t.Folder != "" {
+		id, err := folderByPath(ctx, folders, ExpandTemplate(t.Folder, vars), true)
+		if err != nil {
+			return "", 0, "", err
+		}
+		folderID = id
+	}
+	return title, folderID, ExpandTemplate(t.Body, vars), nil
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		name, content string
+		want          Template
+	}{
+		{
+			name:    "without header",
+			content: "# {{title}}\n\ntesto",
+			want:    Template{Body: "# {{title}}\n\ntesto"},
+		},
+		{
+			name:    "header",
+			content: "---\ntitle: Riunione {{date}}\nTags: #lavoro, riunioni;clienti\nfolder: /Lavoro/Riunioni/\naltro: ignorato\n---\n\n# {{prompt:Cliente}}",
+			want: Template{
+				Title:  "Riunione {{date}}",
+				Tags:   []string{"lavoro", "riunioni", "clienti"},
+				Folder: "Lavoro/Riunioni",
+				Body:   "# {{prompt:Cliente}}",
+			},
+		},
+		{
+			name:    "empty header",
+			content: "---\n---\ncorpo",
+			want:    Template{Body: "corpo"},
+		},
+		{
+			// Without the closing line the dashes are a horizontal rule and
+			// the lines after them are body
+			name:    "unclosed header",
+			content: "---\ntitle: Riunione\ntags: lavoro\nfolder: Lavoro\ncorpo",
+			want:    Template{Body: "---\ntitle: Riunione\ntags: lavoro\nfolder: Lavoro\ncorpo"},
+		},
+		{
+			name:    "only dashes",
+			content: "---",
+			want:    Template{Body: "---"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.want.Name = "Modello"
+			if got := ParseTemplate("Modello", tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplatePrompts(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl Template
+		want []string
+	}{
+		{"none", Template{Body: "{{date}} {{title}}"}, nil},
+		{
+			"in order, once",
+			Template{
+				Title:  "{{prompt:Cliente}} {{date}}",
+				Folder: "Clienti/{{ prompt:Cliente }}",
+				Body:   "{{prompt:Progetto}} per {{prompt:Cliente}}",
+			},
+			[]string{"Cliente", "Progetto"},
+		},
+		{"empty label", Template{Body: "{{prompt:}} {{prompt: }}"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tmpl.Prompts(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("prompts %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	vars := TemplateVars{
+		Now:     time.Date(2024, 5, 3, 9, 5, 0, 0, time.UTC),
+		Title:   "Acme",
+		Folder:  "Clienti",
+		Prompts: map[string]string{"Cliente": "Acme Srl"},
+	}
+	tests := []struct{ text, want string }{
+		{"{{date}}", "2024-05-03"},
+		{"{{time}}", "09:05"},
+		{"{{datetime}}", "2024-05-03 09:05"},
+		{"{{weekday}}", "Friday"},
+		{"# {{title}} in {{folder}}", "# Acme in Clienti"},
+		{"{{prompt:Cliente}} / {{ prompt: Cliente }}", "Acme Srl / Acme Srl"},
+		{"{{prompt:Progetto}}", "{{prompt:Progetto}}"},
+		{"{{sconosciuta}} {{Date}}", "{{sconosciuta}} {{Date}}"},
+		{"{ {date} }", "{ {date} }"},
+	}
+	for _, tt := range tests {
+		if got := ExpandTemplate(tt.text, vars); got != tt.want {
+			t.Errorf("ExpandTemplate(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCreateNoteFromTemplate(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	vars := TemplateVars{
+		Now:     time.Date(2024, 5, 3, 9, 5, 0, 0, time.UTC),
+		Prompts: map[string]string{"Cliente": "Acme"},
+	}
+	meeting := ParseTemplate("Riunione", "---\ntitle: Riunione {{date}}\ntags: lavoro\nfolder: Clienti/{{prompt:Cliente}}\n---\n# {{title}}")
+
+	note, err := database.CreateNoteFromTemplate(ctx, &meeting, "", 0, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.Title != "Riunione 2024-05-03" || !reflect.DeepEqual(note.Tags, []string{"lavoro"}) {
+		t.Fatalf("note %+v", note)
+	}
+	saved, _ := database.GetNote(ctx, note.ID)
+	if saved.Content != "# Riunione 2024-05-03" {
+		t.Fatalf("content %q", saved.Content)
+	}
+
+	// The folder path was created, and is reused the next time
+	folderID, err := database.FolderByPath(ctx, "clienti/ACME", false)
+	if err != nil || folderID == 0 || note.ParentFolder != folderID {
+		t.Fatalf("note in folder %d, path resolves to %d (%v)", note.ParentFolder, folderID, err)
+	}
+	again, err := database.CreateNoteFromTemplate(ctx, &meeting, "Seconda riunione", 0, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ParentFolder != folderID {
+		t.Fatalf("second note in folder %d, want %d", again.ParentFolder, folderID)
+	}
+	if roots, _ := database.ListFolders(ctx, 0); len(roots) != 1 {
+		t.Fatalf("%d root folders, want 1", len(roots))
+	}
+
+	// Without a folder in the template the note goes where the user is
+	plain := ParseTemplate("Vuoto", "testo")
+	note, err = database.CreateNoteFromTemplate(ctx, &plain, "Appunti", folderID, vars)
+	if err != nil || note.ParentFolder != folderID {
+		t.Fatalf("note %+v, %v", note, err)
+	}
+	if _, err := database.CreateNoteFromTemplate(ctx, &plain, "", 0, vars); err == nil {
+		t.Fatal("note created without a title")
+	}
+}
@@ -0,0 +1,230 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/JustZacca/jotaku/internal/diff"
+)
+
+// Version history is stored as encrypted full snapshots, each followed by
+// up to snapshotInterval-1 encrypted line deltas against that snapshot.
+const (
+	versionSnapshot  = "snapshot"
+	versionDelta     = "delta"
+	snapshotInterval = 20
+)
+
+var ErrWrongKey = errors.New("encryption key does not match existing notes")
+
+// storedVersion is the on-disk form of a version's content.
+type storedVersion struct {
+	payload string
+	kind    sql.NullString
+	baseID  sql.NullInt64
+}
+
+// chooseEncoding returns the kind and plaintext payload for a new version.
+// base is the plaintext of the latest snapshot and since the number of deltas
+// already stored against it. Content too far from base is stored as a
+// snapshot.
+func chooseEncoding(base string, haveBase bool, since int, content string) (string, string) {
+	if !haveBase || since >= snapshotInterval-1 {
+		return versionSnapshot, content
+	}
+	delta, ok := diff.MakeDelta(base, content)
+	if !ok || len(delta) >= len(content) {
+		return versionSnapshot, content
+	}
+	return versionDelta, delta
+}
+
+// encodeVersion prepares the content of a new version of noteID for storage.
+// It reads the latest snapshot through conn, the transaction of the save.
+func (db *DB) encodeVersion(ctx context.Context, conn querier, noteID int64, content string) (string, interface{}, string, error) {
+	var snapID int64
+	var snapPayload string
+	err := conn.QueryRowContext(ctx, `
+		SELECT id, content FROM note_versions
+		WHERE note_id = ? AND kind = 'snapshot'
+		ORDER BY version_num DESC
+		LIMIT 1
+	`, noteID).Scan(&snapID, &snapPayload)
+	if err != nil && err != sql.ErrNoRows {
+		return "", nil, "", err
+	}
+
+	var base string
+	haveBase := false
+	since := 0
+	if err == nil {
+		if base, err = db.open(snapPayload); err == nil {
+			haveBase = true
+			conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM note_versions WHERE base_id = ?`, snapID).Scan(&since)
+		}
+	}
+
+	kind, plain := chooseEncoding(base, haveBase, since, content)
+	payload, err := db.seal(plain)
+	if err != nil {
+		return "", nil, "", err
+	}
+	if kind == versionDelta {
+		return kind, snapID, payload, nil
+	}
+	return kind, nil, payload, nil
+}
+
+// decodeVersion rebuilds the plaintext of a stored version. snapshots caches
+// decrypted snapshots by ID and may be nil.
+func (db *DB) decodeVersion(ctx context.Context, conn querier, sv storedVersion, snapshots map[int64]string) (string, error) {
+	switch sv.kind.String {
+	case versionSnapshot:
+		return db.open(sv.payload)
+
+	case versionDelta:
+		if !sv.baseID.Valid {
+			return "", fmt.Errorf("delta without base snapshot")
+		}
+		base, ok := snapshots[sv.baseID.Int64]
+		if !ok {
+			var basePayload string
+			err := conn.QueryRowContext(ctx, `SELECT content FROM note_versions WHERE id = ?`, sv.baseID.Int64).Scan(&basePayload)
+			if err != nil {
+				return "", fmt.Errorf("failed to load base snapshot: %w", err)
+			}
+			if base, err = db.open(basePayload); err != nil {
+				return "", err
+			}
+			if snapshots != nil {
+				snapshots[sv.baseID.Int64] = base
+			}
+		}
+		delta, err := db.open(sv.payload)
+		if err != nil {
+			return "", err
+		}
+		return diff.ApplyDelta(base, delta)
+
+	default:
+		// Rows written before delta storage hold a full copy
+		return sv.payload, nil
+	}
+}
+
+// cipherMatches reports whether the cipher can decrypt existing note content.
+func (db *DB) cipherMatches(ctx context.Context) (bool, error) {
+	var content string
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT content FROM notes WHERE content != '' LIMIT 1
+	`).Scan(&content)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = db.open(content)
+	return err == nil, nil
+}
+
+// MigrateVersions converts full-copy history rows into encrypted snapshots
+// and deltas. It needs the cipher, so it runs after SetCipher, and refuses to
+// run when the cipher cannot read existing notes.
+func (db *DB) MigrateVersions(ctx context.Context) error {
+	if db.cipher == nil {
+		return nil
+	}
+
+	var legacy int
+	if err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM note_versions WHERE kind IS NULL`).Scan(&legacy); err != nil {
+		return err
+	}
+	if legacy == 0 {
+		return nil
+	}
+
+	ok, err := db.cipherMatches(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWrongKey
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, note_id, content FROM note_versions
+		WHERE kind IS NULL
+		ORDER BY note_id, version_num ASC
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to list versions: %w", err)
+	}
+
+	type legacyRow struct {
+		id, noteID int64
+		content    string
+	}
+	var legacyRows []legacyRow
+	for rows.Next() {
+		var r legacyRow
+		if err := rows.Scan(&r.id, &r.noteID, &r.content); err != nil {
+			rows.Close()
+			return err
+		}
+		// Older versions may hold encrypted content, newer ones plaintext
+		if plain, err := db.open(r.content); err == nil {
+			r.content = plain
+		}
+		legacyRows = append(legacyRows, r)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	rows.Close()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	var noteID, snapID int64
+	var base string
+	since := 0
+	for i, r := range legacyRows {
+		if i == 0 || r.noteID != noteID {
+			noteID = r.noteID
+			snapID = 0
+			since = 0
+		}
+
+		kind, plain := chooseEncoding(base, snapID != 0, since, r.content)
+		payload, err := db.seal(plain)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		var baseID interface{}
+		if kind == versionDelta {
+			baseID = snapID
+			since++
+		} else {
+			snapID = r.id
+			base = r.content
+			since = 0
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE note_versions SET content = ?, kind = ?, base_id = ? WHERE id = ?
+		`, payload, kind, baseID, r.id); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to migrate version: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
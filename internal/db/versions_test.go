@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/JustZacca/jotaku/internal/crypto"
+)
+
+var testSalt = []byte("0123456789abcdef")
+
+// newEncryptedTestDB opens a test vault with a cipher and a note whose
+// content, as the UI does, is encrypted with it.
+func newEncryptedTestDB(t *testing.T, password string) (*DB, *Note) {
+	t.Helper()
+	database := newTestDB(t)
+	enc := crypto.NewEncryptor(password, testSalt)
+	database.SetCipher(enc)
+	content, err := enc.Encrypt("testo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	note, err := database.CreateNoteInFolder(context.Background(), "Nota", content, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return database, note
+}
+
+// versionKinds returns the storage kind of every version of noteID, oldest
+// first.
+func versionKinds(t *testing.T, database *DB, noteID int64) []string {
+	t.Helper()
+	rows, err := database.conn.Query(`SELECT kind FROM note_versions WHERE note_id = ? ORDER BY version_num`, noteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var kinds []string
+	for rows.Next() {
+		var kind string
+		rows.Scan(&kind)
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+func TestVersionsRebuildFromSnapshotsAndDeltas(t *testing.T) {
+	ctx := context.Background()
+	database, note := newEncryptedTestDB(t, "password")
+
+	// Long enough for a delta to be smaller than the content
+	lines := []string{strings.Repeat("intestazione del diario ", 10)}
+	var want []string
+	for i := 0; i < snapshotInterval+5; i++ {
+		lines = append(lines, fmt.Sprintf("riga %d", i))
+		content := strings.Join(lines, "\n")
+		if err := database.SaveNoteVersion(ctx, note.ID, "Nota", content, nil); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, content)
+	}
+	// Rewriting both ends around a long unchanged middle would make a small
+	// delta, but past diff.MaxEdits the version is stored whole
+	block := func(word string) string {
+		var b []string
+		for i := 0; i < 600; i++ {
+			b = append(b, fmt.Sprintf("%s %d", word, i))
+		}
+		return strings.Join(b, "\n")
+	}
+	middle := strings.Repeat(strings.Repeat("x", 100)+"\n", 200)
+	for _, content := range []string{
+		block("prima") + "\n" + middle + block("dopo"),
+		block("inizio") + "\n" + middle + block("fine"),
+	} {
+		if err := database.SaveNoteVersion(ctx, note.ID, "Nota", content, nil); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, content)
+	}
+
+	kinds := versionKinds(t, database, note.ID)
+	if kinds[0] != versionSnapshot || kinds[1] != versionDelta || kinds[snapshotInterval] != versionSnapshot {
+		t.Fatalf("unexpected storage kinds %v", kinds)
+	}
+	if kinds[len(kinds)-1] != versionSnapshot {
+		t.Fatal("rewrite past diff.MaxEdits stored as a delta")
+	}
+
+	versions, err := database.GetNoteVersions(ctx, note.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != len(want) {
+		t.Fatalf("%d versions, want %d", len(versions), len(want))
+	}
+	for _, v := range versions {
+		if v.Content != want[v.VersionNum-1] {
+			t.Errorf("version %d rebuilt as %q", v.VersionNum, v.Content)
+		}
+		single, err := database.GetNoteVersion(ctx, v.ID)
+		if err != nil || single.Content != v.Content {
+			t.Errorf("version %d alone: %v", v.VersionNum, err)
+		}
+	}
+}
+
+func TestMigrateVersions(t *testing.T) {
+	ctx := context.Background()
+	database, note := newEncryptedTestDB(t, "password")
+
+	want := []string{"prima", "prima\nseconda", "prima\nseconda\nterza"}
+	for i, content := range want {
+		// History rows as written before delta storage: full plaintext copies
+		if _, err := database.conn.Exec(`
+			INSERT INTO note_versions (note_id, title, content, tags, version_num) VALUES (?, 'Nota', ?, '[]', ?)
+		`, note.ID, content, i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := database.MigrateVersions(ctx); err != nil {
+		t.Fatal(err)
+	}
+	kinds := versionKinds(t, database, note.ID)
+	if strings.Join(kinds, ",") != "snapshot,delta,delta" {
+		t.Fatalf("migrated kinds %v", kinds)
+	}
+	var payload string
+	database.conn.QueryRow(`SELECT content FROM note_versions WHERE note_id = ? AND version_num = 1`, note.ID).Scan(&payload)
+	if payload == want[0] {
+		t.Fatal("migrated snapshot left in plaintext")
+	}
+
+	versions, err := database.GetNoteVersions(ctx, note.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range versions {
+		if v.Content != want[v.VersionNum-1] {
+			t.Errorf("version %d migrated to %q", v.VersionNum, v.Content)
+		}
+	}
+
+	// A key that cannot read the notes must not touch the history
+	other, stray := newEncryptedTestDB(t, "password")
+	other.conn.Exec(`INSERT INTO note_versions (note_id, title, content, version_num) VALUES (?, 'Nota', 'x', 1)`, stray.ID)
+	other.SetCipher(crypto.NewEncryptor("sbagliata", testSalt))
+	if err := other.MigrateVersions(ctx); err != ErrWrongKey {
+		t.Fatalf("migration with the wrong key: %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+package diff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Edit is one step of the script that turns a into b.
+type Edit struct {
+	Op   Op
+	Text string
+}
+
+// MaxEdits bounds the number of inserted and deleted items Myers' algorithm
+// searches for. Its memory grows with the square of that number, so texts
+// that differ more are diffed as a single replacement instead.
+const MaxEdits = 1000
+
+// Strings returns the shortest edit script turning a into b, using Myers'
+// algorithm. The common prefix and suffix are trimmed first, so small edits
+// to long notes stay cheap. Past MaxEdits changes the part between the
+// common prefix and suffix is deleted and inserted whole.
+func Strings(a, b []string) []Edit {
+	edits, _ := diffStrings(a, b)
+	return edits
+}
+
+// diffStrings is Strings, also reporting whether the script is the shortest
+// one or the replacement used past MaxEdits.
+func diffStrings(a, b []string) ([]Edit, bool) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var edits []Edit
+	for _, s := range a[:prefix] {
+		edits = append(edits, Edit{Op: Equal, Text: s})
+	}
+	middle, ok := myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	if !ok {
+		for _, s := range a[prefix : len(a)-suffix] {
+			middle = append(middle, Edit{Op: Delete, Text: s})
+		}
+		for _, s := range b[prefix : len(b)-suffix] {
+			middle = append(middle, Edit{Op: Insert, Text: s})
+		}
+	}
+	edits = append(edits, middle...)
+	for _, s := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{Op: Equal, Text: s})
+	}
+	return edits, ok
+}
+
+// Lines diffs two texts line by line.
+func Lines(a, b string) []Edit {
+	return Strings(strings.Split(a, "\n"), strings.Split(b, "\n"))
+}
+
+// myers returns the shortest edit script turning a into b, or false when it
+// needs more than MaxEdits changes.
+func myers(a, b []string) ([]Edit, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil, true
+	}
+
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds v[-d..d] as it was before step d
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		if d > MaxEdits {
+			return nil, false
+		}
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b), true
+			}
+		}
+	}
+	return nil, true
+}
+
+func backtrack(trace [][]int, a, b []string) []Edit {
+	x, y := len(a), len(b)
+	var reversed []Edit
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		k := x - y
+		var prevX, prevY int
+		if d > 0 {
+			v := trace[d]
+			at := func(k int) int { return v[k+d] }
+			prevK := k - 1
+			if k == -d || (k != d && at(k-1) < at(k+1)) {
+				prevK = k + 1
+			}
+			prevX = at(prevK)
+			prevY = prevX - prevK
+		}
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, Edit{Op: Equal, Text: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, Edit{Op: Insert, Text: b[y-1]})
+			} else {
+				reversed = append(reversed, Edit{Op: Delete, Text: a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	edits := make([]Edit, len(reversed))
+	for i, e := range reversed {
+		edits[len(reversed)-1-i] = e
+	}
+	return edits
+}
+
+// MakeDelta encodes target as a line delta against base. Each line of the
+// delta is "=N" (copy N base lines), "-N" (skip N base lines) or "+text"
+// (insert one line). It returns false, and no delta, when the texts differ
+// in more than MaxEdits lines: target is better stored whole.
+func MakeDelta(base, target string) (string, bool) {
+	var ops []string
+	var run Op = -1
+	count := 0
+
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		if run == Equal {
+			ops = append(ops, "="+strconv.Itoa(count))
+		} else {
+			ops = append(ops, "-"+strconv.Itoa(count))
+		}
+		count = 0
+	}
+
+	edits, ok := diffStrings(strings.Split(base, "\n"), strings.Split(target, "\n"))
+	if !ok {
+		return "", false
+	}
+	for _, e := range edits {
+		if e.Op == Insert {
+			flush()
+			ops = append(ops, "+"+e.Text)
+			continue
+		}
+		if e.Op != run {
+			flush()
+			run = e.Op
+		}
+		count++
+	}
+	flush()
+
+	return strings.Join(ops, "\n"), true
+}
+
+// ApplyDelta rebuilds the target text from base and a delta made by MakeDelta.
+func ApplyDelta(base, delta string) (string, error) {
+	lines := strings.Split(base, "\n")
+	var out []string
+	pos := 0
+
+	for _, op := range strings.Split(delta, "\n") {
+		if op == "" {
+			return "", fmt.Errorf("invalid delta: empty op")
+		}
+		switch op[0] {
+		case '+':
+			out = append(out, op[1:])
+		case '=', '-':
+			n, err := strconv.Atoi(op[1:])
+			if err != nil || n < 0 || pos+n > len(lines) {
+				return "", fmt.Errorf("invalid delta op %q", op)
+			}
+			if op[0] == '=' {
+				out = append(out, lines[pos:pos+n]...)
+			}
+			pos += n
+		default:
+			return "", fmt.Errorf("invalid delta op %q", op)
+		}
+	}
+
+	if pos != len(lines) {
+		return "", fmt.Errorf("delta does not match base")
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// Words splits text into diffable tokens: runs of letters and digits, runs
+// of spaces, line breaks and single punctuation characters.
+func Words(s string) []string {
+	var tokens []string
+	runes := []rune(s)
+	class := func(r rune) int {
+		switch {
+		case r == '\n':
+			return 0
+		case r == ' ' || r == '\t':
+			return 1
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 2
+		default:
+			return 3
+		}
+	}
+
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		if i == len(runes) || class(runes[i]) != class(runes[start]) || class(runes[start]) == 0 || class(runes[start]) == 3 {
+			tokens = append(tokens, string(runes[start:i]))
+			start = i
+		}
+	}
+	return tokens
+}
+
+// Block is a run of consecutive changes in an edit script, as the index
+// range [Start, End) into the edits.
+type Block struct {
+	Start int
+	End   int
+}
+
+// Blocks returns the runs of Insert and Delete edits in edits.
+func Blocks(edits []Edit) []Block {
+	var blocks []Block
+	for i := 0; i < len(edits); i++ {
+		if edits[i].Op == Equal {
+			continue
+		}
+		start := i
+		for i < len(edits) && edits[i].Op != Equal {
+			i++
+		}
+		blocks = append(blocks, Block{Start: start, End: i})
+	}
+	return blocks
+}
+
+// Revert rebuilds the new side of a line diff with one block undone, so
+// that block reads as it did on the old side.
+func Revert(edits []Edit, block Block) string {
+	var lines []string
+	for i, e := range edits {
+		inBlock := i >= block.Start && i < block.End
+		switch {
+		case e.Op == Equal:
+			lines = append(lines, e.Text)
+		case e.Op == Insert && !inBlock:
+			lines = append(lines, e.Text)
+		case e.Op == Delete && inBlock:
+			lines = append(lines, e.Text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Blame attributes every line of the last text to the text that introduced
+// it. texts must be ordered oldest first; the result holds one index into
+// texts per line of the last one.
+func Blame(texts []string) []int {
+	if len(texts) == 0 {
+		return nil
+	}
+
+	origin := make([]int, len(strings.Split(texts[0], "\n")))
+	for i := 1; i < len(texts); i++ {
+		next := make([]int, 0, len(origin))
+		pos := 0
+		for _, e := range Lines(texts[i-1], texts[i]) {
+			switch e.Op {
+			case Equal:
+				next = append(next, origin[pos])
+				pos++
+			case Delete:
+				pos++
+			case Insert:
+				next = append(next, i)
+			}
+		}
+		origin = next
+	}
+	return origin
+}
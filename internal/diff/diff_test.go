@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// apply rebuilds the new side of an edit script.
+func apply(edits []Edit) []string {
+	var out []string
+	for _, e := range edits {
+		if e.Op != Delete {
+			out = append(out, e.Text)
+		}
+	}
+	return out
+}
+
+func numbered(prefix string, n int) string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%s %d", prefix, i)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	cases := []struct{ base, target string }{
+		{"", ""},
+		{"", "nuova nota"},
+		{"una riga", ""},
+		{"a\nb\nc", "a\nb\nc"},
+		{"a\nb\nc", "x\na\nb\nc"},
+		{"a\nb\nc", "a\nc\nd"},
+		{"a\nb\nc\n", "a\nB\nc\n"},
+		{"+più\n-meno\n=uguale", "=uguale\n+più"},
+		{"a\n\n\nb", "\na\n\nb\n"},
+	}
+	for _, c := range cases {
+		delta, ok := MakeDelta(c.base, c.target)
+		if !ok {
+			t.Fatalf("no delta for %q -> %q", c.base, c.target)
+		}
+		got, err := ApplyDelta(c.base, delta)
+		if err != nil {
+			t.Fatalf("%q -> %q: %v", c.base, c.target, err)
+		}
+		if got != c.target {
+			t.Errorf("%q -> %q: rebuilt %q", c.base, c.target, got)
+		}
+	}
+}
+
+func TestApplyDeltaRejectsOtherBase(t *testing.T) {
+	delta, _ := MakeDelta("a\nb\nc", "a\nc")
+	if _, err := ApplyDelta("a\nb", delta); err == nil {
+		t.Fatal("delta applied to a different base")
+	}
+}
+
+func TestTooManyEdits(t *testing.T) {
+	base := "titolo\n" + numbered("vecchia", MaxEdits) + "\nfine"
+	target := "titolo\n" + numbered("nuova", MaxEdits) + "\nfine"
+
+	if _, ok := MakeDelta(base, target); ok {
+		t.Fatal("delta made past MaxEdits")
+	}
+	edits := Lines(base, target)
+	if got := strings.Join(apply(edits), "\n"); got != target {
+		t.Fatal("replacement script does not rebuild the target")
+	}
+	if edits[0].Op != Equal || edits[len(edits)-1].Op != Equal {
+		t.Fatal("common prefix and suffix not kept")
+	}
+}
+
+func TestBlame(t *testing.T) {
+	texts := []string{
+		"titolo\nprima",
+		"titolo\nprima\nseconda",
+		"TITOLO\nprima\nseconda",
+		"TITOLO\nseconda\nterza",
+	}
+	want := []int{2, 1, 3}
+	if got := Blame(texts); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Blame = %v, want %v", got, want)
+	}
+}
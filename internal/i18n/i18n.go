@@ -7,7 +7,10 @@ const (
 	English Language = "en"
 )
 
-var currentLang = Italian
+// DefaultLanguage is used when the configuration sets none.
+const DefaultLanguage = Italian
+
+var currentLang = DefaultLanguage
 
 type Messages struct {
 	// General
@@ -44,6 +47,7 @@ type Messages struct {
 
 	// Dialogs
 	NewNote             string
+	RenameNote          string
 	NewFolder           string
 	DeleteNote          string
 	DeleteFolder        string
@@ -89,9 +93,17 @@ type Messages struct {
 	HelpImport       string
 	HelpSync         string
 	HelpHistory      string
+	HelpBlame        string
+	HelpTagBrowser   string
+	HelpRename       string
+	HelpFollowLink   string
+	HelpGraph        string
 	HelpTags         string
 	HelpPassword     string
 	HelpParentFolder string
+	HelpTreeView     string
+	HelpExpand       string
+	HelpCollapse     string
 	HelpHelp         string
 	HelpExit         string
 	HelpClose        string
@@ -117,10 +129,17 @@ type Messages struct {
 	KeyGoToList     string
 	KeySync         string
 	KeyHistory      string
+	KeyBlame        string
+	KeyTagBrowser   string
+	KeyRename       string
+	KeyGraph        string
 	KeyTags         string
 	KeyPassword     string
 	KeyParentFolder string
 	KeyCopy         string
+	KeyTreeView     string
+	KeyExpand       string
+	KeyCollapse     string
 
 	// Prompts
 	MasterPassword string
@@ -148,6 +167,192 @@ type Messages struct {
 	HistoryRestore string
 	HistoryScroll  string
 	HistoryBack    string
+	HistoryDiff      string
+	HistoryLayout    string
+	HistoryWords     string
+	HistoryCompare   string
+	HistoryHunk      string
+	HistoryApplyHunk string
+	HistoryCurrent   string
+	HistoryNoChanges string
+
+	// Blame
+	BlameTitle   string
+	BlameJump    string
+	BlameUnsaved string
+
+	// Tag browser
+	TagsTitle       string
+	TagsEmpty       string
+	TagFilter       string
+	TagRename       string
+	TagMerge        string
+	TagRenamePrompt string
+	TagMergePrompt  string
+	TagsUpdated     string
+
+	// Links
+	Backlinks   string
+	LinkBroken  string
+	NoteRenamed string
+
+	// Graph explorer
+	GraphTitle     string
+	GraphEmpty     string
+	GraphDepth     string
+	GraphDepthKeys string
+	GraphOpen      string
+	GraphRecenter  string
+	GraphBack      string
+	GraphParent    string
+	GraphChild     string
+
+	// Attachments
+	Attachments           string
+	AttachAdd             string
+	AttachExtract         string
+	AttachDelete          string
+	AttachPathPlaceholder string
+	AttachAdded           string
+	AttachExtracted       string
+	AttachDeleted         string
+	DeleteAttachment      string
+	HelpAttachments       string
+
+	// Templates
+	TemplateBlank     string
+	TemplateChoose    string
+	TemplateCreatedIn string
+	HelpTemplates     string
+
+	// Daily notes and calendar
+	KeyDaily         string
+	KeyCalendar      string
+	HelpDaily        string
+	HelpCalendar     string
+	CalendarTitle    string
+	CalendarMonths   string
+	CalendarWeekdays string
+	CalendarDay      string
+	CalendarWeek     string
+	CalendarMonth    string
+	CalendarToday    string
+	CalendarOpen     string
+	CalendarNoNote   string
+
+	// Reminders and agenda
+	KeyReminder         string
+	KeyAgenda           string
+	HelpReminder        string
+	HelpAgenda          string
+	Reminders           string
+	ReminderTitle       string
+	ReminderChoose      string
+	ReminderWholeNote   string
+	ReminderPlaceholder string
+	ReminderSet         string
+	ReminderToday       string
+	ReminderTomorrow    string
+	ReminderOpen        string
+	ReminderDone        string
+	ReminderDismiss     string
+	ReminderMore        string
+	AgendaTitle         string
+	AgendaEmpty         string
+	AgendaScroll        string
+	AgendaDelete        string
+	AgendaBack          string
+
+	// Tasks
+	KeyTasks         string
+	HelpTasks        string
+	TasksTitle       string
+	TasksEmpty       string
+	TaskToggle       string
+	TaskStatusOpen   string
+	TaskStatusDone   string
+	TaskStatusAll    string
+	TaskDueAny       string
+	TaskDueOverdue   string
+	TaskDueToday     string
+	TaskDueWeek      string
+	TaskDueNone      string
+	TaskAllFolders   string
+	TaskFilterStatus string
+	TaskFilterDue    string
+	TaskFilterFolder string
+	TaskFilterTag    string
+
+	// Board
+	KeyBoard         string
+	HelpBoard        string
+	BoardTitle       string
+	BoardPlaceholder string
+	BoardColumns     string
+	BoardMove        string
+	BoardEdit        string
+	BoardNoTag       string
+	BoardTodo        string
+	BoardDoing       string
+	BoardDone        string
+	BoardReadOnly    string
+
+	// Properties and table view
+	KeyProperties            string
+	KeyTable                 string
+	HelpProperties           string
+	HelpTable                string
+	Properties               string
+	PropertiesEmpty          string
+	PropertyAdd              string
+	PropertyEdit             string
+	PropertyNewPlaceholder   string
+	PropertyValuePlaceholder string
+	TableViewTitle           string
+	TableTitleColumn         string
+	TableEmpty               string
+	TableSort                string
+	TableFilter              string
+	TableFilterPlaceholder   string
+
+	// Pinning and sorting
+	KeyPin      string
+	KeySort     string
+	KeyMove     string
+	HelpPin     string
+	HelpSort    string
+	HelpMove    string
+	SortBy      string
+	SortUpdated string
+	SortCreated string
+	SortTitle   string
+	SortSize    string
+	SortManual  string
+
+	// Archive and read-only lock
+	KeyArchive       string
+	KeyShowArchived  string
+	KeyLockNote      string
+	HelpArchive      string
+	HelpLockNote     string
+	Archived         string
+	NoteLocked       string
+	NoteArchived     string
+	NoteUnarchived   string
+	NoteLockedStatus string
+	NoteUnlocked     string
+	NoteLockedHint   string
+	ArchivedShown    string
+	ArchivedHidden   string
+
+	// Profiles
+	Profile        string
+	ChooseProfile  string
+	KeyProfiles    string
+	HelpProfiles   string
+	ProfileCurrent string
+	ProfileChoose  string
+	ProfileSwitch  string
 }
 
 var translations = map[Language]Messages{
@@ -186,6 +391,7 @@ var translations = map[Language]Messages{
 
 		// Dialogs
 		NewNote:             "Nuova Nota",
+		RenameNote:          "Rinomina Nota",
 		NewFolder:           "Nuova Cartella",
 		DeleteNote:          "Elimina Nota",
 		DeleteFolder:        "Elimina Cartella",
@@ -231,9 +437,17 @@ var translations = map[Language]Messages{
 		HelpImport:       "Importa Markdown",
 		HelpSync:         "Sincronizza con server",
 		HelpHistory:      "Storico versioni",
+		HelpBlame:        "Autore di ogni riga (blame)",
+		HelpTagBrowser:   "Elenco tag",
+		HelpRename:       "Rinomina nota (aggiorna i link)",
+		HelpFollowLink:   "Scegli/segui link (pannello contenuto)",
+		HelpGraph:        "Grafo dei collegamenti",
 		HelpTags:         "Modifica tag",
 		HelpPassword:     "Imposta password",
 		HelpParentFolder: "Cartella superiore",
+		HelpTreeView:     "Vista ad albero",
+		HelpExpand:       "Espandi cartella/apri nota",
+		HelpCollapse:     "Comprimi cartella",
 		HelpHelp:         "Mostra aiuto",
 		HelpExit:         "Esci",
 		HelpClose:        "Premi Esc o Ctrl+H per chiudere",
@@ -259,10 +473,17 @@ var translations = map[Language]Messages{
 		KeyGoToList:     "vai alla lista",
 		KeySync:         "sincronizza",
 		KeyHistory:      "storico",
+		KeyBlame:        "blame",
+		KeyTagBrowser:   "elenco tag",
+		KeyRename:       "rinomina",
+		KeyGraph:        "grafo",
 		KeyTags:         "tag",
 		KeyPassword:     "password",
 		KeyParentFolder: "indietro",
 		KeyCopy:         "copia",
+		KeyTreeView:     "albero",
+		KeyExpand:       "espandi",
+		KeyCollapse:     "comprimi",
 
 		// Prompts
 		MasterPassword: "Password master: ",
@@ -290,6 +511,192 @@ var translations = map[Language]Messages{
 		HistoryRestore: "Ripristina",
 		HistoryScroll:  "Scorri",
 		HistoryBack:    "Lista",
+		HistoryDiff:      "Diff/Anteprima",
+		HistoryLayout:    "Affiancato/Unificato",
+		HistoryWords:     "Parole/Righe",
+		HistoryCompare:   "Confronta con",
+		HistoryHunk:      "Blocco",
+		HistoryApplyHunk: "Ripristina blocco",
+		HistoryCurrent:   "nota corrente",
+		HistoryNoChanges: "Nessuna differenza",
+
+		// Blame
+		BlameTitle:   "Blame",
+		BlameJump:    "vai alla versione",
+		BlameUnsaved: "non salvata",
+
+		// Tag browser
+		TagsTitle:       "Tag",
+		TagsEmpty:       "Nessun tag",
+		TagFilter:       "filtra note",
+		TagRename:       "rinomina",
+		TagMerge:        "unisci",
+		TagRenamePrompt: "Nuovo nome (usa / per annidare):",
+		TagMergePrompt:  "Unisci #%s in:",
+		TagsUpdated:     "%d note aggiornate",
+
+		// Links
+		Backlinks:   "Backlink:",
+		LinkBroken:  "link interrotto: %s",
+		NoteRenamed: "Nota rinominata, link aggiornati in %d note",
+
+		// Graph explorer
+		GraphTitle:     "Grafo",
+		GraphEmpty:     "Apri una nota o una cartella per esplorarne i collegamenti",
+		GraphDepth:     "profondità %d",
+		GraphDepthKeys: "profondità",
+		GraphOpen:      "apri",
+		GraphRecenter:  "centra",
+		GraphBack:      "indietro",
+		GraphParent:    "genitore",
+		GraphChild:     "figlio",
+
+		// Attachments
+		Attachments:           "Allegati",
+		AttachAdd:             "aggiungi",
+		AttachExtract:         "estrai",
+		AttachDelete:          "elimina",
+		AttachPathPlaceholder: "Percorso file...",
+		AttachAdded:           "Allegato %s aggiunto",
+		AttachExtracted:       "Allegato salvato in %s",
+		AttachDeleted:         "Allegato %s eliminato",
+		DeleteAttachment:      "Elimina Allegato",
+		HelpAttachments:       "Allegati (pannello metadati): a aggiungi, Enter estrai, d elimina",
+
+		// Templates
+		TemplateBlank:     "Nota vuota",
+		TemplateChoose:    "scegli",
+		TemplateCreatedIn: "Nota %s creata nella cartella del template",
+		HelpTemplates:     "Le note nella cartella dei template diventano modelli",
+
+		// Daily notes and calendar
+		KeyDaily:         "nota del giorno",
+		KeyCalendar:      "calendario",
+		HelpDaily:        "Apri o crea la nota di oggi",
+		HelpCalendar:     "Calendario delle note giornaliere",
+		CalendarTitle:    "Calendario",
+		CalendarMonths:   "Gennaio,Febbraio,Marzo,Aprile,Maggio,Giugno,Luglio,Agosto,Settembre,Ottobre,Novembre,Dicembre",
+		CalendarWeekdays: "Lu,Ma,Me,Gi,Ve,Sa,Do",
+		CalendarDay:      "giorno",
+		CalendarWeek:     "settimana",
+		CalendarMonth:    "mese",
+		CalendarToday:    "oggi",
+		CalendarOpen:     "[Enter] apri",
+		CalendarNoNote:   "[Enter] crea",
+
+		// Reminders and agenda
+		KeyReminder:         "promemoria",
+		KeyAgenda:           "agenda",
+		HelpReminder:        "Promemoria sulla nota o su una voce della checklist",
+		HelpAgenda:          "Agenda: promemoria in arrivo e scaduti",
+		Reminders:           "Promemoria",
+		ReminderTitle:       "Promemoria",
+		ReminderChoose:      "scegli",
+		ReminderWholeNote:   "Tutta la nota",
+		ReminderPlaceholder: "2024-05-01 18:30, domani 9:00, +2h...",
+		ReminderSet:         "Promemoria impostato per %s",
+		ReminderToday:       "oggi",
+		ReminderTomorrow:    "domani",
+		ReminderOpen:        "apri",
+		ReminderDone:        "fatto",
+		ReminderDismiss:     "chiudi",
+		ReminderMore:        "altri %d promemoria",
+		AgendaTitle:         "Agenda",
+		AgendaEmpty:         "Nessun promemoria. Premi R su una nota per aggiungerne uno",
+		AgendaScroll:        "Scorri",
+		AgendaDelete:        "elimina",
+		AgendaBack:          "Lista",
+
+		// Tasks
+		KeyTasks:         "attività",
+		HelpTasks:        "Attività: le checkbox di tutte le note, con filtri",
+		TasksTitle:       "Attività",
+		TasksEmpty:       "Nessuna attività con questi filtri",
+		TaskToggle:       "spunta",
+		TaskStatusOpen:   "da fare",
+		TaskStatusDone:   "completate",
+		TaskStatusAll:    "tutte",
+		TaskDueAny:       "qualsiasi scadenza",
+		TaskDueOverdue:   "scadute",
+		TaskDueToday:     "entro oggi",
+		TaskDueWeek:      "entro 7 giorni",
+		TaskDueNone:      "senza scadenza",
+		TaskAllFolders:   "tutte le cartelle",
+		TaskFilterStatus: "stato",
+		TaskFilterDue:    "scadenza",
+		TaskFilterFolder: "cartella",
+		TaskFilterTag:    "tag",
+
+		// Board
+		KeyBoard:         "bacheca",
+		HelpBoard:        "Bacheca kanban della cartella, per tag o stato delle attività",
+		BoardTitle:       "Bacheca",
+		BoardPlaceholder: "#todo #doing #done, oppure tasks",
+		BoardColumns:     "colonne",
+		BoardMove:        "sposta",
+		BoardEdit:        "modifica colonne",
+		BoardNoTag:       "Senza stato",
+		BoardTodo:        "Da fare",
+		BoardDoing:       "In corso",
+		BoardDone:        "Fatto",
+		BoardReadOnly:    "Le schede di una bacheca per attività si spostano spuntando le checkbox",
+
+		// Properties and table view
+		KeyProperties:            "proprietà",
+		KeyTable:                 "tabella",
+		HelpProperties:           "Proprietà della nota: testo, numero, data, select, checkbox",
+		HelpTable:                "Tabella delle note della cartella con le loro proprietà",
+		Properties:               "Proprietà",
+		PropertiesEmpty:          "Nessuna proprietà. Premi n per aggiungerne una",
+		PropertyAdd:              "nuova",
+		PropertyEdit:             "modifica",
+		PropertyNewPlaceholder:   "nome:tipo, es. stato:select(attivo, chiuso)",
+		PropertyValuePlaceholder: "Valore...",
+		TableViewTitle:           "Tabella",
+		TableTitleColumn:         "Titolo",
+		TableEmpty:               "Nessuna nota",
+		TableSort:                "ordina",
+		TableFilter:              "filtro",
+		TableFilterPlaceholder:   "stato=attivo, voto>3, testo...",
+
+		// Pinning and sorting
+		KeyPin:      "fissa",
+		KeySort:     "ordina",
+		KeyMove:     "sposta",
+		HelpPin:     "Fissa o stacca la nota in cima alla lista",
+		HelpSort:    "Cambia ordinamento della cartella / inverti la direzione",
+		HelpMove:    "Sposta l'elemento su/giù (ordinamento manuale)",
+		SortBy:      "Ordine",
+		SortUpdated: "modifica",
+		SortCreated: "creazione",
+		SortTitle:   "titolo",
+		SortSize:    "dimensione",
+		SortManual:  "manuale",
+
+		// Archive and read-only lock
+		KeyArchive:       "archivia",
+		KeyShowArchived:  "mostra archiviate",
+		KeyLockNote:      "blocca",
+		HelpArchive:      "Archivia o ripristina la nota / mostra le note archiviate",
+		HelpLockNote:     "Blocca o sblocca la nota contro le modifiche",
+		Archived:         "Archiviata",
+		NoteLocked:       "Bloccata",
+		NoteArchived:     "Nota archiviata",
+		NoteUnarchived:   "Nota ripristinata dall'archivio",
+		NoteLockedStatus: "Nota bloccata",
+		NoteUnlocked:     "Nota sbloccata",
+		NoteLockedHint:   "Nota bloccata: premi w per sbloccarla",
+		ArchivedShown:    "Note archiviate visibili",
+		ArchivedHidden:   "Note archiviate nascoste",
+
+		// Profiles
+		Profile:        "Profilo",
+		ChooseProfile:  "Quale profilo apro? (Invio = default)",
+		KeyProfiles:    "profili",
+		HelpProfiles:   "Passa a un altro profilo (chiede la sua password)",
+		ProfileCurrent: "aperto",
+		ProfileChoose:  "scegli",
+		ProfileSwitch:  "apri",
 	},
 
 	English: {
@@ -327,6 +734,7 @@ var translations = map[Language]Messages{
 
 		// Dialogs
 		NewNote:             "New Note",
+		RenameNote:          "Rename Note",
 		NewFolder:           "New Folder",
 		DeleteNote:          "Delete Note",
 		DeleteFolder:        "Delete Folder",
@@ -372,9 +780,17 @@ var translations = map[Language]Messages{
 		HelpImport:       "Import Markdown",
 		HelpSync:         "Sync with server",
 		HelpHistory:      "Version history",
+		HelpBlame:        "Line-by-line blame",
+		HelpTagBrowser:   "Tag browser",
+		HelpRename:       "Rename note (updates links)",
+		HelpFollowLink:   "Pick/follow link (content panel)",
+		HelpGraph:        "Link graph",
 		HelpTags:         "Edit tags",
 		HelpPassword:     "Set password",
 		HelpParentFolder: "Parent folder",
+		HelpTreeView:     "Tree view",
+		HelpExpand:       "Expand folder/open note",
+		HelpCollapse:     "Collapse folder",
 		HelpHelp:         "Show help",
 		HelpExit:         "Exit",
 		HelpClose:        "Press Esc or Ctrl+H to close",
@@ -400,10 +816,17 @@ var translations = map[Language]Messages{
 		KeyGoToList:     "go to list",
 		KeySync:         "sync",
 		KeyHistory:      "history",
+		KeyBlame:        "blame",
+		KeyTagBrowser:   "tag browser",
+		KeyRename:       "rename",
+		KeyGraph:        "graph",
 		KeyTags:         "tags",
 		KeyPassword:     "password",
 		KeyParentFolder: "back",
 		KeyCopy:         "copy",
+		KeyTreeView:     "tree",
+		KeyExpand:       "expand",
+		KeyCollapse:     "collapse",
 
 		// Prompts
 		MasterPassword: "Master password: ",
@@ -431,6 +854,192 @@ var translations = map[Language]Messages{
 		HistoryRestore: "Restore",
 		HistoryScroll:  "Scroll",
 		HistoryBack:    "List",
+		HistoryDiff:      "Diff/Preview",
+		HistoryLayout:    "Side-by-side/Unified",
+		HistoryWords:     "Words/Lines",
+		HistoryCompare:   "Compare with",
+		HistoryHunk:      "Hunk",
+		HistoryApplyHunk: "Restore hunk",
+		HistoryCurrent:   "current note",
+		HistoryNoChanges: "No differences",
+
+		// Blame
+		BlameTitle:   "Blame",
+		BlameJump:    "go to version",
+		BlameUnsaved: "unsaved",
+
+		// Tag browser
+		TagsTitle:       "Tags",
+		TagsEmpty:       "No tags",
+		TagFilter:       "filter notes",
+		TagRename:       "rename",
+		TagMerge:        "merge",
+		TagRenamePrompt: "New name (use / to nest):",
+		TagMergePrompt:  "Merge #%s into:",
+		TagsUpdated:     "%d notes updated",
+
+		// Links
+		Backlinks:   "Backlinks:",
+		LinkBroken:  "broken link: %s",
+		NoteRenamed: "Note renamed, links updated in %d notes",
+
+		// Graph explorer
+		GraphTitle:     "Graph",
+		GraphEmpty:     "Open a note or folder to explore its connections",
+		GraphDepth:     "depth %d",
+		GraphDepthKeys: "depth",
+		GraphOpen:      "open",
+		GraphRecenter:  "center",
+		GraphBack:      "back",
+		GraphParent:    "parent",
+		GraphChild:     "child",
+
+		// Attachments
+		Attachments:           "Attachments",
+		AttachAdd:             "add",
+		AttachExtract:         "extract",
+		AttachDelete:          "delete",
+		AttachPathPlaceholder: "File path...",
+		AttachAdded:           "Attached %s",
+		AttachExtracted:       "Attachment saved to %s",
+		AttachDeleted:         "Deleted attachment %s",
+		DeleteAttachment:      "Delete Attachment",
+		HelpAttachments:       "Attachments (metadata panel): a add, Enter extract, d delete",
+
+		// Templates
+		TemplateBlank:     "Empty note",
+		TemplateChoose:    "choose",
+		TemplateCreatedIn: "Note %s created in the template's folder",
+		HelpTemplates:     "Notes in the templates folder become templates",
+
+		// Daily notes and calendar
+		KeyDaily:         "daily note",
+		KeyCalendar:      "calendar",
+		HelpDaily:        "Open or create today's note",
+		HelpCalendar:     "Daily notes calendar",
+		CalendarTitle:    "Calendar",
+		CalendarMonths:   "January,February,March,April,May,June,July,August,September,October,November,December",
+		CalendarWeekdays: "Mo,Tu,We,Th,Fr,Sa,Su",
+		CalendarDay:      "day",
+		CalendarWeek:     "week",
+		CalendarMonth:    "month",
+		CalendarToday:    "today",
+		CalendarOpen:     "[Enter] open",
+		CalendarNoNote:   "[Enter] create",
+
+		// Reminders and agenda
+		KeyReminder:         "reminder",
+		KeyAgenda:           "agenda",
+		HelpReminder:        "Reminder on the note or a checklist item",
+		HelpAgenda:          "Agenda: upcoming and overdue reminders",
+		Reminders:           "Reminders",
+		ReminderTitle:       "Reminder",
+		ReminderChoose:      "choose",
+		ReminderWholeNote:   "Whole note",
+		ReminderPlaceholder: "2024-05-01 18:30, tomorrow 9:00, +2h...",
+		ReminderSet:         "Reminder set for %s",
+		ReminderToday:       "today",
+		ReminderTomorrow:    "tomorrow",
+		ReminderOpen:        "open",
+		ReminderDone:        "done",
+		ReminderDismiss:     "dismiss",
+		ReminderMore:        "%d more reminders",
+		AgendaTitle:         "Agenda",
+		AgendaEmpty:         "No reminders. Press R on a note to add one",
+		AgendaScroll:        "Scroll",
+		AgendaDelete:        "delete",
+		AgendaBack:          "List",
+
+		// Tasks
+		KeyTasks:         "tasks",
+		HelpTasks:        "Tasks: the checkboxes of every note, with filters",
+		TasksTitle:       "Tasks",
+		TasksEmpty:       "No tasks match these filters",
+		TaskToggle:       "toggle",
+		TaskStatusOpen:   "open",
+		TaskStatusDone:   "done",
+		TaskStatusAll:    "all",
+		TaskDueAny:       "any due date",
+		TaskDueOverdue:   "overdue",
+		TaskDueToday:     "due today",
+		TaskDueWeek:      "due in 7 days",
+		TaskDueNone:      "no due date",
+		TaskAllFolders:   "all folders",
+		TaskFilterStatus: "status",
+		TaskFilterDue:    "due",
+		TaskFilterFolder: "folder",
+		TaskFilterTag:    "tag",
+
+		// Board
+		KeyBoard:         "board",
+		HelpBoard:        "Kanban board of the folder, by tags or task state",
+		BoardTitle:       "Board",
+		BoardPlaceholder: "#todo #doing #done, or tasks",
+		BoardColumns:     "columns",
+		BoardMove:        "move",
+		BoardEdit:        "edit columns",
+		BoardNoTag:       "No status",
+		BoardTodo:        "To do",
+		BoardDoing:       "Doing",
+		BoardDone:        "Done",
+		BoardReadOnly:    "Cards on a task board move when their checkboxes are ticked",
+
+		// Properties and table view
+		KeyProperties:            "properties",
+		KeyTable:                 "table",
+		HelpProperties:           "Note properties: text, number, date, select, checkbox",
+		HelpTable:                "Table of the folder's notes with their properties",
+		Properties:               "Properties",
+		PropertiesEmpty:          "No properties. Press n to add one",
+		PropertyAdd:              "new",
+		PropertyEdit:             "edit",
+		PropertyNewPlaceholder:   "name:type, e.g. status:select(active, closed)",
+		PropertyValuePlaceholder: "Value...",
+		TableViewTitle:           "Table",
+		TableTitleColumn:         "Title",
+		TableEmpty:               "No notes",
+		TableSort:                "sort",
+		TableFilter:              "filter",
+		TableFilterPlaceholder:   "status=active, rating>3, text...",
+
+		// Pinning and sorting
+		KeyPin:      "pin",
+		KeySort:     "sort",
+		KeyMove:     "move",
+		HelpPin:     "Pin or unpin the note at the top of the list",
+		HelpSort:    "Change the folder's sort mode / reverse the direction",
+		HelpMove:    "Move the item up/down (manual order)",
+		SortBy:      "Sort",
+		SortUpdated: "updated",
+		SortCreated: "created",
+		SortTitle:   "title",
+		SortSize:    "size",
+		SortManual:  "manual",
+
+		// Archive and read-only lock
+		KeyArchive:       "archive",
+		KeyShowArchived:  "show archived",
+		KeyLockNote:      "lock",
+		HelpArchive:      "Archive or restore the note / show archived notes",
+		HelpLockNote:     "Lock or unlock the note against edits",
+		Archived:         "Archived",
+		NoteLocked:       "Locked",
+		NoteArchived:     "Note archived",
+		NoteUnarchived:   "Note restored from the archive",
+		NoteLockedStatus: "Note locked",
+		NoteUnlocked:     "Note unlocked",
+		NoteLockedHint:   "Note locked: press w to unlock it",
+		ArchivedShown:    "Archived notes shown",
+		ArchivedHidden:   "Archived notes hidden",
+
+		// Profiles
+		Profile:        "Profile",
+		ChooseProfile:  "Which profile should I open? (Enter = default)",
+		KeyProfiles:    "profiles",
+		HelpProfiles:   "Switch to another profile (asks for its password)",
+		ProfileCurrent: "open",
+		ProfileChoose:  "choose",
+		ProfileSwitch:  "open",
 	},
 }
 
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/JustZacca/jotaku/internal/db"
+)
+
+// Blob handlers
+
+type StartBlobRequest struct {
+	Size   int64 `json:"size"`
+	Chunks int   `json:"chunks"`
+}
+
+type BlobUsageResponse struct {
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
+}
+
+// blobError maps storage errors to HTTP statuses.
+func blobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrQuotaExceeded):
+		jsonError(w, err.Error(), http.StatusInsufficientStorage)
+	case errors.Is(err, db.ErrBlobNotFound):
+		jsonError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, db.ErrBlobMismatch):
+		jsonError(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, db.ErrBlobIncomplete):
+		jsonError(w, err.Error(), http.StatusConflict)
+	default:
+		jsonError(w, "blob storage error", http.StatusInternalServerError)
+	}
+}
+
+// blobHashParam returns the {hash} URL parameter, or "" after answering 400.
+func blobHashParam(w http.ResponseWriter, r *http.Request) string {
+	hash := chi.URLParam(r, "hash")
+	if !db.ValidBlobHash(hash) {
+		jsonError(w, "invalid blob hash", http.StatusBadRequest)
+		return ""
+	}
+	return hash
+}
+
+func (s *Server) blobUsageHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	used, err := s.db.BlobUsage(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, "failed to get usage", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, BlobUsageResponse{Used: used, Quota: s.blobQuota}, http.StatusOK)
+}
+
+func (s *Server) getBlobHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	hash := blobHashParam(w, r)
+	if hash == "" {
+		return
+	}
+
+	blob, err := s.db.GetBlob(r.Context(), user.ID, hash)
+	if err != nil {
+		blobError(w, err)
+		return
+	}
+	if blob == nil {
+		jsonError(w, "blob not found", http.StatusNotFound)
+		return
+	}
+	jsonResponse(w, blob, http.StatusOK)
+}
+
+// startBlobHandler declares an upload, or reports the chunks already
+// received when resuming one.
+func (s *Server) startBlobHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	hash := blobHashParam(w, r)
+	if hash == "" {
+		return
+	}
+
+	var req StartBlobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	blob, err := s.db.StartBlobUpload(r.Context(), user.ID, hash, req.Size, req.Chunks, s.blobQuota)
+	if err != nil {
+		blobError(w, err)
+		return
+	}
+	jsonResponse(w, blob, http.StatusOK)
+}
+
+func (s *Server) putBlobChunkHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	hash := blobHashParam(w, r)
+	if hash == "" {
+		return
+	}
+	seq, err := strconv.Atoi(chi.URLParam(r, "seq"))
+	if err != nil {
+		jsonError(w, "invalid chunk number", http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, db.MaxBlobChunkSize))
+	if err != nil {
+		jsonError(w, "chunk too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	blob, err := s.db.PutBlobChunk(r.Context(), user.ID, hash, seq, data)
+	if err != nil {
+		blobError(w, err)
+		return
+	}
+	jsonResponse(w, blob, http.StatusOK)
+}
+
+func (s *Server) getBlobChunkHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	hash := blobHashParam(w, r)
+	if hash == "" {
+		return
+	}
+	seq, err := strconv.Atoi(chi.URLParam(r, "seq"))
+	if err != nil {
+		jsonError(w, "invalid chunk number", http.StatusBadRequest)
+		return
+	}
+
+	data, err := s.db.GetBlobChunk(r.Context(), user.ID, hash, seq)
+	if err != nil {
+		blobError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// Attachment handlers
+
+type AttachmentResponse struct {
+	ID        string `json:"id"`
+	NoteID    string `json:"note_id"`
+	Name      string `json:"name"`
+	Hash      string `json:"hash"`
+	Size      int64  `json:"size"`
+	Deleted   bool   `json:"deleted"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+type AttachmentListResponse struct {
+	Attachments []AttachmentResponse `json:"attachments"`
+}
+
+type UpsertAttachmentRequest struct {
+	ID        string `json:"id"`
+	NoteID    string `json:"note_id"`
+	Name      string `json:"name"`
+	Hash      string `json:"hash"`
+	Size      int64  `json:"size"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func attachmentResponse(a *db.ServerAttachment) AttachmentResponse {
+	return AttachmentResponse{
+		ID:        a.ID,
+		NoteID:    a.NoteID,
+		Name:      a.Name,
+		Hash:      a.Hash,
+		Size:      a.Size,
+		Deleted:   a.Deleted,
+		CreatedAt: a.CreatedAt.Unix(),
+		UpdatedAt: a.UpdatedAt.Unix(),
+	}
+}
+
+func (s *Server) upsertAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	var req UpsertAttachmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.NoteID == "" || req.Name == "" || !db.ValidBlobHash(req.Hash) {
+		jsonError(w, "note_id, name and hash required", http.StatusBadRequest)
+		return
+	}
+
+	createdAt := time.Now()
+	if req.CreatedAt > 0 {
+		createdAt = time.Unix(req.CreatedAt, 0)
+	}
+
+	a, err := s.db.UpsertAttachment(r.Context(), user.ID, req.ID, req.NoteID, req.Name, req.Hash, req.Size, createdAt)
+	if err != nil {
+		blobError(w, err)
+		return
+	}
+	jsonResponse(w, attachmentResponse(a), http.StatusOK)
+}
+
+func (s *Server) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	id := chi.URLParam(r, "id")
+
+	if err := s.db.DeleteAttachment(r.Context(), id, user.ID); err != nil {
+		jsonError(w, "failed to delete attachment", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) syncAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	var since time.Time
+	if ts, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64); err == nil {
+		since = time.Unix(ts, 0)
+	}
+
+	attachments, err := s.db.GetAttachmentsSince(r.Context(), user.ID, since)
+	if err != nil {
+		jsonError(w, "failed to get attachments", http.StatusInternalServerError)
+		return
+	}
+
+	response := AttachmentListResponse{Attachments: make([]AttachmentResponse, len(attachments))}
+	for i := range attachments {
+		response.Attachments[i] = attachmentResponse(&attachments[i])
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
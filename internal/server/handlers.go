@@ -40,7 +40,7 @@ func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := s.db.GetUserByUsername(req.Username)
+	user, err := s.db.GetUserByUsername(r.Context(), req.Username)
 	if err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
@@ -96,13 +96,13 @@ func (s *Server) registerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	existing, _ := s.db.GetUserByUsername(req.Username)
+	existing, _ := s.db.GetUserByUsername(r.Context(), req.Username)
 	if existing != nil {
 		jsonError(w, "username already exists", http.StatusConflict)
 		return
 	}
 
-	user, err := s.db.CreateUser(req.Username, req.Password)
+	user, err := s.db.CreateUser(r.Context(), req.Username, req.Password)
 	if err != nil {
 		jsonError(w, "failed to create user", http.StatusInternalServerError)
 		return
@@ -130,6 +130,8 @@ type NoteResponse struct {
 	Content        string `json:"content"`
 	Tags           string `json:"tags"`
 	ParentFolderID string `json:"parent_folder_id,omitempty"`
+	Archived       bool   `json:"archived,omitempty"`
+	ReadOnly       bool   `json:"read_only,omitempty"`
 	CreatedAt      int64  `json:"created_at"`
 	UpdatedAt      int64  `json:"updated_at"`
 }
@@ -141,7 +143,7 @@ type NoteListResponse struct {
 func (s *Server) listNotesHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
 
-	notes, err := s.db.ListNotesByUser(user.ID)
+	notes, err := s.db.ListNotesByUser(r.Context(), user.ID)
 	if err != nil {
 		jsonError(w, "failed to list notes", http.StatusInternalServerError)
 		return
@@ -155,6 +157,8 @@ func (s *Server) listNotesHandler(w http.ResponseWriter, r *http.Request) {
 			Content:        n.Content,
 			Tags:           n.Tags,
 			ParentFolderID: n.ParentFolderID,
+			Archived:       n.Archived,
+			ReadOnly:       n.ReadOnly,
 			CreatedAt:      n.CreatedAt.Unix(),
 			UpdatedAt:      n.UpdatedAt.Unix(),
 		}
@@ -167,7 +171,7 @@ func (s *Server) getNoteHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
 	noteID := chi.URLParam(r, "id")
 
-	note, err := s.db.GetNote(noteID, user.ID)
+	note, err := s.db.GetNote(r.Context(), noteID, user.ID)
 	if err != nil {
 		jsonError(w, "failed to get note", http.StatusInternalServerError)
 		return
@@ -183,6 +187,8 @@ func (s *Server) getNoteHandler(w http.ResponseWriter, r *http.Request) {
 		Content:        note.Content,
 		Tags:           note.Tags,
 		ParentFolderID: note.ParentFolderID,
+		Archived:       note.Archived,
+		ReadOnly:       note.ReadOnly,
 		CreatedAt:      note.CreatedAt.Unix(),
 		UpdatedAt:      note.UpdatedAt.Unix(),
 	}, http.StatusOK)
@@ -194,6 +200,8 @@ type UpsertNoteRequest struct {
 	Content        string `json:"content"`
 	Tags           string `json:"tags"`
 	ParentFolderID string `json:"parent_folder_id,omitempty"`
+	Archived       bool   `json:"archived,omitempty"`
+	ReadOnly       bool   `json:"read_only,omitempty"`
 	CreatedAt      int64  `json:"created_at"`
 	UpdatedAt      int64  `json:"updated_at"`
 }
@@ -222,7 +230,8 @@ func (s *Server) upsertNoteHandler(w http.ResponseWriter, r *http.Request) {
 		updatedAt = time.Unix(req.UpdatedAt, 0)
 	}
 
-	note, err := s.db.UpsertNote(user.ID, req.ID, req.Title, req.Content, req.Tags, req.ParentFolderID, createdAt, updatedAt)
+	note, err := s.db.UpsertNote(r.Context(), user.ID, req.ID, req.Title, req.Content, req.Tags, req.ParentFolderID, req.Archived, req.ReadOnly,
+		createdAt, updatedAt)
 	if err != nil {
 		jsonError(w, "failed to save note", http.StatusInternalServerError)
 		return
@@ -234,6 +243,8 @@ func (s *Server) upsertNoteHandler(w http.ResponseWriter, r *http.Request) {
 		Content:        note.Content,
 		Tags:           note.Tags,
 		ParentFolderID: note.ParentFolderID,
+		Archived:       note.Archived,
+		ReadOnly:       note.ReadOnly,
 		CreatedAt:      note.CreatedAt.Unix(),
 		UpdatedAt:      note.UpdatedAt.Unix(),
 	}, http.StatusOK)
@@ -243,7 +254,7 @@ func (s *Server) deleteNoteHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
 	noteID := chi.URLParam(r, "id")
 
-	if err := s.db.DeleteNote(noteID, user.ID); err != nil {
+	if err := s.db.DeleteNote(r.Context(), noteID, user.ID); err != nil {
 		jsonError(w, "failed to delete note", http.StatusInternalServerError)
 		return
 	}
@@ -273,7 +284,7 @@ func (s *Server) syncNotesHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	notes, err := s.db.GetNotesSince(user.ID, since)
+	notes, err := s.db.GetNotesSince(r.Context(), user.ID, since)
 	if err != nil {
 		jsonError(w, "failed to get notes", http.StatusInternalServerError)
 		return
@@ -287,6 +298,8 @@ func (s *Server) syncNotesHandler(w http.ResponseWriter, r *http.Request) {
 			Content:        n.Content,
 			Tags:           n.Tags,
 			ParentFolderID: n.ParentFolderID,
+			Archived:       n.Archived,
+			ReadOnly:       n.ReadOnly,
 			CreatedAt:      n.CreatedAt.Unix(),
 			UpdatedAt:      n.UpdatedAt.Unix(),
 		}
@@ -320,7 +333,7 @@ type UpsertFolderRequest struct {
 func (s *Server) listFoldersHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
 
-	folders, err := s.db.ListFoldersByUser(user.ID)
+	folders, err := s.db.ListFoldersByUser(r.Context(), user.ID)
 	if err != nil {
 		jsonError(w, "failed to list folders", http.StatusInternalServerError)
 		return
@@ -344,7 +357,7 @@ func (s *Server) getFolderHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
 	folderID := chi.URLParam(r, "id")
 
-	folder, err := s.db.GetFolder(folderID, user.ID)
+	folder, err := s.db.GetFolder(r.Context(), folderID, user.ID)
 	if err != nil {
 		jsonError(w, "failed to get folder", http.StatusInternalServerError)
 		return
@@ -387,7 +400,7 @@ func (s *Server) upsertFolderHandler(w http.ResponseWriter, r *http.Request) {
 		updatedAt = time.Unix(req.UpdatedAt, 0)
 	}
 
-	folder, err := s.db.UpsertFolder(user.ID, req.ID, req.Title, req.ParentFolderID, createdAt, updatedAt)
+	folder, err := s.db.UpsertFolder(r.Context(), user.ID, req.ID, req.Title, req.ParentFolderID, createdAt, updatedAt)
 	if err != nil {
 		jsonError(w, "failed to save folder", http.StatusInternalServerError)
 		return
@@ -406,7 +419,7 @@ func (s *Server) deleteFolderHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
 	folderID := chi.URLParam(r, "id")
 
-	if err := s.db.DeleteFolder(folderID, user.ID); err != nil {
+	if err := s.db.DeleteFolder(r.Context(), folderID, user.ID); err != nil {
 		jsonError(w, "failed to delete folder", http.StatusInternalServerError)
 		return
 	}
@@ -433,7 +446,7 @@ func (s *Server) syncFoldersHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	folders, err := s.db.GetFoldersSince(user.ID, since)
+	folders, err := s.db.GetFoldersSince(r.Context(), user.ID, since)
 	if err != nil {
 		jsonError(w, "failed to get folders", http.StatusInternalServerError)
 		return
@@ -101,3 +101,9 @@ func NewAPIRateLimiter() *RateLimiter {
 	// 100 requests per minute
 	return NewRateLimiter(100, time.Minute)
 }
+
+// Rate limiter for blob endpoints, where every attachment chunk is a request
+func NewBlobRateLimiter() *RateLimiter {
+	// 600 requests per minute, about 150 MB of 256 KB chunks
+	return NewRateLimiter(600, time.Minute)
+}
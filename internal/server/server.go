@@ -14,24 +14,28 @@ import (
 )
 
 type Server struct {
-	db          *db.ServerDB
+	db          db.ServerStore
 	jwt         *auth.JWTManager
 	router      *chi.Mux
 	authLimiter *RateLimiter
 	apiLimiter  *RateLimiter
+	blobLimiter *RateLimiter
+	blobQuota   int64 // Byte per utente per gli allegati
 }
 
 type contextKey string
 
 const userContextKey contextKey = "user"
 
-func New(database *db.ServerDB, jwtManager *auth.JWTManager) *Server {
+func New(database db.ServerStore, jwtManager *auth.JWTManager) *Server {
 	s := &Server{
 		db:          database,
 		jwt:         jwtManager,
 		router:      chi.NewRouter(),
 		authLimiter: NewAuthRateLimiter(),
 		apiLimiter:  NewAPIRateLimiter(),
+		blobLimiter: NewBlobRateLimiter(),
+		blobQuota:   db.DefaultBlobQuota,
 	}
 	s.setupRoutes()
 	return s
@@ -40,13 +44,13 @@ func New(database *db.ServerDB, jwtManager *auth.JWTManager) *Server {
 func (s *Server) setupRoutes() {
 	s.router.Use(middleware.Logger)
 	s.router.Use(middleware.Recoverer)
-	s.router.Use(middleware.Timeout(30 * time.Second))
 
 	// Health check
 	s.router.Get("/health", s.healthHandler)
 
 	// Auth routes (public) - stricter rate limiting
 	s.router.Route("/api/auth", func(r chi.Router) {
+		r.Use(middleware.Timeout(30 * time.Second))
 		r.Use(s.authLimiter.Middleware)
 		r.Post("/login", s.loginHandler)
 		r.Post("/register", s.registerHandler)
@@ -54,6 +58,7 @@ func (s *Server) setupRoutes() {
 
 	// Protected routes - general rate limiting
 	s.router.Route("/api/notes", func(r chi.Router) {
+		r.Use(middleware.Timeout(30 * time.Second))
 		r.Use(s.authMiddleware)
 		r.Use(s.apiLimiter.Middleware)
 		r.Get("/", s.listNotesHandler)
@@ -65,6 +70,7 @@ func (s *Server) setupRoutes() {
 
 	// Folder routes
 	s.router.Route("/api/folders", func(r chi.Router) {
+		r.Use(middleware.Timeout(30 * time.Second))
 		r.Use(s.authMiddleware)
 		r.Use(s.apiLimiter.Middleware)
 		r.Get("/", s.listFoldersHandler)
@@ -73,6 +79,35 @@ func (s *Server) setupRoutes() {
 		r.Delete("/{id}", s.deleteFolderHandler)
 		r.Get("/sync", s.syncFoldersHandler)
 	})
+
+	// Attachment routes
+	s.router.Route("/api/attachments", func(r chi.Router) {
+		r.Use(middleware.Timeout(30 * time.Second))
+		r.Use(s.authMiddleware)
+		r.Use(s.apiLimiter.Middleware)
+		r.Post("/", s.upsertAttachmentHandler)
+		r.Delete("/{id}", s.deleteAttachmentHandler)
+		r.Get("/sync", s.syncAttachmentsHandler)
+	})
+
+	// Blob routes: chunks are uploaded one request at a time, so a slow link
+	// gets a longer timeout per request instead of one for the whole file, and
+	// a limiter that leaves room for a file's worth of chunks
+	s.router.Route("/api/blobs", func(r chi.Router) {
+		r.Use(middleware.Timeout(5 * time.Minute))
+		r.Use(s.authMiddleware)
+		r.Use(s.blobLimiter.Middleware)
+		r.Get("/", s.blobUsageHandler)
+		r.Get("/{hash}", s.getBlobHandler)
+		r.Post("/{hash}", s.startBlobHandler)
+		r.Put("/{hash}/chunks/{seq}", s.putBlobChunkHandler)
+		r.Get("/{hash}/chunks/{seq}", s.getBlobChunkHandler)
+	})
+}
+
+// SetBlobQuota sets how many bytes of attachments each user may store.
+func (s *Server) SetBlobQuota(quota int64) {
+	s.blobQuota = quota
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -99,7 +134,7 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := s.db.GetUserByID(claims.UserID)
+		user, err := s.db.GetUserByID(r.Context(), claims.UserID)
 		if err != nil || user == nil || !user.Active {
 			jsonError(w, "user not found or inactive", http.StatusUnauthorized)
 			return
@@ -0,0 +1,208 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+type attachmentsLoadedMsg struct {
+	noteID      int64
+	attachments []db.Attachment
+}
+
+type attachmentSavedMsg string
+
+func (m Model) loadAttachments(noteID int64) tea.Cmd {
+	return func() tea.Msg {
+		attachments, err := m.db.ListAttachments(m.ctx, noteID)
+		if err != nil {
+			return errMsg(err)
+		}
+		return attachmentsLoadedMsg{noteID: noteID, attachments: attachments}
+	}
+}
+
+// expandPath resolves a leading ~ to the home directory.
+func expandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+func (m Model) addAttachment(noteID int64, path string) tea.Cmd {
+	return func() tea.Msg {
+		data, err := os.ReadFile(expandPath(path))
+		if err != nil {
+			return errMsg(err)
+		}
+		a, err := m.db.AddAttachment(m.ctx, noteID, path, data, m.config.MaxAttachmentSize)
+		if err != nil {
+			return errMsg(err)
+		}
+		return attachmentSavedMsg(fmt.Sprintf(i18n.T().AttachAdded, a.Name))
+	}
+}
+
+// extractAttachment decrypts an attachment to path. A directory path keeps
+// the attachment's own file name.
+func (m Model) extractAttachment(a db.Attachment, path string) tea.Cmd {
+	return func() tea.Msg {
+		path = expandPath(path)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			path = filepath.Join(path, a.Name)
+		}
+		data, err := m.db.ReadAttachment(m.ctx, a.ID)
+		if err != nil {
+			return errMsg(err)
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return errMsg(err)
+		}
+		return attachmentSavedMsg(fmt.Sprintf(i18n.T().AttachExtracted, path))
+	}
+}
+
+func (m Model) deleteAttachment() tea.Cmd {
+	return func() tea.Msg {
+		if m.deleteTargetID == 0 {
+			return nil
+		}
+		if err := m.db.DeleteAttachment(m.ctx, m.deleteTargetID); err != nil {
+			return errMsg(err)
+		}
+		return attachmentSavedMsg(fmt.Sprintf(i18n.T().AttachDeleted, m.deleteTargetTitle))
+	}
+}
+
+func (m Model) selectedAttachment() *db.Attachment {
+	if m.attachCursor >= 0 && m.attachCursor < len(m.attachments) {
+		return &m.attachments[m.attachCursor]
+	}
+	return nil
+}
+
+// handleAttachmentKeys manages the attachments of the open note while the
+// metadata panel is focused.
+func (m Model) handleAttachmentKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
+	if m.currentNote == nil || m.currentFolderData != nil {
+		return m, nil, false
+	}
+	t := i18n.T()
+
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		if m.attachCursor > 0 {
+			m.attachCursor--
+		}
+		return m, nil, true
+
+	case key.Matches(msg, m.keys.Down):
+		if m.attachCursor < len(m.attachments)-1 {
+			m.attachCursor++
+		}
+		return m, nil, true
+
+	case key.Matches(msg, m.keys.Attach):
+		if m.noteLocked() {
+			return m, nil, true
+		}
+		m.mode = ModeAttachPath
+		m.attachAction = "add"
+		m.textinput.Placeholder = t.AttachPathPlaceholder
+		m.textinput.SetValue("")
+		m.textinput.Focus()
+		return m, nil, true
+
+	case key.Matches(msg, m.keys.Enter):
+		a := m.selectedAttachment()
+		if a == nil {
+			return m, nil, true
+		}
+		dir, _ := os.Getwd()
+		m.mode = ModeAttachPath
+		m.attachAction = "extract"
+		m.textinput.Placeholder = t.AttachPathPlaceholder
+		m.textinput.SetValue(filepath.Join(dir, a.Name))
+		m.textinput.Focus()
+		return m, nil, true
+
+	case key.Matches(msg, m.keys.Delete):
+		a := m.selectedAttachment()
+		if a == nil || m.noteLocked() {
+			return m, nil, true
+		}
+		m.deleteTargetID = a.ID
+		m.deleteTargetType = "attachment"
+		m.deleteTargetTitle = a.Name
+		m.mode = ModeConfirmDelete
+		return m, nil, true
+	}
+
+	return m, nil, false
+}
+
+func (m Model) handleAttachPathKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch {
+	case key.Matches(msg, m.keys.Escape):
+		m.mode = ModeNormal
+		m.attachAction = ""
+		m.textinput.Blur()
+
+	case key.Matches(msg, m.keys.Enter):
+		path := strings.TrimSpace(m.textinput.Value())
+		action := m.attachAction
+		m.mode = ModeNormal
+		m.attachAction = ""
+		m.textinput.Blur()
+		m.textinput.Placeholder = i18n.T().TitlePlaceholder
+		if path == "" || m.currentNote == nil {
+			return m, nil
+		}
+		if action == "add" {
+			return m, m.addAttachment(m.currentNote.ID, path)
+		}
+		if a := m.selectedAttachment(); a != nil {
+			return m, m.extractAttachment(*a, path)
+		}
+
+	default:
+		m.textinput, cmd = m.textinput.Update(msg)
+	}
+
+	return m, cmd
+}
+
+// renderAttachments lists the attachments in the metadata panel.
+func (m Model) renderAttachments() []string {
+	t := i18n.T()
+	lines := []string{"", LabelStyle.Render(t.Attachments)}
+	if len(m.attachments) == 0 {
+		lines = append(lines, MutedStyle.Render("  "+t.None))
+	}
+	width := m.metadataWidth() - 8
+	for i, a := range m.attachments {
+		size := formatBytes(a.Size)
+		name := truncate(a.Name, width-len(size)-3)
+		if m.activePanel == PanelMetadata && i == m.attachCursor {
+			lines = append(lines, SelectedStyle.Render("> "+name)+" "+MutedStyle.Render(size))
+		} else {
+			lines = append(lines, "  "+name+" "+MutedStyle.Render(size))
+		}
+	}
+	if m.activePanel == PanelMetadata {
+		lines = append(lines, MutedStyle.Render("  [a] "+t.AttachAdd+" [Enter] "+t.AttachExtract+" [d] "+t.AttachDelete))
+	}
+	return lines
+}
@@ -0,0 +1,38 @@
+package ui
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/JustZacca/jotaku/internal/db"
+)
+
+// autoBackup takes an automatic backup when the last one is older than the
+// configured interval, then removes the ones rotation no longer keeps.
+func (m Model) autoBackup() tea.Cmd {
+	cfg := db.BackupConfig(m.config.Backup)
+	if !cfg.Enabled || m.encryptor == nil || m.vault == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		dir := cfg.BackupDir(m.config.DBPath)
+		backups, err := db.ListBackups(dir, m.config.BackupProfile())
+		if err != nil {
+			return errMsg(err)
+		}
+		if !cfg.Due(backups, time.Now()) {
+			return nil
+		}
+		salt, err := m.config.GetSalt()
+		if err != nil {
+			return errMsg(err)
+		}
+		if _, err := m.vault.Backup(m.ctx, dir, m.config.BackupProfile(), db.BackupAuto, salt); err != nil {
+			return errMsg(err)
+		}
+		if _, err := db.RotateBackups(dir, m.config.BackupProfile(), cfg); err != nil {
+			return errMsg(err)
+		}
+		return nil
+	}
+}
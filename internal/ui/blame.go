@@ -0,0 +1,147 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/diff"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+// blameLine is one line of the current note with the version that last
+// changed it.
+type blameLine struct {
+	Text    string
+	Version int // Indice in noteVersions, -1 = modifica non ancora salvata
+}
+
+type blameLoadedMsg struct {
+	versions []db.NoteVersion
+	lines    []blameLine
+}
+
+// loadBlame attributes every line of the current note to a stored version by
+// replaying the history oldest first.
+func (m Model) loadBlame() tea.Cmd {
+	note := m.currentNote
+	return func() tea.Msg {
+		versions, err := m.db.GetNoteVersions(m.ctx, note.ID)
+		if err != nil {
+			return errMsg(err)
+		}
+
+		// GetNoteVersions returns newest first
+		oldest := make([]int, len(versions))
+		for i := range oldest {
+			oldest[i] = i
+		}
+		sort.Slice(oldest, func(a, b int) bool {
+			return versions[oldest[a]].VersionNum < versions[oldest[b]].VersionNum
+		})
+
+		texts := make([]string, 0, len(versions)+1)
+		for _, i := range oldest {
+			texts = append(texts, versions[i].Content)
+		}
+		texts = append(texts, note.Content)
+
+		origins := diff.Blame(texts)
+		lines := make([]blameLine, len(origins))
+		for i, text := range strings.Split(note.Content, "\n") {
+			lines[i] = blameLine{Text: text, Version: -1}
+			if origins[i] < len(oldest) {
+				lines[i].Version = oldest[origins[i]]
+			}
+		}
+
+		return blameLoadedMsg{versions: versions, lines: lines}
+	}
+}
+
+func (m Model) handleBlameKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	height := m.listVisibleHeight()
+
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		if m.blameCursor > 0 {
+			m.blameCursor--
+			if m.blameCursor < m.blameOffset {
+				m.blameOffset = m.blameCursor
+			}
+		}
+
+	case key.Matches(msg, m.keys.Down):
+		if m.blameCursor < len(m.blameLines)-1 {
+			m.blameCursor++
+			if m.blameCursor >= m.blameOffset+height {
+				m.blameOffset = m.blameCursor - height + 1
+			}
+		}
+
+	case key.Matches(msg, m.keys.Enter):
+		// Open the version that wrote this line in the history viewer
+		if m.blameCursor >= len(m.blameLines) {
+			return m, nil
+		}
+		version := m.blameLines[m.blameCursor].Version
+		if version < 0 || version >= len(m.noteVersions) {
+			return m, nil
+		}
+		m.mode = ModeHistory
+		m.versionCursor = version
+		m.historyOffset = 0
+		if version >= height {
+			m.historyOffset = version - height + 1
+		}
+		m.diffMode = true
+		m.compareIndex = -1
+		m.hunkCursor = 0
+		m.diffOffset = 0
+
+	case key.Matches(msg, m.keys.Escape), key.Matches(msg, m.keys.GoToList), key.Matches(msg, m.keys.Blame):
+		m.mode = ModeNormal
+		m.blameLines = nil
+	}
+
+	return m, nil
+}
+
+func (m Model) renderBlame() string {
+	t := i18n.T()
+	height := m.listVisibleHeight()
+	width := m.width - 6
+
+	var rows []string
+	for i := m.blameOffset; i < len(m.blameLines) && i < m.blameOffset+height; i++ {
+		line := m.blameLines[i]
+
+		// Only label the first line of each run written by the same version
+		label := ""
+		if i == m.blameOffset || m.blameLines[i-1].Version != line.Version {
+			if line.Version < 0 {
+				label = t.BlameUnsaved
+			} else {
+				label = versionLabel(m.noteVersions[line.Version])
+			}
+		}
+		gutter := MutedStyle.Render(fmt.Sprintf("%-18s", truncate(label, 18)) + " │ ")
+
+		text := clip(line.Text, width-21)
+		if i == m.blameCursor {
+			rows = append(rows, SelectedStyle.Render("> ")+gutter+SelectedStyle.Render(text))
+		} else {
+			rows = append(rows, "  "+gutter+text)
+		}
+	}
+
+	body := PanelStyle.Width(m.width - 2).Height(m.contentHeight()).Render(strings.Join(rows, "\n"))
+	footer := MutedStyle.Render(fmt.Sprintf("%s  [↑/↓] %s  [Enter] %s  [Esc/Ctrl+L] %s",
+		t.BlameTitle, t.HistoryScroll, t.BlameJump, t.HistoryBack))
+
+	return lipgloss.JoinVertical(lipgloss.Left, m.renderHeader(), body, "\n"+footer)
+}
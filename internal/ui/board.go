@@ -0,0 +1,267 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+type boardLoadedMsg struct {
+	board   db.Board
+	columns []db.BoardColumn
+	folder  string
+}
+
+func (m Model) loadBoard(folderID int64) tea.Cmd {
+	return func() tea.Msg {
+		board, err := m.db.GetBoard(m.ctx, folderID)
+		if err != nil {
+			return errMsg(err)
+		}
+		columns, err := m.db.BoardColumns(m.ctx, board)
+		if err != nil {
+			return errMsg(err)
+		}
+		msg := boardLoadedMsg{board: board, columns: columns}
+		if folderID != 0 {
+			if f, err := m.db.GetFolder(m.ctx, folderID); err == nil && f != nil {
+				msg.folder = f.Title
+			}
+		}
+		return msg
+	}
+}
+
+func (m Model) moveCard(card db.BoardCard, tag string) tea.Cmd {
+	board := m.board
+	return func() tea.Msg {
+		if err := m.db.MoveCard(m.ctx, board, card.NoteID, tag); err != nil {
+			return errMsg(err)
+		}
+		return m.loadBoard(board.FolderID)()
+	}
+}
+
+func (m Model) saveBoard(input string) tea.Cmd {
+	folderID := m.board.FolderID
+	return func() tea.Msg {
+		board, err := db.ParseBoard(folderID, input)
+		if err != nil {
+			return errMsg(err)
+		}
+		if err := m.db.SaveBoard(m.ctx, board); err != nil {
+			return errMsg(err)
+		}
+		return m.loadBoard(folderID)()
+	}
+}
+
+// selectedCard returns the card under the cursor, if any.
+func (m Model) selectedCard() *db.BoardCard {
+	if m.boardColumn >= len(m.boardColumns) {
+		return nil
+	}
+	cards := m.boardColumns[m.boardColumn].Cards
+	if m.boardCard >= len(cards) {
+		return nil
+	}
+	return &cards[m.boardCard]
+}
+
+// focusCard puts the cursor back on the card of a note after a reload, as
+// moving a card changes its column.
+func (m Model) focusCard(noteID int64) Model {
+	for i, col := range m.boardColumns {
+		for j, card := range col.Cards {
+			if card.NoteID == noteID {
+				m.boardColumn, m.boardCard = i, j
+				return m
+			}
+		}
+	}
+	return m.clampBoardCursor()
+}
+
+func (m Model) clampBoardCursor() Model {
+	if m.boardColumn >= len(m.boardColumns) {
+		m.boardColumn = len(m.boardColumns) - 1
+	}
+	if m.boardColumn < 0 {
+		m.boardColumn = 0
+		m.boardCard = 0
+		return m
+	}
+	if n := len(m.boardColumns[m.boardColumn].Cards); m.boardCard >= n {
+		m.boardCard = n - 1
+	}
+	if m.boardCard < 0 {
+		m.boardCard = 0
+	}
+	return m
+}
+
+func (m Model) handleBoardKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	t := i18n.T()
+	card := m.selectedCard()
+
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		if m.boardCard > 0 {
+			m.boardCard--
+		}
+
+	case key.Matches(msg, m.keys.Down):
+		if card != nil && m.boardCard < len(m.boardColumns[m.boardColumn].Cards)-1 {
+			m.boardCard++
+		}
+
+	case key.Matches(msg, m.keys.Collapse):
+		if m.boardColumn > 0 {
+			m.boardColumn--
+			m = m.clampBoardCursor()
+		}
+
+	case key.Matches(msg, m.keys.Expand):
+		if m.boardColumn < len(m.boardColumns)-1 {
+			m.boardColumn++
+			m = m.clampBoardCursor()
+		}
+
+	case key.Matches(msg, m.keys.MoveLeft), key.Matches(msg, m.keys.MoveRight):
+		if card == nil {
+			break
+		}
+		if m.board.Kind != db.BoardTags {
+			m.syncStatus = t.BoardReadOnly
+			break
+		}
+		target := m.boardColumn + 1
+		if key.Matches(msg, m.keys.MoveLeft) {
+			target = m.boardColumn - 1
+		}
+		if target < 0 || target >= len(m.boardColumns) {
+			break
+		}
+		m.boardFocus = card.NoteID
+		return m, m.moveCard(*card, m.boardColumns[target].Tag)
+
+	case key.Matches(msg, m.keys.Enter):
+		if card != nil {
+			m.mode = ModeNormal
+			m.activePanel = PanelContent
+			return m, m.loadNote(card.NoteID)
+		}
+
+	case key.Matches(msg, m.keys.EditBoard):
+		m.mode = ModeBoardEdit
+		m.textinput.SetValue(m.board.String())
+		m.textinput.Placeholder = t.BoardPlaceholder
+		m.textinput.CursorEnd()
+		m.textinput.Focus()
+
+	case key.Matches(msg, m.keys.Escape), key.Matches(msg, m.keys.Board):
+		m.mode = ModeNormal
+		m.boardColumns = nil
+		// Moved cards changed tags
+		return m, m.loadNotes()
+	}
+
+	return m, nil
+}
+
+func (m Model) handleBoardEditKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch {
+	case key.Matches(msg, m.keys.Escape):
+		m.mode = ModeBoard
+		m.textinput.Blur()
+		m.textinput.Placeholder = i18n.T().TitlePlaceholder
+
+	case key.Matches(msg, m.keys.Enter):
+		m.mode = ModeBoard
+		m.textinput.Blur()
+		m.textinput.Placeholder = i18n.T().TitlePlaceholder
+		m.boardColumn, m.boardCard = 0, 0
+		return m, m.saveBoard(m.textinput.Value())
+
+	default:
+		m.textinput, cmd = m.textinput.Update(msg)
+	}
+
+	return m, cmd
+}
+
+// boardColumnName is the heading of a column.
+func (m Model) boardColumnName(i int) string {
+	t := i18n.T()
+	if m.board.Kind == db.BoardTasks {
+		return []string{t.BoardTodo, t.BoardDoing, t.BoardDone}[i]
+	}
+	if tag := m.boardColumns[i].Tag; tag != "" {
+		return "#" + tag
+	}
+	return t.BoardNoTag
+}
+
+// renderBoard draws the columns side by side, scrolling the selected one to
+// keep its cursor visible.
+func (m Model) renderBoard() string {
+	t := i18n.T()
+
+	height := m.contentHeight() - 2
+	n := len(m.boardColumns)
+	width := m.width - 2
+	if n > 0 {
+		width = (m.width-2)/n - 1
+	}
+
+	var cols []string
+	for i, col := range m.boardColumns {
+		heading := fmt.Sprintf("%s (%d)", m.boardColumnName(i), len(col.Cards))
+		lines := []string{LabelStyle.Render(truncate(heading, max(width-2, 4))), ""}
+
+		start := 0
+		if i == m.boardColumn && m.boardCard >= height-2 {
+			start = m.boardCard - height + 3
+		}
+		for j := start; j < len(col.Cards) && len(lines) < height; j++ {
+			card := col.Cards[j]
+			text := card.Title
+			if card.Total > 0 {
+				text += fmt.Sprintf(" %d/%d", card.Done, card.Total)
+			}
+			text = truncate(text, max(width-4, 4))
+			if i == m.boardColumn && j == m.boardCard {
+				lines = append(lines, SelectedStyle.Render("> "+text))
+			} else {
+				lines = append(lines, "  "+text)
+			}
+		}
+		if len(col.Cards) == 0 {
+			lines = append(lines, MutedStyle.Render("  —"))
+		}
+
+		style := PanelStyle.Width(width).Height(m.contentHeight())
+		if i == m.boardColumn {
+			style = ActivePanelStyle.Width(width).Height(m.contentHeight())
+		}
+		cols = append(cols, style.Render(strings.Join(lines, "\n")))
+	}
+
+	body := lipgloss.JoinHorizontal(lipgloss.Top, cols...)
+	footer := MutedStyle.Render(fmt.Sprintf("[←/→] %s  [↑/↓] %s  [H/L] %s  [Enter] %s  [e] %s  [Esc] %s",
+		t.BoardColumns, t.HistoryScroll, t.BoardMove, t.GraphOpen, t.BoardEdit, t.HistoryBack))
+
+	title := t.BoardTitle
+	if m.boardFolder != "" {
+		title += " · " + m.boardFolder
+	}
+	header := HeaderStyle.Width(m.width - 2).Render(TitleStyle.Render(title) + "  " + MutedStyle.Render(m.board.String()))
+	return lipgloss.JoinVertical(lipgloss.Left, header, body, "\n"+footer)
+}
@@ -0,0 +1,169 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+type calendarLoadedMsg struct {
+	month time.Time
+	days  map[int]int64
+}
+
+type dailyNoteMsg int64
+
+func (m Model) loadCalendar(month time.Time) tea.Cmd {
+	return func() tea.Msg {
+		days, err := m.db.DailyNoteDays(m.ctx, db.DailyConfig(m.config.Daily), month)
+		if err != nil {
+			return errMsg(err)
+		}
+		return calendarLoadedMsg{month: month, days: days}
+	}
+}
+
+// openDailyNote opens the daily note of day, creating it if needed.
+func (m Model) openDailyNote(day time.Time) tea.Cmd {
+	return func() tea.Msg {
+		id, err := m.db.DailyNote(m.ctx, db.DailyConfig(m.config.Daily), m.config.TemplatesFolder, day)
+		if err != nil {
+			return errMsg(err)
+		}
+		return dailyNoteMsg(id)
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, mo, d := t.Date()
+	return time.Date(y, mo, d, 0, 0, 0, 0, t.Location())
+}
+
+// moveCalendar changes the selected day, reloading the marks when the month
+// changes.
+func (m Model) moveCalendar(day time.Time) (Model, tea.Cmd) {
+	prev := m.calendarDay
+	m.calendarDay = day
+	if day.Year() != prev.Year() || day.Month() != prev.Month() {
+		return m, m.loadCalendar(day)
+	}
+	return m, nil
+}
+
+func (m Model) handleCalendarKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	day := m.calendarDay
+
+	switch {
+	case key.Matches(msg, m.keys.Collapse):
+		return m.moveCalendar(day.AddDate(0, 0, -1))
+
+	case key.Matches(msg, m.keys.Expand):
+		return m.moveCalendar(day.AddDate(0, 0, 1))
+
+	case key.Matches(msg, m.keys.Up):
+		return m.moveCalendar(day.AddDate(0, 0, -7))
+
+	case key.Matches(msg, m.keys.Down):
+		return m.moveCalendar(day.AddDate(0, 0, 7))
+
+	case key.Matches(msg, m.keys.ScrollUp):
+		return m.moveCalendar(day.AddDate(0, -1, 0))
+
+	case key.Matches(msg, m.keys.ScrollDown):
+		return m.moveCalendar(day.AddDate(0, 1, 0))
+
+	case key.Matches(msg, m.keys.Daily):
+		return m.moveCalendar(startOfDay(time.Now()))
+
+	case key.Matches(msg, m.keys.Enter):
+		m.mode = ModeNormal
+		return m, m.openDailyNote(day)
+
+	case key.Matches(msg, m.keys.Escape), key.Matches(msg, m.keys.Calendar):
+		m.mode = ModeNormal
+		m.calendarDays = nil
+	}
+
+	return m, nil
+}
+
+// renderCalendar draws the month of the selected day, marking the days that
+// have a daily note.
+func (m Model) renderCalendar() string {
+	t := i18n.T()
+	day := m.calendarDay
+	today := startOfDay(time.Now())
+
+	months := strings.Split(t.CalendarMonths, ",")
+	title := fmt.Sprintf("%s %d", months[day.Month()-1], day.Year())
+
+	var rows []string
+	rows = append(rows, LabelStyle.Render(title), "")
+
+	var weekdays []string
+	for _, wd := range strings.Split(t.CalendarWeekdays, ",") {
+		weekdays = append(weekdays, fmt.Sprintf("%-3s", wd))
+	}
+	rows = append(rows, MutedStyle.Render(strings.Join(weekdays, " ")))
+
+	first := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	// Weeks start on Monday
+	offset := (int(first.Weekday()) + 6) % 7
+	daysInMonth := first.AddDate(0, 1, -1).Day()
+
+	week := make([]string, offset)
+	for i := range week {
+		week[i] = "   "
+	}
+	for d := 1; d <= daysInMonth; d++ {
+		cell := fmt.Sprintf("%2d", d)
+		if _, ok := m.calendarDays[d]; ok {
+			cell += "•"
+		} else {
+			cell += " "
+		}
+
+		date := time.Date(day.Year(), day.Month(), d, 0, 0, 0, 0, day.Location())
+		switch {
+		case d == day.Day():
+			cell = SelectedStyle.Render(cell)
+		case date.Equal(today):
+			cell = TagStyle.Render(cell)
+		case m.calendarDays[d] != 0:
+			cell = LinkStyle.Render(cell)
+		}
+		week = append(week, cell)
+
+		if len(week) == 7 || d == daysInMonth {
+			rows = append(rows, strings.Join(week, " "))
+			week = nil
+		}
+	}
+
+	rows = append(rows, "")
+	status := t.CalendarNoNote
+	if m.calendarDays[day.Day()] != 0 {
+		status = t.CalendarOpen
+	}
+	rows = append(rows, day.Format(m.dailyFormat())+"  "+MutedStyle.Render(status))
+
+	body := PanelStyle.Width(m.width - 2).Height(m.contentHeight()).Render(strings.Join(rows, "\n"))
+	footer := MutedStyle.Render(fmt.Sprintf("%s  [←/→] %s  [↑/↓] %s  [K/J] %s  [Enter] %s  [D] %s  [Esc] %s",
+		t.CalendarTitle, t.CalendarDay, t.CalendarWeek, t.CalendarMonth, t.GraphOpen, t.CalendarToday, t.HistoryBack))
+
+	header := HeaderStyle.Width(m.width - 2).Render(TitleStyle.Render(t.CalendarTitle))
+	return lipgloss.JoinVertical(lipgloss.Left, header, body, "\n"+footer)
+}
+
+func (m Model) dailyFormat() string {
+	if m.config.Daily.Format != "" {
+		return m.config.Daily.Format
+	}
+	return db.DefaultDailyFormat
+}
@@ -0,0 +1,392 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/diff"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+// diffRows is a rendered diff, one string per screen row. blockRows holds
+// the first row of every change block (line mode only).
+type diffRows struct {
+	rows      []string
+	blockRows []int
+}
+
+// diffCache keeps the rendered diff between frames: View runs after every
+// message, while the diff only changes with the compared texts or the way it
+// is shown.
+type diffCache struct {
+	key  diffKey
+	rows diffRows
+	ok   bool
+}
+
+type diffKey struct {
+	oldID, newID int64    // Versioni confrontate; newID 0 = nota corrente
+	note         *db.Note // Nota corrente, sostituita a ogni ricaricamento
+	words        bool
+	sideBySide   bool
+	width        int
+	hunk         int
+}
+
+func versionLabel(v db.NoteVersion) string {
+	return fmt.Sprintf("#%d %s", v.VersionNum, v.CreatedAt.Local().Format("01-02 15:04"))
+}
+
+// diffSides returns the two texts being compared, oldest first. current is
+// true when the new side is the current note, which allows hunk restore.
+func (m Model) diffSides() (oldText, newText, oldLabel, newLabel string, current bool) {
+	selected := m.noteVersions[m.versionCursor]
+	if m.compareIndex < 0 || m.compareIndex >= len(m.noteVersions) || m.compareIndex == m.versionCursor {
+		content := ""
+		if m.currentNote != nil {
+			content = m.currentNote.Content
+		}
+		return selected.Content, content, versionLabel(selected), i18n.T().HistoryCurrent, true
+	}
+
+	other := m.noteVersions[m.compareIndex]
+	if other.VersionNum < selected.VersionNum {
+		return other.Content, selected.Content, versionLabel(other), versionLabel(selected), false
+	}
+	return selected.Content, other.Content, versionLabel(selected), versionLabel(other), false
+}
+
+// canRestoreHunk reports whether the focused hunk can be copied into the note.
+func (m Model) canRestoreHunk() bool {
+	if m.diffWords || m.noteLocked() || m.currentNote == nil || len(m.noteVersions) == 0 {
+		return false
+	}
+	_, _, _, _, current := m.diffSides()
+	return current
+}
+
+func (m Model) handleDiffKeys(msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	switch {
+	case key.Matches(msg, m.keys.DiffToggle):
+		m.diffMode = !m.diffMode
+		m.diffOffset = 0
+
+	case key.Matches(msg, m.keys.DiffLayout):
+		m.diffSideBySide = !m.diffSideBySide
+		m.diffOffset = 0
+
+	case key.Matches(msg, m.keys.DiffWords):
+		m.diffWords = !m.diffWords
+		m.hunkCursor = 0
+		m.diffOffset = 0
+
+	case key.Matches(msg, m.keys.DiffCompare):
+		// Mark the selected version as the other side, or go back to the note
+		if m.compareIndex == m.versionCursor {
+			m.compareIndex = -1
+		} else {
+			m.compareIndex = m.versionCursor
+		}
+		m.hunkCursor = 0
+		m.diffOffset = 0
+
+	case key.Matches(msg, m.keys.NextHunk), key.Matches(msg, m.keys.PrevHunk):
+		if !m.diffMode || m.diffWords || len(m.noteVersions) == 0 {
+			return m, nil, true
+		}
+		blockRows := m.diffRows(m.historyPanelWidth() - 6).blockRows
+		if len(blockRows) == 0 {
+			return m, nil, true
+		}
+		if key.Matches(msg, m.keys.NextHunk) {
+			m.hunkCursor = (m.hunkCursor + 1) % len(blockRows)
+		} else {
+			m.hunkCursor = (m.hunkCursor + len(blockRows) - 1) % len(blockRows)
+		}
+		m.diffOffset = blockRows[m.hunkCursor] - 3
+		if m.diffOffset < 0 {
+			m.diffOffset = 0
+		}
+
+	case key.Matches(msg, m.keys.ApplyHunk):
+		if !m.diffMode || !m.canRestoreHunk() {
+			return m, nil, true
+		}
+		oldText, newText, _, _, _ := m.diffSides()
+		edits := diff.Lines(oldText, newText)
+		blocks := diff.Blocks(edits)
+		if m.hunkCursor >= len(blocks) {
+			return m, nil, true
+		}
+		content := diff.Revert(edits, blocks[m.hunkCursor])
+		if m.hunkCursor > 0 {
+			m.hunkCursor--
+		}
+		return m, tea.Sequence(m.restoreHunk(content), m.loadNoteVersions(m.currentNote.ID)), true
+
+	case key.Matches(msg, m.keys.ScrollDown):
+		m.diffOffset++
+
+	case key.Matches(msg, m.keys.ScrollUp):
+		if m.diffOffset > 0 {
+			m.diffOffset--
+		}
+
+	default:
+		return m, nil, false
+	}
+
+	return m, nil, true
+}
+
+// restoreHunk saves content, built from the current note with one hunk
+// taken from an older version, as the new note content.
+func (m Model) restoreHunk(content string) tea.Cmd {
+	note := m.currentNote
+	return func() tea.Msg {
+		_ = m.db.SaveNoteVersion(m.ctx, note.ID, note.Title, content, note.Tags)
+
+		stored := content
+		if m.encryptor != nil {
+			encrypted, err := m.encryptor.Encrypt(content)
+			if err != nil {
+				return errMsg(err)
+			}
+			stored = encrypted
+		}
+
+		if err := m.db.UpdateNote(m.ctx, note.ID, note.Title, stored, note.Tags); err != nil {
+			return errMsg(err)
+		}
+		return m.loadNote(note.ID)()
+	}
+}
+
+// diffRows returns the diff between the compared versions for a panel of
+// the given inner width, rendering it again only when its inputs changed.
+func (m Model) diffRows(width int) diffRows {
+	key := diffKey{
+		oldID:      m.noteVersions[m.versionCursor].ID,
+		note:       m.currentNote,
+		words:      m.diffWords,
+		sideBySide: m.diffSideBySide,
+		width:      width,
+		hunk:       m.hunkCursor,
+	}
+	if m.compareIndex >= 0 && m.compareIndex < len(m.noteVersions) && m.compareIndex != m.versionCursor {
+		key.newID = m.noteVersions[m.compareIndex].ID
+		key.note = nil
+	}
+	if m.diffCache == nil {
+		return m.buildDiffRows(width)
+	}
+	if !m.diffCache.ok || m.diffCache.key != key {
+		*m.diffCache = diffCache{key: key, rows: m.buildDiffRows(width), ok: true}
+	}
+	return m.diffCache.rows
+}
+
+// buildDiffRows renders the diff between the compared versions for a panel
+// of the given inner width.
+func (m Model) buildDiffRows(width int) diffRows {
+	oldText, newText, _, _, _ := m.diffSides()
+
+	if m.diffWords {
+		edits := diff.Strings(diff.Words(oldText), diff.Words(newText))
+		if m.diffSideBySide {
+			left := renderWordEdits(edits, diff.Delete)
+			right := renderWordEdits(edits, diff.Insert)
+			return diffRows{rows: zipColumns(left, right, width)}
+		}
+		return diffRows{rows: clipRows(renderWordEdits(edits, -1), width)}
+	}
+
+	edits := diff.Lines(oldText, newText)
+	blocks := diff.Blocks(edits)
+	if m.diffSideBySide {
+		return m.sideBySideLineRows(edits, blocks, width)
+	}
+	return m.unifiedLineRows(edits, blocks, width)
+}
+
+func (m Model) gutter(block int) string {
+	if block >= 0 && block == m.hunkCursor && !m.diffWords {
+		return DiffGutterStyle.Render("┃")
+	}
+	return " "
+}
+
+func (m Model) unifiedLineRows(edits []diff.Edit, blocks []diff.Block, width int) diffRows {
+	var out diffRows
+	block := 0
+	for i, e := range edits {
+		current := -1
+		if block < len(blocks) && i >= blocks[block].Start {
+			if i == blocks[block].Start {
+				out.blockRows = append(out.blockRows, len(out.rows))
+			}
+			if i < blocks[block].End {
+				current = block
+			}
+			if i == blocks[block].End-1 {
+				block++
+			}
+		}
+
+		var line string
+		switch e.Op {
+		case diff.Insert:
+			line = DiffInsertStyle.Render("+ " + e.Text)
+		case diff.Delete:
+			line = DiffDeleteStyle.Render("- " + e.Text)
+		default:
+			line = MutedStyle.Render("  " + e.Text)
+		}
+		out.rows = append(out.rows, m.gutter(current)+clip(line, width-1))
+	}
+	return out
+}
+
+func (m Model) sideBySideLineRows(edits []diff.Edit, blocks []diff.Block, width int) diffRows {
+	var out diffRows
+	colWidth := (width - 3) / 2
+	cell := func(s string, style lipgloss.Style) string {
+		return lipgloss.NewStyle().Width(colWidth).Render(clip(style.Render(s), colWidth))
+	}
+
+	i := 0
+	for b := 0; i < len(edits); {
+		if b < len(blocks) && i == blocks[b].Start {
+			var deleted, inserted []string
+			for _, e := range edits[blocks[b].Start:blocks[b].End] {
+				if e.Op == diff.Delete {
+					deleted = append(deleted, e.Text)
+				} else {
+					inserted = append(inserted, e.Text)
+				}
+			}
+			out.blockRows = append(out.blockRows, len(out.rows))
+			for r := 0; r < len(deleted) || r < len(inserted); r++ {
+				left, right := cell("", MutedStyle), cell("", MutedStyle)
+				if r < len(deleted) {
+					left = cell(deleted[r], DiffDeleteStyle)
+				}
+				if r < len(inserted) {
+					right = cell(inserted[r], DiffInsertStyle)
+				}
+				out.rows = append(out.rows, m.gutter(b)+left+MutedStyle.Render(" │ ")+right)
+			}
+			i = blocks[b].End
+			b++
+			continue
+		}
+
+		text := edits[i].Text
+		out.rows = append(out.rows, " "+cell(text, MutedStyle)+MutedStyle.Render(" │ ")+cell(text, MutedStyle))
+		i++
+	}
+	return out
+}
+
+// renderWordEdits renders a word diff as screen lines. only limits the
+// output to one side (Delete for the old text, Insert for the new text);
+// any other value renders both sides inline.
+func renderWordEdits(edits []diff.Edit, only diff.Op) []string {
+	var b strings.Builder
+	for _, e := range edits {
+		switch {
+		case e.Op == diff.Equal:
+			b.WriteString(e.Text)
+		case only != diff.Insert && e.Op == diff.Delete:
+			if e.Text == "\n" {
+				b.WriteString(DiffWordDeleteStyle.Render("¶"))
+				if only == diff.Delete {
+					b.WriteString("\n")
+				}
+			} else {
+				b.WriteString(DiffWordDeleteStyle.Render(e.Text))
+			}
+		case only != diff.Delete && e.Op == diff.Insert:
+			if e.Text == "\n" {
+				b.WriteString(DiffWordInsertStyle.Render("¶") + "\n")
+			} else {
+				b.WriteString(DiffWordInsertStyle.Render(e.Text))
+			}
+		}
+	}
+	return strings.Split(b.String(), "\n")
+}
+
+func zipColumns(left, right []string, width int) []string {
+	colWidth := (width - 3) / 2
+	var rows []string
+	for r := 0; r < len(left) || r < len(right); r++ {
+		var l, rt string
+		if r < len(left) {
+			l = left[r]
+		}
+		if r < len(right) {
+			rt = right[r]
+		}
+		l = lipgloss.NewStyle().Width(colWidth).Render(clip(l, colWidth))
+		rt = lipgloss.NewStyle().Width(colWidth).Render(clip(rt, colWidth))
+		rows = append(rows, " "+l+MutedStyle.Render(" │ ")+rt)
+	}
+	return rows
+}
+
+func clipRows(rows []string, width int) []string {
+	for i := range rows {
+		rows[i] = " " + clip(rows[i], width-1)
+	}
+	return rows
+}
+
+// clip cuts a styled line to width cells without breaking escape sequences.
+func clip(s string, width int) string {
+	if width < 1 {
+		return ""
+	}
+	return lipgloss.NewStyle().MaxWidth(width).Render(s)
+}
+
+// renderDiffPanel draws the diff between the compared versions.
+func (m Model) renderDiffPanel(width int) string {
+	t := i18n.T()
+	_, _, oldLabel, newLabel, _ := m.diffSides()
+
+	inner := width - 6
+	d := m.diffRows(inner)
+
+	title := LabelStyle.Render(oldLabel) + MutedStyle.Render(" → ") + LabelStyle.Render(newLabel)
+	if len(d.blockRows) > 0 {
+		title += MutedStyle.Render(fmt.Sprintf("  %s %d/%d", t.HistoryHunk, m.hunkCursor+1, len(d.blockRows)))
+	}
+	height := m.listVisibleHeight() - 2
+	if height < 1 {
+		height = 1
+	}
+
+	rows := []string{title, ""}
+	changed := len(d.blockRows) > 0 || m.diffWords
+	if !changed {
+		rows = append(rows, MutedStyle.Render(t.HistoryNoChanges))
+	} else {
+		offset := m.diffOffset
+		if offset > len(d.rows)-1 {
+			offset = len(d.rows) - 1
+		}
+		if offset < 0 {
+			offset = 0
+		}
+		for i := offset; i < len(d.rows) && i < offset+height; i++ {
+			rows = append(rows, d.rows[i])
+		}
+	}
+
+	return PanelStyle.Width(width).Height(m.contentHeight()).Render(strings.Join(rows, "\n"))
+}
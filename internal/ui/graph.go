@@ -0,0 +1,285 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+const (
+	defaultGraphDepth = 2
+	maxGraphDepth     = 5
+)
+
+// graphRow is one line of the graph explorer: a node of the breadth-first
+// tree grown from the centre, with the edge that reached it.
+type graphRow struct {
+	Node     db.GraphNode
+	Prefix   string // Rami dell'albero (├─, └─, │)
+	Kind     string
+	Outgoing bool
+	Mutual   bool // Link in entrambe le direzioni
+}
+
+type graphLoadedMsg *db.Graph
+
+func (m Model) loadGraph() tea.Cmd {
+	return func() tea.Msg {
+		g, err := m.db.VaultGraph(m.ctx)
+		if err != nil {
+			return errMsg(err)
+		}
+		return graphLoadedMsg(g)
+	}
+}
+
+// graphStart picks the node the explorer opens on: the open note, else the
+// selected folder.
+func (m Model) graphStart() string {
+	if m.currentNote != nil {
+		return db.NoteKey(m.currentNote.ID)
+	}
+	if m.currentFolderData != nil {
+		return db.FolderKey(m.currentFolderData.ID)
+	}
+	if selected := m.currentSelectedItem(); selected != nil {
+		if selected.Type == "folder" {
+			return db.FolderKey(selected.ID)
+		}
+		return db.NoteKey(selected.ID)
+	}
+	return ""
+}
+
+// buildGraphRows lays out the neighbourhood of center as a tree. Every node
+// appears once, under the neighbour that first reached it.
+func buildGraphRows(g *db.Graph, center string, depth int) []graphRow {
+	root, ok := g.Node(center)
+	if !ok {
+		return nil
+	}
+
+	// Breadth-first, so each node hangs at its shortest distance
+	parent := map[string]string{center: ""}
+	dist := map[string]int{center: 0}
+	queue := []string{center}
+	for len(queue) > 0 {
+		k := queue[0]
+		queue = queue[1:]
+		if dist[k] >= depth {
+			continue
+		}
+		for _, n := range g.Neighbors(k) {
+			if _, seen := dist[n.Node.Key]; !seen {
+				dist[n.Node.Key] = dist[k] + 1
+				parent[n.Node.Key] = k
+				queue = append(queue, n.Node.Key)
+			}
+		}
+	}
+
+	rows := []graphRow{{Node: root}}
+	var walk func(key, indent string)
+	walk = func(key, indent string) {
+		// Notes linking each other show up once
+		var children []graphRow
+		seen := make(map[string]int)
+		for _, n := range g.Neighbors(key) {
+			if parent[n.Node.Key] != key {
+				continue
+			}
+			if i, ok := seen[n.Node.Key]; ok {
+				children[i].Mutual = true
+				continue
+			}
+			seen[n.Node.Key] = len(children)
+			children = append(children, graphRow{Node: n.Node, Kind: n.Kind, Outgoing: n.Outgoing})
+		}
+		for i, child := range children {
+			branch, next := "├─ ", "│  "
+			if i == len(children)-1 {
+				branch, next = "└─ ", "   "
+			}
+			child.Prefix = indent + branch
+			rows = append(rows, child)
+			walk(child.Node.Key, indent+next)
+		}
+	}
+	walk(center, "")
+	return rows
+}
+
+// recenterGraph moves the explorer to key, remembering the previous centre.
+func (m Model) recenterGraph(key string) Model {
+	if m.graphCenter != "" && m.graphCenter != key {
+		m.graphTrail = append(m.graphTrail, m.graphCenter)
+	}
+	m.graphCenter = key
+	m.graphCursor = 0
+	m.graphOffset = 0
+	m.graphRows = buildGraphRows(m.graph, key, m.graphDepth)
+	return m
+}
+
+func (m Model) handleGraphKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	height := m.listVisibleHeight()
+
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		if m.graphCursor > 0 {
+			m.graphCursor--
+			if m.graphCursor < m.graphOffset {
+				m.graphOffset = m.graphCursor
+			}
+		}
+
+	case key.Matches(msg, m.keys.Down):
+		if m.graphCursor < len(m.graphRows)-1 {
+			m.graphCursor++
+			if m.graphCursor >= m.graphOffset+height {
+				m.graphOffset = m.graphCursor - height + 1
+			}
+		}
+
+	case key.Matches(msg, m.keys.Expand):
+		if m.graphCursor > 0 && m.graphCursor < len(m.graphRows) {
+			m = m.recenterGraph(m.graphRows[m.graphCursor].Node.Key)
+		}
+
+	case key.Matches(msg, m.keys.Collapse):
+		if n := len(m.graphTrail); n > 0 {
+			prev := m.graphTrail[n-1]
+			m.graphTrail = m.graphTrail[:n-1]
+			m.graphCenter = ""
+			m = m.recenterGraph(prev)
+		}
+
+	case key.Matches(msg, m.keys.Deeper), key.Matches(msg, m.keys.Shallower):
+		if key.Matches(msg, m.keys.Deeper) && m.graphDepth < maxGraphDepth {
+			m.graphDepth++
+		} else if key.Matches(msg, m.keys.Shallower) && m.graphDepth > 1 {
+			m.graphDepth--
+		}
+		m.graphRows = buildGraphRows(m.graph, m.graphCenter, m.graphDepth)
+		if m.graphCursor >= len(m.graphRows) {
+			m.graphCursor = 0
+			m.graphOffset = 0
+		}
+
+	case key.Matches(msg, m.keys.Enter):
+		// Open the node: notes in the editor, folders in the list, tags as a filter
+		if m.graphCursor >= len(m.graphRows) {
+			return m, nil
+		}
+		node := m.graphRows[m.graphCursor].Node
+		m.mode = ModeNormal
+		m.graph = nil
+		m.graphRows = nil
+		switch node.Type {
+		case db.GraphNote:
+			m.activePanel = PanelContent
+			return m, m.loadNote(node.ID)
+		case db.GraphFolder:
+			m.activePanel = PanelList
+			m.searchQuery = ""
+			m.searchTags = nil
+			m.treeMode = false
+			m.currentFolder = node.ID
+			m.currentNote = nil
+			m.cursor = 0
+			m.listOffset = 0
+			return m, m.loadNotes()
+		case db.GraphTag:
+			m.activePanel = PanelList
+			m.searchQuery = ""
+			m.searchTags = []string{node.Label}
+			m.searchFilter = db.SearchFilter{}
+			m.leaveTreeForSearch()
+			m.cursor = 0
+			m.listOffset = 0
+			return m, m.searchNotes()
+		}
+
+	case key.Matches(msg, m.keys.Escape), key.Matches(msg, m.keys.GoToList), key.Matches(msg, m.keys.Graph):
+		m.mode = ModeNormal
+		m.graph = nil
+		m.graphRows = nil
+	}
+
+	return m, nil
+}
+
+// graphNodeLabel renders a node with a marker for its type.
+func graphNodeLabel(n db.GraphNode) string {
+	switch n.Type {
+	case db.GraphFolder:
+		return FolderIcon + " " + n.Label
+	case db.GraphTag:
+		return TagStyle.Render("#" + n.Label)
+	}
+	return NoteIcon + " " + n.Label
+}
+
+// graphRelation describes the edge that leads to a row, seen from its parent.
+func graphRelation(r graphRow) string {
+	t := i18n.T()
+	switch r.Kind {
+	case db.EdgeLink:
+		if r.Mutual {
+			return "↔"
+		}
+		if r.Outgoing {
+			return "→"
+		}
+		return "←"
+	case db.EdgeParent:
+		if r.Outgoing {
+			return t.GraphParent
+		}
+		return t.GraphChild
+	}
+	return ""
+}
+
+func (m Model) renderGraph() string {
+	t := i18n.T()
+	height := m.listVisibleHeight()
+	width := m.width - 8
+
+	var rows []string
+	if len(m.graphRows) == 0 {
+		rows = append(rows, MutedStyle.Render(t.GraphEmpty))
+	}
+	for i := m.graphOffset; i < len(m.graphRows) && i < m.graphOffset+height; i++ {
+		r := m.graphRows[i]
+		relation := graphRelation(r)
+		if relation != "" {
+			relation = MutedStyle.Render(" " + relation)
+		}
+		label := graphNodeLabel(db.GraphNode{Type: r.Node.Type, Label: truncate(r.Node.Label, width-len([]rune(r.Prefix))-4)})
+		line := MutedStyle.Render(r.Prefix) + label + relation
+		if i == 0 {
+			line = TitleStyle.Render(r.Node.Label)
+			if r.Node.Type == db.GraphTag {
+				line = TitleStyle.Render("#" + r.Node.Label)
+			}
+		}
+		if i == m.graphCursor {
+			rows = append(rows, SelectedStyle.Render("> ")+line)
+		} else {
+			rows = append(rows, "  "+line)
+		}
+	}
+
+	body := PanelStyle.Width(m.width - 2).Height(m.contentHeight()).Render(strings.Join(rows, "\n"))
+	footer := MutedStyle.Render(fmt.Sprintf("%s  %s  [↑/↓] %s  [Enter] %s  [→/l] %s  [←/h] %s  [+/-] %s  [Esc] %s",
+		t.GraphTitle, fmt.Sprintf(t.GraphDepth, m.graphDepth), t.HistoryScroll, t.GraphOpen, t.GraphRecenter, t.GraphBack, t.GraphDepthKeys, t.HistoryBack))
+
+	header := HeaderStyle.Width(m.width - 2).Render(TitleStyle.Render(t.GraphTitle))
+	return lipgloss.JoinVertical(lipgloss.Left, header, body, "\n"+footer)
+}
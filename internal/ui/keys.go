@@ -26,10 +26,58 @@ type KeyMap struct {
 	GoToList     key.Binding
 	Sync         key.Binding
 	History      key.Binding
+	Blame        key.Binding
+	TagBrowser   key.Binding
+	Rename       key.Binding
+	Merge        key.Binding
+	Attach       key.Binding
+	Graph        key.Binding
+	Daily        key.Binding
+	Calendar     key.Binding
+	Reminder     key.Binding
+	Agenda       key.Binding
+	Done         key.Binding
+	Tasks        key.Binding
+	FilterStatus key.Binding
+	FilterDue    key.Binding
+	FilterFolder key.Binding
+	FilterTag    key.Binding
+	Board        key.Binding
+	MoveLeft     key.Binding
+	MoveRight    key.Binding
+	EditBoard    key.Binding
+	Properties   key.Binding
+	AddProperty  key.Binding
+	Table        key.Binding
+	SortColumn   key.Binding
+	TableFilter  key.Binding
+	Pin          key.Binding
+	SortMode     key.Binding
+	SortReverse  key.Binding
+	MoveUp       key.Binding
+	MoveDown     key.Binding
+	Archive      key.Binding
+	ShowArchived key.Binding
+	LockNote     key.Binding
+	Profiles     key.Binding
+	Deeper       key.Binding
+	Shallower    key.Binding
 	EditTags     key.Binding
 	SetPassword  key.Binding
 	ParentFolder key.Binding
 	Copy         key.Binding
+	TreeView     key.Binding
+	Expand       key.Binding
+	Collapse     key.Binding
+	DiffToggle   key.Binding
+	DiffLayout   key.Binding
+	DiffWords    key.Binding
+	DiffCompare  key.Binding
+	NextHunk     key.Binding
+	PrevHunk     key.Binding
+	ApplyHunk    key.Binding
+	ScrollUp     key.Binding
+	ScrollDown   key.Binding
 }
 
 func NewKeyMap() KeyMap {
@@ -115,6 +163,150 @@ func NewKeyMap() KeyMap {
 			key.WithKeys("h"),
 			key.WithHelp("h", t.KeyHistory),
 		),
+		Blame: key.NewBinding(
+			key.WithKeys("b"),
+			key.WithHelp("b", t.KeyBlame),
+		),
+		TagBrowser: key.NewBinding(
+			key.WithKeys("T"),
+			key.WithHelp("T", t.KeyTagBrowser),
+		),
+		Rename: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", t.KeyRename),
+		),
+		Merge: key.NewBinding(
+			key.WithKeys("m"),
+			key.WithHelp("m", t.TagMerge),
+		),
+		Attach: key.NewBinding(
+			key.WithKeys("a"),
+			key.WithHelp("a", t.AttachAdd),
+		),
+		Graph: key.NewBinding(
+			key.WithKeys("G"),
+			key.WithHelp("G", t.KeyGraph),
+		),
+		Daily: key.NewBinding(
+			key.WithKeys("D"),
+			key.WithHelp("D", t.KeyDaily),
+		),
+		Calendar: key.NewBinding(
+			key.WithKeys("C"),
+			key.WithHelp("C", t.KeyCalendar),
+		),
+		Reminder: key.NewBinding(
+			key.WithKeys("R"),
+			key.WithHelp("R", t.KeyReminder),
+		),
+		Agenda: key.NewBinding(
+			key.WithKeys("A"),
+			key.WithHelp("A", t.KeyAgenda),
+		),
+		Done: key.NewBinding(
+			key.WithKeys("x"),
+			key.WithHelp("x", t.ReminderDone),
+		),
+		Tasks: key.NewBinding(
+			key.WithKeys("X"),
+			key.WithHelp("X", t.KeyTasks),
+		),
+		FilterStatus: key.NewBinding(
+			key.WithKeys("s"),
+			key.WithHelp("s", t.TaskFilterStatus),
+		),
+		FilterDue: key.NewBinding(
+			key.WithKeys("u"),
+			key.WithHelp("u", t.TaskFilterDue),
+		),
+		FilterFolder: key.NewBinding(
+			key.WithKeys("f"),
+			key.WithHelp("f", t.TaskFilterFolder),
+		),
+		FilterTag: key.NewBinding(
+			key.WithKeys("#"),
+			key.WithHelp("#", t.TaskFilterTag),
+		),
+		Board: key.NewBinding(
+			key.WithKeys("B"),
+			key.WithHelp("B", t.KeyBoard),
+		),
+		MoveLeft: key.NewBinding(
+			key.WithKeys("H", "shift+left"),
+			key.WithHelp("H", t.BoardMove),
+		),
+		MoveRight: key.NewBinding(
+			key.WithKeys("L", "shift+right"),
+			key.WithHelp("L", t.BoardMove),
+		),
+		EditBoard: key.NewBinding(
+			key.WithKeys("e"),
+			key.WithHelp("e", t.BoardEdit),
+		),
+		Properties: key.NewBinding(
+			key.WithKeys("P"),
+			key.WithHelp("P", t.KeyProperties),
+		),
+		AddProperty: key.NewBinding(
+			key.WithKeys("n"),
+			key.WithHelp("n", t.PropertyAdd),
+		),
+		Table: key.NewBinding(
+			key.WithKeys("V"),
+			key.WithHelp("V", t.KeyTable),
+		),
+		SortColumn: key.NewBinding(
+			key.WithKeys("s"),
+			key.WithHelp("s", t.TableSort),
+		),
+		TableFilter: key.NewBinding(
+			key.WithKeys("/"),
+			key.WithHelp("/", t.TableFilter),
+		),
+		Pin: key.NewBinding(
+			key.WithKeys("*"),
+			key.WithHelp("*", t.KeyPin),
+		),
+		SortMode: key.NewBinding(
+			key.WithKeys("o"),
+			key.WithHelp("o", t.KeySort),
+		),
+		SortReverse: key.NewBinding(
+			key.WithKeys("O"),
+			key.WithHelp("O", t.KeySort),
+		),
+		MoveUp: key.NewBinding(
+			key.WithKeys("K", "shift+up"),
+			key.WithHelp("K", t.KeyMove),
+		),
+		MoveDown: key.NewBinding(
+			key.WithKeys("J", "shift+down"),
+			key.WithHelp("J", t.KeyMove),
+		),
+		Archive: key.NewBinding(
+			key.WithKeys("z"),
+			key.WithHelp("z", t.KeyArchive),
+		),
+		ShowArchived: key.NewBinding(
+			key.WithKeys("Z"),
+			key.WithHelp("Z", t.KeyShowArchived),
+		),
+		LockNote: key.NewBinding(
+			key.WithKeys("w"),
+			key.WithHelp("w", t.KeyLockNote),
+		),
+		Profiles: key.NewBinding(
+			key.WithKeys("ctrl+p"),
+			key.WithHelp("Ctrl+P", t.KeyProfiles),
+		),
+		Deeper: key.NewBinding(
+			key.WithKeys("+", "="),
+			key.WithHelp("+", t.GraphDepthKeys),
+		),
+		Shallower: key.NewBinding(
+			key.WithKeys("-"),
+			key.WithHelp("-", t.GraphDepthKeys),
+		),
 		EditTags: key.NewBinding(
 			key.WithKeys("t"),
 			key.WithHelp("t", t.KeyTags),
@@ -131,6 +323,55 @@ func NewKeyMap() KeyMap {
 			key.WithKeys("c"),
 			key.WithHelp("c", t.KeyCopy),
 		),
+		TreeView: key.NewBinding(
+			key.WithKeys("ctrl+t"),
+			key.WithHelp("Ctrl+T", t.KeyTreeView),
+		),
+		Expand: key.NewBinding(
+			key.WithKeys("right", "l"),
+			key.WithHelp("→/l", t.KeyExpand),
+		),
+		Collapse: key.NewBinding(
+			// h only reaches it in the tree list: elsewhere it opens the history
+			key.WithKeys("left", "h"),
+			key.WithHelp("←/h", t.KeyCollapse),
+		),
+		DiffToggle: key.NewBinding(
+			key.WithKeys("d"),
+			key.WithHelp("d", t.HistoryDiff),
+		),
+		DiffLayout: key.NewBinding(
+			key.WithKeys("s"),
+			key.WithHelp("s", t.HistoryLayout),
+		),
+		DiffWords: key.NewBinding(
+			key.WithKeys("w"),
+			key.WithHelp("w", t.HistoryWords),
+		),
+		DiffCompare: key.NewBinding(
+			key.WithKeys("m"),
+			key.WithHelp("m", t.HistoryCompare),
+		),
+		NextHunk: key.NewBinding(
+			key.WithKeys("n"),
+			key.WithHelp("n", t.HistoryHunk),
+		),
+		PrevHunk: key.NewBinding(
+			key.WithKeys("N"),
+			key.WithHelp("N", t.HistoryHunk),
+		),
+		ApplyHunk: key.NewBinding(
+			key.WithKeys("a"),
+			key.WithHelp("a", t.HistoryApplyHunk),
+		),
+		ScrollUp: key.NewBinding(
+			key.WithKeys("K", "pgup"),
+			key.WithHelp("K/PgUp", t.HistoryScroll),
+		),
+		ScrollDown: key.NewBinding(
+			key.WithKeys("J", "pgdown"),
+			key.WithHelp("J/PgDn", t.HistoryScroll),
+		),
 	}
 }
 
@@ -142,7 +383,8 @@ func (k KeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{k.Up, k.Down, k.Enter, k.Edit, k.Escape},
 		{k.New, k.NewFolder, k.Delete, k.Save, k.Search},
-		{k.History, k.EditTags, k.SetPassword, k.Sync, k.Copy},
+		{k.History, k.Blame, k.EditTags, k.TagBrowser, k.SetPassword, k.Sync, k.Copy},
+		{k.TreeView, k.Expand, k.Collapse},
 		{k.Export, k.Import, k.Help, k.Quit},
 	}
 }
@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+type backlinksLoadedMsg struct {
+	noteID int64
+	notes  []db.NoteListItem
+}
+
+type noteRenamedMsg struct {
+	id    int64
+	links int
+}
+
+func (m Model) loadBacklinks(id int64) tea.Cmd {
+	return func() tea.Msg {
+		notes, err := m.db.GetBacklinks(m.ctx, id)
+		if err != nil {
+			return errMsg(err)
+		}
+		return backlinksLoadedMsg{noteID: id, notes: notes}
+	}
+}
+
+// currentLinks returns the wiki links of the note shown in the content panel.
+func (m Model) currentLinks() []db.Link {
+	if m.currentNote == nil || m.currentReadOnly {
+		return nil
+	}
+	return db.ParseLinks(m.currentNote.Content)
+}
+
+// followLink opens the note a link points to.
+func (m Model) followLink(l db.Link) tea.Cmd {
+	return func() tea.Msg {
+		id, err := m.db.ResolveLink(m.ctx, l)
+		if err != nil {
+			return errMsg(err)
+		}
+		if id == 0 {
+			return errMsg(fmt.Errorf(i18n.T().LinkBroken, l.Target))
+		}
+		return m.loadNote(id)()
+	}
+}
+
+// handleLinkKeys moves between and follows links while the content panel
+// is focused.
+func (m Model) handleLinkKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
+	links := m.currentLinks()
+	if len(links) == 0 {
+		return m, nil, false
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		if m.linkCursor > 0 {
+			m.linkCursor--
+		}
+		return m, nil, true
+
+	case key.Matches(msg, m.keys.Down):
+		if m.linkCursor < len(links)-1 {
+			m.linkCursor++
+		}
+		return m, nil, true
+
+	case key.Matches(msg, m.keys.Enter):
+		if m.linkCursor < len(links) {
+			return m, m.followLink(links[m.linkCursor]), true
+		}
+	}
+
+	return m, nil, false
+}
+
+// renderLinks highlights the wiki links in content; the focused one is shown
+// selected when the content panel is active.
+func (m Model) renderLinks(content string) string {
+	links := db.ParseLinks(content)
+	if len(links) == 0 {
+		return content
+	}
+
+	var b strings.Builder
+	last := 0
+	for i, l := range links {
+		b.WriteString(content[last:l.Start])
+		style := LinkStyle
+		if m.activePanel == PanelContent && i == m.linkCursor {
+			style = SelectedLinkStyle
+		}
+		b.WriteString(style.Render(l.Label))
+		last = l.End
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
+
+func (m Model) renameNote(id int64, title string) tea.Cmd {
+	return func() tea.Msg {
+		count, err := m.db.RenameNote(m.ctx, id, title)
+		if err != nil {
+			return errMsg(err)
+		}
+		return noteRenamedMsg{id: id, links: count}
+	}
+}
+
+func (m Model) handleRenameKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch {
+	case key.Matches(msg, m.keys.Escape):
+		m.mode = ModeNormal
+		m.textinput.Blur()
+
+	case key.Matches(msg, m.keys.Enter):
+		title := strings.TrimSpace(m.textinput.Value())
+		m.mode = ModeNormal
+		m.textinput.Blur()
+		if title != "" && m.currentNote != nil && title != m.currentNote.Title {
+			return m, m.renameNote(m.currentNote.ID, title)
+		}
+
+	default:
+		m.textinput, cmd = m.textinput.Update(msg)
+	}
+
+	return m, cmd
+}
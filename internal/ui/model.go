@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -45,6 +46,32 @@ const (
 	ModeEditTags
 	ModeSetPassword
 	ModeNewChoice
+	ModeBlame
+	ModeTags
+	ModeRename
+	ModeGraph
+	ModeAttachPath
+	ModeTemplates
+	ModeTemplatePrompt
+	ModeCalendar
+	ModeReminderTarget
+	ModeReminderTime
+	ModeAgenda
+	ModeTasks
+	ModeTaskTag
+	ModeBoard
+	ModeBoardEdit
+	ModeProperties
+	ModePropertyInput
+	ModeTable
+	ModeTableFilter
+	ModeProfiles
+)
+
+// How often the background jobs run while Jotaku is open
+const (
+	compactInterval     = time.Hour
+	backupCheckInterval = 10 * time.Minute
 )
 
 type Panel int
@@ -55,8 +82,35 @@ const (
 	PanelMetadata
 )
 
+// Store is the vault the interface works on. *db.DB satisfies it; the tests
+// use a db.MemoryStore.
+type Store interface {
+	db.NoteStore
+	db.FolderStore
+	db.VersionStore
+	db.FileStore
+	db.LinkStore
+	db.TagStore
+	db.PropertyStore
+	db.ReminderStore
+	db.TaskStore
+	db.BoardStore
+	db.TemplateStore
+	db.DailyStore
+}
+
+// Vault is what the interface does with the database file as a whole:
+// snapshots and backups. *db.DB satisfies it; it is nil in the tests.
+type Vault interface {
+	HasSnapshot(ctx context.Context, reason string) (bool, error)
+	CreateSnapshot(ctx context.Context, name, reason string) (*db.Snapshot, error)
+	Backup(ctx context.Context, dir, profile, reason string, salt []byte) (*db.BackupInfo, error)
+}
+
 type Model struct {
-	db        *db.DB
+	ctx       context.Context // Contesto delle operazioni sul database
+	db        Store
+	vault     Vault // Snapshot e backup, nil nei test
 	encryptor *crypto.Encryptor
 	config    *config.Config
 	apiClient *api.Client
@@ -73,8 +127,10 @@ type Model struct {
 	textarea  textarea.Model
 	textinput textinput.Model
 
-	searchQuery string
-	searchTags  []string
+	searchQuery  string
+	searchTags   []string
+	searchFilter db.SearchFilter
+	showArchived bool // Mostra anche le note archiviate nella lista
 
 	width  int
 	height int
@@ -90,13 +146,110 @@ type Model struct {
 	syncStatus    string
 	uploadBytes   int64
 	downloadBytes int64
-	tickCount     int // Counter for periodic sync (every 5 minutes = 100 ticks of 3 seconds)
+	tickCount     int       // Counter for periodic sync (every 5 minutes = 100 ticks of 3 seconds)
+	lastCompact   time.Time // Ultima compattazione dello storico
+	lastBackup    time.Time // Ultimo controllo del backup automatico
 
 	// History state
 	noteVersions  []db.NoteVersion
 	versionCursor int
 	historyOffset int
 
+	// Diff viewer state (history mode)
+	diffMode       bool
+	diffSideBySide bool
+	diffWords      bool
+	compareIndex   int // -1 = nota corrente, altrimenti indice in noteVersions
+	hunkCursor     int
+	diffOffset     int
+	diffCache      *diffCache // Diff già calcolato, condiviso tra le copie del modello
+
+	// Blame state
+	blameLines  []blameLine
+	blameCursor int
+	blameOffset int
+
+	// Links state
+	linkCursor int // Link selezionato nel pannello contenuto
+	backlinks  []db.NoteListItem
+
+	// Attachments of the open note (metadata panel)
+	attachments  []db.Attachment
+	attachCursor int
+	attachAction string // "add" o "extract" mentre si digita il percorso
+
+	// Template state (new note from template)
+	templates       []db.Template
+	templateCursor  int // 0 = nota vuota, poi i template
+	template        *db.Template
+	templatePrompts []string
+	templateValues  map[string]string
+	promptIndex     int
+
+	// Calendar state (daily notes)
+	calendarDay  time.Time
+	calendarDays map[int]int64 // Giorni del mese con una nota giornaliera
+
+	// Reminders state
+	reminders      []db.Reminder // In attesa, controllati a ogni tick
+	alerts         []db.Reminder // Promemoria scattati da mostrare
+	reminderItems  []db.ChecklistItem
+	reminderCursor int    // 0 = nota intera, poi le voci aperte
+	reminderItem   string // Voce scelta, vuota = nota intera
+	agenda         []db.Reminder
+	agendaCursor   int
+	agendaOffset   int
+
+	// Task list state
+	tasks      []db.Task
+	taskCursor int
+	taskOffset int
+	taskFilter db.TaskFilter
+	taskFolder string // Titolo della cartella filtrata
+
+	// Board state
+	board        db.Board
+	boardColumns []db.BoardColumn
+	boardFolder  string
+	boardColumn  int
+	boardCard    int
+	boardFocus   int64 // Nota da riselezionare dopo lo spostamento
+
+	// Properties and table view state
+	properties      []db.Property
+	propCursor      int
+	propAction      string // "new" o "edit" mentre si digita
+	propNote        int64  // Nota a cui si riferiscono le proprietà caricate
+	table           *db.PropertyTable
+	tableFolder     int64
+	tableFolderName string
+	tableCursor     int
+	tableOffset     int
+	tableColumn     int    // 0 = titolo, poi le proprietà
+	tableSort       string // Proprietà di ordinamento, vuota = titolo
+	tableDesc       bool
+	tableFilter     string
+
+	// Graph explorer state
+	graph       *db.Graph
+	graphCenter string
+	graphDepth  int
+	graphRows   []graphRow
+	graphCursor int
+	graphOffset int
+	graphTrail  []string // Centri precedenti, per tornare indietro
+
+	// Profile switcher state
+	profiles      []string
+	profileCursor int
+	switchProfile string // Profilo da aprire dopo l'uscita, vuoto = esci
+
+	// Tag browser state
+	tagList   []db.TagCount
+	tagCursor int
+	tagOffset int
+	tagAction string // "rename" o "merge" mentre si digita il nuovo nome
+
 	// Folder/Password state
 	currentFolder      int64      // 0 = root
 	currentFolderData  *db.Folder // Metadata della cartella selezionata
@@ -107,9 +260,18 @@ type Model struct {
 	passwordTargetType string // "note" o "folder"
 	newChoice          int    // 0 = note, 1 = folder (per ModeNewChoice)
 
+	// Tree view state
+	treeMode     bool
+	treeSearched bool // Vista ad albero attiva prima della ricerca, da ripristinare
+	tree         []*treeNode
+	treeRows     []*treeNode // Righe visibili, in ordine di visualizzazione
+	treeExpanded map[int64]bool
+	treeCursor   int
+	treeOffset   int
+
 	// Delete state
 	deleteTargetID    int64  // ID dell'elemento da eliminare
-	deleteTargetType  string // "note" o "folder"
+	deleteTargetType  string // "note", "folder" o "attachment"
 	deleteTargetTitle string // Titolo dell'elemento da eliminare
 
 	err error
@@ -133,7 +295,11 @@ type versionsLoadedMsg []db.NoteVersion
 type onlineCheckMsg bool
 type folderLoadedMsg *db.Folder
 
-func NewModel(database *db.DB, enc *crypto.Encryptor, cfg *config.Config) Model {
+func NewModel(ctx context.Context, database *db.DB, enc *crypto.Encryptor, cfg *config.Config) Model {
+	return newModel(ctx, database, database, enc, cfg)
+}
+
+func newModel(ctx context.Context, store Store, vault Vault, enc *crypto.Encryptor, cfg *config.Config) Model {
 	t := i18n.T()
 
 	ti := textinput.New()
@@ -158,7 +324,9 @@ func NewModel(database *db.DB, enc *crypto.Encryptor, cfg *config.Config) Model
 	}
 
 	m := Model{
-		db:            database,
+		ctx:           ctx,
+		db:            store,
+		vault:         vault,
 		encryptor:     enc,
 		config:        cfg,
 		apiClient:     client,
@@ -168,6 +336,13 @@ func NewModel(database *db.DB, enc *crypto.Encryptor, cfg *config.Config) Model
 		passwordInput: pi,
 		activePanel:   PanelList,
 		currentFolder: 0,
+		compareIndex:  -1,
+		diffCache:     &diffCache{},
+		treeMode:      cfg.TreeView,
+		treeExpanded:  make(map[int64]bool),
+		// Init runs both right away
+		lastCompact: time.Now(),
+		lastBackup:  time.Now(),
 	}
 
 	return m
@@ -177,6 +352,13 @@ func (m Model) Init() tea.Cmd {
 	cmds := []tea.Cmd{
 		m.loadNotes(),
 		m.tickCmd(),
+		m.compactHistory(),
+		m.autoBackup(),
+		m.loadReminders(),
+	}
+
+	if m.treeMode {
+		cmds = append(cmds, m.loadTree())
 	}
 
 	if m.apiClient != nil {
@@ -196,21 +378,38 @@ func (m Model) tickCmd() tea.Cmd {
 	})
 }
 
+// saveConfig writes the configuration in the background. It writes a copy,
+// so settings changed in the meantime do not race with the write.
+func (m Model) saveConfig() tea.Cmd {
+	cfg := *m.config
+	return func() tea.Msg {
+		if err := cfg.Save(config.DefaultConfigPath()); err != nil {
+			return errMsg(err)
+		}
+		return nil
+	}
+}
+
 func (m Model) loadNotes() tea.Cmd {
 	return func() tea.Msg {
 		var notes []db.NoteListItem
 		var err error
 
 		// Load notes only for current folder level
-		if m.currentFolder == 0 {
+		if m.showArchived {
+			notes, err = m.db.ListNotesWithArchived(m.ctx, m.currentFolder)
+			if err != nil {
+				return errMsg(err)
+			}
+		} else if m.currentFolder == 0 {
 			// Root level: load only notes without parent_folder_id
-			notes, err = m.db.ListNotes()
+			notes, err = m.db.ListNotes(m.ctx)
 			if err != nil {
 				return errMsg(err)
 			}
 		} else {
 			// Inside folder: load notes for this folder
-			notes, err = m.db.ListNotesInFolder(m.currentFolder)
+			notes, err = m.db.ListNotesInFolder(m.ctx, m.currentFolder)
 			if err != nil {
 				return errMsg(err)
 			}
@@ -222,28 +421,29 @@ func (m Model) loadNotes() tea.Cmd {
 		}
 
 		// Load folders for current folder
-		folders, err := m.db.ListFolders(m.currentFolder)
+		folders, err := m.db.ListFolders(m.ctx, m.currentFolder)
 		if err != nil {
 			return errMsg(err)
 		}
 
 		// Add folders to notes list with D- prefix
+		var folderItems []db.NoteListItem
 		for _, f := range folders {
 			folderItem := db.NoteListItem{
 				ID:    f.ID,
 				Title: "D- " + f.Title,
 				Type:  "folder",
 			}
-			notes = append(notes, folderItem)
+			folderItems = append(folderItems, folderItem)
 		}
 
-		return notesLoadedMsg(notes)
+		return notesLoadedMsg(arrangeItems(folderItems, notes))
 	}
 }
 
 func (m Model) loadNote(id int64) tea.Cmd {
 	return func() tea.Msg {
-		note, err := m.db.GetNote(id)
+		note, err := m.db.GetNote(m.ctx, id)
 		if err != nil {
 			return errMsg(err)
 		}
@@ -263,7 +463,7 @@ func (m Model) loadNote(id int64) tea.Cmd {
 
 func (m Model) loadNoteVersions(id int64) tea.Cmd {
 	return func() tea.Msg {
-		versions, err := m.db.GetNoteVersions(id)
+		versions, err := m.db.GetNoteVersions(m.ctx, id)
 		if err != nil {
 			return errMsg(err)
 		}
@@ -273,7 +473,7 @@ func (m Model) loadNoteVersions(id int64) tea.Cmd {
 
 func (m Model) loadFolder(id int64) tea.Cmd {
 	return func() tea.Msg {
-		folder, err := m.db.GetFolder(id)
+		folder, err := m.db.GetFolder(m.ctx, id)
 		if err != nil {
 			return errMsg(err)
 		}
@@ -281,6 +481,16 @@ func (m Model) loadFolder(id int64) tea.Cmd {
 	}
 }
 
+// compactHistory thins out old note versions according to the retention policy.
+func (m Model) compactHistory() tea.Cmd {
+	return func() tea.Msg {
+		if _, err := m.db.CompactNoteVersions(m.ctx, db.RetentionPolicy(m.config.History)); err != nil {
+			return errMsg(err)
+		}
+		return nil
+	}
+}
+
 func (m Model) checkOnline() tea.Cmd {
 	return func() tea.Msg {
 		if m.apiClient == nil {
@@ -297,7 +507,21 @@ func (m Model) doSync() tea.Cmd {
 			return syncResultMsg{success: false, message: i18n.T().Offline}
 		}
 
-		result, err := api.Sync(m.db, m.apiClient, m.config.Server.LastSync)
+		// The first sync may overwrite local notes with server copies. LastSync
+		// stays 0 until a sync succeeds, so a failing one must not snapshot again
+		if m.config.Server.LastSync == 0 && m.vault != nil {
+			taken, err := m.vault.HasSnapshot(m.ctx, db.SnapshotSync)
+			if err != nil {
+				return syncResultMsg{success: false, message: err.Error()}
+			}
+			if !taken {
+				if _, err := m.vault.CreateSnapshot(m.ctx, "", db.SnapshotSync); err != nil {
+					return syncResultMsg{success: false, message: err.Error()}
+				}
+			}
+		}
+
+		result, err := api.Sync(m.ctx, m.db, m.apiClient, m.config.Server.LastSync)
 		if err != nil {
 			return syncResultMsg{success: false, message: err.Error()}
 		}
@@ -325,6 +549,18 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.dirty && m.mode == ModeEditing {
 			cmds = append(cmds, m.saveCurrentNote())
 		}
+		var remind tea.Cmd
+		if m, remind = m.checkReminders(time.Time(msg)); remind != nil {
+			cmds = append(cmds, remind)
+		}
+		if time.Since(m.lastCompact) >= compactInterval {
+			m.lastCompact = time.Now()
+			cmds = append(cmds, m.compactHistory())
+		}
+		if time.Since(m.lastBackup) >= backupCheckInterval {
+			m.lastBackup = time.Now()
+			cmds = append(cmds, m.autoBackup())
+		}
 		// Check connection status periodically
 		if m.apiClient != nil {
 			cmds = append(cmds, m.checkOnline())
@@ -338,7 +574,30 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		cmds = append(cmds, m.tickCmd())
 
 	case notesLoadedMsg:
+		// Keep the cursor on the open note or folder when the order changed
+		var previous *db.NoteListItem
+		if m.cursor < len(m.notes) {
+			item := m.notes[m.cursor]
+			if (item.Type != "folder" && m.currentNote != nil && m.currentNote.ID == item.ID) ||
+				(item.Type == "folder" && m.currentFolderData != nil && m.currentFolderData.ID == item.ID) {
+				previous = &item
+			}
+		}
 		m.notes = msg
+		if previous != nil {
+			for i, n := range m.notes {
+				if n.ID == previous.ID && (n.Type == "folder") == (previous.Type == "folder") {
+					m.cursor = i
+					break
+				}
+			}
+			if m.cursor < m.listOffset {
+				m.listOffset = m.cursor
+			}
+			if listHeight := m.listVisibleHeight(); m.cursor >= m.listOffset+listHeight {
+				m.listOffset = m.cursor - listHeight + 1
+			}
+		}
 		// Reset cursor if out of bounds
 		if m.cursor >= len(m.notes) {
 			m.cursor = 0
@@ -351,15 +610,207 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				cmds = append(cmds, m.loadNote(selected.ID))
 			}
 		}
+		if m.treeMode {
+			cmds = append(cmds, m.loadTree())
+		}
+
+	case treeLoadedMsg:
+		previous := m.selectedTreeNode()
+		m.tree = msg
+		m.refreshTreeRows()
+		if previous != nil {
+			for i, row := range m.treeRows {
+				if row.ID == previous.ID && row.Type == previous.Type {
+					m.treeCursor = i
+					m.clampTreeOffset()
+					break
+				}
+			}
+		}
+
+	case noteStateChangedMsg:
+		if m.currentNote != nil && m.currentNote.ID == msg.id {
+			cmds = append(cmds, m.loadNote(msg.id))
+		}
+		m.syncStatus = msg.status
+		cmds = append(cmds, m.loadNotes())
+
+	case sortChangedMsg:
+		m.syncStatus = sortLabel(db.FolderSort(msg))
+		cmds = append(cmds, m.loadNotes())
+
+	case treeChildrenLoadedMsg:
+		if node := findTreeNode(m.tree, msg.parentID); node != nil {
+			node.Children = msg.children
+			node.Loaded = true
+		}
+		m.refreshTreeRows()
 
 	case noteLoadedMsg:
 		m.currentNote = msg.note
 		m.currentReadOnly = msg.readOnly
 		m.currentFolderData = nil // Clear folder data when loading note
+		m.linkCursor = 0
+		m.backlinks = nil
+		m.attachments = nil
+		m.attachCursor = 0
+		if msg.note == nil || m.properties == nil || m.propNote != msg.note.ID {
+			m.properties = nil
+			m.propCursor = 0
+		}
 		if msg.note != nil {
 			m.textarea.SetValue(msg.note.Content)
+			cmds = append(cmds, m.loadBacklinks(msg.note.ID), m.loadAttachments(msg.note.ID),
+				m.loadProperties(msg.note.ID))
+		}
+
+	case propertiesLoadedMsg:
+		if m.currentNote != nil && m.currentNote.ID == msg.noteID {
+			m.properties = msg.properties
+			m.propNote = msg.noteID
+			if m.propCursor >= len(m.properties) {
+				m.propCursor = len(m.properties) - 1
+			}
+			if m.propCursor < 0 {
+				m.propCursor = 0
+			}
+		}
+
+	case propertySavedMsg:
+		// The front matter may have changed with the property
+		if m.currentNote != nil && m.currentNote.ID == int64(msg) {
+			cmds = append(cmds, m.loadNote(m.currentNote.ID))
 		}
 
+	case tableLoadedMsg:
+		m.table = msg.table
+		m.tableFolderName = msg.folder
+		if m.tableColumn > len(m.table.Columns) {
+			m.tableColumn = len(m.table.Columns)
+		}
+		if m.tableCursor >= len(m.table.Rows) {
+			m.tableCursor = len(m.table.Rows) - 1
+		}
+		if m.tableCursor < 0 {
+			m.tableCursor = 0
+		}
+		if m.mode != ModeTableFilter {
+			m.mode = ModeTable
+		}
+
+	case attachmentsLoadedMsg:
+		if m.currentNote != nil && m.currentNote.ID == msg.noteID {
+			m.attachments = msg.attachments
+			if m.attachCursor >= len(m.attachments) {
+				m.attachCursor = len(m.attachments) - 1
+			}
+			if m.attachCursor < 0 {
+				m.attachCursor = 0
+			}
+		}
+
+	case attachmentSavedMsg:
+		m.syncStatus = string(msg)
+		if m.currentNote != nil {
+			cmds = append(cmds, m.loadAttachments(m.currentNote.ID))
+		}
+
+	case backlinksLoadedMsg:
+		if m.currentNote != nil && m.currentNote.ID == msg.noteID {
+			m.backlinks = msg.notes
+		}
+
+	case noteRenamedMsg:
+		m.syncStatus = fmt.Sprintf(i18n.T().NoteRenamed, msg.links)
+		cmds = append(cmds, m.loadNotes(), m.loadNote(msg.id))
+
+	case templatesLoadedMsg:
+		m.templates = msg
+		m.templateCursor = 0
+		if len(m.templates) == 0 {
+			m = m.startNewNote()
+		} else {
+			m.mode = ModeTemplates
+		}
+
+	case templateNoteCreatedMsg:
+		m = m.resetTemplate()
+		if msg.note.ParentFolder != m.currentFolder {
+			m.syncStatus = fmt.Sprintf(i18n.T().TemplateCreatedIn, msg.note.Title)
+		}
+		cmds = append(cmds, m.loadNotes(), m.loadNote(msg.note.ID))
+
+	case remindersLoadedMsg:
+		// Keep reminders already queued as alerts from firing twice
+		fired := make(map[int64]bool)
+		for _, r := range m.reminders {
+			if r.Fired {
+				fired[r.ID] = true
+			}
+		}
+		m.reminders = msg
+		for i := range m.reminders {
+			if fired[m.reminders[i].ID] {
+				m.reminders[i].Fired = true
+			}
+		}
+
+	case reminderSavedMsg:
+		m.syncStatus = string(msg)
+		cmds = append(cmds, m.loadReminders())
+
+	case agendaLoadedMsg:
+		m.agenda = msg
+		if m.agendaCursor >= len(m.agenda) {
+			m.agendaCursor = len(m.agenda) - 1
+		}
+		if m.agendaCursor < 0 {
+			m.agendaCursor = 0
+		}
+		m.mode = ModeAgenda
+
+	case tasksLoadedMsg:
+		m.tasks = msg
+		if m.taskCursor >= len(m.tasks) {
+			m.taskCursor = len(m.tasks) - 1
+		}
+		if m.taskCursor < 0 {
+			m.taskCursor = 0
+		}
+		if m.mode != ModeTaskTag {
+			m.mode = ModeTasks
+		}
+
+	case boardLoadedMsg:
+		m.board = msg.board
+		m.boardColumns = msg.columns
+		m.boardFolder = msg.folder
+		if m.boardFocus != 0 {
+			m = m.focusCard(m.boardFocus)
+			m.boardFocus = 0
+		} else {
+			m = m.clampBoardCursor()
+		}
+		if m.mode != ModeBoardEdit {
+			m.mode = ModeBoard
+		}
+
+	case taskToggledMsg:
+		// Item reminders follow their checkbox
+		cmds = append(cmds, m.loadTasks(), m.loadReminders())
+		if m.currentNote != nil && m.currentNote.ID == int64(msg) {
+			cmds = append(cmds, m.loadNote(m.currentNote.ID))
+		}
+
+	case calendarLoadedMsg:
+		if msg.month.Year() == m.calendarDay.Year() && msg.month.Month() == m.calendarDay.Month() {
+			m.calendarDays = msg.days
+		}
+
+	case dailyNoteMsg:
+		m.activePanel = PanelContent
+		cmds = append(cmds, m.loadNotes(), m.loadNote(int64(msg)))
+
 	case folderLoadedMsg:
 		m.currentFolderData = msg
 		m.currentNote = nil // Clear note when viewing folder
@@ -374,8 +825,55 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case onlineCheckMsg:
 		m.online = bool(msg)
 
+	case tagsLoadedMsg:
+		m.tagList = msg
+		if m.tagCursor >= len(m.tagList) {
+			m.tagCursor = len(m.tagList) - 1
+		}
+		if m.tagCursor < 0 {
+			m.tagCursor = 0
+		}
+
+	case tagsRenamedMsg:
+		m.syncStatus = fmt.Sprintf(i18n.T().TagsUpdated, int(msg))
+		cmds = append(cmds, m.loadTags(), m.loadNotes())
+		if m.currentNote != nil {
+			cmds = append(cmds, m.loadNote(m.currentNote.ID))
+		}
+
+	case graphLoadedMsg:
+		m.graph = msg
+		m.graphCenter = ""
+		m.graphTrail = nil
+		m = m.recenterGraph(m.graphStart())
+		m.mode = ModeGraph
+
+	case blameLoadedMsg:
+		m.noteVersions = msg.versions
+		m.blameLines = msg.lines
+		m.blameCursor = 0
+		m.blameOffset = 0
+		m.mode = ModeBlame
+
 	case versionsLoadedMsg:
+		// Keep the same version selected when the list is reloaded
+		var selectedID int64
+		if m.versionCursor < len(m.noteVersions) {
+			selectedID = m.noteVersions[m.versionCursor].ID
+		}
 		m.noteVersions = msg
+		for i, v := range m.noteVersions {
+			if v.ID == selectedID {
+				if m.compareIndex >= 0 {
+					m.compareIndex += i - m.versionCursor
+				}
+				m.versionCursor = i
+				break
+			}
+		}
+		if m.versionCursor >= len(m.noteVersions) {
+			m.versionCursor = 0
+		}
 
 	case syncResultMsg:
 		m.syncing = false
@@ -384,8 +882,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.downloadBytes = msg.downloadBytes
 		if msg.success {
 			m.config.Server.LastSync = time.Now().Unix()
-			m.config.Save(config.DefaultConfigPath())
-			cmds = append(cmds, m.loadNotes())
+			cmds = append(cmds, m.saveConfig(), m.loadNotes())
 		}
 
 	case tea.KeyMsg:
@@ -416,6 +913,69 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.mode == ModeHistory {
 			return m.handleHistoryKeys(msg)
 		}
+		if m.mode == ModeBlame {
+			return m.handleBlameKeys(msg)
+		}
+		if m.mode == ModeTags {
+			return m.handleTagKeys(msg)
+		}
+		if m.mode == ModeRename {
+			return m.handleRenameKeys(msg)
+		}
+		if m.mode == ModeGraph {
+			return m.handleGraphKeys(msg)
+		}
+		if m.mode == ModeAttachPath {
+			return m.handleAttachPathKeys(msg)
+		}
+		if m.mode == ModeTemplates {
+			return m.handleTemplateKeys(msg)
+		}
+		if m.mode == ModeCalendar {
+			return m.handleCalendarKeys(msg)
+		}
+		if m.mode == ModeReminderTarget {
+			return m.handleReminderTargetKeys(msg)
+		}
+		if m.mode == ModeReminderTime {
+			return m.handleReminderTimeKeys(msg)
+		}
+		if m.mode == ModeAgenda {
+			return m.handleAgendaKeys(msg)
+		}
+		if m.mode == ModeTasks {
+			return m.handleTaskKeys(msg)
+		}
+		if m.mode == ModeTaskTag {
+			return m.handleTaskTagKeys(msg)
+		}
+		if m.mode == ModeBoard {
+			return m.handleBoardKeys(msg)
+		}
+		if m.mode == ModeBoardEdit {
+			return m.handleBoardEditKeys(msg)
+		}
+		if m.mode == ModeProperties {
+			return m.handlePropertyKeys(msg)
+		}
+		if m.mode == ModePropertyInput {
+			return m.handlePropertyInputKeys(msg)
+		}
+		if m.mode == ModeTable {
+			return m.handleTableKeys(msg)
+		}
+		if m.mode == ModeTableFilter {
+			return m.handleTableFilterKeys(msg)
+		}
+		if m.mode == ModeProfiles {
+			return m.handleProfileKeys(msg)
+		}
+		if len(m.alerts) > 0 && m.mode == ModeNormal {
+			return m.handleAlertKeys(msg)
+		}
+		if m.mode == ModeTemplatePrompt {
+			return m.handleTemplatePromptKeys(msg)
+		}
 		return m.handleNormalKeys(msg)
 	}
 
@@ -423,6 +983,19 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m Model) currentSelectedItem() *db.NoteListItem {
+	if m.treeMode {
+		node := m.selectedTreeNode()
+		if node == nil {
+			return nil
+		}
+		return &db.NoteListItem{
+			ID:         node.ID,
+			Title:      node.Title,
+			SyncStatus: node.SyncStatus,
+			Type:       node.Type,
+			Locked:     node.Locked,
+		}
+	}
 	if len(m.notes) > m.cursor && m.cursor >= 0 {
 		return &m.notes[m.cursor]
 	}
@@ -432,10 +1005,48 @@ func (m Model) currentSelectedItem() *db.NoteListItem {
 func (m Model) handleNormalKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	t := i18n.T()
 
+	// In tree mode the list panel handles its own navigation (j/k/h/l), so
+	// there h collapses instead of opening the history
+	if m.treeMode && m.activePanel == PanelList {
+		if updated, cmd, handled := m.handleTreeKeys(msg); handled {
+			return updated, cmd
+		}
+	}
+
+	// The content panel moves between and follows wiki links
+	if m.activePanel == PanelContent {
+		if updated, cmd, handled := m.handleLinkKeys(msg); handled {
+			return updated, cmd
+		}
+	}
+
+	// Pinning, sort modes and manual ordering apply to the list
+	if m.activePanel == PanelList {
+		if updated, cmd, handled := m.handleOrderKeys(msg); handled {
+			return updated, cmd
+		}
+	}
+
+	// The metadata panel manages attachments
+	if m.activePanel == PanelMetadata {
+		if updated, cmd, handled := m.handleAttachmentKeys(msg); handled {
+			return updated, cmd
+		}
+	}
+
 	switch {
 	case key.Matches(msg, m.keys.Quit):
 		return m, tea.Quit
 
+	case key.Matches(msg, m.keys.TreeView):
+		m.treeMode = !m.treeMode
+		m.treeSearched = false
+		m.config.TreeView = m.treeMode
+		if m.treeMode {
+			return m, tea.Batch(m.saveConfig(), m.loadTree())
+		}
+		return m, tea.Batch(m.saveConfig(), m.loadNotes())
+
 	case key.Matches(msg, m.keys.Help):
 		m.mode = ModeHelp
 
@@ -494,17 +1105,17 @@ func (m Model) handleNormalKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case key.Matches(msg, m.keys.Edit):
 		// Only allow edit if currentNote is not a folder
 		selected := m.currentSelectedItem()
-		if m.currentNote != nil && !m.currentReadOnly && selected != nil && selected.Type != "folder" {
+		if m.currentNote != nil && !m.noteLocked() && selected != nil && selected.Type != "folder" {
 			m.mode = ModeEditing
 			m.textarea.Focus()
+		} else if m.currentNote != nil && m.currentNote.ReadOnly {
+			m.syncStatus = t.NoteLockedHint
 		}
 
 	case key.Matches(msg, m.keys.New):
-		m.mode = ModeNewNote
-		m.textinput.SetValue("")
-		m.textinput.Placeholder = "Titolo nota..."
-		m.textinput.Focus()
-		m.currentItemType = "note"
+		// With templates available a picker is shown first
+		m = m.resetTemplate()
+		return m, m.loadTemplates()
 
 	case key.Matches(msg, m.keys.NewFolder):
 		m.mode = ModeNewNote
@@ -529,9 +1140,40 @@ func (m Model) handleNormalKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+	case key.Matches(msg, m.keys.Archive):
+		selected := m.currentSelectedItem()
+		if m.currentNote != nil && selected != nil && selected.Type != "folder" {
+			return m, m.setNoteArchived(m.currentNote.ID, !m.currentNote.Archived)
+		}
+
+	case key.Matches(msg, m.keys.LockNote):
+		selected := m.currentSelectedItem()
+		if m.currentNote != nil && !m.currentReadOnly && selected != nil && selected.Type != "folder" {
+			return m, m.setNoteReadOnly(m.currentNote.ID, !m.currentNote.ReadOnly)
+		}
+
+	case key.Matches(msg, m.keys.Profiles):
+		return m.startProfilePicker(), nil
+
+	case key.Matches(msg, m.keys.ShowArchived):
+		m.showArchived = !m.showArchived
+		if m.showArchived {
+			m.syncStatus = t.ArchivedShown
+		} else {
+			m.syncStatus = t.ArchivedHidden
+		}
+		return m, m.loadNotes()
+
 	case key.Matches(msg, m.keys.Search):
 		m.mode = ModeSearch
-		m.textinput.SetValue(m.searchQuery)
+		search := m.searchQuery
+		for _, tag := range m.searchTags {
+			search = strings.TrimSpace(search + " #" + tag)
+		}
+		for _, token := range searchFilterTokens(m.searchFilter) {
+			search = strings.TrimSpace(search + " " + token)
+		}
+		m.textinput.SetValue(search)
 		m.textinput.Placeholder = t.Search + "..."
 		m.textinput.Focus()
 
@@ -557,13 +1199,87 @@ func (m Model) handleNormalKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if m.currentNote != nil && selected != nil && selected.Type != "folder" {
 			m.mode = ModeHistory
 			m.versionCursor = 0
+			m.noteVersions = nil
+			m.diffMode = true
+			m.compareIndex = -1
+			m.hunkCursor = 0
+			m.diffOffset = 0
 			return m, m.loadNoteVersions(m.currentNote.ID)
 		}
 
+	case key.Matches(msg, m.keys.Rename):
+		selected := m.currentSelectedItem()
+		if m.currentNote != nil && !m.noteLocked() && selected != nil && selected.Type != "folder" {
+			m.mode = ModeRename
+			m.textinput.Placeholder = t.TitlePlaceholder
+			m.textinput.SetValue(m.currentNote.Title)
+			m.textinput.Focus()
+		}
+
+	case key.Matches(msg, m.keys.Graph):
+		m.graphDepth = defaultGraphDepth
+		return m, m.loadGraph()
+
+	case key.Matches(msg, m.keys.Reminder):
+		selected := m.currentSelectedItem()
+		if m.currentNote != nil && !m.currentReadOnly && selected != nil && selected.Type != "folder" {
+			return m.startReminder(), nil
+		}
+
+	case key.Matches(msg, m.keys.Agenda):
+		m.agendaCursor = 0
+		m.agendaOffset = 0
+		return m, m.loadAgenda()
+
+	case key.Matches(msg, m.keys.Properties):
+		selected := m.currentSelectedItem()
+		if m.currentNote != nil && selected != nil && selected.Type != "folder" {
+			m.mode = ModeProperties
+		}
+
+	case key.Matches(msg, m.keys.Table):
+		m.tableFolder = m.currentFolder
+		m.tableCursor, m.tableOffset, m.tableColumn = 0, 0, 0
+		m.tableSort, m.tableDesc, m.tableFilter = "", false, ""
+		return m, m.loadTable(m.tableFolder)
+
+	case key.Matches(msg, m.keys.Board):
+		m.boardColumn = 0
+		m.boardCard = 0
+		return m, m.loadBoard(m.currentFolder)
+
+	case key.Matches(msg, m.keys.Tasks):
+		m.taskCursor = 0
+		m.taskOffset = 0
+		return m, m.loadTasks()
+
+	case key.Matches(msg, m.keys.Daily):
+		return m, m.openDailyNote(startOfDay(time.Now()))
+
+	case key.Matches(msg, m.keys.Calendar):
+		m.mode = ModeCalendar
+		m.calendarDay = startOfDay(time.Now())
+		m.calendarDays = nil
+		return m, m.loadCalendar(m.calendarDay)
+
+	case key.Matches(msg, m.keys.TagBrowser):
+		m.mode = ModeTags
+		m.tagAction = ""
+		m.tagOffset = 0
+		return m, m.loadTags()
+
+	case key.Matches(msg, m.keys.Blame):
+		selected := m.currentSelectedItem()
+		if m.currentNote != nil && selected != nil && selected.Type != "folder" {
+			return m, m.loadBlame()
+		}
+
 	case key.Matches(msg, m.keys.EditTags):
 		// Only allow edit tags if not a folder
 		selected := m.currentSelectedItem()
-		if m.currentNote != nil && selected != nil && selected.Type != "folder" {
+		if m.currentNote != nil && m.noteLocked() {
+			m.syncStatus = t.NoteLockedHint
+		} else if m.currentNote != nil && selected != nil && selected.Type != "folder" {
 			m.mode = ModeEditTags
 			// Prepend # to each tag for display
 			tagsStr := ""
@@ -651,13 +1367,17 @@ func (m Model) handleSearchKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case key.Matches(msg, m.keys.Escape):
 		m.mode = ModeNormal
 		m.textinput.Blur()
-		m.searchQuery = ""
-		return m, m.loadNotes()
+		return m, m.endSearch()
 
 	case key.Matches(msg, m.keys.Enter):
 		m.mode = ModeNormal
-		m.searchQuery = m.textinput.Value()
 		m.textinput.Blur()
+		query, tags, filter := parseSearch(m.textinput.Value())
+		if query == "" && len(tags) == 0 && filter == (db.SearchFilter{}) {
+			return m, m.endSearch()
+		}
+		m.searchQuery, m.searchTags, m.searchFilter = query, tags, filter
+		m.leaveTreeForSearch()
 		return m, m.searchNotes()
 
 	default:
@@ -676,6 +1396,7 @@ func (m Model) handleNewNoteKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.textinput.Blur()
 		m.textinput.Placeholder = "Titolo..."
 		m.currentItemType = ""
+		m = m.resetTemplate()
 
 	case key.Matches(msg, m.keys.Enter):
 		title := m.textinput.Value()
@@ -687,6 +1408,8 @@ func (m Model) handleNewNoteKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			if m.currentItemType == "folder" {
 				m.currentItemType = ""
 				return m, m.createFolder(title)
+			} else if m.template != nil {
+				return m, m.createNoteFromTemplate(title)
 			} else {
 				return m, m.createNote(title)
 			}
@@ -748,6 +1471,9 @@ func (m Model) handleConfirmDeleteKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if m.deleteTargetType == "folder" {
 			return m, m.deleteCurrentFolder()
 		}
+		if m.deleteTargetType == "attachment" {
+			return m, m.deleteAttachment()
+		}
 		return m, m.deleteCurrentNote()
 	case "n", "N", "esc":
 		m.mode = ModeNormal
@@ -759,9 +1485,15 @@ func (m Model) handleConfirmDeleteKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func (m Model) handleHistoryKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if updated, cmd, handled := m.handleDiffKeys(msg); handled {
+		return updated, cmd
+	}
+
 	switch {
 	case key.Matches(msg, m.keys.Up):
 		if m.versionCursor > 0 {
+			m.hunkCursor = 0
+			m.diffOffset = 0
 			m.versionCursor--
 			if m.versionCursor < m.historyOffset {
 				m.historyOffset = m.versionCursor
@@ -769,6 +1501,8 @@ func (m Model) handleHistoryKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 	case key.Matches(msg, m.keys.Down):
 		if m.versionCursor < len(m.noteVersions)-1 {
+			m.hunkCursor = 0
+			m.diffOffset = 0
 			m.versionCursor++
 			listHeight := m.listVisibleHeight()
 			if m.versionCursor >= m.historyOffset+listHeight {
@@ -793,7 +1527,7 @@ func (m Model) handleHistoryKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 func (m Model) restoreNoteVersion(noteID, versionID int64) tea.Cmd {
 	return func() tea.Msg {
-		if err := m.db.RestoreNoteVersion(noteID, versionID); err != nil {
+		if err := m.db.RestoreNoteVersion(m.ctx, noteID, versionID); err != nil {
 			return errMsg(err)
 		}
 		m.mode = ModeNormal
@@ -803,7 +1537,8 @@ func (m Model) restoreNoteVersion(noteID, versionID int64) tea.Cmd {
 
 func (m Model) saveCurrentNote() tea.Cmd {
 	return func() tea.Msg {
-		if m.currentNote == nil {
+		// Locked notes are never saved, autosave included
+		if m.currentNote == nil || m.currentNote.ReadOnly {
 			return nil
 		}
 
@@ -812,7 +1547,7 @@ func (m Model) saveCurrentNote() tea.Cmd {
 		plaintext := m.textarea.Value()
 
 		// Save a version only if content actually changed (hash check is inside SaveNoteVersion).
-		_ = m.db.SaveNoteVersion(m.currentNote.ID, m.currentNote.Title, plaintext, m.currentNote.Tags)
+		_ = m.db.SaveNoteVersion(m.ctx, m.currentNote.ID, m.currentNote.Title, plaintext, m.currentNote.Tags)
 
 		// Encrypt for storage if needed.
 		content := plaintext
@@ -824,7 +1559,7 @@ func (m Model) saveCurrentNote() tea.Cmd {
 			content = encrypted
 		}
 
-		err := m.db.UpdateNote(m.currentNote.ID, m.currentNote.Title, content, m.currentNote.Tags)
+		err := m.db.UpdateNote(m.ctx, m.currentNote.ID, m.currentNote.Title, content, m.currentNote.Tags)
 		if err != nil {
 			return errMsg(err)
 		}
@@ -851,7 +1586,7 @@ func (m Model) createNote(title string) tea.Cmd {
 			content = encrypted
 		}
 
-		_, err := m.db.CreateNoteInFolder(title, content, []string{}, m.currentFolder)
+		_, err := m.db.CreateNoteInFolder(m.ctx, title, content, []string{}, m.currentFolder)
 		if err != nil {
 			return errMsg(err)
 		}
@@ -863,7 +1598,7 @@ func (m Model) createNote(title string) tea.Cmd {
 
 func (m Model) createFolder(title string) tea.Cmd {
 	return func() tea.Msg {
-		_, err := m.db.CreateFolder(title, m.currentFolder)
+		_, err := m.db.CreateFolder(m.ctx, title, m.currentFolder)
 		if err != nil {
 			return errMsg(err)
 		}
@@ -889,8 +1624,8 @@ func (m Model) saveTags(tagsStr string) tea.Cmd {
 			}
 		}
 
-		// Update note with new tags
-		err := m.db.UpdateNote(m.currentNote.ID, m.currentNote.Title, m.currentNote.Content, tags)
+		// Only the tags change: the loaded content is decrypted and must not be written back
+		err := m.db.SetNoteTags(m.ctx, m.currentNote.ID, tags)
 		if err != nil {
 			return errMsg(err)
 		}
@@ -902,13 +1637,18 @@ func (m Model) saveTags(tagsStr string) tea.Cmd {
 
 func (m Model) setPassword(password string) tea.Cmd {
 	return func() tea.Msg {
-		var err error
+		if m.vault != nil {
+			if _, err := m.vault.CreateSnapshot(m.ctx, "", db.SnapshotNotePassword); err != nil {
+				return errMsg(err)
+			}
+		}
 
+		var err error
 		switch m.passwordTargetType {
 		case "note":
-			err = m.db.SetNotePassword(m.passwordTarget, password)
+			err = m.db.SetNotePassword(m.ctx, m.passwordTarget, password)
 		case "folder":
-			err = m.db.SetFolderPassword(m.passwordTarget, password)
+			err = m.db.SetFolderPassword(m.ctx, m.passwordTarget, password)
 		}
 
 		if err != nil {
@@ -929,7 +1669,7 @@ func (m Model) deleteCurrentNote() tea.Cmd {
 			return nil
 		}
 
-		err := m.db.DeleteNote(m.deleteTargetID)
+		err := m.db.DeleteNote(m.ctx, m.deleteTargetID)
 		if err != nil {
 			return errMsg(err)
 		}
@@ -944,7 +1684,7 @@ func (m Model) deleteCurrentFolder() tea.Cmd {
 			return nil
 		}
 
-		err := m.db.DeleteFolder(m.deleteTargetID)
+		err := m.db.DeleteFolder(m.ctx, m.deleteTargetID)
 		if err != nil {
 			return errMsg(err)
 		}
@@ -953,9 +1693,32 @@ func (m Model) deleteCurrentFolder() tea.Cmd {
 	}
 }
 
+// leaveTreeForSearch shows search results as a flat list, remembering
+// whether the tree was on so that endSearch can bring it back.
+func (m *Model) leaveTreeForSearch() {
+	if m.treeMode {
+		m.treeMode = false
+		m.treeSearched = true
+	}
+}
+
+// endSearch clears the search and goes back to the list or tree shown
+// before it.
+func (m *Model) endSearch() tea.Cmd {
+	m.searchQuery = ""
+	m.searchTags = nil
+	m.searchFilter = db.SearchFilter{}
+	if m.treeSearched {
+		m.treeSearched = false
+		m.treeMode = true
+		return m.loadTree()
+	}
+	return m.loadNotes()
+}
+
 func (m Model) searchNotes() tea.Cmd {
 	return func() tea.Msg {
-		notes, err := m.db.SearchNotes(m.searchQuery, m.searchTags)
+		notes, err := m.db.SearchNotes(m.ctx, m.searchQuery, m.searchTags, m.searchFilter)
 		if err != nil {
 			return errMsg(err)
 		}
@@ -1008,7 +1771,51 @@ func (m Model) View() string {
 		return m.renderHistory()
 	}
 
-	if m.mode == ModeNewNote || m.mode == ModeSearch {
+	if m.mode == ModeBlame {
+		return m.renderBlame()
+	}
+
+	if m.mode == ModeGraph {
+		return m.renderGraph()
+	}
+	if m.mode == ModeTags {
+		return m.renderTagBrowser()
+	}
+	if m.mode == ModeCalendar {
+		return m.renderCalendar()
+	}
+	if m.mode == ModeAgenda {
+		return m.renderAgenda()
+	}
+	if m.mode == ModeTasks {
+		return m.renderTasks()
+	}
+	if m.mode == ModeBoard {
+		return m.renderBoard()
+	}
+	if m.mode == ModeTable {
+		return m.renderTable()
+	}
+
+	if m.mode == ModeProperties {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, m.renderPropertyDialog())
+	}
+
+	if m.mode == ModeReminderTarget {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, m.renderReminderTarget())
+	}
+
+	if m.mode == ModeTemplates {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, m.renderTemplatePicker())
+	}
+
+	if m.mode == ModeProfiles {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, m.renderProfilePicker())
+	}
+
+	if m.mode == ModeNewNote || m.mode == ModeSearch || m.mode == ModeRename || m.mode == ModeAttachPath || m.mode == ModeTemplatePrompt ||
+		m.mode == ModeReminderTime || m.mode == ModeTaskTag || m.mode == ModeBoardEdit ||
+		m.mode == ModePropertyInput || m.mode == ModeTableFilter {
 		dialog := m.renderInputDialog()
 		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, dialog)
 	}
@@ -1028,6 +1835,10 @@ func (m Model) View() string {
 		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, dialog)
 	}
 
+	if len(m.alerts) > 0 && m.mode == ModeNormal {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, m.renderAlert())
+	}
+
 	return lipgloss.JoinVertical(lipgloss.Left, header, body, status)
 }
 
@@ -1040,6 +1851,9 @@ func (m Model) renderHeader() string {
 	}
 
 	headerContent := TitleStyle.Render(title)
+	if len(m.config.Profiles) > 0 {
+		headerContent += MutedStyle.Render("  · " + m.config.Profile())
+	}
 	return HeaderStyle.Width(m.width - 2).Render(headerContent)
 }
 
@@ -1061,7 +1875,10 @@ func (m Model) renderList() string {
 	listHeight := m.listVisibleHeight()
 
 	lineWidth := m.listWidth() - 4
-	for i := m.listOffset; i < len(m.notes) && i < m.listOffset+listHeight; i++ {
+	if m.treeMode {
+		items = m.renderTree(lineWidth, listHeight)
+	}
+	for i := m.listOffset; !m.treeMode && i < len(m.notes) && i < m.listOffset+listHeight; i++ {
 		note := m.notes[i]
 		// Icon + title, same base style for alignment
 		icon := NoteIcon
@@ -1071,6 +1888,10 @@ func (m Model) renderList() string {
 		}
 
 		lineContent := fmt.Sprintf(" %s %s", icon, titleText)
+		if badges := noteBadges(note.Pinned, note.Archived, note.ReadOnly); badges != "" {
+			titleText = truncate(note.Title, max(lineWidth-6-lipgloss.Width(badges), 4))
+			lineContent = fmt.Sprintf(" %s %s%s", icon, titleText, badges)
+		}
 
 		if i == m.cursor {
 			// Highlight selected item with dedicated style
@@ -1103,6 +1924,9 @@ func (m Model) renderContent() string {
 		content = m.textarea.View()
 	} else if m.currentNote != nil {
 		content = m.currentNote.Content
+		if !m.currentReadOnly {
+			content = m.renderLinks(content)
+		}
 	} else {
 		content = MutedStyle.Render(t.NoNoteSelected)
 	}
@@ -1126,7 +1950,7 @@ func (m Model) renderMetadata() string {
 		lines = append(lines, "")
 
 		// Count notes in folder
-		count, err := m.db.CountNotesInFolder(m.currentFolderData.ID)
+		count, err := m.db.CountNotesInFolder(m.ctx, m.currentFolderData.ID, m.showArchived)
 		if err == nil {
 			lines = append(lines, LabelStyle.Render("Note"))
 			lines = append(lines, MutedStyle.Render("  "+fmt.Sprintf("%d", count)))
@@ -1154,6 +1978,18 @@ func (m Model) renderMetadata() string {
 			lines = append(lines, MutedStyle.Render("  "+t.None))
 		}
 
+		if len(m.backlinks) > 0 {
+			lines = append(lines, "")
+			lines = append(lines, LabelStyle.Render(t.Backlinks))
+			for _, b := range m.backlinks {
+				lines = append(lines, MutedStyle.Render("  ← "+truncate(b.Title, m.metadataWidth()-10)))
+			}
+		}
+
+		lines = append(lines, m.renderNoteProperties()...)
+		lines = append(lines, m.renderNoteReminders()...)
+		lines = append(lines, m.renderAttachments()...)
+
 		lines = append(lines, "")
 		lines = append(lines, LabelStyle.Render(t.CreatedAt))
 		lines = append(lines, MutedStyle.Render("  "+m.currentNote.CreatedAt.Format("2006-01-02 15:04")))
@@ -1161,6 +1997,16 @@ func (m Model) renderMetadata() string {
 		lines = append(lines, "")
 		lines = append(lines, LabelStyle.Render(t.ModifiedAt))
 		lines = append(lines, MutedStyle.Render("  "+m.currentNote.UpdatedAt.Format("2006-01-02 15:04")))
+
+		if m.currentNote.Archived || m.currentNote.ReadOnly {
+			lines = append(lines, "")
+		}
+		if m.currentNote.Archived {
+			lines = append(lines, LabelStyle.Render(ArchiveIcon+" "+t.Archived))
+		}
+		if m.currentNote.ReadOnly {
+			lines = append(lines, LabelStyle.Render(ReadOnlyIcon+" "+t.NoteLocked))
+		}
 	}
 
 	content := strings.Join(lines, "\n")
@@ -1180,7 +2026,7 @@ func (m Model) renderStatus() string {
 
 	modeBadge := TagStyle.Render(modeStr)
 	left := fmt.Sprintf(" %s | %d %s", modeBadge, len(m.notes), t.Notes)
-	if m.currentReadOnly {
+	if m.noteLocked() {
 		left += " | " + ErrorStyle.Render(t.ReadOnly)
 	}
 
@@ -1245,6 +2091,24 @@ func (m Model) renderInputDialog() string {
 	title := t.NewNote
 	if m.mode == ModeSearch {
 		title = t.Search
+	} else if m.mode == ModeRename {
+		title = t.RenameNote
+	} else if m.mode == ModeAttachPath {
+		title = t.Attachments
+	} else if m.mode == ModeTemplatePrompt {
+		title = m.template.Name
+	} else if m.mode == ModeReminderTime {
+		title = t.ReminderTitle
+	} else if m.mode == ModeTaskTag {
+		title = t.TaskFilterTag
+	} else if m.mode == ModeBoardEdit {
+		title = t.BoardTitle
+	} else if m.mode == ModePropertyInput {
+		title = t.Properties
+	} else if m.mode == ModeTableFilter {
+		title = t.TableFilter
+	} else if m.template != nil {
+		title = t.NewNote + " · " + m.template.Name
 	} else if m.currentItemType == "folder" {
 		title = "Nuova cartella"
 	}
@@ -1298,6 +2162,9 @@ func (m Model) renderConfirmDialog() string {
 	if m.deleteTargetType == "folder" {
 		title = t.DeleteFolder
 		message = fmt.Sprintf(t.DeleteFolderConfirm, m.deleteTargetTitle)
+	} else if m.deleteTargetType == "attachment" {
+		title = t.DeleteAttachment
+		message = fmt.Sprintf(t.DeleteConfirm, m.deleteTargetTitle)
 	} else {
 		title = t.DeleteNote
 		message = fmt.Sprintf(t.DeleteConfirm, m.deleteTargetTitle)
@@ -1341,20 +2208,44 @@ func (m Model) renderHelp() string {
 	// Actions
 	b.WriteString(LabelStyle.Render(t.HelpActions) + "\n")
 	b.WriteString(fmt.Sprintf("  %-12s %s\n", "Ctrl+N", t.HelpNew))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "", t.HelpTemplates))
 	b.WriteString(fmt.Sprintf("  %-12s %s\n", "d", t.HelpDelete))
 	b.WriteString(fmt.Sprintf("  %-12s %s\n", "Ctrl+F", t.HelpSearch))
 	b.WriteString(fmt.Sprintf("  %-12s %s\n", "h", t.HelpHistory))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "b", t.HelpBlame))
 	b.WriteString(fmt.Sprintf("  %-12s %s\n", "t", t.HelpTags))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "T", t.HelpTagBrowser))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "r", t.HelpRename))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "G", t.HelpGraph))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "D", t.HelpDaily))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "C", t.HelpCalendar))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "R", t.HelpReminder))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "A", t.HelpAgenda))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "X", t.HelpTasks))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "B", t.HelpBoard))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "P", t.HelpProperties))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "*", t.HelpPin))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "o / O", t.HelpSort))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "K / J", t.HelpMove))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "z / Z", t.HelpArchive))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "w", t.HelpLockNote))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "V", t.HelpTable))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "a/Enter/d", t.HelpAttachments))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "↑/↓ Enter", t.HelpFollowLink))
 	b.WriteString(fmt.Sprintf("  %-12s %s\n", "p", t.HelpPassword))
 	b.WriteString(fmt.Sprintf("  %-12s %s\n", "Ctrl+Y", t.HelpSync))
 	b.WriteString(fmt.Sprintf("  %-12s %s\n", "Ctrl+E", t.HelpExport))
 	b.WriteString(fmt.Sprintf("  %-12s %s\n", "Ctrl+I", t.HelpImport))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "Ctrl+P", t.HelpProfiles))
 	b.WriteString("\n")
 
 	// Folders
 	b.WriteString(LabelStyle.Render(t.HelpFolders) + "\n")
 	b.WriteString(fmt.Sprintf("  %-12s %s\n", "Ctrl+D", t.HelpNewFolder))
 	b.WriteString(fmt.Sprintf("  %-12s %s\n", "Backspace", t.HelpParentFolder))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "Ctrl+T", t.HelpTreeView))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "→/l", t.HelpExpand))
+	b.WriteString(fmt.Sprintf("  %-12s %s\n", "←/h", t.HelpCollapse))
 	b.WriteString("\n")
 
 	// General
@@ -1394,7 +2285,10 @@ func (m Model) renderHistoryBody() string {
 	listHeight := m.listVisibleHeight()
 	for i := m.historyOffset; i < len(m.noteVersions) && i < m.historyOffset+listHeight; i++ {
 		version := m.noteVersions[i]
-		line := fmt.Sprintf("%s %s", version.Hash, version.CreatedAt.Format("15:04"))
+		line := fmt.Sprintf("%-4s %s", fmt.Sprintf("#%d", version.VersionNum), version.CreatedAt.Local().Format("01-02 15:04"))
+		if i == m.compareIndex {
+			line += " *"
+		}
 		if i == m.versionCursor {
 			line = SelectedStyle.Render("> " + line)
 		} else {
@@ -1410,30 +2304,35 @@ func (m Model) renderHistoryBody() string {
 	listContent := strings.Join(items, "\n")
 	listPanel := PanelStyle.Width(25).Height(m.contentHeight()).Render(listContent)
 
+	if m.diffMode {
+		return lipgloss.JoinHorizontal(lipgloss.Top, listPanel, m.renderDiffPanel(m.historyPanelWidth()))
+	}
+
 	// Center panel: preview of selected version
 	var previewContent string
 	if m.versionCursor < len(m.noteVersions) {
-		version := m.noteVersions[m.versionCursor]
-		previewContent = version.Content
-		// Decrypt if necessary
-		if m.encryptor != nil && previewContent != "" {
-			decrypted, err := m.encryptor.Decrypt(previewContent)
-			if err == nil {
-				previewContent = decrypted
-			}
-		}
+		// Versions come back from the database already decrypted
+		previewContent = m.noteVersions[m.versionCursor].Content
 	} else {
 		previewContent = ""
 	}
 
-	previewPanel := PanelStyle.Width(m.width - 30).Height(m.contentHeight()).Render(previewContent)
+	previewPanel := PanelStyle.Width(m.historyPanelWidth()).Height(m.contentHeight()).Render(previewContent)
 
 	return lipgloss.JoinHorizontal(lipgloss.Top, listPanel, previewPanel)
 }
 
+// historyPanelWidth is the width of the preview or diff panel next to the
+// version list.
+func (m Model) historyPanelWidth() int {
+	return m.width - 30
+}
+
 func (m Model) renderHistoryFooter() string {
 	t := i18n.T()
-	footer := MutedStyle.Render(fmt.Sprintf("[↑/↓] %s  [Enter] %s  [Esc/Ctrl+L] %s", t.HistoryScroll, t.HistoryRestore, t.HistoryBack))
+	footer := MutedStyle.Render(fmt.Sprintf("[↑/↓] %s  [Enter] %s  [d] %s  [s] %s  [w] %s  [m] %s  [n/N] %s  [a] %s  [J/K] %s  [Esc/Ctrl+L] %s",
+		t.HistoryScroll, t.HistoryRestore, t.HistoryDiff, t.HistoryLayout, t.HistoryWords,
+		t.HistoryCompare, t.HistoryHunk, t.HistoryApplyHunk, t.HistoryScroll, t.HistoryBack))
 	return "\n" + footer
 }
 
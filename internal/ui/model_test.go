@@ -0,0 +1,468 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/JustZacca/jotaku/internal/config"
+	"github.com/JustZacca/jotaku/internal/db"
+)
+
+// newTestModel builds a model on an in-memory store, without a vault or
+// encryption, and loads its list.
+func newTestModel(t *testing.T, store *db.MemoryStore) Model {
+	t.Helper()
+	m := newModel(context.Background(), store, nil, nil, &config.Config{})
+	return update(t, m, m.loadNotes()())
+}
+
+// update feeds msg to the model. The commands it returns are not run: the
+// tests run the ones they care about themselves, or use run.
+func update(t *testing.T, m Model, msg tea.Msg) Model {
+	t.Helper()
+	updated, _ := m.Update(msg)
+	return updated.(Model)
+}
+
+// run feeds msg to the model, then runs the commands it returns and feeds
+// their messages back. Commands started by those are not run.
+func run(t *testing.T, m Model, msg tea.Msg) Model {
+	t.Helper()
+	updated, cmd := m.Update(msg)
+	m = updated.(Model)
+	for _, msg := range messages(cmd) {
+		if err, ok := msg.(errMsg); ok {
+			t.Fatalf("command failed: %v", err)
+		}
+		m = update(t, m, msg)
+	}
+	return m
+}
+
+// messages runs cmd, and the commands of a batch, and returns their
+// messages.
+func messages(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	msg := cmd()
+	batch, ok := msg.(tea.BatchMsg)
+	if !ok {
+		return []tea.Msg{msg}
+	}
+	var msgs []tea.Msg
+	for _, c := range batch {
+		msgs = append(msgs, messages(c)...)
+	}
+	return msgs
+}
+
+// press sends a key to the model and returns the message of the command it
+// started, if any.
+func press(t *testing.T, m Model, k string) (Model, tea.Msg) {
+	t.Helper()
+	msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+	switch k {
+	case "enter":
+		msg = tea.KeyMsg{Type: tea.KeyEnter}
+	case "esc":
+		msg = tea.KeyMsg{Type: tea.KeyEsc}
+	case "ctrl+d":
+		msg = tea.KeyMsg{Type: tea.KeyCtrlD}
+	case "ctrl+p":
+		msg = tea.KeyMsg{Type: tea.KeyCtrlP}
+	case "ctrl+f":
+		msg = tea.KeyMsg{Type: tea.KeyCtrlF}
+	}
+	updated, cmd := m.Update(msg)
+	if cmd == nil {
+		return updated.(Model), nil
+	}
+	return updated.(Model), cmd()
+}
+
+func titles(items []db.NoteListItem) []string {
+	var out []string
+	for _, item := range items {
+		out = append(out, item.Title)
+	}
+	return out
+}
+
+func assertTitles(t *testing.T, items []db.NoteListItem, want ...string) {
+	t.Helper()
+	got := titles(items)
+	if len(got) != len(want) {
+		t.Fatalf("list = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("list = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestListShowsPinnedNotesThenFoldersThenNotes(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	store.CreateNoteInFolder(ctx, "Alfa", "", nil, 0)
+	pinned, _ := store.CreateNoteInFolder(ctx, "Beta", "", nil, 0)
+	store.SetNotePinned(ctx, pinned.ID, true)
+	store.CreateFolder(ctx, "Lavoro", 0)
+
+	m := newTestModel(t, store)
+	assertTitles(t, m.notes, "N- Beta", "D- Lavoro", "N- Alfa")
+}
+
+func TestEnterOpensFolder(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	folderID, _ := store.CreateFolder(ctx, "Progetti", 0)
+	store.CreateNoteInFolder(ctx, "Dentro", "", nil, folderID)
+	store.CreateNoteInFolder(ctx, "Fuori", "", nil, 0)
+
+	m := newTestModel(t, store)
+	assertTitles(t, m.notes, "D- Progetti", "N- Fuori")
+
+	m, msg := press(t, m, "enter")
+	if m.currentFolder != folderID {
+		t.Fatalf("current folder = %d, want %d", m.currentFolder, folderID)
+	}
+	m = update(t, m, msg)
+	assertTitles(t, m.notes, "N- Dentro")
+}
+
+func TestCreateFolder(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	m := newTestModel(t, store)
+
+	m, _ = press(t, m, "ctrl+d")
+	if m.mode != ModeNewNote || m.currentItemType != "folder" {
+		t.Fatalf("mode %v, item type %q after the new folder key", m.mode, m.currentItemType)
+	}
+	m, _ = press(t, m, "Idee")
+	m, msg := press(t, m, "enter")
+	m = update(t, m, msg)
+
+	if m.mode != ModeNormal {
+		t.Fatalf("mode %v after creating the folder, want normal", m.mode)
+	}
+	assertTitles(t, m.notes, "D- Idee")
+	if folders, _ := store.ListFolders(ctx, 0); len(folders) != 1 || folders[0].Title != "Idee" {
+		t.Fatalf("stored folders = %+v", folders)
+	}
+}
+
+func TestSaveKeepsVersion(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	note, _ := store.CreateNoteInFolder(ctx, "Diario", "lunedì", nil, 0)
+
+	m := newTestModel(t, store)
+	m = run(t, m, m.loadNote(note.ID)())
+	if m.textarea.Value() != "lunedì" {
+		t.Fatalf("editor content %q, want %q", m.textarea.Value(), "lunedì")
+	}
+
+	m.textarea.SetValue("martedì")
+	m = update(t, m, m.saveCurrentNote()())
+
+	saved, _ := store.GetNote(ctx, note.ID)
+	if saved.Content != "martedì" {
+		t.Fatalf("stored content %q, want %q", saved.Content, "martedì")
+	}
+	versions, _ := store.GetNoteVersions(ctx, note.ID)
+	if len(versions) != 1 || versions[0].Content != "martedì" {
+		t.Fatalf("versions = %+v, want the saved content", versions)
+	}
+
+	// Saving the same content again adds no version
+	m.saveCurrentNote()()
+	if versions, _ := store.GetNoteVersions(ctx, note.ID); len(versions) != 1 {
+		t.Fatalf("%d versions after saving unchanged content, want 1", len(versions))
+	}
+}
+
+func TestReadOnlyNoteIsNotSaved(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	note, _ := store.CreateNoteInFolder(ctx, "Contratto", "firmato", nil, 0)
+	store.SetNoteReadOnly(ctx, note.ID, true)
+
+	m := newTestModel(t, store)
+	m = run(t, m, m.loadNote(note.ID)())
+	m.textarea.SetValue("modificato")
+	m.saveCurrentNote()()
+
+	if saved, _ := store.GetNote(ctx, note.ID); saved.Content != "firmato" {
+		t.Fatalf("read-only note saved: content %q", saved.Content)
+	}
+}
+
+func TestReadOnlyNoteTagsAreNotEdited(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	note, _ := store.CreateNoteInFolder(ctx, "Contratto", "firmato", []string{"lavoro"}, 0)
+	store.SetNoteReadOnly(ctx, note.ID, true)
+
+	m := newTestModel(t, store)
+	m = run(t, m, m.loadNote(note.ID)())
+	m, _ = press(t, m, "t")
+	if m.mode == ModeEditTags {
+		t.Fatal("tag editor opened on a read-only note")
+	}
+	if err := store.SetNoteTags(ctx, note.ID, nil); !errors.Is(err, db.ErrNoteReadOnly) {
+		t.Fatalf("SetNoteTags on a read-only note: %v", err)
+	}
+}
+
+func TestDeleteNoteAfterConfirmation(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	note, _ := store.CreateNoteInFolder(ctx, "Vecchia", "", nil, 0)
+	store.CreateNoteInFolder(ctx, "Nuova", "", nil, 0)
+
+	m := newTestModel(t, store)
+	m = run(t, m, m.loadNote(note.ID)())
+
+	m, _ = press(t, m, "d")
+	if m.mode != ModeConfirmDelete || m.deleteTargetID != note.ID {
+		t.Fatalf("mode %v, target %d after the delete key", m.mode, m.deleteTargetID)
+	}
+
+	// Answering no keeps the note
+	m, _ = press(t, m, "n")
+	assertTitles(t, m.notes, "N- Nuova", "N- Vecchia")
+
+	m, _ = press(t, m, "d")
+	m, msg := press(t, m, "y")
+	m = update(t, m, msg)
+	assertTitles(t, m.notes, "N- Nuova")
+	if deleted, _ := store.GetNote(ctx, note.ID); deleted == nil || !deleted.Deleted {
+		t.Fatalf("note not marked deleted: %+v", deleted)
+	}
+}
+
+func TestRestoreVersionFromHistory(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	note, _ := store.CreateNoteInFolder(ctx, "Ricetta", "", nil, 0)
+
+	m := newTestModel(t, store)
+	m = run(t, m, m.loadNote(note.ID)())
+	for _, content := range []string{"farina", "farina e uova"} {
+		m.textarea.SetValue(content)
+		m = update(t, m, m.saveCurrentNote()())
+	}
+
+	m, msg := press(t, m, "h")
+	if m.mode != ModeHistory {
+		t.Fatalf("mode %v after the history key, want history", m.mode)
+	}
+	m = update(t, m, msg)
+	if len(m.noteVersions) != 2 {
+		t.Fatalf("%d versions in history, want 2", len(m.noteVersions))
+	}
+
+	// Versions are newest first: pick the older one
+	m.versionCursor = 1
+	m, msg = press(t, m, "enter")
+	m = update(t, m, msg)
+
+	if restored, _ := store.GetNote(ctx, note.ID); restored.Content != "farina" {
+		t.Fatalf("stored content %q after restore, want %q", restored.Content, "farina")
+	}
+	if m.textarea.Value() != "farina" {
+		t.Fatalf("editor content %q after restore, want %q", m.textarea.Value(), "farina")
+	}
+}
+
+func TestDiffIsCachedBetweenFrames(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	note, _ := store.CreateNoteInFolder(ctx, "Ricetta", "", nil, 0)
+
+	m := newTestModel(t, store)
+	m = update(t, m, tea.WindowSizeMsg{Width: 120, Height: 40})
+	m = run(t, m, m.loadNote(note.ID)())
+	for _, content := range []string{"farina", "farina e uova"} {
+		m.textarea.SetValue(content)
+		m = update(t, m, m.saveCurrentNote()())
+	}
+	// History opens on the diff against the note
+	m, msg := press(t, m, "h")
+	m = update(t, m, msg)
+
+	m.View()
+	first := m.diffCache.rows
+	m.View()
+	if len(first.rows) == 0 || &m.diffCache.rows.rows[0] != &first.rows[0] {
+		t.Fatal("diff rendered again for an unchanged frame")
+	}
+
+	m, _ = press(t, m, "w")
+	m.View()
+	if !m.diffCache.key.words {
+		t.Fatal("diff not rendered again after switching to the word diff")
+	}
+}
+
+func TestHistoryFromTreeView(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	folder, _ := store.CreateFolder(ctx, "Cucina", 0)
+	note, _ := store.CreateNoteInFolder(ctx, "Ricetta", "", nil, folder)
+
+	m := newModel(ctx, store, nil, nil, &config.Config{TreeView: true})
+	m = update(t, m, m.loadTree()())
+
+	// In the tree list l and h expand and collapse the folder
+	m, msg := press(t, m, "l")
+	m = update(t, m, msg)
+	if len(m.treeRows) != 2 {
+		t.Fatalf("%d tree rows after expanding the folder, want 2", len(m.treeRows))
+	}
+	m, msg = press(t, m, "l")
+	m = run(t, m, msg)
+	if m.currentNote == nil || m.currentNote.ID != note.ID {
+		t.Fatal("note not opened stepping into the folder")
+	}
+
+	// With the note panel focused h opens the history
+	m.activePanel = PanelContent
+	if m, _ := press(t, m, "h"); m.mode != ModeHistory {
+		t.Fatalf("mode %v after the history key from the note panel, want history", m.mode)
+	}
+
+	m.activePanel = PanelList
+	m, _ = press(t, m, "h")
+	if m.mode == ModeHistory || m.treeCursor != 0 {
+		t.Fatalf("mode %v, cursor %d after h on the note, want the parent folder", m.mode, m.treeCursor)
+	}
+	m, _ = press(t, m, "h")
+	if len(m.treeRows) != 1 {
+		t.Fatalf("%d tree rows after collapsing the folder, want 1", len(m.treeRows))
+	}
+}
+
+func TestSearchReturnsToTreeView(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	store.CreateNoteInFolder(ctx, "Ricetta", "", nil, 0)
+	m := newModel(ctx, store, nil, nil, &config.Config{TreeView: true})
+
+	for _, leave := range []func(Model) Model{
+		func(m Model) Model { m, _ = press(t, m, "esc"); return m },
+		func(m Model) Model { m.textinput.SetValue(""); m, _ = press(t, m, "enter"); return m },
+	} {
+		m, _ = press(t, m, "ctrl+f")
+		m.textinput.SetValue("ricetta")
+		if m, _ = press(t, m, "enter"); m.treeMode {
+			t.Fatal("search results shown in the tree")
+		}
+		m, _ = press(t, m, "ctrl+f")
+		if m = leave(m); !m.treeMode || m.searchQuery != "" {
+			t.Fatalf("tree %v, query %q after leaving the search", m.treeMode, m.searchQuery)
+		}
+	}
+}
+
+func TestSwitchProfile(t *testing.T) {
+	cfg := &config.Config{Profiles: map[string]config.Profile{"lavoro": {}}}
+	m := newModel(context.Background(), db.NewMemoryStore(), nil, nil, cfg)
+
+	m, _ = press(t, m, "ctrl+p")
+	if m.mode != ModeProfiles || len(m.profiles) != 2 || m.profileCursor != 0 {
+		t.Fatalf("mode %v, profiles %q, cursor %d after the profiles key", m.mode, m.profiles, m.profileCursor)
+	}
+
+	// Choosing the open profile only closes the picker
+	m, msg := press(t, m, "enter")
+	if msg != nil || m.SwitchProfile() != "" {
+		t.Fatalf("switched to %q from the open profile", m.SwitchProfile())
+	}
+
+	m, _ = press(t, m, "ctrl+p")
+	m, _ = press(t, m, "j")
+	m, msg = press(t, m, "enter")
+	if _, ok := msg.(tea.QuitMsg); !ok || m.SwitchProfile() != "lavoro" {
+		t.Fatalf("switch returned %T, profile %q; want quit and lavoro", msg, m.SwitchProfile())
+	}
+}
+
+func TestSetPasswordWithoutVault(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	note, _ := store.CreateNoteInFolder(ctx, "Diario", "", nil, 0)
+
+	m := newTestModel(t, store)
+	m.passwordTarget = note.ID
+	m.passwordTargetType = "note"
+	if msg := m.setPassword("segreta")(); msg != nil {
+		if err, ok := msg.(errMsg); ok {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := store.GetNote(ctx, note.ID); got.Password != "segreta" {
+		t.Fatalf("password %q after setting it", got.Password)
+	}
+}
+
+func TestNoteLoadFillsPanels(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	note, _ := store.CreateNoteInFolder(ctx, "Cliente", "---\nstato: attivo\n---\nNote sul cliente", nil, 0)
+	store.CreateNoteInFolder(ctx, "Riunione", "Parlato con [[cliente]]", nil, 0)
+	store.AddAttachment(ctx, note.ID, "/tmp/contratto.pdf", []byte("%PDF"), 0)
+
+	m := newTestModel(t, store)
+	m = run(t, m, m.loadNote(note.ID)())
+
+	if titles := titles(m.backlinks); len(titles) != 1 || titles[0] != "Riunione" {
+		t.Fatalf("backlinks = %q, want Riunione", titles)
+	}
+	if len(m.attachments) != 1 || m.attachments[0].Name != "contratto.pdf" {
+		t.Fatalf("attachments = %+v", m.attachments)
+	}
+	if len(m.properties) != 1 || m.properties[0].Name != "stato" || m.properties[0].Value != "attivo" {
+		t.Fatalf("properties = %+v", m.properties)
+	}
+}
+
+func TestRenameNoteRewritesLinks(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	note, _ := store.CreateNoteInFolder(ctx, "Cliente", "", nil, 0)
+	source, _ := store.CreateNoteInFolder(ctx, "Riunione", "Parlato con [[Cliente|lui]]", nil, 0)
+
+	m := newTestModel(t, store)
+	m = run(t, m, m.renameNote(note.ID, "Acme")())
+
+	if got, _ := store.GetNote(ctx, source.ID); got.Content != "Parlato con [[Acme|lui]]" {
+		t.Fatalf("linking note content %q after the rename", got.Content)
+	}
+	if backlinks, _ := store.GetBacklinks(ctx, note.ID); len(backlinks) != 1 {
+		t.Fatalf("%d backlinks after the rename, want 1", len(backlinks))
+	}
+}
+
+func TestRemindersRenderOnNarrowTerminal(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	note, _ := store.CreateNoteInFolder(ctx, "Spesa", "- [ ] comprare il latte", nil, 0)
+	store.AddReminder(ctx, note.ID, "comprare il latte", time.Now().AddDate(0, 0, 3))
+
+	m := newTestModel(t, store)
+	m = update(t, m, tea.WindowSizeMsg{Width: 80, Height: 24})
+	m = run(t, m, m.loadReminders()())
+	m = run(t, m, m.loadNote(note.ID)())
+
+	if len(m.renderNoteReminders()) != 3 {
+		t.Fatalf("reminder lines %q", m.renderNoteReminders())
+	}
+	m.View()
+}
@@ -0,0 +1,188 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+type sortChangedMsg db.FolderSort
+
+// arrangeItems puts the notes and subfolders of a folder in display order:
+// pinned notes, folders, then the other notes. Both come sorted from the
+// database, pinned notes first.
+func arrangeItems(folders, notes []db.NoteListItem) []db.NoteListItem {
+	items := make([]db.NoteListItem, 0, len(folders)+len(notes))
+	pinned := 0
+	for pinned < len(notes) && notes[pinned].Pinned {
+		pinned++
+	}
+	items = append(items, notes[:pinned]...)
+	items = append(items, folders...)
+	return append(items, notes[pinned:]...)
+}
+
+// orderFolder is the folder whose items the list shows around the cursor:
+// the current folder, or in the tree the parent of the selected row.
+func (m Model) orderFolder() int64 {
+	if m.treeMode {
+		if node := m.selectedTreeNode(); node != nil {
+			return node.ParentID
+		}
+		return 0
+	}
+	return m.currentFolder
+}
+
+func (m Model) changeSort(reverse bool) tea.Cmd {
+	folderID := m.orderFolder()
+	return func() tea.Msg {
+		sort, err := m.db.GetFolderSort(m.ctx, folderID)
+		if err != nil {
+			return errMsg(err)
+		}
+		if !reverse {
+			sort = sort.Next()
+		} else if sort.Mode != db.SortManual {
+			sort.Desc = !sort.Desc
+		}
+		if err := m.db.SaveFolderSort(m.ctx, sort); err != nil {
+			return errMsg(err)
+		}
+		return sortChangedMsg(sort)
+	}
+}
+
+func (m Model) togglePin(item db.NoteListItem) tea.Cmd {
+	return func() tea.Msg {
+		if err := m.db.SetNotePinned(m.ctx, item.ID, !item.Pinned); err != nil {
+			return errMsg(err)
+		}
+		return m.loadNotes()()
+	}
+}
+
+func (m Model) saveOrder(folderID int64, items []db.NoteListItem) tea.Cmd {
+	return func() tea.Msg {
+		if err := m.db.SetManualOrder(m.ctx, folderID, items); err != nil {
+			return errMsg(err)
+		}
+		return nil
+	}
+}
+
+// treeSiblings returns the slice holding the selected tree row and its
+// siblings.
+func (m Model) treeSiblings(node *treeNode) []*treeNode {
+	if node.ParentID == 0 {
+		return m.tree
+	}
+	if parent := findTreeNode(m.tree, node.ParentID); parent != nil {
+		return parent.Children
+	}
+	return nil
+}
+
+// moveItem swaps the selected item with the one above (delta -1) or below
+// (+1) and saves the new order, which switches the folder to manual sort.
+// Items only move within their group: pinned notes, folders or notes.
+func (m Model) moveItem(delta int) (Model, tea.Cmd) {
+	sameGroup := func(a, b db.NoteListItem) bool {
+		return (a.Type == "folder") == (b.Type == "folder") && a.Pinned == b.Pinned
+	}
+
+	if !m.treeMode {
+		i, j := m.cursor, m.cursor+delta
+		if i >= len(m.notes) || j < 0 || j >= len(m.notes) || !sameGroup(m.notes[i], m.notes[j]) {
+			return m, nil
+		}
+		notes := append([]db.NoteListItem(nil), m.notes...)
+		notes[i], notes[j] = notes[j], notes[i]
+		m.notes = notes
+		m.cursor = j
+		if m.cursor < m.listOffset {
+			m.listOffset = m.cursor
+		}
+		if listHeight := m.listVisibleHeight(); m.cursor >= m.listOffset+listHeight {
+			m.listOffset = m.cursor - listHeight + 1
+		}
+		return m, m.saveOrder(m.currentFolder, notes)
+	}
+
+	node := m.selectedTreeNode()
+	if node == nil {
+		return m, nil
+	}
+	siblings := m.treeSiblings(node)
+	items := make([]db.NoteListItem, len(siblings))
+	i := -1
+	for k, n := range siblings {
+		items[k] = db.NoteListItem{ID: n.ID, Type: n.Type, Pinned: n.Pinned}
+		if n == node {
+			i = k
+		}
+	}
+	j := i + delta
+	if i < 0 || j < 0 || j >= len(items) || !sameGroup(items[i], items[j]) {
+		return m, nil
+	}
+	siblings[i], siblings[j] = siblings[j], siblings[i]
+	items[i], items[j] = items[j], items[i]
+	m.refreshTreeRows()
+	for k, row := range m.treeRows {
+		if row == node {
+			m.treeCursor = k
+		}
+	}
+	m.clampTreeOffset()
+	return m, m.saveOrder(node.ParentID, items)
+}
+
+func (m Model) handleOrderKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
+	switch {
+	case key.Matches(msg, m.keys.Pin):
+		selected := m.currentSelectedItem()
+		if selected != nil && selected.Type != "folder" {
+			return m, m.togglePin(*selected), true
+		}
+		return m, nil, true
+
+	case key.Matches(msg, m.keys.SortMode):
+		return m, m.changeSort(false), true
+
+	case key.Matches(msg, m.keys.SortReverse):
+		return m, m.changeSort(true), true
+
+	case key.Matches(msg, m.keys.MoveUp):
+		m, cmd := m.moveItem(-1)
+		return m, cmd, true
+
+	case key.Matches(msg, m.keys.MoveDown):
+		m, cmd := m.moveItem(1)
+		return m, cmd, true
+	}
+	return m, nil, false
+}
+
+// sortLabel describes a sort for the status bar.
+func sortLabel(s db.FolderSort) string {
+	t := i18n.T()
+	names := map[db.SortMode]string{
+		db.SortUpdated: t.SortUpdated,
+		db.SortCreated: t.SortCreated,
+		db.SortTitle:   t.SortTitle,
+		db.SortSize:    t.SortSize,
+		db.SortManual:  t.SortManual,
+	}
+	label := fmt.Sprintf("%s: %s", t.SortBy, names[s.Mode])
+	if s.Mode == db.SortManual {
+		return label
+	}
+	if s.Desc {
+		return label + " ↓"
+	}
+	return label + " ↑"
+}
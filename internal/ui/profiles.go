@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+// SwitchProfile returns the profile the user chose to open next, or "" if
+// the interface was quit. The vault is closed before the next one asks for
+// its password, so the switch happens in main.
+func (m Model) SwitchProfile() string {
+	return m.switchProfile
+}
+
+func (m Model) startProfilePicker() Model {
+	m.mode = ModeProfiles
+	m.profiles = m.config.ProfileNames()
+	m.profileCursor = 0
+	for i, name := range m.profiles {
+		if name == m.config.Profile() {
+			m.profileCursor = i
+		}
+	}
+	return m
+}
+
+func (m Model) handleProfileKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.Escape), key.Matches(msg, m.keys.Profiles):
+		m.mode = ModeNormal
+
+	case key.Matches(msg, m.keys.Up):
+		if m.profileCursor > 0 {
+			m.profileCursor--
+		}
+
+	case key.Matches(msg, m.keys.Down):
+		if m.profileCursor < len(m.profiles)-1 {
+			m.profileCursor++
+		}
+
+	case key.Matches(msg, m.keys.Enter):
+		m.mode = ModeNormal
+		name := m.profiles[m.profileCursor]
+		if name == m.config.Profile() {
+			return m, nil
+		}
+		m.switchProfile = name
+		if m.dirty {
+			return m, tea.Sequence(m.saveCurrentNote(), tea.Quit)
+		}
+		return m, tea.Quit
+	}
+
+	return m, nil
+}
+
+// renderProfilePicker lists the profiles, marking the open one.
+func (m Model) renderProfilePicker() string {
+	t := i18n.T()
+
+	var rows []string
+	for i, name := range m.profiles {
+		if name == m.config.Profile() {
+			name += MutedStyle.Render(" (" + t.ProfileCurrent + ")")
+		}
+		if i == m.profileCursor {
+			rows = append(rows, SelectedStyle.Render("> ")+name)
+		} else {
+			rows = append(rows, "  "+name)
+		}
+	}
+
+	content := lipgloss.JoinVertical(
+		lipgloss.Left,
+		TitleStyle.Render(t.Profile),
+		"",
+		strings.Join(rows, "\n"),
+		"",
+		MutedStyle.Render(fmt.Sprintf("[↑/↓] %s  [Enter] %s  %s", t.ProfileChoose, t.ProfileSwitch, t.EscCancel)),
+	)
+
+	return DialogStyle.Width(50).Render(content)
+}
@@ -0,0 +1,436 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+type propertiesLoadedMsg struct {
+	noteID     int64
+	properties []db.Property
+}
+
+type propertySavedMsg int64
+
+type tableLoadedMsg struct {
+	table  *db.PropertyTable
+	folder string
+}
+
+func (m Model) loadProperties(noteID int64) tea.Cmd {
+	return func() tea.Msg {
+		props, err := m.db.NoteProperties(m.ctx, noteID)
+		if err != nil {
+			return errMsg(err)
+		}
+		return propertiesLoadedMsg{noteID: noteID, properties: props}
+	}
+}
+
+func (m Model) setProperty(noteID int64, p db.Property) tea.Cmd {
+	return func() tea.Msg {
+		if err := m.db.SetNoteProperty(m.ctx, noteID, p); err != nil {
+			return errMsg(err)
+		}
+		return propertySavedMsg(noteID)
+	}
+}
+
+// addProperty adds a property from a definition such as "status:select(a, b)".
+func (m Model) addProperty(noteID int64, def string) tea.Cmd {
+	return func() tea.Msg {
+		p, err := db.ParsePropertyDef(def)
+		if err != nil {
+			return errMsg(err)
+		}
+		return m.setProperty(noteID, p)()
+	}
+}
+
+func (m Model) deleteProperty(noteID int64, name string) tea.Cmd {
+	return func() tea.Msg {
+		if err := m.db.DeleteNoteProperty(m.ctx, noteID, name); err != nil {
+			return errMsg(err)
+		}
+		return propertySavedMsg(noteID)
+	}
+}
+
+func (m Model) selectedProperty() *db.Property {
+	if m.propCursor >= 0 && m.propCursor < len(m.properties) {
+		return &m.properties[m.propCursor]
+	}
+	return nil
+}
+
+func (m Model) startPropertyInput(action, value string) Model {
+	t := i18n.T()
+	m.mode = ModePropertyInput
+	m.propAction = action
+	m.textinput.SetValue(value)
+	m.textinput.Placeholder = t.PropertyValuePlaceholder
+	if action == "new" {
+		m.textinput.Placeholder = t.PropertyNewPlaceholder
+	}
+	m.textinput.CursorEnd()
+	m.textinput.Focus()
+	return m
+}
+
+// handlePropertyKeys edits the properties of the open note. Checkboxes are
+// toggled and select values cycled in place; other types are typed in.
+func (m Model) handlePropertyKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	p := m.selectedProperty()
+
+	switch {
+	case key.Matches(msg, m.keys.Escape), key.Matches(msg, m.keys.Properties):
+		m.mode = ModeNormal
+
+	case key.Matches(msg, m.keys.Up):
+		if m.propCursor > 0 {
+			m.propCursor--
+		}
+
+	case key.Matches(msg, m.keys.Down):
+		if m.propCursor < len(m.properties)-1 {
+			m.propCursor++
+		}
+
+	case key.Matches(msg, m.keys.AddProperty):
+		if !m.noteLocked() {
+			return m.startPropertyInput("new", ""), nil
+		}
+
+	case key.Matches(msg, m.keys.Enter):
+		if p == nil || m.noteLocked() {
+			break
+		}
+		switch {
+		case p.Type == db.PropertyCheckbox:
+			next := *p
+			next.Value = "true"
+			if p.Value == "true" {
+				next.Value = "false"
+			}
+			return m, m.setProperty(m.currentNote.ID, next)
+		case p.Type == db.PropertySelect && len(p.Options) > 0:
+			next := *p
+			next.Value = p.Options[0]
+			for i, o := range p.Options {
+				if o == p.Value && i+1 < len(p.Options) {
+					next.Value = p.Options[i+1]
+				}
+			}
+			return m, m.setProperty(m.currentNote.ID, next)
+		}
+		return m.startPropertyInput("edit", p.Value), nil
+
+	case key.Matches(msg, m.keys.Delete):
+		if p != nil && !m.noteLocked() {
+			return m, m.deleteProperty(m.currentNote.ID, p.Name)
+		}
+	}
+
+	return m, nil
+}
+
+func (m Model) handlePropertyInputKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch {
+	case key.Matches(msg, m.keys.Escape):
+		m.mode = ModeProperties
+		m.textinput.Blur()
+		m.textinput.Placeholder = i18n.T().TitlePlaceholder
+
+	case key.Matches(msg, m.keys.Enter):
+		input := strings.TrimSpace(m.textinput.Value())
+		action := m.propAction
+		m.mode = ModeProperties
+		m.propAction = ""
+		m.textinput.Blur()
+		m.textinput.Placeholder = i18n.T().TitlePlaceholder
+		if m.currentNote == nil {
+			return m, nil
+		}
+		if action == "new" {
+			if input == "" {
+				return m, nil
+			}
+			m.propCursor = len(m.properties)
+			return m, m.addProperty(m.currentNote.ID, input)
+		}
+		if p := m.selectedProperty(); p != nil {
+			next := *p
+			next.Value = input
+			return m, m.setProperty(m.currentNote.ID, next)
+		}
+
+	default:
+		m.textinput, cmd = m.textinput.Update(msg)
+	}
+
+	return m, cmd
+}
+
+// propertyValue formats a value for display.
+func propertyValue(p db.Property) string {
+	if p.Type == db.PropertyCheckbox {
+		if p.Value == "true" {
+			return "☑"
+		}
+		return "☐"
+	}
+	if p.Value == "" {
+		return "—"
+	}
+	return p.Value
+}
+
+// renderNoteProperties lists the properties of the open note in the metadata
+// panel.
+func (m Model) renderNoteProperties() []string {
+	if len(m.properties) == 0 {
+		return nil
+	}
+	t := i18n.T()
+	lines := []string{"", LabelStyle.Render(t.Properties)}
+	width := m.metadataWidth() - 8
+	for _, p := range m.properties {
+		line := truncate(p.Name+": "+propertyValue(p), width)
+		lines = append(lines, MutedStyle.Render("  "+line))
+	}
+	return lines
+}
+
+func (m Model) renderPropertyDialog() string {
+	t := i18n.T()
+
+	var rows []string
+	if len(m.properties) == 0 {
+		rows = append(rows, MutedStyle.Render(t.PropertiesEmpty))
+	}
+	for i, p := range m.properties {
+		line := fmt.Sprintf("%s %s %s", p.Name, MutedStyle.Render("("+string(p.Type)+")"), propertyValue(p))
+		if p.FrontMatter {
+			line += MutedStyle.Render(" · front matter")
+		}
+		if i == m.propCursor {
+			rows = append(rows, SelectedStyle.Render("> ")+line)
+		} else {
+			rows = append(rows, "  "+line)
+		}
+	}
+
+	content := lipgloss.JoinVertical(
+		lipgloss.Left,
+		TitleStyle.Render(t.Properties),
+		"",
+		strings.Join(rows, "\n"),
+		"",
+		MutedStyle.Render(fmt.Sprintf("[n] %s  [Enter] %s  [d] %s  %s", t.PropertyAdd, t.PropertyEdit, t.AttachDelete, t.EscCancel)),
+	)
+	return DialogStyle.Width(60).Render(content)
+}
+
+func (m Model) loadTable(folderID int64) tea.Cmd {
+	filter, sortBy, desc := m.tableFilter, m.tableSort, m.tableDesc
+	return func() tea.Msg {
+		table, err := m.db.PropertyTable(m.ctx, folderID)
+		if err != nil {
+			return errMsg(err)
+		}
+		table.Filter(filter)
+		table.Sort(sortBy, desc)
+		msg := tableLoadedMsg{table: table}
+		if folderID != 0 {
+			if f, err := m.db.GetFolder(m.ctx, folderID); err == nil && f != nil {
+				msg.folder = f.Title
+			}
+		}
+		return msg
+	}
+}
+
+// tableColumnName returns the property of a table column; column 0 is the
+// title.
+func (m Model) tableColumnName(i int) string {
+	if i == 0 || m.table == nil || i > len(m.table.Columns) {
+		return ""
+	}
+	return m.table.Columns[i-1].Name
+}
+
+func (m Model) handleTableKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.table == nil {
+		m.mode = ModeNormal
+		return m, nil
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		if m.tableCursor > 0 {
+			m.tableCursor--
+			if m.tableCursor < m.tableOffset {
+				m.tableOffset = m.tableCursor
+			}
+		}
+
+	case key.Matches(msg, m.keys.Down):
+		if m.tableCursor < len(m.table.Rows)-1 {
+			m.tableCursor++
+			if height := m.listVisibleHeight() - 2; m.tableCursor >= m.tableOffset+height {
+				m.tableOffset = m.tableCursor - height + 1
+			}
+		}
+
+	case key.Matches(msg, m.keys.Collapse):
+		if m.tableColumn > 0 {
+			m.tableColumn--
+		}
+
+	case key.Matches(msg, m.keys.Expand):
+		if m.tableColumn < len(m.table.Columns) {
+			m.tableColumn++
+		}
+
+	case key.Matches(msg, m.keys.SortColumn):
+		name := m.tableColumnName(m.tableColumn)
+		if name == m.tableSort {
+			m.tableDesc = !m.tableDesc
+		} else {
+			m.tableSort, m.tableDesc = name, false
+		}
+		return m, m.loadTable(m.tableFolder)
+
+	case key.Matches(msg, m.keys.TableFilter):
+		m.mode = ModeTableFilter
+		m.textinput.SetValue(m.tableFilter)
+		m.textinput.Placeholder = i18n.T().TableFilterPlaceholder
+		m.textinput.CursorEnd()
+		m.textinput.Focus()
+
+	case key.Matches(msg, m.keys.Enter):
+		if m.tableCursor < len(m.table.Rows) {
+			m.mode = ModeNormal
+			m.activePanel = PanelContent
+			return m, m.loadNote(m.table.Rows[m.tableCursor].NoteID)
+		}
+
+	case key.Matches(msg, m.keys.Escape), key.Matches(msg, m.keys.Table):
+		m.mode = ModeNormal
+		m.table = nil
+	}
+
+	return m, nil
+}
+
+func (m Model) handleTableFilterKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch {
+	case key.Matches(msg, m.keys.Escape):
+		m.mode = ModeTable
+		m.textinput.Blur()
+		m.textinput.Placeholder = i18n.T().TitlePlaceholder
+
+	case key.Matches(msg, m.keys.Enter):
+		m.mode = ModeTable
+		m.textinput.Blur()
+		m.textinput.Placeholder = i18n.T().TitlePlaceholder
+		m.tableFilter = strings.TrimSpace(m.textinput.Value())
+		m.tableCursor, m.tableOffset = 0, 0
+		return m, m.loadTable(m.tableFolder)
+
+	default:
+		m.textinput, cmd = m.textinput.Update(msg)
+	}
+
+	return m, cmd
+}
+
+// renderTable shows the notes of a folder with their properties as columns,
+// scrolling sideways to keep the selected column visible.
+func (m Model) renderTable() string {
+	t := i18n.T()
+	if m.table == nil {
+		return ""
+	}
+
+	const titleWidth, cellWidth = 28, 16
+	// Columns after the title that fit, starting from the first one shown
+	fit := max((m.width-8-titleWidth)/(cellWidth+1), 1)
+	first := 1
+	if m.tableColumn >= first+fit {
+		first = m.tableColumn - fit + 1
+	}
+	last := min(first+fit, len(m.table.Columns)+1)
+
+	cell := func(s string, width int) string {
+		return fmt.Sprintf("%-*s", width, truncate(s, width))
+	}
+	heading := func(i int, name string, width int) string {
+		if m.tableColumnName(i) == m.tableSort {
+			if m.tableDesc {
+				name += " ↓"
+			} else {
+				name += " ↑"
+			}
+		}
+		text := cell(name, width)
+		if i == m.tableColumn {
+			return SelectedStyle.Render(text)
+		}
+		return LabelStyle.Render(text)
+	}
+
+	header := []string{"  " + heading(0, t.TableTitleColumn, titleWidth)}
+	for i := first; i < last; i++ {
+		header = append(header, heading(i, m.table.Columns[i-1].Name, cellWidth))
+	}
+	rows := []string{strings.Join(header, " "), ""}
+
+	if len(m.table.Rows) == 0 {
+		rows = append(rows, MutedStyle.Render(t.TableEmpty))
+	}
+	height := m.listVisibleHeight() - 2
+	for r := m.tableOffset; r < len(m.table.Rows) && r < m.tableOffset+height; r++ {
+		row := m.table.Rows[r]
+		cells := []string{cell(row.Title, titleWidth)}
+		for i := first; i < last; i++ {
+			p, ok := row.Values[strings.ToLower(m.table.Columns[i-1].Name)]
+			value := ""
+			if ok {
+				value = propertyValue(p)
+			}
+			cells = append(cells, cell(value, cellWidth))
+		}
+		line := strings.Join(cells, " ")
+		if r == m.tableCursor {
+			rows = append(rows, SelectedStyle.Render("> ")+line)
+		} else {
+			rows = append(rows, "  "+line)
+		}
+	}
+
+	body := PanelStyle.Width(m.width - 2).Height(m.contentHeight()).Render(strings.Join(rows, "\n"))
+	footer := MutedStyle.Render(fmt.Sprintf("[←/→] %s  [↑/↓] %s  [s] %s  [/] %s  [Enter] %s  [Esc] %s",
+		t.BoardColumns, t.HistoryScroll, t.TableSort, t.TableFilter, t.GraphOpen, t.HistoryBack))
+
+	title := fmt.Sprintf("%s (%d)", t.TableViewTitle, len(m.table.Rows))
+	if m.tableFolderName != "" {
+		title += " · " + m.tableFolderName
+	}
+	info := ""
+	if m.tableFilter != "" {
+		info = MutedStyle.Render("  " + t.TableFilter + ": " + m.tableFilter)
+	}
+	head := HeaderStyle.Width(m.width - 2).Render(TitleStyle.Render(title) + info)
+	return lipgloss.JoinVertical(lipgloss.Left, head, body, "\n"+footer)
+}
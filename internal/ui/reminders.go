@@ -0,0 +1,377 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+type remindersLoadedMsg []db.Reminder
+
+type reminderSavedMsg string
+
+type agendaLoadedMsg []db.Reminder
+
+func (m Model) loadReminders() tea.Cmd {
+	return func() tea.Msg {
+		reminders, err := m.db.ListReminders(m.ctx, 0, false)
+		if err != nil {
+			return errMsg(err)
+		}
+		return remindersLoadedMsg(reminders)
+	}
+}
+
+func (m Model) addReminder(noteID int64, item, when string) tea.Cmd {
+	return func() tea.Msg {
+		due, err := db.ParseReminderTime(when, time.Now())
+		if err != nil {
+			return errMsg(err)
+		}
+		if _, err := m.db.AddReminder(m.ctx, noteID, item, due); err != nil {
+			return errMsg(err)
+		}
+		return reminderSavedMsg(fmt.Sprintf(i18n.T().ReminderSet, due.Format("2006-01-02 15:04")))
+	}
+}
+
+// markFired records the reminders whose alert was just shown.
+func (m Model) markFired(reminders []db.Reminder) tea.Cmd {
+	return func() tea.Msg {
+		for _, r := range reminders {
+			if err := m.db.MarkReminderFired(m.ctx, r.ID); err != nil {
+				return errMsg(err)
+			}
+		}
+		return m.loadReminders()()
+	}
+}
+
+func (m Model) setReminderDone(r db.Reminder) tea.Cmd {
+	return func() tea.Msg {
+		if err := m.db.SetReminderDone(m.ctx, r.ID, !r.Done); err != nil {
+			return errMsg(err)
+		}
+		return m.loadAgenda()()
+	}
+}
+
+func (m Model) deleteReminder(r db.Reminder) tea.Cmd {
+	return func() tea.Msg {
+		if err := m.db.DeleteReminder(m.ctx, r.ID); err != nil {
+			return errMsg(err)
+		}
+		return m.loadAgenda()()
+	}
+}
+
+// loadAgenda loads every reminder, done ones included, for the agenda.
+func (m Model) loadAgenda() tea.Cmd {
+	return func() tea.Msg {
+		reminders, err := m.db.ListReminders(m.ctx, 0, true)
+		if err != nil {
+			return errMsg(err)
+		}
+		return agendaLoadedMsg(reminders)
+	}
+}
+
+// checkReminders is the scheduler, run on every tick: reminders that came
+// due are queued as alerts and marked fired.
+func (m Model) checkReminders(now time.Time) (Model, tea.Cmd) {
+	var due []db.Reminder
+	for i := range m.reminders {
+		r := &m.reminders[i]
+		if !r.Fired && !r.Done && !r.Due.After(now) {
+			r.Fired = true
+			due = append(due, *r)
+		}
+	}
+	if len(due) == 0 {
+		return m, nil
+	}
+	m.alerts = append(m.alerts, due...)
+	return m, m.markFired(due)
+}
+
+// handleAlertKeys dismisses the oldest alert; Enter also opens its note.
+func (m Model) handleAlertKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	alert := m.alerts[0]
+	m.alerts = m.alerts[1:]
+	if key.Matches(msg, m.keys.Enter) {
+		m.activePanel = PanelContent
+		return m, m.loadNote(alert.NoteID)
+	}
+	return m, nil
+}
+
+// startReminder asks which checklist item the reminder is for, if the note
+// has open ones, then when it is due.
+func (m Model) startReminder() Model {
+	m.reminderItems = nil
+	m.reminderCursor = 0
+	m.reminderItem = ""
+	for _, item := range db.ParseChecklist(m.currentNote.Content) {
+		if !item.Done {
+			m.reminderItems = append(m.reminderItems, item)
+		}
+	}
+	if len(m.reminderItems) > 0 {
+		m.mode = ModeReminderTarget
+		return m
+	}
+	return m.startReminderTime()
+}
+
+func (m Model) startReminderTime() Model {
+	m.mode = ModeReminderTime
+	m.textinput.SetValue("")
+	m.textinput.Placeholder = i18n.T().ReminderPlaceholder
+	m.textinput.Focus()
+	return m
+}
+
+func (m Model) handleReminderTargetKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.Escape):
+		m.mode = ModeNormal
+
+	case key.Matches(msg, m.keys.Up):
+		if m.reminderCursor > 0 {
+			m.reminderCursor--
+		}
+
+	case key.Matches(msg, m.keys.Down):
+		// La prima riga è la nota intera
+		if m.reminderCursor < len(m.reminderItems) {
+			m.reminderCursor++
+		}
+
+	case key.Matches(msg, m.keys.Enter):
+		if m.reminderCursor > 0 {
+			m.reminderItem = m.reminderItems[m.reminderCursor-1].Text
+		}
+		return m.startReminderTime(), nil
+	}
+
+	return m, nil
+}
+
+func (m Model) handleReminderTimeKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch {
+	case key.Matches(msg, m.keys.Escape):
+		m.mode = ModeNormal
+		m.textinput.Blur()
+		m.textinput.Placeholder = i18n.T().TitlePlaceholder
+
+	case key.Matches(msg, m.keys.Enter):
+		when := strings.TrimSpace(m.textinput.Value())
+		m.mode = ModeNormal
+		m.textinput.Blur()
+		m.textinput.Placeholder = i18n.T().TitlePlaceholder
+		if when == "" || m.currentNote == nil {
+			return m, nil
+		}
+		return m, m.addReminder(m.currentNote.ID, m.reminderItem, when)
+
+	default:
+		m.textinput, cmd = m.textinput.Update(msg)
+	}
+
+	return m, cmd
+}
+
+func (m Model) handleAgendaKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var selected *db.Reminder
+	if m.agendaCursor < len(m.agenda) {
+		selected = &m.agenda[m.agendaCursor]
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		if m.agendaCursor > 0 {
+			m.agendaCursor--
+			if m.agendaCursor < m.agendaOffset {
+				m.agendaOffset = m.agendaCursor
+			}
+		}
+
+	case key.Matches(msg, m.keys.Down):
+		if m.agendaCursor < len(m.agenda)-1 {
+			m.agendaCursor++
+			if height := m.listVisibleHeight(); m.agendaCursor >= m.agendaOffset+height {
+				m.agendaOffset = m.agendaCursor - height + 1
+			}
+		}
+
+	case key.Matches(msg, m.keys.Enter):
+		if selected != nil {
+			m.mode = ModeNormal
+			m.activePanel = PanelContent
+			return m, m.loadNote(selected.NoteID)
+		}
+
+	case key.Matches(msg, m.keys.Done):
+		if selected != nil {
+			return m, m.setReminderDone(*selected)
+		}
+
+	case key.Matches(msg, m.keys.Delete):
+		if selected != nil {
+			return m, m.deleteReminder(*selected)
+		}
+
+	case key.Matches(msg, m.keys.Escape), key.Matches(msg, m.keys.Agenda):
+		m.mode = ModeNormal
+		m.agenda = nil
+		return m, m.loadReminders()
+	}
+
+	return m, nil
+}
+
+// reminderWhen formats a due time relative to today.
+func reminderWhen(due, now time.Time) string {
+	t := i18n.T()
+	today := startOfDay(now)
+	switch day := startOfDay(due); {
+	case day.Equal(today):
+		return t.ReminderToday + " " + due.Format("15:04")
+	case day.Equal(today.AddDate(0, 0, 1)):
+		return t.ReminderTomorrow + " " + due.Format("15:04")
+	}
+	return due.Format("2006-01-02 15:04")
+}
+
+// renderNoteReminders lists the pending reminders of the open note in the
+// metadata panel.
+func (m Model) renderNoteReminders() []string {
+	if m.currentNote == nil {
+		return nil
+	}
+	t := i18n.T()
+	now := time.Now()
+	var lines []string
+	for _, r := range m.reminders {
+		if r.NoteID != m.currentNote.ID {
+			continue
+		}
+		if lines == nil {
+			lines = append(lines, "", LabelStyle.Render(t.Reminders))
+		}
+		line := "  ⏰ " + reminderWhen(r.Due, now)
+		if r.Item != "" {
+			line += " " + truncate(r.Item, max(m.metadataWidth()-len(line)-6, 4))
+		}
+		style := MutedStyle
+		if r.Due.Before(now) {
+			style = ErrorStyle
+		}
+		lines = append(lines, style.Render(line))
+	}
+	return lines
+}
+
+func (m Model) renderReminderTarget() string {
+	t := i18n.T()
+
+	names := []string{t.ReminderWholeNote}
+	for _, item := range m.reminderItems {
+		names = append(names, "☐ "+truncate(item.Text, 50))
+	}
+	var rows []string
+	for i, name := range names {
+		if i == m.reminderCursor {
+			rows = append(rows, SelectedStyle.Render("> ")+name)
+		} else {
+			rows = append(rows, "  "+name)
+		}
+	}
+
+	content := lipgloss.JoinVertical(
+		lipgloss.Left,
+		TitleStyle.Render(t.ReminderTitle),
+		"",
+		strings.Join(rows, "\n"),
+		"",
+		MutedStyle.Render(fmt.Sprintf("[↑/↓] %s  %s  %s", t.ReminderChoose, t.EnterConfirm, t.EscCancel)),
+	)
+	return DialogStyle.Width(60).Render(content)
+}
+
+func (m Model) renderAlert() string {
+	t := i18n.T()
+	alert := m.alerts[0]
+
+	lines := []string{TitleStyle.Render("⏰ " + t.ReminderTitle), ""}
+	lines = append(lines, alert.Label())
+	if alert.Item != "" {
+		lines = append(lines, MutedStyle.Render(alert.NoteTitle))
+	}
+	lines = append(lines, MutedStyle.Render(alert.Due.Format("2006-01-02 15:04")), "")
+	if len(m.alerts) > 1 {
+		lines = append(lines, MutedStyle.Render(fmt.Sprintf(t.ReminderMore, len(m.alerts)-1)))
+	}
+	lines = append(lines, MutedStyle.Render("[Enter] "+t.ReminderOpen+"  [Esc] "+t.ReminderDismiss))
+
+	return DialogStyle.Width(50).Render(lipgloss.JoinVertical(lipgloss.Center, lines...))
+}
+
+// renderAgenda is the "upcoming" panel: overdue reminders first, then by
+// due time.
+func (m Model) renderAgenda() string {
+	t := i18n.T()
+	now := time.Now()
+	height := m.listVisibleHeight()
+	width := m.width - 8
+
+	var rows []string
+	if len(m.agenda) == 0 {
+		rows = append(rows, MutedStyle.Render(t.AgendaEmpty))
+	}
+	for i := m.agendaOffset; i < len(m.agenda) && i < m.agendaOffset+height; i++ {
+		r := m.agenda[i]
+		check := "☐"
+		if r.Done {
+			check = "☑"
+		}
+		when := fmt.Sprintf("%-18s", reminderWhen(r.Due, now))
+		// Truncate the plain text, then style the note title
+		label := r.Label()
+		text := label
+		if r.Item != "" {
+			text += " · " + r.NoteTitle
+		}
+		text = truncate(text, max(width-24, 10))
+		if len(text) > len(label) {
+			text = text[:len(label)] + MutedStyle.Render(text[len(label):])
+		}
+		line := fmt.Sprintf("%s %s %s", check, when, text)
+
+		switch {
+		case i == m.agendaCursor:
+			rows = append(rows, SelectedStyle.Render("> ")+line)
+		case r.Done:
+			rows = append(rows, "  "+MutedStyle.Render(line))
+		case r.Due.Before(now):
+			rows = append(rows, "  "+ErrorStyle.Render(line))
+		default:
+			rows = append(rows, "  "+line)
+		}
+	}
+
+	body := PanelStyle.Width(m.width - 2).Height(m.contentHeight()).Render(strings.Join(rows, "\n"))
+	footer := MutedStyle.Render(fmt.Sprintf("%s  [↑/↓] %s  [Enter] %s  [x] %s  [d] %s  [Esc] %s",
+		t.AgendaTitle, t.AgendaScroll, t.ReminderOpen, t.ReminderDone, t.AgendaDelete, t.AgendaBack))
+
+	header := HeaderStyle.Width(m.width - 2).Render(TitleStyle.Render(t.AgendaTitle))
+	return lipgloss.JoinVertical(lipgloss.Left, header, body, "\n"+footer)
+}
@@ -0,0 +1,58 @@
+package ui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+type noteStateChangedMsg struct {
+	id     int64
+	status string
+}
+
+func (m Model) setNoteArchived(id int64, archived bool) tea.Cmd {
+	return func() tea.Msg {
+		if err := m.db.SetNoteArchived(m.ctx, id, archived); err != nil {
+			return errMsg(err)
+		}
+		status := i18n.T().NoteArchived
+		if !archived {
+			status = i18n.T().NoteUnarchived
+		}
+		return noteStateChangedMsg{id: id, status: status}
+	}
+}
+
+func (m Model) setNoteReadOnly(id int64, readOnly bool) tea.Cmd {
+	return func() tea.Msg {
+		if err := m.db.SetNoteReadOnly(m.ctx, id, readOnly); err != nil {
+			return errMsg(err)
+		}
+		status := i18n.T().NoteLockedStatus
+		if !readOnly {
+			status = i18n.T().NoteUnlocked
+		}
+		return noteStateChangedMsg{id: id, status: status}
+	}
+}
+
+// noteLocked reports whether the open note must not be changed: it is
+// locked, or it could not be decrypted.
+func (m Model) noteLocked() bool {
+	return m.currentReadOnly || (m.currentNote != nil && m.currentNote.ReadOnly)
+}
+
+// noteBadges are the icons shown after a note's title in the list.
+func noteBadges(pinned, archived, readOnly bool) string {
+	var badges string
+	if pinned {
+		badges += " " + PinIcon
+	}
+	if archived {
+		badges += " " + ArchiveIcon
+	}
+	if readOnly {
+		badges += " " + ReadOnlyIcon
+	}
+	return badges
+}
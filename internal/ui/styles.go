@@ -90,9 +90,48 @@ var (
 
 	KeyHintStyle = lipgloss.NewStyle().
 			Foreground(muted)
+
+	// Diff viewer
+	DiffInsertStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#73F59F"))
+
+	DiffDeleteStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FF5F5F"))
+
+	DiffWordInsertStyle = DiffInsertStyle.Copy().
+				Underline(true)
+
+	DiffWordDeleteStyle = DiffDeleteStyle.Copy().
+				Strikethrough(true)
+
+	DiffGutterStyle = lipgloss.NewStyle().
+			Foreground(highlight).
+			Bold(true)
+
+	// Wiki links
+	LinkStyle = lipgloss.NewStyle().
+			Foreground(highlight).
+			Underline(true)
+
+	SelectedLinkStyle = LinkStyle.Copy().
+				Reverse(true)
 )
 
 const (
-	FolderIcon = "📁"
-	NoteIcon   = "📝"
+	FolderIcon   = "📁"
+	NoteIcon     = "📝"
+	LockIcon     = "🔒"
+	PinIcon      = "📌"
+	ArchiveIcon  = "🗄"
+	ReadOnlyIcon = "🔏"
+	SyncedIcon   = "✓"
+	PendingIcon  = "↑"
+	LocalIcon    = "•"
 )
+
+// SetTheme picks the light or dark variant of the adaptive colors above,
+// instead of guessing it from the terminal. Any theme other than "light" is
+// dark, the default.
+func SetTheme(theme string) {
+	lipgloss.SetHasDarkBackground(theme != "light")
+}
@@ -0,0 +1,198 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+type tagsLoadedMsg []db.TagCount
+type tagsRenamedMsg int
+
+func (m Model) loadTags() tea.Cmd {
+	return func() tea.Msg {
+		tags, err := m.db.ListTags(m.ctx)
+		if err != nil {
+			return errMsg(err)
+		}
+		return tagsLoadedMsg(tags)
+	}
+}
+
+// renameTag renames or merges the selected tag into newName.
+func (m Model) renameTag(oldName, newName string) tea.Cmd {
+	return func() tea.Msg {
+		count, err := m.db.RenameTag(m.ctx, oldName, newName)
+		if err != nil {
+			return errMsg(err)
+		}
+		return tagsRenamedMsg(count)
+	}
+}
+
+func (m Model) selectedTag() string {
+	if m.tagCursor >= 0 && m.tagCursor < len(m.tagList) {
+		return m.tagList[m.tagCursor].Name
+	}
+	return ""
+}
+
+func (m Model) handleTagKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	// Rename/merge prompt
+	if m.tagAction != "" {
+		switch {
+		case key.Matches(msg, m.keys.Escape):
+			m.tagAction = ""
+			m.textinput.Blur()
+		case key.Matches(msg, m.keys.Enter):
+			newName := db.NormalizeTag(m.textinput.Value())
+			oldName := m.selectedTag()
+			m.tagAction = ""
+			m.textinput.Blur()
+			if newName != "" && oldName != "" && newName != oldName {
+				return m, m.renameTag(oldName, newName)
+			}
+		default:
+			m.textinput, cmd = m.textinput.Update(msg)
+		}
+		return m, cmd
+	}
+
+	height := m.listVisibleHeight()
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		if m.tagCursor > 0 {
+			m.tagCursor--
+			if m.tagCursor < m.tagOffset {
+				m.tagOffset = m.tagCursor
+			}
+		}
+
+	case key.Matches(msg, m.keys.Down):
+		if m.tagCursor < len(m.tagList)-1 {
+			m.tagCursor++
+			if m.tagCursor >= m.tagOffset+height {
+				m.tagOffset = m.tagCursor - height + 1
+			}
+		}
+
+	case key.Matches(msg, m.keys.Enter):
+		// Show the notes with this tag (or one of its children)
+		if tag := m.selectedTag(); tag != "" {
+			m.mode = ModeNormal
+			m.activePanel = PanelList
+			m.searchQuery = ""
+			m.searchTags = []string{tag}
+			m.searchFilter = db.SearchFilter{}
+			m.leaveTreeForSearch()
+			m.cursor = 0
+			m.listOffset = 0
+			return m, m.searchNotes()
+		}
+
+	case key.Matches(msg, m.keys.Rename), key.Matches(msg, m.keys.Merge):
+		if tag := m.selectedTag(); tag != "" {
+			m.tagAction = "rename"
+			m.textinput.SetValue(tag)
+			if key.Matches(msg, m.keys.Merge) {
+				m.tagAction = "merge"
+				m.textinput.SetValue("")
+			}
+			m.textinput.Placeholder = "tag/..."
+			m.textinput.Focus()
+		}
+
+	case key.Matches(msg, m.keys.Escape), key.Matches(msg, m.keys.GoToList), key.Matches(msg, m.keys.TagBrowser):
+		m.mode = ModeNormal
+	}
+
+	return m, nil
+}
+
+func (m Model) renderTagBrowser() string {
+	t := i18n.T()
+	height := m.listVisibleHeight()
+	if m.tagAction != "" {
+		height -= 3
+	}
+
+	var rows []string
+	if len(m.tagList) == 0 {
+		rows = append(rows, MutedStyle.Render(t.TagsEmpty))
+	}
+	for i := m.tagOffset; i < len(m.tagList) && i < m.tagOffset+height; i++ {
+		tag := m.tagList[i]
+		depth := strings.Count(tag.Name, "/")
+		name := tag.Name[strings.LastIndex(tag.Name, "/")+1:]
+
+		line := fmt.Sprintf("%s#%s %s", strings.Repeat("  ", depth), name, MutedStyle.Render(fmt.Sprintf("(%d)", tag.Count)))
+		if i == m.tagCursor {
+			rows = append(rows, SelectedStyle.Render("> ")+TagStyle.Render(line))
+		} else {
+			rows = append(rows, "  "+TagStyle.Render(line))
+		}
+	}
+
+	if m.tagAction != "" {
+		prompt := t.TagRenamePrompt
+		if m.tagAction == "merge" {
+			prompt = fmt.Sprintf(t.TagMergePrompt, m.selectedTag())
+		}
+		for len(rows) < height {
+			rows = append(rows, "")
+		}
+		rows = append(rows, "", LabelStyle.Render(prompt), m.textinput.View())
+	}
+
+	body := PanelStyle.Width(m.width - 2).Height(m.contentHeight()).Render(strings.Join(rows, "\n"))
+	footer := MutedStyle.Render(fmt.Sprintf("%s  [↑/↓] %s  [Enter] %s  [r] %s  [m] %s  [Esc] %s",
+		t.TagsTitle, t.HistoryScroll, t.TagFilter, t.TagRename, t.TagMerge, t.HistoryBack))
+
+	header := HeaderStyle.Width(m.width - 2).Render(TitleStyle.Render(t.TagsTitle))
+	return lipgloss.JoinVertical(lipgloss.Left, header, body, "\n"+footer)
+}
+
+// parseSearch splits a search into free text, #tag filters and state
+// filters: is:archived (only archived notes), is:any (archived too) and
+// is:readonly (only locked notes).
+func parseSearch(input string) (string, []string, db.SearchFilter) {
+	var words, tags []string
+	var filter db.SearchFilter
+	for _, w := range strings.Fields(input) {
+		switch {
+		case strings.HasPrefix(w, "#") && len(w) > 1:
+			tags = append(tags, w[1:])
+		case strings.EqualFold(w, "is:archived"):
+			filter.Archived = db.ArchivedOnly
+		case strings.EqualFold(w, "is:any"):
+			filter.Archived = db.ArchivedShow
+		case strings.EqualFold(w, "is:readonly"):
+			filter.ReadOnly = true
+		default:
+			words = append(words, w)
+		}
+	}
+	return strings.Join(words, " "), tags, filter
+}
+
+// searchFilterTokens turns a filter back into the words parseSearch reads.
+func searchFilterTokens(filter db.SearchFilter) []string {
+	var tokens []string
+	switch filter.Archived {
+	case db.ArchivedOnly:
+		tokens = append(tokens, "is:archived")
+	case db.ArchivedShow:
+		tokens = append(tokens, "is:any")
+	}
+	if filter.ReadOnly {
+		tokens = append(tokens, "is:readonly")
+	}
+	return tokens
+}
@@ -0,0 +1,214 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+type tasksLoadedMsg []db.Task
+
+type taskToggledMsg int64
+
+func (m Model) loadTasks() tea.Cmd {
+	filter := m.taskFilter
+	return func() tea.Msg {
+		tasks, err := m.db.ListTasks(m.ctx, filter, time.Now())
+		if err != nil {
+			return errMsg(err)
+		}
+		return tasksLoadedMsg(tasks)
+	}
+}
+
+func (m Model) toggleTask(task db.Task) tea.Cmd {
+	return func() tea.Msg {
+		_, err := m.db.ToggleTask(m.ctx, task.NoteID, task.Line, task.Text)
+		if errors.Is(err, db.ErrTaskChanged) {
+			// The note was edited meanwhile: show it as it is now
+			return m.loadTasks()()
+		}
+		if err != nil {
+			return errMsg(err)
+		}
+		return taskToggledMsg(task.NoteID)
+	}
+}
+
+func (m Model) handleTaskKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var selected *db.Task
+	if m.taskCursor < len(m.tasks) {
+		selected = &m.tasks[m.taskCursor]
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		if m.taskCursor > 0 {
+			m.taskCursor--
+			if m.taskCursor < m.taskOffset {
+				m.taskOffset = m.taskCursor
+			}
+		}
+
+	case key.Matches(msg, m.keys.Down):
+		if m.taskCursor < len(m.tasks)-1 {
+			m.taskCursor++
+			if height := m.listVisibleHeight(); m.taskCursor >= m.taskOffset+height {
+				m.taskOffset = m.taskCursor - height + 1
+			}
+		}
+
+	case key.Matches(msg, m.keys.Enter):
+		if selected != nil {
+			m.mode = ModeNormal
+			m.activePanel = PanelContent
+			return m, m.loadNote(selected.NoteID)
+		}
+
+	case key.Matches(msg, m.keys.Done):
+		if selected != nil {
+			return m, m.toggleTask(*selected)
+		}
+
+	case key.Matches(msg, m.keys.FilterStatus):
+		m.taskFilter.Status = (m.taskFilter.Status + 1) % (db.TaskAll + 1)
+		return m.reloadTasks()
+
+	case key.Matches(msg, m.keys.FilterDue):
+		m.taskFilter.Due = (m.taskFilter.Due + 1) % (db.DueNone + 1)
+		return m.reloadTasks()
+
+	case key.Matches(msg, m.keys.FilterFolder):
+		// Alterna tra tutte le cartelle e quella corrente
+		m.taskFolder = ""
+		if m.taskFilter.Folder == 0 && m.currentFolder != 0 {
+			m.taskFilter.Folder = m.currentFolder
+			if f, err := m.db.GetFolder(m.ctx, m.currentFolder); err == nil && f != nil {
+				m.taskFolder = f.Title
+			}
+		} else {
+			m.taskFilter.Folder = 0
+		}
+		return m.reloadTasks()
+
+	case key.Matches(msg, m.keys.FilterTag):
+		m.mode = ModeTaskTag
+		m.textinput.SetValue(m.taskFilter.Tag)
+		m.textinput.Placeholder = "#tag"
+		m.textinput.CursorEnd()
+		m.textinput.Focus()
+
+	case key.Matches(msg, m.keys.Escape), key.Matches(msg, m.keys.Tasks):
+		m.mode = ModeNormal
+		m.tasks = nil
+	}
+
+	return m, nil
+}
+
+// reloadTasks applies a changed filter from the top of the list.
+func (m Model) reloadTasks() (tea.Model, tea.Cmd) {
+	m.taskCursor = 0
+	m.taskOffset = 0
+	return m, m.loadTasks()
+}
+
+func (m Model) handleTaskTagKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch {
+	case key.Matches(msg, m.keys.Escape):
+		m.mode = ModeTasks
+		m.textinput.Blur()
+		m.textinput.Placeholder = i18n.T().TitlePlaceholder
+
+	case key.Matches(msg, m.keys.Enter):
+		m.mode = ModeTasks
+		m.textinput.Blur()
+		m.textinput.Placeholder = i18n.T().TitlePlaceholder
+		m.taskFilter.Tag = db.NormalizeTag(m.textinput.Value())
+		return m.reloadTasks()
+
+	default:
+		m.textinput, cmd = m.textinput.Update(msg)
+	}
+
+	return m, cmd
+}
+
+// taskFilterLabel describes the active filters for the task view footer.
+func (m Model) taskFilterLabel() string {
+	t := i18n.T()
+	f := m.taskFilter
+
+	status := []string{t.TaskStatusOpen, t.TaskStatusDone, t.TaskStatusAll}[f.Status]
+	due := []string{t.TaskDueAny, t.TaskDueOverdue, t.TaskDueToday, t.TaskDueWeek, t.TaskDueNone}[f.Due]
+	parts := []string{status, due}
+
+	folder := t.TaskAllFolders
+	if f.Folder != 0 {
+		folder = m.taskFolder
+	}
+	parts = append(parts, "📁 "+folder)
+	if f.Tag != "" {
+		parts = append(parts, "#"+f.Tag)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// renderTasks is the task list across all notes.
+func (m Model) renderTasks() string {
+	t := i18n.T()
+	now := time.Now()
+	today := startOfDay(now)
+	height := m.listVisibleHeight()
+	width := m.width - 8
+
+	var rows []string
+	if len(m.tasks) == 0 {
+		rows = append(rows, MutedStyle.Render(t.TasksEmpty))
+	}
+	for i := m.taskOffset; i < len(m.tasks) && i < m.taskOffset+height; i++ {
+		task := m.tasks[i]
+		check := "☐"
+		if task.Done {
+			check = "☑"
+		}
+		when := ""
+		if !task.Due.IsZero() {
+			when = task.Due.Format("2006-01-02")
+		}
+		source := task.NoteTitle
+		if task.Folder != "" {
+			source = task.Folder + "/" + source
+		}
+		text := truncate(task.Text, max(width-len(source)-20, 10))
+		line := fmt.Sprintf("%s %-10s %s", check, when, text) + MutedStyle.Render(" · "+source)
+
+		switch {
+		case i == m.taskCursor:
+			rows = append(rows, SelectedStyle.Render("> ")+line)
+		case task.Done:
+			rows = append(rows, "  "+MutedStyle.Render(line))
+		case !task.Due.IsZero() && task.Due.Before(today):
+			rows = append(rows, "  "+ErrorStyle.Render(line))
+		default:
+			rows = append(rows, "  "+line)
+		}
+	}
+
+	body := PanelStyle.Width(m.width - 2).Height(m.contentHeight()).Render(strings.Join(rows, "\n"))
+	footer := MutedStyle.Render(fmt.Sprintf("%s  [↑/↓] %s  [Enter] %s  [x] %s  [s] %s  [u] %s  [f] %s  [#] %s  [Esc] %s",
+		m.taskFilterLabel(), t.HistoryScroll, t.GraphOpen, t.TaskToggle, t.TaskFilterStatus, t.TaskFilterDue,
+		t.TaskFilterFolder, t.TaskFilterTag, t.HistoryBack))
+
+	header := HeaderStyle.Width(m.width - 2).Render(TitleStyle.Render(fmt.Sprintf("%s (%d)", t.TasksTitle, len(m.tasks))))
+	return lipgloss.JoinVertical(lipgloss.Left, header, body, "\n"+footer)
+}
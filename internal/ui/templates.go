@@ -0,0 +1,177 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/JustZacca/jotaku/internal/db"
+	"github.com/JustZacca/jotaku/internal/i18n"
+)
+
+type templatesLoadedMsg []db.Template
+
+type templateNoteCreatedMsg struct {
+	note *db.Note
+}
+
+func (m Model) loadTemplates() tea.Cmd {
+	return func() tea.Msg {
+		templates, err := m.db.ListTemplates(m.ctx, m.config.TemplatesFolder)
+		if err != nil {
+			return errMsg(err)
+		}
+		return templatesLoadedMsg(templates)
+	}
+}
+
+// startNewNote opens the title prompt for a plain note, or for a note from
+// the chosen template.
+func (m Model) startNewNote() Model {
+	t := i18n.T()
+	m.mode = ModeNewNote
+	m.currentItemType = "note"
+	m.textinput.SetValue("")
+	m.textinput.Placeholder = t.TitlePlaceholder
+	if m.template != nil {
+		m.textinput.SetValue(db.ExpandTemplate(m.template.Title, m.templateVars()))
+		m.textinput.CursorEnd()
+	}
+	m.textinput.Focus()
+	return m
+}
+
+// startTemplatePrompt asks for the next {{prompt:...}} value, or moves on to
+// the title once all are answered.
+func (m Model) startTemplatePrompt() Model {
+	if m.promptIndex >= len(m.templatePrompts) {
+		return m.startNewNote()
+	}
+	m.mode = ModeTemplatePrompt
+	m.textinput.SetValue("")
+	m.textinput.Placeholder = m.templatePrompts[m.promptIndex] + "..."
+	m.textinput.Focus()
+	return m
+}
+
+func (m Model) templateVars() db.TemplateVars {
+	vars := db.TemplateVars{Now: time.Now(), Prompts: m.templateValues}
+	if m.currentFolder != 0 {
+		if f, err := m.db.GetFolder(m.ctx, m.currentFolder); err == nil {
+			vars.Folder = f.Title
+		}
+	}
+	return vars
+}
+
+func (m Model) resetTemplate() Model {
+	m.template = nil
+	m.templatePrompts = nil
+	m.templateValues = nil
+	m.promptIndex = 0
+	return m
+}
+
+func (m Model) createNoteFromTemplate(title string) tea.Cmd {
+	tmpl := m.template
+	vars := m.templateVars()
+	return func() tea.Msg {
+		note, err := m.db.CreateNoteFromTemplate(m.ctx, tmpl, title, m.currentFolder, vars)
+		if err != nil {
+			return errMsg(err)
+		}
+		return templateNoteCreatedMsg{note: note}
+	}
+}
+
+func (m Model) handleTemplateKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.Escape):
+		m.mode = ModeNormal
+		m = m.resetTemplate()
+
+	case key.Matches(msg, m.keys.Up):
+		if m.templateCursor > 0 {
+			m.templateCursor--
+		}
+
+	case key.Matches(msg, m.keys.Down):
+		// La prima riga è la nota vuota
+		if m.templateCursor < len(m.templates) {
+			m.templateCursor++
+		}
+
+	case key.Matches(msg, m.keys.Enter):
+		m = m.resetTemplate()
+		if m.templateCursor == 0 {
+			return m.startNewNote(), nil
+		}
+		tmpl := m.templates[m.templateCursor-1]
+		m.template = &tmpl
+		m.templatePrompts = tmpl.Prompts()
+		m.templateValues = make(map[string]string)
+		return m.startTemplatePrompt(), nil
+	}
+
+	return m, nil
+}
+
+func (m Model) handleTemplatePromptKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch {
+	case key.Matches(msg, m.keys.Escape):
+		m.mode = ModeNormal
+		m.textinput.Blur()
+		m.textinput.Placeholder = i18n.T().TitlePlaceholder
+		m = m.resetTemplate()
+
+	case key.Matches(msg, m.keys.Enter):
+		m.templateValues[m.templatePrompts[m.promptIndex]] = strings.TrimSpace(m.textinput.Value())
+		m.promptIndex++
+		return m.startTemplatePrompt(), nil
+
+	default:
+		m.textinput, cmd = m.textinput.Update(msg)
+	}
+
+	return m, cmd
+}
+
+// renderTemplatePicker lets the user choose between an empty note and the
+// available templates.
+func (m Model) renderTemplatePicker() string {
+	t := i18n.T()
+
+	names := []string{t.TemplateBlank}
+	for _, tmpl := range m.templates {
+		name := tmpl.Name
+		if tmpl.Folder != "" {
+			name += MutedStyle.Render(" → " + tmpl.Folder)
+		}
+		names = append(names, name)
+	}
+
+	var rows []string
+	for i, name := range names {
+		if i == m.templateCursor {
+			rows = append(rows, SelectedStyle.Render("> ")+name)
+		} else {
+			rows = append(rows, "  "+name)
+		}
+	}
+
+	content := lipgloss.JoinVertical(
+		lipgloss.Left,
+		TitleStyle.Render(t.NewNote),
+		"",
+		strings.Join(rows, "\n"),
+		"",
+		MutedStyle.Render(fmt.Sprintf("[↑/↓] %s  %s  %s", t.TemplateChoose, t.EnterConfirm, t.EscCancel)),
+	)
+
+	return DialogStyle.Width(50).Render(content)
+}
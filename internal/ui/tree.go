@@ -0,0 +1,337 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/JustZacca/jotaku/internal/db"
+)
+
+// treeNode is a folder or note in the tree view. Folder children are loaded
+// lazily the first time the folder is expanded.
+type treeNode struct {
+	ID         int64
+	Title      string
+	Type       string // "note" o "folder"
+	ParentID   int64
+	Depth      int
+	Count      int
+	Locked     bool
+	Pinned     bool
+	Archived   bool
+	ReadOnly   bool
+	SyncStatus db.SyncStatus
+	Loaded     bool
+	Children   []*treeNode
+}
+
+type treeLoadedMsg []*treeNode
+type treeChildrenLoadedMsg struct {
+	parentID int64
+	children []*treeNode
+}
+
+// loadTreeLevel reads the folders and notes directly inside folderID.
+func loadTreeLevel(ctx context.Context, database Store, folderID int64, depth int, archived bool) ([]*treeNode, error) {
+	folders, err := database.ListFolders(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var notes []db.NoteListItem
+	if archived {
+		notes, err = database.ListNotesWithArchived(ctx, folderID)
+	} else if folderID == 0 {
+		notes, err = database.ListNotes(ctx)
+	} else {
+		notes, err = database.ListNotesInFolder(ctx, folderID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := database.CountNotesInSubfolders(ctx, folderID, archived)
+	if err != nil {
+		return nil, err
+	}
+
+	folderItems := make([]db.NoteListItem, len(folders))
+	for i, f := range folders {
+		folderItems[i] = db.NoteListItem{ID: f.ID, Title: f.Title, Type: "folder", Locked: f.Password != ""}
+	}
+
+	items := arrangeItems(folderItems, notes)
+	nodes := make([]*treeNode, 0, len(items))
+	for _, item := range items {
+		if item.Type == "folder" {
+			nodes = append(nodes, &treeNode{
+				ID:       item.ID,
+				Title:    item.Title,
+				Type:     "folder",
+				ParentID: folderID,
+				Depth:    depth,
+				Count:    counts[item.ID],
+				Locked:   item.Locked,
+			})
+			continue
+		}
+		nodes = append(nodes, &treeNode{
+			ID:         item.ID,
+			Title:      item.Title,
+			Type:       "note",
+			ParentID:   folderID,
+			Depth:      depth,
+			Locked:     item.Locked,
+			Pinned:     item.Pinned,
+			Archived:   item.Archived,
+			ReadOnly:   item.ReadOnly,
+			SyncStatus: item.SyncStatus,
+		})
+	}
+	return nodes, nil
+}
+
+// loadTree rebuilds the tree from the root, reloading the children of every
+// folder that is currently expanded so the view survives a refresh.
+func (m Model) loadTree() tea.Cmd {
+	expanded := make(map[int64]bool, len(m.treeExpanded))
+	for id, open := range m.treeExpanded {
+		expanded[id] = open
+	}
+
+	return func() tea.Msg {
+		var load func(folderID int64, depth int) ([]*treeNode, error)
+		load = func(folderID int64, depth int) ([]*treeNode, error) {
+			nodes, err := loadTreeLevel(m.ctx, m.db, folderID, depth, m.showArchived)
+			if err != nil {
+				return nil, err
+			}
+			for _, n := range nodes {
+				if n.Type == "folder" && expanded[n.ID] {
+					n.Children, err = load(n.ID, depth+1)
+					if err != nil {
+						return nil, err
+					}
+					n.Loaded = true
+				}
+			}
+			return nodes, nil
+		}
+
+		roots, err := load(0, 0)
+		if err != nil {
+			return errMsg(err)
+		}
+		return treeLoadedMsg(roots)
+	}
+}
+
+func (m Model) loadTreeChildren(node *treeNode) tea.Cmd {
+	id, depth := node.ID, node.Depth+1
+	return func() tea.Msg {
+		children, err := loadTreeLevel(m.ctx, m.db, id, depth, m.showArchived)
+		if err != nil {
+			return errMsg(err)
+		}
+		return treeChildrenLoadedMsg{parentID: id, children: children}
+	}
+}
+
+// flattenTree returns the visible rows of the tree in display order.
+func flattenTree(nodes []*treeNode, expanded map[int64]bool) []*treeNode {
+	var rows []*treeNode
+	for _, n := range nodes {
+		rows = append(rows, n)
+		if n.Type == "folder" && expanded[n.ID] {
+			rows = append(rows, flattenTree(n.Children, expanded)...)
+		}
+	}
+	return rows
+}
+
+func findTreeNode(nodes []*treeNode, id int64) *treeNode {
+	for _, n := range nodes {
+		if n.Type != "folder" {
+			continue
+		}
+		if n.ID == id {
+			return n
+		}
+		if found := findTreeNode(n.Children, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func (m *Model) refreshTreeRows() {
+	m.treeRows = flattenTree(m.tree, m.treeExpanded)
+	if m.treeCursor >= len(m.treeRows) {
+		m.treeCursor = len(m.treeRows) - 1
+	}
+	if m.treeCursor < 0 {
+		m.treeCursor = 0
+	}
+	m.clampTreeOffset()
+}
+
+func (m *Model) clampTreeOffset() {
+	listHeight := m.listVisibleHeight()
+	if m.treeCursor < m.treeOffset {
+		m.treeOffset = m.treeCursor
+	}
+	if m.treeCursor >= m.treeOffset+listHeight {
+		m.treeOffset = m.treeCursor - listHeight + 1
+	}
+}
+
+func (m Model) selectedTreeNode() *treeNode {
+	if m.treeCursor >= 0 && m.treeCursor < len(m.treeRows) {
+		return m.treeRows[m.treeCursor]
+	}
+	return nil
+}
+
+// selectTreeNode loads the note or folder under the cursor and keeps
+// currentFolder pointing at the folder new items should be created in.
+func (m *Model) selectTreeNode() tea.Cmd {
+	node := m.selectedTreeNode()
+	if node == nil {
+		return nil
+	}
+	if node.Type == "folder" {
+		m.currentFolder = node.ID
+		return m.loadFolder(node.ID)
+	}
+	m.currentFolder = node.ParentID
+	return m.loadNote(node.ID)
+}
+
+func (m Model) handleTreeKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		if m.treeCursor > 0 {
+			m.treeCursor--
+			m.clampTreeOffset()
+			cmd := m.selectTreeNode()
+			return m, cmd, true
+		}
+		return m, nil, true
+
+	case key.Matches(msg, m.keys.Down):
+		if m.treeCursor < len(m.treeRows)-1 {
+			m.treeCursor++
+			m.clampTreeOffset()
+			cmd := m.selectTreeNode()
+			return m, cmd, true
+		}
+		return m, nil, true
+
+	case key.Matches(msg, m.keys.Expand), key.Matches(msg, m.keys.Enter):
+		node := m.selectedTreeNode()
+		if node == nil {
+			return m, nil, true
+		}
+		if node.Type != "folder" {
+			cmd := m.selectTreeNode()
+			return m, cmd, true
+		}
+		if m.treeExpanded[node.ID] {
+			if key.Matches(msg, m.keys.Enter) {
+				m.treeExpanded[node.ID] = false
+				m.refreshTreeRows()
+			} else if len(node.Children) > 0 {
+				// Already open: step into the first child
+				m.treeCursor++
+				m.clampTreeOffset()
+				cmd := m.selectTreeNode()
+				return m, cmd, true
+			}
+			return m, nil, true
+		}
+		m.treeExpanded[node.ID] = true
+		if !node.Loaded {
+			return m, m.loadTreeChildren(node), true
+		}
+		m.refreshTreeRows()
+		return m, nil, true
+
+	case key.Matches(msg, m.keys.Collapse), key.Matches(msg, m.keys.ParentFolder):
+		node := m.selectedTreeNode()
+		if node == nil {
+			return m, nil, true
+		}
+		if node.Type == "folder" && m.treeExpanded[node.ID] {
+			m.treeExpanded[node.ID] = false
+			m.refreshTreeRows()
+			return m, nil, true
+		}
+		// Jump to the parent folder row
+		for i := m.treeCursor - 1; i >= 0; i-- {
+			if m.treeRows[i].Type == "folder" && m.treeRows[i].ID == node.ParentID {
+				m.treeCursor = i
+				m.clampTreeOffset()
+				cmd := m.selectTreeNode()
+				return m, cmd, true
+			}
+		}
+		return m, nil, true
+	}
+
+	return m, nil, false
+}
+
+func (m Model) renderTree(lineWidth, listHeight int) []string {
+	var items []string
+	for i := m.treeOffset; i < len(m.treeRows) && i < m.treeOffset+listHeight; i++ {
+		node := m.treeRows[i]
+
+		indent := strings.Repeat("  ", node.Depth)
+		arrow := " "
+		icon := NoteIcon
+		suffix := ""
+		if node.Type == "folder" {
+			icon = FolderIcon
+			arrow = "▸"
+			if m.treeExpanded[node.ID] {
+				arrow = "▾"
+			}
+			suffix = fmt.Sprintf(" (%d)", node.Count)
+		} else {
+			suffix = " " + syncIcon(node.SyncStatus)
+		}
+		if node.Locked {
+			suffix += " " + LockIcon
+		}
+		suffix += noteBadges(node.Pinned, node.Archived, node.ReadOnly)
+
+		prefix := fmt.Sprintf(" %s%s %s ", indent, arrow, icon)
+		available := lineWidth - len([]rune(prefix)) - len([]rune(suffix)) - 2
+		if available < 4 {
+			available = 4
+		}
+		titleText := truncate(node.Title, available)
+		lineContent := prefix + titleText + suffix
+
+		if i == m.treeCursor {
+			items = append(items, SelectedListItemStyle.Width(lineWidth).Render(lineContent))
+		} else {
+			items = append(items, ListItemStyle.Width(lineWidth).Render(lineContent))
+		}
+	}
+	return items
+}
+
+func syncIcon(status db.SyncStatus) string {
+	switch status {
+	case db.SyncStatusSynced:
+		return SyncedIcon
+	case db.SyncStatusPending:
+		return PendingIcon
+	default:
+		return LocalIcon
+	}
+}